@@ -0,0 +1,81 @@
+package payment
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MetadataAccount is the PaymentRequest.Metadata key selecting a named
+// account registered with RegisterGatewayAccount
+const MetadataAccount = "account"
+
+// RegisterGatewayAccount creates a gateway for a named account of method
+// (e.g. one Stripe account per brand) using the method's factory. The first
+// account registered for a method also becomes its default if no gateway is
+// registered for it yet.
+func (pm *PaymentManager) RegisterGatewayAccount(method, account string, config *GatewayConfig) error {
+	if account == "" {
+		return fmt.Errorf("gateway %s: account name is required", method)
+	}
+
+	method = NormalizeMethod(method)
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	gateway, err := pm.buildGateway(method, config)
+	if err != nil {
+		return err
+	}
+	if pm.accounts[method] == nil {
+		pm.accounts[method] = make(map[string]Gateway)
+	}
+	pm.accounts[method][account] = gateway
+	if _, ok := pm.gateways[method]; !ok {
+		pm.gateways[method] = gateway
+	}
+	return nil
+}
+
+// GetGatewayAccount returns the gateway for a named account of method. An
+// empty account returns the default gateway, as GetGateway does.
+func (pm *PaymentManager) GetGatewayAccount(method, account string) (Gateway, error) {
+	if account == "" {
+		return pm.GetGateway(method)
+	}
+
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	g, ok := pm.accounts[pm.resolveMethod(method)][account]
+	if !ok {
+		return nil, fmt.Errorf("gateway %s account %s %w", method, account, ErrGatewayNotRegistered)
+	}
+	return g, nil
+}
+
+// ListAccounts returns the account names registered for method, sorted
+func (pm *PaymentManager) ListAccounts(method string) []string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	accounts := []string{}
+	for name := range pm.accounts[pm.resolveMethod(method)] {
+		accounts = append(accounts, name)
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// transactionAccount returns the account recorded for the first stored
+// transaction matching one of ids, or "" if unknown
+func (pm *PaymentManager) transactionAccount(ids ...string) string {
+	pm.mu.RLock()
+	store := pm.transactions
+	pm.mu.RUnlock()
+	if store == nil {
+		return ""
+	}
+	if txn, ok := findTransaction(store, ids...); ok {
+		return txn.Metadata[MetadataAccount]
+	}
+	return ""
+}
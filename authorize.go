@@ -0,0 +1,198 @@
+package payment
+
+import (
+	"context"
+	"time"
+
+	"github.com/oarkflow/money"
+)
+
+// AuthorizationResponse is the result of placing a hold on funds
+type AuthorizationResponse struct {
+	Success       bool        `json:"success"`
+	TransactionID string      `json:"transaction_id"`
+	OrderID       string      `json:"order_id"`
+	Amount        money.Money `json:"amount"`
+	// ExpiresAt is when the hold lapses if not captured
+	ExpiresAt time.Time `json:"expires_at"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// CaptureRequest captures a held authorization. A zero Amount captures the
+// full hold.
+type CaptureRequest struct {
+	TransactionID string      `json:"transaction_id"`
+	Amount        money.Money `json:"amount,omitempty"`
+}
+
+// CaptureResponse is the result of a capture
+type CaptureResponse struct {
+	Success       bool        `json:"success"`
+	TransactionID string      `json:"transaction_id"`
+	Amount        money.Money `json:"amount"`
+	Message       string      `json:"message,omitempty"`
+}
+
+// Authorizer is implemented by gateways supporting two-phase payments
+type Authorizer interface {
+	AuthorizePayment(ctx context.Context, req *PaymentRequest) (*AuthorizationResponse, error)
+	CapturePayment(ctx context.Context, req *CaptureRequest) (*CaptureResponse, error)
+	VoidAuthorization(ctx context.Context, txnID string) error
+}
+
+// authorizer returns method's gateway as an Authorizer
+func (pm *PaymentManager) authorizer(method, account string) (Authorizer, string, error) {
+	g, err := pm.GetGatewayAccount(method, account)
+	if err != nil {
+		return nil, "", err
+	}
+	a, ok := UnwrapGateway(g).(Authorizer)
+	if !ok {
+		return nil, "", NewPaymentError(ErrKindUnsupported, g.GetMethod(), "authorization is not supported", nil)
+	}
+	return a, g.GetMethod(), nil
+}
+
+// AuthorizePayment places a hold for req. The hold's expiry is recorded in
+// the TransactionStore so the reaper can report holds nearing expiry.
+func (pm *PaymentManager) AuthorizePayment(ctx context.Context, method string, req *PaymentRequest) (*AuthorizationResponse, error) {
+	if req == nil {
+		return nil, NewPaymentError(ErrKindValidation, method, "", ErrNilRequest)
+	}
+	a, resolved, err := pm.authorizer(method, req.Metadata[MetadataAccount])
+	if err != nil {
+		return nil, err
+	}
+	release, err := pm.acquire(ctx, resolved)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	resp, err := a.AuthorizePayment(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	pm.mu.RLock()
+	store := pm.transactions
+	pm.mu.RUnlock()
+	if store != nil && resp.Success {
+		now := time.Now()
+		_ = store.Save(&Transaction{
+			ID:            resp.TransactionID,
+			OrderID:       req.OrderID,
+			Method:        resolved,
+			Amount:        req.Amount,
+			Status:        StatusAuthorized,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+			Metadata:      req.Metadata,
+			HoldExpiresAt: resp.ExpiresAt,
+		})
+		pm.recordLedger(LedgerEntry{
+			Time:          now,
+			Type:          LedgerAuthorized,
+			Method:        resolved,
+			TransactionID: resp.TransactionID,
+			OrderID:       req.OrderID,
+			Amount:        req.Amount,
+			Status:        StatusAuthorized,
+		})
+	}
+	return resp, nil
+}
+
+// CapturePayment captures a held authorization
+func (pm *PaymentManager) CapturePayment(ctx context.Context, method string, req *CaptureRequest) (*CaptureResponse, error) {
+	if req == nil {
+		return nil, NewPaymentError(ErrKindValidation, method, "", ErrNilRequest)
+	}
+	a, resolved, err := pm.authorizer(method, pm.transactionAccount(req.TransactionID))
+	if err != nil {
+		return nil, err
+	}
+	release, err := pm.acquire(ctx, resolved)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	resp, err := a.CapturePayment(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Success {
+		entry := LedgerEntry{
+			Type:          LedgerCaptured,
+			Method:        resolved,
+			TransactionID: req.TransactionID,
+			Amount:        resp.Amount,
+			Status:        StatusCompleted,
+		}
+		pm.updateTransaction(req.TransactionID, func(txn *Transaction) {
+			txn.Status = StatusCompleted
+			if resp.Amount.Currency().Code != "" {
+				txn.Amount = resp.Amount
+			}
+			entry.OrderID = txn.OrderID
+			entry.Amount = txn.Amount
+		})
+		pm.recordLedger(entry)
+	}
+	return resp, nil
+}
+
+// VoidAuthorization releases a held authorization
+func (pm *PaymentManager) VoidAuthorization(ctx context.Context, method, txnID string) error {
+	a, resolved, err := pm.authorizer(method, pm.transactionAccount(txnID))
+	if err != nil {
+		return err
+	}
+	release, err := pm.acquire(ctx, resolved)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if err := a.VoidAuthorization(ctx, txnID); err != nil {
+		return err
+	}
+	pm.updateTransaction(txnID, func(txn *Transaction) {
+		txn.Status = StatusCanceled
+	})
+	return nil
+}
+
+// ExpiringHolds returns authorized transactions whose hold lapses within d
+func (pm *PaymentManager) ExpiringHolds(d time.Duration) ([]*Transaction, error) {
+	store := pm.GetTransactionStore()
+	if store == nil {
+		return nil, nil
+	}
+	pending, err := store.ListPending(0)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(d)
+	expiring := []*Transaction{}
+	for _, txn := range pending {
+		if txn.Status == StatusAuthorized && !txn.HoldExpiresAt.IsZero() && txn.HoldExpiresAt.Before(deadline) {
+			expiring = append(expiring, txn)
+		}
+	}
+	return expiring, nil
+}
+
+// updateTransaction applies fn to a stored transaction, if present
+func (pm *PaymentManager) updateTransaction(id string, fn func(txn *Transaction)) {
+	store := pm.GetTransactionStore()
+	if store == nil {
+		return
+	}
+	txn, err := store.Get(id)
+	if err != nil {
+		return
+	}
+	fn(txn)
+	txn.UpdatedAt = time.Now()
+	_ = store.Save(txn)
+}
@@ -0,0 +1,43 @@
+package payment
+
+import (
+	"context"
+	"time"
+
+	"github.com/oarkflow/money"
+)
+
+// Balance is the merchant balance held by a provider in one currency
+type Balance struct {
+	Currency string `json:"currency"`
+	// Available can be paid out; Pending is still settling
+	Available money.Money `json:"available"`
+	Pending   money.Money `json:"pending"`
+}
+
+// BalanceChecker is implemented by gateways that report the merchant
+// balance, one entry per currency
+type BalanceChecker interface {
+	GetBalance(ctx context.Context) ([]Balance, error)
+}
+
+// GetBalance returns the merchant balance held by method's provider, for
+// reconciliation. Gateways that don't implement BalanceChecker return an
+// ErrKindUnsupported error.
+func (pm *PaymentManager) GetBalance(ctx context.Context, method string) ([]Balance, error) {
+	g, err := pm.GetGateway(method)
+	if err != nil {
+		return nil, err
+	}
+	checker, ok := UnwrapGateway(g).(BalanceChecker)
+	if !ok {
+		return nil, NewPaymentError(ErrKindUnsupported, g.GetMethod(), "balance not supported", nil)
+	}
+	release, err := pm.acquire(ctx, g.GetMethod())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	defer pm.trackLatency(g.GetMethod(), time.Now())
+	return checker.GetBalance(ctx)
+}
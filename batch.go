@@ -0,0 +1,191 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrBatchAborted is recorded for batch items skipped after an earlier failure
+var ErrBatchAborted = errors.New("batch aborted after earlier failure")
+
+// BatchItem is a single payment to initiate as part of a batch
+type BatchItem struct {
+	Method  string
+	Request *PaymentRequest
+}
+
+// BatchOptions controls batch execution
+type BatchOptions struct {
+	// StopOnFirstError aborts the remaining items after the first failure.
+	// Skipped items are reported with ErrBatchAborted.
+	StopOnFirstError bool
+}
+
+// BatchResult is the outcome of a single batch item
+type BatchResult struct {
+	Method   string           `json:"method"`
+	OrderID  string           `json:"order_id,omitempty"`
+	Response *PaymentResponse `json:"response,omitempty"`
+	Err      error            `json:"-"`
+}
+
+// Succeeded reports whether the item was initiated successfully
+func (r BatchResult) Succeeded() bool {
+	return r.Err == nil && r.Response != nil && r.Response.Success
+}
+
+// BatchResults holds the outcome of every item in a batch, in input order
+type BatchResults []BatchResult
+
+// Successes returns the results that succeeded
+func (rs BatchResults) Successes() BatchResults {
+	out := BatchResults{}
+	for _, r := range rs {
+		if r.Succeeded() {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Failures returns the results that failed or were skipped
+func (rs BatchResults) Failures() BatchResults {
+	out := BatchResults{}
+	for _, r := range rs {
+		if !r.Succeeded() {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// AllSucceeded reports whether every item succeeded
+func (rs BatchResults) AllSucceeded() bool {
+	for _, r := range rs {
+		if !r.Succeeded() {
+			return false
+		}
+	}
+	return true
+}
+
+// FailedMethods returns the methods of failed items, without duplicates
+func (rs BatchResults) FailedMethods() []string {
+	seen := make(map[string]bool)
+	methods := []string{}
+	for _, r := range rs {
+		if !r.Succeeded() && !seen[r.Method] {
+			seen[r.Method] = true
+			methods = append(methods, r.Method)
+		}
+	}
+	return methods
+}
+
+// checkBatchRequest rejects a batch item's nil request before dispatch, with
+// the same validation error InitiatePayment returns for it
+func checkBatchRequest(method string, req *PaymentRequest) error {
+	if req == nil {
+		return NewPaymentError(ErrKindValidation, method, "", ErrNilRequest)
+	}
+	return nil
+}
+
+// InitiatePaymentBatch initiates each item in order and reports per-item
+// results. An item without a request fails with ErrNilRequest.
+func (pm *PaymentManager) InitiatePaymentBatch(ctx context.Context, items []BatchItem, opts BatchOptions) BatchResults {
+	results := make(BatchResults, len(items))
+	aborted := false
+
+	for i, item := range items {
+		result := BatchResult{Method: item.Method}
+		if item.Request != nil {
+			result.OrderID = item.Request.OrderID
+		}
+
+		if aborted {
+			result.Err = ErrBatchAborted
+			results[i] = result
+			continue
+		}
+
+		if result.Err = checkBatchRequest(item.Method, item.Request); result.Err == nil {
+			result.Response, result.Err = pm.InitiatePayment(ctx, item.Method, item.Request)
+		}
+		results[i] = result
+
+		if !result.Succeeded() && opts.StopOnFirstError {
+			aborted = true
+		}
+	}
+
+	return results
+}
+
+// InitiateAllForCountry initiates req with every configured gateway available
+// for the country, in priority order
+func (pm *PaymentManager) InitiateAllForCountry(ctx context.Context, country Country, req *PaymentRequest, opts BatchOptions) BatchResults {
+	methods := pm.GetAvailableGatewaysForCountry(country)
+	items := make([]BatchItem, 0, len(methods))
+	for _, method := range methods {
+		items = append(items, BatchItem{Method: method, Request: req})
+	}
+	return pm.InitiatePaymentBatch(ctx, items, opts)
+}
+
+// CountryPaymentItem is a payment to route by country
+type CountryPaymentItem struct {
+	Country Country
+	Request *PaymentRequest
+}
+
+// CountryPaymentResult is the outcome of a CountryPaymentItem
+type CountryPaymentResult struct {
+	Country  Country          `json:"country"`
+	Method   string           `json:"method,omitempty"`
+	OrderID  string           `json:"order_id,omitempty"`
+	Response *PaymentResponse `json:"response,omitempty"`
+	Err      error            `json:"-"`
+}
+
+// InitiatePaymentsForCountries routes each item via GetRecommendedGateway for
+// its country and initiates them concurrently, with at most concurrency in
+// flight. Results are returned in input order. An item without a request
+// fails with ErrNilRequest and is not dispatched.
+func (pm *PaymentManager) InitiatePaymentsForCountries(ctx context.Context, items []CountryPaymentItem, concurrency int) []CountryPaymentResult {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	results := make([]CountryPaymentResult, len(items))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, item := range items {
+		results[i] = CountryPaymentResult{Country: item.Country}
+		if err := checkBatchRequest("", item.Request); err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].OrderID = item.Request.OrderID
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, item CountryPaymentItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			method, err := pm.GetRecommendedGateway(item.Country)
+			if err != nil {
+				results[i].Err = err
+				return
+			}
+			results[i].Method = method
+			results[i].Response, results[i].Err = pm.InitiatePayment(ctx, method, item.Request)
+		}(i, item)
+	}
+
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,105 @@
+package payment
+
+// PaymentFlow is how the customer completes a payment
+type PaymentFlow string
+
+const (
+	// FlowRedirect sends the customer to the provider's hosted page
+	FlowRedirect PaymentFlow = "redirect"
+	// FlowInApp completes the payment in a provider widget on our page
+	FlowInApp PaymentFlow = "in_app"
+	// FlowPush prompts the customer to approve the payment on their phone,
+	// e.g. M-Pesa STK Push; there is no page to send them to
+	FlowPush PaymentFlow = "push"
+)
+
+// GatewayCapabilities describes what a gateway can do and what it needs from
+// the customer, for building checkout forms
+type GatewayCapabilities struct {
+	Flow PaymentFlow `json:"flow"`
+	// RequiresPhone and RequiresEmail mean PaymentRequest.CustomerPhone or
+	// CustomerEmail should be collected
+	RequiresPhone bool `json:"requires_phone,omitempty"`
+	RequiresEmail bool `json:"requires_email,omitempty"`
+	Refund        bool `json:"refund"`
+	// PartialRefund means RefundPayment accepts less than the captured amount
+	PartialRefund bool `json:"partial_refund"`
+	// StatusCheck means GetStatus queries the provider for the current status
+	StatusCheck bool `json:"status_check"`
+	// Webhook means the gateway implements WebhookHandler
+	Webhook bool `json:"webhook"`
+	// Recurring means the gateway can charge saved payment methods
+	Recurring bool `json:"recurring"`
+	// Subscriptions means the gateway implements SubscriptionGateway
+	Subscriptions bool `json:"subscriptions"`
+}
+
+// CapabilityReporter is implemented by gateways that describe their
+// capabilities
+type CapabilityReporter interface {
+	Capabilities() GatewayCapabilities
+}
+
+// Capabilities returns g's capabilities. Gateways that don't report them are
+// assumed to redirect and to support nothing optional. Webhook and
+// Subscriptions are always derived from whether g implements WebhookHandler
+// and SubscriptionGateway.
+func Capabilities(g Gateway) GatewayCapabilities {
+	inner := UnwrapGateway(g)
+	caps := GatewayCapabilities{Flow: FlowRedirect}
+	if c, ok := inner.(CapabilityReporter); ok {
+		caps = c.Capabilities()
+	}
+	_, caps.Webhook = inner.(WebhookHandler)
+	_, caps.Subscriptions = inner.(SubscriptionGateway)
+	return caps
+}
+
+// GetCapabilities returns the capabilities of the gateway registered for
+// method, e.g. to decide whether to offer refunds
+func (pm *PaymentManager) GetCapabilities(method string) (GatewayCapabilities, error) {
+	g, err := pm.GetGateway(method)
+	if err != nil {
+		return GatewayCapabilities{}, err
+	}
+	return Capabilities(g), nil
+}
+
+// Operations reported by GatewayOperations
+const (
+	OperationInitiate = "initiate"
+	OperationVerify   = "verify"
+	OperationRefund   = "refund"
+	OperationStatus   = "status"
+	OperationWebhook  = "webhook"
+)
+
+// Operations lists the operations c supports, in the order of the Operation
+// constants. Every gateway can initiate and verify payments.
+func (c GatewayCapabilities) Operations() []string {
+	ops := []string{OperationInitiate, OperationVerify}
+	if c.Refund {
+		ops = append(ops, OperationRefund)
+	}
+	if c.StatusCheck {
+		ops = append(ops, OperationStatus)
+	}
+	if c.Webhook {
+		ops = append(ops, OperationWebhook)
+	}
+	return ops
+}
+
+// GatewayOperations returns the operations each configured gateway supports,
+// keyed by method, as derived from Capabilities. Calling an operation that
+// isn't listed fails.
+func (pm *PaymentManager) GatewayOperations() map[string][]string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	ops := make(map[string][]string, len(pm.gateways))
+	for method, g := range pm.gateways {
+		ops[method] = Capabilities(g).Operations()
+	}
+	return ops
+}
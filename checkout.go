@@ -0,0 +1,73 @@
+package payment
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CheckoutMethod is one payment method offered to a checkout frontend
+type CheckoutMethod struct {
+	// Method is the identifier passed back to InitiatePayment. Frontends
+	// also use it to pick the method's icon.
+	Method string   `json:"method"`
+	Name   string   `json:"name"`
+	Tags   []string `json:"tags,omitempty"`
+	// Currencies are the currencies the method is registered for. Empty
+	// means it is not restricted by currency.
+	Currencies  []string `json:"currencies,omitempty"`
+	Priority    int      `json:"priority"`
+	Recommended bool     `json:"recommended"`
+}
+
+// CheckoutOptions is everything a checkout frontend needs to render the
+// payment method picker
+type CheckoutOptions struct {
+	Country  Country `json:"country"`
+	Currency string  `json:"currency,omitempty"`
+	// Symbol is the display symbol of Currency, see CurrencySymbol
+	Symbol  string           `json:"symbol,omitempty"`
+	Methods []CheckoutMethod `json:"methods"`
+}
+
+// CheckoutOptions returns the configured methods available in country that
+// accept currency, highest priority first. The first method is marked
+// recommended. An empty currency doesn't filter by currency.
+func (pm *PaymentManager) CheckoutOptions(country Country, currency string) (*CheckoutOptions, error) {
+	currency = strings.ToUpper(currency)
+	registry := pm.GetRegistry()
+	opts := &CheckoutOptions{Country: country, Currency: currency, Methods: []CheckoutMethod{}}
+	if currency != "" {
+		opts.Symbol = CurrencySymbol(currency)
+	}
+
+	for _, rec := range pm.GetGatewayRecommendations(country) {
+		if !rec.Available {
+			continue
+		}
+		var currencies, tags []string
+		if registry != nil {
+			currencies = registry.GetGatewayCurrencies(rec.Method)
+			tags = registry.GetGatewayTags(rec.Method)
+		}
+		if currency != "" && len(currencies) > 0 && !slices.Contains(currencies, currency) {
+			continue
+		}
+		opts.Methods = append(opts.Methods, CheckoutMethod{
+			Method:      rec.Method,
+			Name:        rec.Name,
+			Tags:        tags,
+			Currencies:  currencies,
+			Priority:    rec.Priority,
+			Recommended: len(opts.Methods) == 0,
+		})
+	}
+
+	if len(opts.Methods) == 0 {
+		if currency != "" {
+			return nil, fmt.Errorf("no gateways available for country %s and currency %s", country, currency)
+		}
+		return nil, fmt.Errorf("no gateways available for country %s", country)
+	}
+	return opts, nil
+}
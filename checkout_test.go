@@ -0,0 +1,57 @@
+package payment
+
+import "testing"
+
+func TestCheckoutOptions(t *testing.T) {
+	pm := NewPaymentManager(0)
+	registry := pm.GetRegistry()
+	registry.RegisterCountryGateway(CountryNepal, "esewa", 1)
+	registry.RegisterCountryGateway(CountryNepal, "khalti", 2)
+	registry.RegisterGlobalGateway("stripe", 10)
+	registry.RegisterGlobalGateway("paypal", 20)
+	registry.RegisterCurrencyGateway("NPR", "esewa", 1)
+	registry.RegisterCurrencyGateway("USD", "stripe", 10)
+	registry.TagGateway("esewa", "wallet")
+	pm.RegisterGateway("esewa", &fakeGateway{method: "esewa"})
+	pm.RegisterGateway("stripe", &fakeGateway{method: "stripe"})
+	pm.RegisterGateway("paypal", &fakeGateway{method: "paypal"})
+
+	opts, err := pm.CheckoutOptions(CountryNepal, "npr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// khalti isn't configured and stripe is USD only
+	got := []string{}
+	for _, m := range opts.Methods {
+		got = append(got, m.Method)
+	}
+	if len(got) != 2 || got[0] != "esewa" || got[1] != "paypal" {
+		t.Fatalf("Expected [esewa paypal], got %v", got)
+	}
+	esewa := opts.Methods[0]
+	if !esewa.Recommended || opts.Methods[1].Recommended {
+		t.Error("Only the first method should be recommended")
+	}
+	if esewa.Name != "Fake" || len(esewa.Tags) != 1 || esewa.Tags[0] != "wallet" {
+		t.Errorf("Unexpected esewa entry %+v", esewa)
+	}
+	if len(esewa.Currencies) != 1 || esewa.Currencies[0] != "NPR" {
+		t.Errorf("Expected NPR, got %v", esewa.Currencies)
+	}
+	if opts.Currency != "NPR" {
+		t.Errorf("Expected normalized currency NPR, got %s", opts.Currency)
+	}
+
+	opts, err = pm.CheckoutOptions(CountryNepal, "")
+	if err != nil || len(opts.Methods) != 3 {
+		t.Errorf("Expected all 3 configured methods without a currency, got %+v, %v", opts, err)
+	}
+
+	if _, err := pm.CheckoutOptions(CountryNepal, "JPY"); err != nil {
+		t.Errorf("Unrestricted paypal should accept JPY, got %v", err)
+	}
+	pm2 := NewPaymentManager(0)
+	if _, err := pm2.CheckoutOptions(CountryNepal, "NPR"); err == nil {
+		t.Error("Expected error with no configured gateways")
+	}
+}
@@ -0,0 +1,30 @@
+package payment
+
+import "time"
+
+// Clock supplies the current time to gateways, for timestamps, generated
+// ids and token expiry. Tests set GatewayConfig.Clock to a fixed clock to
+// make outgoing requests deterministic.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to Clock
+type ClockFunc func() time.Time
+
+// Now returns f()
+func (f ClockFunc) Now() time.Time { return f() }
+
+// FixedClock returns a Clock that always reports t
+func FixedClock(t time.Time) Clock {
+	return ClockFunc(func() time.Time { return t })
+}
+
+// Now returns the time from c.Clock, or time.Now() when no clock is
+// configured
+func (c *GatewayConfig) Now() time.Time {
+	if c == nil || c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock.Now()
+}
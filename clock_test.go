@@ -0,0 +1,21 @@
+package payment
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGatewayConfigNow(t *testing.T) {
+	fixed := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	config := &GatewayConfig{Clock: FixedClock(fixed)}
+	if got := config.Now(); !got.Equal(fixed) {
+		t.Errorf("Expected the configured clock's time %s, got %s", fixed, got)
+	}
+
+	before := time.Now()
+	for _, config := range []*GatewayConfig{nil, {}} {
+		if got := config.Now(); got.Before(before) {
+			t.Errorf("Expected the current time without a clock, got %s", got)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrTooManyRequests is returned when a concurrency limit is reached and
+// ConcurrencyOptions.Queue is not set
+var ErrTooManyRequests = errors.New("too many concurrent requests")
+
+// ConcurrencyOptions bounds the number of in-flight gateway calls made
+// through the manager. Zero limits are unlimited.
+type ConcurrencyOptions struct {
+	// Global is the maximum number of calls in flight across all gateways
+	Global int
+	// PerGateway is the default maximum per gateway
+	PerGateway int
+	// Gateways overrides PerGateway for individual methods
+	Gateways map[string]int
+	// Queue makes calls wait for a free slot until their context is done,
+	// instead of failing with ErrTooManyRequests
+	Queue bool
+}
+
+// concurrencyLimiter is a set of semaphores, one global and one per gateway
+type concurrencyLimiter struct {
+	opts     ConcurrencyOptions
+	global   chan struct{}
+	gateways map[string]chan struct{}
+	mu       sync.Mutex
+}
+
+func newConcurrencyLimiter(opts ConcurrencyOptions) *concurrencyLimiter {
+	if opts.Gateways != nil {
+		limits := make(map[string]int, len(opts.Gateways))
+		for method, n := range opts.Gateways {
+			limits[NormalizeMethod(method)] = n
+		}
+		opts.Gateways = limits
+	}
+	l := &concurrencyLimiter{opts: opts, gateways: make(map[string]chan struct{})}
+	if opts.Global > 0 {
+		l.global = make(chan struct{}, opts.Global)
+	}
+	return l
+}
+
+// semaphore returns method's semaphore, or nil if it is unlimited
+func (l *concurrencyLimiter) semaphore(method string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if sem, ok := l.gateways[method]; ok {
+		return sem
+	}
+	limit := l.opts.PerGateway
+	if n, ok := l.opts.Gateways[method]; ok {
+		limit = n
+	}
+	var sem chan struct{}
+	if limit > 0 {
+		sem = make(chan struct{}, limit)
+	}
+	l.gateways[method] = sem
+	return sem
+}
+
+// take claims a slot in sem, waiting if queueing is enabled
+func (l *concurrencyLimiter) take(ctx context.Context, sem chan struct{}, method string) error {
+	if sem == nil {
+		return nil
+	}
+	if !l.opts.Queue {
+		select {
+		case sem <- struct{}{}:
+			return nil
+		default:
+			return fmt.Errorf("%w: %s", ErrTooManyRequests, method)
+		}
+	}
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquire claims a global and a per-gateway slot. The returned func releases
+// them.
+func (l *concurrencyLimiter) acquire(ctx context.Context, method string) (func(), error) {
+	if err := l.take(ctx, l.global, method); err != nil {
+		return nil, err
+	}
+	sem := l.semaphore(method)
+	if err := l.take(ctx, sem, method); err != nil {
+		if l.global != nil {
+			<-l.global
+		}
+		return nil, err
+	}
+	return func() {
+		if sem != nil {
+			<-sem
+		}
+		if l.global != nil {
+			<-l.global
+		}
+	}, nil
+}
+
+// SetConcurrencyLimits bounds concurrent outbound gateway calls. Calls
+// already in flight are not counted against the new limits.
+func (pm *PaymentManager) SetConcurrencyLimits(opts ConcurrencyOptions) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.limiter = newConcurrencyLimiter(opts)
+}
+
+// acquire claims a slot for a call to method. The returned func must be
+// called when the call completes.
+func (pm *PaymentManager) acquire(ctx context.Context, method string) (func(), error) {
+	pm.mu.RLock()
+	limiter := pm.limiter
+	pm.mu.RUnlock()
+	if limiter == nil {
+		return func() {}, nil
+	}
+	return limiter.acquire(ctx, method)
+}
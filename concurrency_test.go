@@ -0,0 +1,94 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingGateway holds GetStatus calls until release is closed
+type blockingGateway struct {
+	fakeGateway
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingGateway) GetStatus(ctx context.Context, req *StatusRequest) (*StatusResponse, error) {
+	b.started <- struct{}{}
+	<-b.release
+	return b.fakeGateway.GetStatus(ctx, req)
+}
+
+func TestConcurrencyLimits(t *testing.T) {
+	pm := NewPaymentManager(0)
+	slow := &blockingGateway{fakeGateway: fakeGateway{method: "slow"}, started: make(chan struct{}, 2), release: make(chan struct{})}
+	pm.RegisterGateway("slow", slow)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+	pm.SetConcurrencyLimits(ConcurrencyOptions{Global: 3, Gateways: map[string]int{"slow": 2}})
+	ctx := context.Background()
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := pm.GetStatus(ctx, "slow", &StatusRequest{TransactionID: "t1"})
+			done <- err
+		}()
+	}
+	<-slow.started
+	<-slow.started
+
+	if _, err := pm.GetStatus(ctx, "slow", &StatusRequest{TransactionID: "t1"}); !errors.Is(err, ErrTooManyRequests) {
+		t.Errorf("Expected ErrTooManyRequests, got %v", err)
+	}
+	if got := HTTPStatusForError(ErrTooManyRequests); got != 429 {
+		t.Errorf("Expected 429, got %d", got)
+	}
+	// Other gateways still have global capacity
+	if _, err := pm.GetStatus(ctx, "fake", &StatusRequest{TransactionID: "t1"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	close(slow.release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if _, err := pm.GetStatus(ctx, "slow", &StatusRequest{TransactionID: "t1"}); err != nil {
+		t.Errorf("Expected slots to be released, got %v", err)
+	}
+}
+
+func TestConcurrencyQueue(t *testing.T) {
+	pm := NewPaymentManager(0)
+	slow := &blockingGateway{fakeGateway: fakeGateway{method: "slow"}, started: make(chan struct{}, 2), release: make(chan struct{})}
+	pm.RegisterGateway("slow", slow)
+	pm.SetConcurrencyLimits(ConcurrencyOptions{PerGateway: 1, Queue: true})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := pm.GetStatus(context.Background(), "slow", &StatusRequest{TransactionID: "t1"})
+		done <- err
+	}()
+	<-slow.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pm.GetStatus(ctx, "slow", &StatusRequest{TransactionID: "t2"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected queued call to time out, got %v", err)
+	}
+
+	queued := make(chan error, 1)
+	go func() {
+		_, err := pm.GetStatus(context.Background(), "slow", &StatusRequest{TransactionID: "t3"})
+		queued <- err
+	}()
+	close(slow.release)
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := <-queued; err != nil {
+		t.Errorf("Expected queued call to proceed, got %v", err)
+	}
+}
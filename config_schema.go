@@ -0,0 +1,185 @@
+package payment
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConfigValueType is the expected type of an ExtraConfig value
+type ConfigValueType string
+
+const (
+	ConfigString   ConfigValueType = "string"
+	ConfigBool     ConfigValueType = "bool"
+	ConfigInt      ConfigValueType = "int"
+	ConfigFloat    ConfigValueType = "float"
+	ConfigDuration ConfigValueType = "duration"
+	// ConfigStringMap accepts map[string]string, or map[string]interface{}
+	// with string values as decoded from JSON
+	ConfigStringMap ConfigValueType = "string_map"
+	// ConfigIntMap accepts map[string]int, or map[string]interface{} with
+	// whole-number values as decoded from JSON
+	ConfigIntMap ConfigValueType = "int_map"
+)
+
+// ConfigKey describes a recognized ExtraConfig key
+type ConfigKey struct {
+	Name        string          `json:"name"`
+	Type        ConfigValueType `json:"type"`
+	Description string          `json:"description,omitempty"`
+}
+
+// ExtraConfigSchema lists the ExtraConfig keys a gateway recognizes
+type ExtraConfigSchema []ConfigKey
+
+// ExtraConfigDescriber is implemented by gateways that declare the
+// ExtraConfig keys they read. Registration fails for unknown or wrong-typed
+// keys on these gateways.
+type ExtraConfigDescriber interface {
+	ExtraConfigSchema() ExtraConfigSchema
+}
+
+// CommonExtraConfigSchema lists keys recognized for every gateway
+var CommonExtraConfigSchema = ExtraConfigSchema{
+	{Name: "webhook_secret", Type: ConfigString, Description: "Deprecated: use GatewayConfig.WebhookSecret"},
+	{Name: ExtraConfigMinorUnits, Type: ConfigIntMap, Description: "Minor-unit exponents by currency, overriding MinorUnitOverrides"},
+}
+
+// Keys returns the names of the recognized keys, sorted
+func (s ExtraConfigSchema) Keys() []string {
+	keys := make([]string, 0, len(s))
+	for _, k := range s {
+		keys = append(keys, k.Name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate checks extra against the schema and reports every unknown or
+// wrong-typed key
+func (s ExtraConfigSchema) Validate(extra map[string]interface{}) error {
+	known := make(map[string]ConfigKey, len(s))
+	for _, k := range s {
+		known[k.Name] = k
+	}
+
+	problems := []string{}
+	for name, value := range extra {
+		key, ok := known[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown key %q", name))
+			continue
+		}
+		if !key.Type.matches(value) {
+			problems = append(problems, fmt.Sprintf("key %q must be %s, got %T", name, key.Type, value))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("invalid extra config: %s", strings.Join(problems, "; "))
+}
+
+func (t ConfigValueType) matches(v interface{}) bool {
+	switch t {
+	case ConfigString:
+		_, ok := v.(string)
+		return ok
+	case ConfigBool:
+		_, ok := v.(bool)
+		return ok
+	case ConfigInt:
+		switch n := v.(type) {
+		case int, int32, int64:
+			return true
+		case float64:
+			// JSON numbers decode as float64
+			return n == float64(int64(n))
+		}
+		return false
+	case ConfigFloat:
+		switch v.(type) {
+		case float32, float64, int, int32, int64:
+			return true
+		}
+		return false
+	case ConfigDuration:
+		switch d := v.(type) {
+		case time.Duration:
+			return true
+		case string:
+			_, err := time.ParseDuration(d)
+			return err == nil
+		}
+		return false
+	case ConfigStringMap:
+		switch m := v.(type) {
+		case map[string]string:
+			return true
+		case map[string]interface{}:
+			for _, val := range m {
+				if _, ok := val.(string); !ok {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	case ConfigIntMap:
+		switch m := v.(type) {
+		case map[string]int:
+			return true
+		case map[string]interface{}:
+			for _, val := range m {
+				if !ConfigInt.matches(val) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// ValidateExtraConfig validates config.ExtraConfig against the gateway's
+// declared schema plus CommonExtraConfigSchema. Gateways that don't implement
+// ExtraConfigDescriber are not validated.
+func ValidateExtraConfig(g Gateway, config *GatewayConfig) error {
+	d, ok := UnwrapGateway(g).(ExtraConfigDescriber)
+	if !ok || config == nil {
+		return nil
+	}
+	schema := append(ExtraConfigSchema{}, CommonExtraConfigSchema...)
+	schema = append(schema, d.ExtraConfigSchema()...)
+	return schema.Validate(config.ExtraConfig)
+}
+
+// GatewayDescription summarizes a configured gateway
+type GatewayDescription struct {
+	Method          string   `json:"method"`
+	Name            string   `json:"name"`
+	ExtraConfigKeys []string `json:"extra_config_keys,omitempty"`
+}
+
+// Describe returns a description of a configured gateway
+func (pm *PaymentManager) Describe(method string) (*GatewayDescription, error) {
+	g, err := pm.GetGateway(method)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := &GatewayDescription{
+		Method: g.GetMethod(),
+		Name:   g.GetName(),
+	}
+	if d, ok := UnwrapGateway(g).(ExtraConfigDescriber); ok {
+		schema := append(ExtraConfigSchema{}, CommonExtraConfigSchema...)
+		desc.ExtraConfigKeys = append(schema, d.ExtraConfigSchema()...).Keys()
+	}
+	return desc, nil
+}
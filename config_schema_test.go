@@ -0,0 +1,67 @@
+package payment
+
+import (
+	"net/http"
+	"testing"
+)
+
+type schemaGateway struct{ fakeGateway }
+
+func (s *schemaGateway) ExtraConfigSchema() ExtraConfigSchema {
+	return ExtraConfigSchema{
+		{Name: "store_id", Type: ConfigString},
+		{Name: "max_retries", Type: ConfigInt},
+	}
+}
+
+func TestExtraConfigValidation(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterFactory("schema", func(config *GatewayConfig, client *http.Client) Gateway {
+		return &schemaGateway{fakeGateway{method: "schema"}}
+	})
+
+	valid := &GatewayConfig{ExtraConfig: map[string]interface{}{
+		"store_id":       "s1",
+		"max_retries":    float64(3),
+		"webhook_secret": "whsec",
+	}}
+	if err := pm.RegisterGatewayWithConfig("schema", valid); err != nil {
+		t.Errorf("Valid config should register: %v", err)
+	}
+
+	typo := &GatewayConfig{ExtraConfig: map[string]interface{}{"webhookSecret": "whsec"}}
+	if err := pm.RegisterGatewayWithConfig("schema", typo); err == nil {
+		t.Error("Unknown key should fail registration")
+	}
+
+	wrongType := &GatewayConfig{ExtraConfig: map[string]interface{}{"max_retries": "three"}}
+	if err := pm.RegisterGatewayWithConfig("schema", wrongType); err == nil {
+		t.Error("Wrong-typed key should fail registration")
+	}
+
+	desc, err := pm.Describe("schema")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(desc.ExtraConfigKeys) != 4 {
+		t.Errorf("Expected 4 recognized keys, got %v", desc.ExtraConfigKeys)
+	}
+}
+
+func TestResponseFieldMap(t *testing.T) {
+	defaults := FieldMap{"status": "status", "amount": "amount"}
+	config := &GatewayConfig{ExtraConfig: map[string]interface{}{
+		ExtraConfigResponseFields: map[string]interface{}{"status": "txn_status"},
+	}}
+
+	fields := ResponseFieldMap(config, defaults)
+	if fields.Get("status") != "txn_status" {
+		t.Errorf("Expected override txn_status, got %s", fields.Get("status"))
+	}
+	if fields.Get("amount") != "amount" {
+		t.Errorf("Expected default amount, got %s", fields.Get("amount"))
+	}
+	if defaults["status"] != "status" {
+		t.Error("Defaults should not be modified")
+	}
+}
@@ -0,0 +1,263 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/oarkflow/money"
+)
+
+// Metadata keys recorded when a payment is presented in a converted currency
+const (
+	MetadataBaseAmount   = "base_amount"
+	MetadataBaseCurrency = "base_currency"
+	MetadataFXRate       = "fx_rate"
+)
+
+// ErrNoExchangeRateProvider is returned when currency conversion is requested
+// without a configured ExchangeRateProvider
+var ErrNoExchangeRateProvider = errors.New("no exchange rate provider configured")
+
+// ExchangeRateProvider supplies exchange rates for currency conversion
+type ExchangeRateProvider interface {
+	GetRate(from, to money.Currency) (money.FXRate, error)
+}
+
+// FXStoreRateProvider serves the latest rates from a money.FXRateStore
+type FXStoreRateProvider struct {
+	Store *money.FXRateStore
+}
+
+func (p FXStoreRateProvider) GetRate(from, to money.Currency) (money.FXRate, error) {
+	rate, ok := p.Store.GetLatestRate(from, to)
+	if !ok {
+		return money.FXRate{}, fmt.Errorf("no exchange rate from %s to %s", from.Code, to.Code)
+	}
+	return rate, nil
+}
+
+// ErrUnsupportedCurrency is returned when a gateway can't charge a currency
+var ErrUnsupportedCurrency = errors.New("currency not supported")
+
+// CurrencyReporter is implemented by gateways that only charge some
+// currencies. Gateways without it are assumed to accept any currency.
+type CurrencyReporter interface {
+	// SupportedCurrencies returns the ISO 4217 codes the gateway charges
+	SupportedCurrencies() []string
+}
+
+// SupportsCurrency reports whether g can charge currency
+func SupportsCurrency(g Gateway, currency string) bool {
+	c, ok := UnwrapGateway(g).(CurrencyReporter)
+	if !ok {
+		return true
+	}
+	return slices.Contains(c.SupportedCurrencies(), strings.ToUpper(currency))
+}
+
+// ValidateCurrency returns an error wrapping ErrUnsupportedCurrency if the
+// gateway registered for method can't charge currency, e.g. to hide it from
+// a checkout in that currency
+func (pm *PaymentManager) ValidateCurrency(method, currency string) error {
+	g, err := pm.GetGateway(method)
+	if err != nil {
+		return err
+	}
+	if !SupportsCurrency(g, currency) {
+		return fmt.Errorf("%w: %s does not charge %s", ErrUnsupportedCurrency, g.GetMethod(), currency)
+	}
+	return nil
+}
+
+// GetCountryCurrency returns the ISO 4217 currency code used in a country
+func GetCountryCurrency(country Country) (string, bool) {
+	iso, ok := money.GetISOCurrencyByCountryCode(string(country))
+	if !ok {
+		return "", false
+	}
+	return iso.Code, true
+}
+
+// DefaultCurrency returns the ISO 4217 code of the currency used in c, or ""
+// for CountryGlobal and countries without a known currency
+func (c Country) DefaultCurrency() string {
+	code, _ := GetCountryCurrency(c)
+	return code
+}
+
+// ErrCountryCurrencyMismatch is returned when a payment for a country is in
+// a currency other than the country's default
+var ErrCountryCurrencyMismatch = errors.New("currency does not match country")
+
+// checkCountryCurrency returns an error wrapping ErrCountryCurrencyMismatch
+// if req is in a currency other than country's default, unless
+// req.AllowCurrencyMismatch is set
+func checkCountryCurrency(country Country, req *PaymentRequest) error {
+	want := country.DefaultCurrency()
+	got := req.Amount.Currency().Code
+	if req.AllowCurrencyMismatch || want == "" || got == "" || got == want {
+		return nil
+	}
+	return fmt.Errorf("%w: %s uses %s, payment is in %s", ErrCountryCurrencyMismatch, country, want, got)
+}
+
+// displayDecimals overrides ISO 4217 minor units for currencies that are
+// conventionally displayed, and accepted by local gateways, as whole numbers
+var displayDecimals = map[string]int{
+	"IDR": 0,
+	"VND": 0,
+}
+
+// DisplayDecimals returns the number of decimals currency is displayed and
+// sent to gateways with
+func DisplayDecimals(currency money.Currency) int {
+	if d, ok := displayDecimals[currency.Code]; ok {
+		return d
+	}
+	return int(currency.Decimals)
+}
+
+// RoundForDisplay rounds m half away from zero to DisplayDecimals of its
+// currency
+func RoundForDisplay(m money.Money) money.Money {
+	drop := int(m.Currency().Decimals) - DisplayDecimals(m.Currency())
+	if drop <= 0 {
+		return m
+	}
+	factor := int64(math.Pow10(drop))
+	minor := m.Minor()
+	q, r := minor/factor, minor%factor
+	if r < 0 {
+		r = -r
+	}
+	if 2*r >= factor {
+		if minor < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return money.NewFromMinor(q*factor, m.Currency())
+}
+
+// FormatAmount formats m as a plain decimal with DisplayDecimals places and
+// no symbol or grouping, e.g. "100.00" for NPR or "12346" for IDR, as
+// gateways expect it in requests
+func FormatAmount(m money.Money) string {
+	m = RoundForDisplay(m)
+	decimals := DisplayDecimals(m.Currency())
+	major := m.Minor()
+	if drop := int(m.Currency().Decimals) - decimals; drop > 0 {
+		major /= int64(math.Pow10(drop))
+	}
+	sign := ""
+	if major < 0 {
+		sign, major = "-", -major
+	}
+	s := strconv.FormatInt(major, 10)
+	if decimals == 0 {
+		return sign + s
+	}
+	for len(s) <= decimals {
+		s = "0" + s
+	}
+	return sign + s[:len(s)-decimals] + "." + s[len(s)-decimals:]
+}
+
+// currencySymbols overrides the money package's symbols where local usage
+// differs
+var currencySymbols = map[string]string{
+	"NPR": "रू",
+	"PKR": "Rs",
+	"INR": "₹",
+	"JPY": "¥",
+	"CNY": "CN¥",
+	"SAR": "﷼",
+	"AED": "د.إ",
+}
+
+// CurrencySymbol returns the display symbol for an ISO 4217 currency code,
+// e.g. "रू" for NPR or "$" for USD. Unknown currencies return the code
+// itself.
+func CurrencySymbol(currency string) string {
+	code := strings.ToUpper(currency)
+	if symbol, ok := currencySymbols[code]; ok {
+		return symbol
+	}
+	if c, ok := money.GetCurrency(code); ok && c.Symbol != "" {
+		return c.Symbol
+	}
+	return code
+}
+
+// SetExchangeRateProvider sets the provider used for currency conversion
+func (pm *PaymentManager) SetExchangeRateProvider(provider ExchangeRateProvider) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.rates = provider
+}
+
+// NegotiateCurrency converts baseAmount into the country's local currency for
+// display, rounded with RoundForDisplay. It returns baseAmount unchanged
+// with a rate of 1 when the country already uses the base currency.
+func (pm *PaymentManager) NegotiateCurrency(country Country, baseAmount money.Money) (money.Money, float64, error) {
+	code, ok := GetCountryCurrency(country)
+	if !ok {
+		return money.Money{}, 0, fmt.Errorf("no currency known for country %s", country)
+	}
+	local, ok := money.GetCurrency(code)
+	if !ok {
+		return money.Money{}, 0, fmt.Errorf("currency %s is not registered", code)
+	}
+	if local.Code == baseAmount.Currency().Code {
+		return baseAmount, 1, nil
+	}
+
+	pm.mu.RLock()
+	provider := pm.rates
+	pm.mu.RUnlock()
+	if provider == nil {
+		return money.Money{}, 0, ErrNoExchangeRateProvider
+	}
+
+	fx, err := provider.GetRate(baseAmount.Currency(), local)
+	if err != nil {
+		return money.Money{}, 0, err
+	}
+	if fx.Rate <= 0 {
+		return money.Money{}, 0, fmt.Errorf("invalid exchange rate from %s to %s", baseAmount.Currency().Code, local.Code)
+	}
+
+	// Convert via major units so currencies with different decimals scale
+	// correctly
+	rate := float64(fx.Rate) / math.Pow10(int(fx.Precision))
+	major := float64(baseAmount.Minor()) / math.Pow10(int(baseAmount.Currency().Decimals))
+	return RoundForDisplay(money.NewFromFloat(major*rate, local)), rate, nil
+}
+
+// InitiatePaymentInLocalCurrency presents req.Amount in the country's local
+// currency and initiates the payment with it. The original amount and rate
+// are recorded in the request metadata.
+func (pm *PaymentManager) InitiatePaymentInLocalCurrency(ctx context.Context, method string, country Country, req *PaymentRequest) (*PaymentResponse, error) {
+	presentment, rate, err := pm.NegotiateCurrency(country, req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	localReq := *req
+	localReq.Amount = presentment
+	localReq.Metadata = make(map[string]string, len(req.Metadata)+3)
+	for k, v := range req.Metadata {
+		localReq.Metadata[k] = v
+	}
+	localReq.Metadata[MetadataBaseAmount] = req.Amount.Format(money.WithoutComma(), money.WithoutSymbol())
+	localReq.Metadata[MetadataBaseCurrency] = req.Amount.Currency().Code
+	localReq.Metadata[MetadataFXRate] = strconv.FormatFloat(rate, 'f', -1, 64)
+
+	return pm.InitiatePayment(ctx, method, &localReq)
+}
@@ -0,0 +1,216 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/oarkflow/money"
+)
+
+func TestNegotiateCurrency(t *testing.T) {
+	pm := NewPaymentManager(0)
+	usd := money.MustCurrency("USD")
+	npr := money.MustCurrency("NPR")
+
+	base := money.New(10, usd)
+	if _, _, err := pm.NegotiateCurrency(CountryNepal, base); err != ErrNoExchangeRateProvider {
+		t.Errorf("Expected ErrNoExchangeRateProvider, got %v", err)
+	}
+
+	store := money.NewFXRateStore()
+	store.SetRate(money.FXRate{From: usd, To: npr, Rate: 13350, Precision: 2})
+	pm.SetExchangeRateProvider(FXStoreRateProvider{Store: store})
+
+	presentment, rate, err := pm.NegotiateCurrency(CountryNepal, base)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rate != 133.5 {
+		t.Errorf("Expected rate 133.5, got %v", rate)
+	}
+	if !presentment.Equals(money.New(1335, npr)) {
+		t.Errorf("Expected NPR 1335, got %s", presentment)
+	}
+
+	// Same currency needs no conversion
+	same, rate, err := pm.NegotiateCurrency(CountryUSA, base)
+	if err != nil || rate != 1 || !same.Equals(base) {
+		t.Errorf("Expected unchanged amount for USA, got %s rate %v err %v", same, rate, err)
+	}
+
+	fake := &fakeGateway{method: "fake"}
+	pm.RegisterGateway("fake", fake)
+	pm.SetTransactionStore(NewMemoryTransactionStore())
+	resp, err := pm.InitiatePaymentInLocalCurrency(context.Background(), "fake", CountryNepal, &PaymentRequest{OrderID: "O1", Amount: base, SuccessURL: testSuccessURL})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	txn, err := pm.GetTransactionStore().Get(resp.TransactionID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !txn.Amount.Equals(presentment) {
+		t.Errorf("Expected presentment amount to be initiated, got %s", txn.Amount)
+	}
+	if txn.Metadata[MetadataBaseCurrency] != "USD" || txn.Metadata[MetadataBaseAmount] != "10.00" {
+		t.Errorf("Expected base amount in metadata, got %v", txn.Metadata)
+	}
+}
+
+func TestDisplayRounding(t *testing.T) {
+	tests := []struct {
+		amount    money.Money
+		decimals  int
+		formatted string
+	}{
+		{money.NewFromMinor(1234567, money.MustCurrency("IDR")), 0, "12346"},
+		{money.NewFromMinor(1234549, money.MustCurrency("IDR")), 0, "12345"},
+		{money.NewFromMinor(-1234550, money.MustCurrency("IDR")), 0, "-12346"},
+		{money.NewFromMinor(25000, money.MustCurrency("VND")), 0, "25000"},
+		{money.NewFromFloat(100, money.MustCurrency("NPR")), 2, "100.00"},
+		{money.NewFromMinor(5, money.MustCurrency("NPR")), 2, "0.05"},
+		{money.NewFromMinor(1500, money.MustCurrency("JPY")), 0, "1500"},
+	}
+
+	for _, tt := range tests {
+		cur := tt.amount.Currency()
+		if got := DisplayDecimals(cur); got != tt.decimals {
+			t.Errorf("DisplayDecimals(%s) = %d, want %d", cur.Code, got, tt.decimals)
+		}
+		if got := FormatAmount(tt.amount); got != tt.formatted {
+			t.Errorf("FormatAmount(%d %s) = %q, want %q", tt.amount.Minor(), cur.Code, got, tt.formatted)
+		}
+	}
+
+	// Rounded IDR amounts keep their currency and whole-rupiah value
+	rounded := RoundForDisplay(money.NewFromMinor(1234567, money.MustCurrency("IDR")))
+	if rounded.Minor() != 1234600 || rounded.Currency().Code != "IDR" {
+		t.Errorf("Unexpected rounded IDR amount %d %s", rounded.Minor(), rounded.Currency().Code)
+	}
+}
+
+func TestAmountInMinorUnits(t *testing.T) {
+	bhd := money.MustCurrency("BHD")
+	jpy := money.MustCurrency("JPY")
+	isk := money.MustCurrency("ISK")
+	override := &GatewayConfig{ExtraConfig: map[string]interface{}{
+		// As decoded from JSON
+		ExtraConfigMinorUnits: map[string]interface{}{"ISK": float64(2), "BHD": float64(2)},
+	}}
+
+	tests := []struct {
+		config *GatewayConfig
+		amount money.Money
+		want   int64
+	}{
+		{nil, money.NewFromFloat(1.5, bhd), 1500},
+		{nil, money.NewFromMinor(1, bhd), 1},
+		{nil, money.New(1500, jpy), 1500},
+		{nil, money.New(100, money.MustCurrency("NPR")), 10000},
+		{override, money.New(100, isk), 10000},
+		{override, money.NewFromMinor(1235, bhd), 124},
+		{override, money.New(1500, jpy), 1500},
+	}
+	for _, tt := range tests {
+		if got := AmountInMinorUnits(tt.config, tt.amount); got != tt.want {
+			t.Errorf("AmountInMinorUnits(%d %s) = %d, want %d", tt.amount.Minor(), tt.amount.Currency().Code, got, tt.want)
+		}
+	}
+
+	if got := MinorUnitExponent(nil, bhd); got != 3 {
+		t.Errorf("Expected 3 decimals for BHD, got %d", got)
+	}
+	if got := MinorUnitExponent(nil, jpy); got != 0 {
+		t.Errorf("Expected 0 decimals for JPY, got %d", got)
+	}
+
+	bad := map[string]interface{}{ExtraConfigMinorUnits: map[string]interface{}{"BHD": 2.5}}
+	if err := CommonExtraConfigSchema.Validate(bad); err == nil {
+		t.Error("Expected fractional exponent to be rejected")
+	}
+}
+
+func TestAmountFromMinorUnits(t *testing.T) {
+	bhd := money.MustCurrency("BHD")
+	isk := money.MustCurrency("ISK")
+	override := &GatewayConfig{ExtraConfig: map[string]interface{}{
+		ExtraConfigMinorUnits: map[string]interface{}{"ISK": float64(2), "BHD": float64(2)},
+	}}
+
+	tests := []struct {
+		config *GatewayConfig
+		minor  int64
+		want   money.Money
+	}{
+		{nil, 1500, money.NewFromFloat(1.5, bhd)},
+		{nil, 1500, money.New(1500, money.MustCurrency("JPY"))},
+		{nil, 10000, money.New(100, money.MustCurrency("NPR"))},
+		{override, 10000, money.New(100, isk)},
+		{override, 10050, money.New(101, isk)},
+		{override, 124, money.NewFromMinor(1240, bhd)},
+	}
+	for _, tt := range tests {
+		if got := AmountFromMinorUnits(tt.config, tt.minor, tt.want.Currency()); !got.Equals(tt.want) {
+			t.Errorf("AmountFromMinorUnits(%d %s) = %s, want %s", tt.minor, tt.want.Currency().Code, got, tt.want)
+		}
+	}
+
+	// Amounts sent to a gateway come back unchanged
+	amount := money.New(2500, isk)
+	if got := AmountFromMinorUnits(override, AmountInMinorUnits(override, amount), isk); !got.Equals(amount) {
+		t.Errorf("Expected %s to round-trip, got %s", amount, got)
+	}
+}
+
+func TestCurrencySymbol(t *testing.T) {
+	tests := map[string]string{"NPR": "रू", "usd": "$", "INR": "₹", "EUR": "€", "XYZ": "XYZ"}
+	for code, want := range tests {
+		if got := CurrencySymbol(code); got != want {
+			t.Errorf("CurrencySymbol(%q) = %q, want %q", code, got, want)
+		}
+	}
+
+	// Every supported country's currency has a symbol
+	for _, countries := range RegionMap {
+		for _, country := range countries {
+			code, ok := GetCountryCurrency(country)
+			if !ok {
+				continue
+			}
+			if CurrencySymbol(code) == code {
+				t.Errorf("No symbol for %s (%s)", code, country)
+			}
+		}
+	}
+}
+
+func TestInitiatePaymentForCountryChecksCurrency(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.GetRegistry().RegisterCountryGateway(CountryNepal, "fake", 1)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+	ctx := context.Background()
+
+	if got := CountryNepal.DefaultCurrency(); got != "NPR" {
+		t.Errorf("Expected NPR for Nepal, got %q", got)
+	}
+	if got := CountryGlobal.DefaultCurrency(); got != "" {
+		t.Errorf("Expected no currency for GLOBAL, got %q", got)
+	}
+
+	req := &PaymentRequest{OrderID: "O1", Amount: money.New(100, money.MustCurrency("INR")), SuccessURL: testSuccessURL}
+	_, err := pm.InitiatePaymentForCountry(ctx, CountryNepal, req)
+	if !errors.Is(err, ErrCountryCurrencyMismatch) || HTTPStatusForError(err) != 400 {
+		t.Errorf("Expected ErrCountryCurrencyMismatch, got %v", err)
+	}
+
+	req.AllowCurrencyMismatch = true
+	if _, err := pm.InitiatePaymentForCountry(ctx, CountryNepal, req); err != nil {
+		t.Errorf("Expected the mismatch to be allowed: %v", err)
+	}
+
+	req = &PaymentRequest{OrderID: "O2", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL}
+	if _, err := pm.InitiatePaymentForCountry(ctx, CountryNepal, req); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MetadataCustomerID is the PaymentRequest.Metadata key carrying a provider
+// customer id, as returned by GetOrCreateCustomer
+const MetadataCustomerID = "customer_id"
+
+// ErrCustomerNotFound is returned when a customer mapping is not cached
+var ErrCustomerNotFound = errors.New("customer not found")
+
+// CustomerRef identifies a customer on our side
+type CustomerRef struct {
+	// ExternalID is our own customer id. It takes precedence over Email for
+	// lookups and caching.
+	ExternalID string `json:"external_id,omitempty"`
+	Email      string `json:"email,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Phone      string `json:"phone,omitempty"`
+	// Account is the named account, registered with RegisterGatewayAccount,
+	// the customer belongs to. Empty uses the method's default gateway.
+	Account string `json:"account,omitempty"`
+}
+
+// key returns the cache key for the ref, or "" if it has no identifier.
+// Customers of different accounts are cached apart.
+func (c CustomerRef) key() string {
+	var key string
+	if c.ExternalID != "" {
+		key = "id:" + c.ExternalID
+	} else if c.Email != "" {
+		key = "email:" + strings.ToLower(strings.TrimSpace(c.Email))
+	}
+	if key == "" || c.Account == "" {
+		return key
+	}
+	return "account:" + c.Account + "|" + key
+}
+
+// CustomerManager is implemented by gateways that keep provider-side
+// customer objects. GetOrCreateCustomer returns an existing customer matching
+// ref, creating one if none exists.
+type CustomerManager interface {
+	GetOrCreateCustomer(ctx context.Context, ref CustomerRef) (string, error)
+}
+
+// CustomerStore is implemented by TransactionStores that can also cache
+// customer ids per gateway
+type CustomerStore interface {
+	GetCustomer(method, key string) (string, error)
+	SaveCustomer(method, key, customerID string) error
+}
+
+// GetOrCreateCustomer returns the provider customer id for ref on method,
+// using the gateway of ref.Account. The mapping is cached when the
+// transaction store implements CustomerStore. Pass the id to
+// InitiatePayment as req.Metadata[MetadataCustomerID], with the same
+// req.Metadata[MetadataAccount].
+func (pm *PaymentManager) GetOrCreateCustomer(ctx context.Context, method string, ref CustomerRef) (string, error) {
+	g, err := pm.GetGatewayAccount(method, ref.Account)
+	if err != nil {
+		return "", err
+	}
+	cm, ok := UnwrapGateway(g).(CustomerManager)
+	if !ok {
+		return "", NewPaymentError(ErrKindUnsupported, g.GetMethod(), "customers are not supported", nil)
+	}
+	key := ref.key()
+	if key == "" {
+		return "", NewPaymentError(ErrKindValidation, g.GetMethod(), "customer ref needs an external id or email", nil)
+	}
+
+	pm.mu.RLock()
+	store, cached := pm.transactions.(CustomerStore)
+	pm.mu.RUnlock()
+	if cached {
+		if id, err := store.GetCustomer(g.GetMethod(), key); err == nil {
+			return id, nil
+		}
+	}
+
+	release, err := pm.acquire(ctx, g.GetMethod())
+	if err != nil {
+		return "", err
+	}
+	id, err := cm.GetOrCreateCustomer(ctx, ref)
+	release()
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", fmt.Errorf("%s: provider returned an empty customer id", g.GetMethod())
+	}
+	if cached {
+		_ = store.SaveCustomer(g.GetMethod(), key, id)
+	}
+	return id, nil
+}
@@ -0,0 +1,163 @@
+package payment
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces sensitive values in debug output
+const Redacted = "[REDACTED]"
+
+// sensitiveParams are substrings of parameter names whose values are always redacted
+var sensitiveParams = []string{"secret", "password", "cvv", "cvc", "pin", "authorization"}
+
+// SignatureBaser is implemented by gateways that sign initiation requests.
+// SignatureBaseString returns the exact string signed for req, so it can be
+// compared against the provider's documentation.
+type SignatureBaser interface {
+	SignatureBaseString(req *PaymentRequest) string
+}
+
+// SignatureBaseString returns the signature base string g would use for req.
+// It is intended for tests and debugging integrations.
+func SignatureBaseString(g Gateway, req *PaymentRequest) (string, error) {
+	sb, ok := UnwrapGateway(g).(SignatureBaser)
+	if !ok {
+		return "", NewPaymentError(ErrKindUnsupported, g.GetMethod(), "gateway does not sign requests", nil)
+	}
+	return sb.SignatureBaseString(req), nil
+}
+
+// LogSignature logs a signature computation when config.LogSignatures is
+// set. fields lists the signed fields in order; base is the exact string
+// hashed, including any appended secret, which is redacted.
+func LogSignature(config *GatewayConfig, method, operation string, fields []string, base, signature string) {
+	if config == nil || !config.LogSignatures {
+		return
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = NewSlogLogger(nil)
+	}
+	secrets := []string{config.SecretKey, config.GetWebhookSecret()}
+	logger.Infof("payment: signature computed method=%s operation=%s fields=%s base=%s signature=%s",
+		method, operation, strings.Join(fields, ","), redactSecrets(base, secrets), signature)
+}
+
+// DebugRequest is a redacted copy of an outbound provider request, attached
+// to PaymentError when GatewayConfig.Debug is set
+type DebugRequest struct {
+	HTTPMethod string            `json:"http_method"`
+	URL        string            `json:"url"`
+	Params     map[string]string `json:"params,omitempty"`
+	// SignatureBase is the exact string the request signature was computed
+	// over, with secrets redacted
+	SignatureBase string `json:"signature_base,omitempty"`
+}
+
+// NewDebugRequest captures an outbound request for debugging. It returns nil
+// unless config.Debug is set, so gateways can call it unconditionally.
+// Secrets from config, sensitive parameter names and card numbers are redacted.
+func NewDebugRequest(config *GatewayConfig, httpMethod, rawURL string, params map[string]string, signatureBase string) *DebugRequest {
+	if config == nil || !config.Debug {
+		return nil
+	}
+	secrets := []string{config.SecretKey, config.GetWebhookSecret()}
+
+	dbg := &DebugRequest{
+		HTTPMethod:    httpMethod,
+		URL:           redactURL(rawURL, secrets),
+		SignatureBase: redactSecrets(signatureBase, secrets),
+	}
+	if len(params) > 0 {
+		dbg.Params = make(map[string]string, len(params))
+		for k, v := range params {
+			dbg.Params[k] = redactParam(k, v, secrets)
+		}
+	}
+	return dbg
+}
+
+// WithDebugRequest attaches dbg to err. Errors that aren't a PaymentError are
+// wrapped as provider errors. It returns err unchanged if either is nil.
+func WithDebugRequest(method string, err error, dbg *DebugRequest) error {
+	if err == nil || dbg == nil {
+		return err
+	}
+	var perr *PaymentError
+	if errors.As(err, &perr) {
+		perr.Request = dbg
+		return err
+	}
+	perr = NewPaymentError(ErrKindProvider, method, "", err)
+	perr.Request = dbg
+	return perr
+}
+
+func redactParam(name, value string, secrets []string) string {
+	lower := strings.ToLower(name)
+	for _, s := range sensitiveParams {
+		if strings.Contains(lower, s) {
+			return Redacted
+		}
+	}
+	if looksLikePAN(value) {
+		return maskPAN(value)
+	}
+	return redactSecrets(value, secrets)
+}
+
+func redactURL(rawURL string, secrets []string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return redactSecrets(rawURL, secrets)
+	}
+	query := u.Query()
+	for k, vs := range query {
+		for i, v := range vs {
+			vs[i] = redactParam(k, v, secrets)
+		}
+		query[k] = vs
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func redactSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, Redacted)
+		}
+	}
+	return s
+}
+
+// looksLikePAN reports whether s is a 13-19 digit number passing the Luhn check
+func looksLikePAN(s string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(s)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if d < 0 || d > 9 {
+			return false
+		}
+		if (len(digits)-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// maskPAN keeps only the last four digits of a card number
+func maskPAN(s string) string {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(s)
+	return strings.Repeat("*", len(digits)-4) + digits[len(digits)-4:]
+}
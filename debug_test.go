@@ -0,0 +1,92 @@
+package payment
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewDebugRequest(t *testing.T) {
+	config := &GatewayConfig{SecretKey: "s3cret"}
+	if NewDebugRequest(config, "POST", "https://example.com", nil, "") != nil {
+		t.Error("Debug request should be nil unless Debug is set")
+	}
+
+	config.Debug = true
+	dbg := NewDebugRequest(config, "GET", "https://example.com/pay?key=s3cret&amt=10", map[string]string{
+		"card":     "4242 4242 4242 4242",
+		"password": "hunter2",
+		"amount":   "100",
+	}, "Msisdn=1,RefId=R1s3cret")
+
+	if dbg.Params["card"] != "************4242" {
+		t.Errorf("Card number should be masked, got %s", dbg.Params["card"])
+	}
+	if dbg.Params["password"] != Redacted {
+		t.Errorf("Password should be redacted, got %s", dbg.Params["password"])
+	}
+	if dbg.Params["amount"] != "100" {
+		t.Errorf("Amount should be kept, got %s", dbg.Params["amount"])
+	}
+	if strings.Contains(dbg.URL, "s3cret") || strings.Contains(dbg.SignatureBase, "s3cret") {
+		t.Errorf("Secret leaked: %s %s", dbg.URL, dbg.SignatureBase)
+	}
+	if dbg.SignatureBase != "Msisdn=1,RefId=R1"+Redacted {
+		t.Errorf("Unexpected signature base %s", dbg.SignatureBase)
+	}
+
+	err := WithDebugRequest("imepay", errors.New("bad json"), dbg)
+	var perr *PaymentError
+	if !errors.As(err, &perr) || perr.Request != dbg {
+		t.Fatalf("Expected PaymentError with request, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "signature_base=") {
+		t.Errorf("Error should include the signature base: %v", err)
+	}
+}
+
+// signingGateway signs MerchantCode and OrderID
+type signingGateway struct{ fakeGateway }
+
+func (s *signingGateway) SignatureBaseString(req *PaymentRequest) string {
+	return "MerchantCode=M1,RefId=" + req.OrderID
+}
+
+func TestSignatureBaseString(t *testing.T) {
+	g := WrapGateway(&signingGateway{fakeGateway{method: "signed"}})
+	base, err := SignatureBaseString(g, &PaymentRequest{OrderID: "O1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if base != "MerchantCode=M1,RefId=O1" {
+		t.Errorf("Unexpected signature base %s", base)
+	}
+
+	if _, err := SignatureBaseString(&fakeGateway{method: "plain"}, &PaymentRequest{}); err == nil {
+		t.Error("Expected error for gateway without signatures")
+	}
+}
+
+func TestLogSignature(t *testing.T) {
+	var buf bytes.Buffer
+	config := &GatewayConfig{SecretKey: "s3cret", Logger: NewSlogLogger(slog.New(slog.NewTextHandler(&buf, nil)))}
+
+	LogSignature(config, "imepay", "initiate", []string{"RefId"}, "RefId=R1s3cret", "ABC")
+	if buf.Len() != 0 {
+		t.Errorf("Signatures should not be logged unless LogSignatures is set, got %s", buf.String())
+	}
+
+	config.LogSignatures = true
+	LogSignature(config, "imepay", "initiate", []string{"MerchantCode", "RefId"}, "MerchantCode=M,RefId=R1s3cret", "ABC")
+	out := buf.String()
+	if strings.Contains(out, "s3cret") {
+		t.Errorf("Secret leaked into log: %s", out)
+	}
+	for _, want := range []string{"method=imepay", "fields=MerchantCode,RefId", "RefId=R1" + Redacted, "signature=ABC"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected log to contain %q, got %s", want, out)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package payment
+
+import "strings"
+
+// DeclineReason is a gateway-independent reason a payment was declined, for
+// showing customers an actionable message
+type DeclineReason string
+
+const (
+	DeclineInsufficientFunds    DeclineReason = "insufficient_funds"
+	DeclineCardExpired          DeclineReason = "card_expired"
+	DeclineDoNotHonor           DeclineReason = "do_not_honor"
+	DeclineIncorrectCVC         DeclineReason = "incorrect_cvc"
+	DeclineIncorrectNumber      DeclineReason = "incorrect_number"
+	DeclineLostOrStolen         DeclineReason = "lost_or_stolen"
+	DeclineFraudSuspected       DeclineReason = "fraud_suspected"
+	DeclineLimitExceeded        DeclineReason = "limit_exceeded"
+	DeclineAuthenticationFailed DeclineReason = "authentication_failed"
+	DeclineCanceled             DeclineReason = "canceled"
+	DeclineProcessingError      DeclineReason = "processing_error"
+	// DeclineOther is any decline code without a more specific reason
+	DeclineOther DeclineReason = "other"
+)
+
+// declineReasons maps provider decline codes, lowercased, to reasons. Stripe
+// decline codes and Razorpay error reasons share this table.
+var declineReasons = map[string]DeclineReason{
+	"insufficient_funds":   DeclineInsufficientFunds,
+	"insufficient_balance": DeclineInsufficientFunds,
+
+	"expired_card": DeclineCardExpired,
+	"card_expired": DeclineCardExpired,
+
+	"do_not_honor":       DeclineDoNotHonor,
+	"do_not_try_again":   DeclineDoNotHonor,
+	"generic_decline":    DeclineDoNotHonor,
+	"card_declined":      DeclineDoNotHonor,
+	"payment_declined":   DeclineDoNotHonor,
+	"transaction_denied": DeclineDoNotHonor,
+
+	"incorrect_cvc": DeclineIncorrectCVC,
+	"invalid_cvc":   DeclineIncorrectCVC,
+	"incorrect_cvv": DeclineIncorrectCVC,
+
+	"incorrect_number":    DeclineIncorrectNumber,
+	"invalid_number":      DeclineIncorrectNumber,
+	"invalid_card_number": DeclineIncorrectNumber,
+
+	"lost_card":   DeclineLostOrStolen,
+	"stolen_card": DeclineLostOrStolen,
+	"pickup_card": DeclineLostOrStolen,
+
+	"fraudulent":          DeclineFraudSuspected,
+	"merchant_blacklist":  DeclineFraudSuspected,
+	"payment_risk_check":  DeclineFraudSuspected,
+	"risk_check_declined": DeclineFraudSuspected,
+
+	"card_velocity_exceeded":          DeclineLimitExceeded,
+	"withdrawal_count_limit_exceeded": DeclineLimitExceeded,
+	"amount_exceeds_limit":            DeclineLimitExceeded,
+	"transaction_limit_exceeded":      DeclineLimitExceeded,
+
+	"authentication_required": DeclineAuthenticationFailed,
+	"authentication_failed":   DeclineAuthenticationFailed,
+	"incorrect_otp":           DeclineAuthenticationFailed,
+	"incorrect_pin":           DeclineAuthenticationFailed,
+
+	"payment_cancelled": DeclineCanceled,
+	"payment_canceled":  DeclineCanceled,
+
+	"processing_error":        DeclineProcessingError,
+	"issuer_not_available":    DeclineProcessingError,
+	"gateway_technical_error": DeclineProcessingError,
+	"server_error":            DeclineProcessingError,
+}
+
+// NormalizeDeclineCode maps a provider decline code to a DeclineReason.
+// Unknown codes are DeclineOther; an empty code has no reason.
+func NormalizeDeclineCode(code string) DeclineReason {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "" {
+		return ""
+	}
+	if reason, ok := declineReasons[code]; ok {
+		return reason
+	}
+	return DeclineOther
+}
+
+// WithDecline sets the provider decline code and its normalized reason
+func WithDecline(code string) VerificationOption {
+	return func(b *verificationBuilder) {
+		b.resp.DeclineCode = code
+		b.resp.DeclineReason = NormalizeDeclineCode(code)
+	}
+}
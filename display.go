@@ -0,0 +1,52 @@
+package payment
+
+import "strings"
+
+// DisplayNamer is implemented by gateways with localized display names
+type DisplayNamer interface {
+	// GetDisplayName returns the name to show for locale (e.g. "ne-NP"),
+	// falling back to GetName when there is no translation
+	GetDisplayName(locale string) string
+}
+
+// DisplayName returns g's display name for locale, or GetName if g has no
+// localized names
+func DisplayName(g Gateway, locale string) string {
+	if d, ok := UnwrapGateway(g).(DisplayNamer); ok && locale != "" {
+		if name := d.GetDisplayName(locale); name != "" {
+			return name
+		}
+	}
+	return g.GetName()
+}
+
+// LocalizedName looks up locale in names, trying the full tag ("hi-IN") then
+// the base language ("hi"), and returns fallback if neither is present.
+// Gateways use it to implement DisplayNamer.
+func LocalizedName(names map[string]string, locale, fallback string) string {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if name, ok := names[locale]; ok {
+		return name
+	}
+	if base, _, found := strings.Cut(locale, "-"); found {
+		if name, ok := names[base]; ok {
+			return name
+		}
+	}
+	return fallback
+}
+
+// GetGatewayRecommendationsForLocale returns GetGatewayRecommendations with
+// each configured gateway's Name localized for locale
+func (pm *PaymentManager) GetGatewayRecommendationsForLocale(country Country, locale string) []GatewayRecommendation {
+	recommendations := pm.GetGatewayRecommendations(country)
+
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	for i := range recommendations {
+		if g, ok := pm.gateways[recommendations[i].Method]; ok {
+			recommendations[i].Name = DisplayName(g, locale)
+		}
+	}
+	return recommendations
+}
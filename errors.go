@@ -0,0 +1,154 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// ErrGatewayNotRegistered is returned when no gateway is registered for a method
+var ErrGatewayNotRegistered = errors.New("not registered")
+
+// ErrNilRequest is wrapped in the ErrKindValidation error returned when a
+// PaymentManager method is passed a nil request
+var ErrNilRequest = errors.New("nil request")
+
+// ErrorKind classifies gateway failures
+type ErrorKind string
+
+const (
+	ErrKindDeclined    ErrorKind = "declined"
+	ErrKindValidation  ErrorKind = "validation"
+	ErrKindProvider    ErrorKind = "provider_unavailable"
+	ErrKindTimeout     ErrorKind = "timeout"
+	ErrKindNotFound    ErrorKind = "not_found"
+	ErrKindUnsupported ErrorKind = "unsupported"
+)
+
+// PaymentError is a classified gateway error
+type PaymentError struct {
+	Kind    ErrorKind
+	Method  string
+	Message string
+	// StatusCode is the provider's HTTP status, if the error came from a response
+	StatusCode int
+	Err        error
+	// Request is the redacted outbound request, captured when the gateway's
+	// config has Debug set
+	Request *DebugRequest
+	// Headers are the response's RateLimitHeaders, e.g. Retry-After
+	Headers map[string]string
+}
+
+// NewPaymentError creates a PaymentError
+func NewPaymentError(kind ErrorKind, method, message string, err error) *PaymentError {
+	return &PaymentError{Kind: kind, Method: method, Message: message, Err: err}
+}
+
+func (e *PaymentError) Error() string {
+	msg := e.Message
+	if msg == "" && e.Err != nil {
+		msg = e.Err.Error()
+	} else if e.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+	if e.Request != nil {
+		msg = fmt.Sprintf("%s (request: %s %s", msg, e.Request.HTTPMethod, e.Request.URL)
+		if len(e.Request.Params) > 0 {
+			msg = fmt.Sprintf("%s params=%v", msg, e.Request.Params)
+		}
+		if e.Request.SignatureBase != "" {
+			msg = fmt.Sprintf("%s signature_base=%q", msg, e.Request.SignatureBase)
+		}
+		msg += ")"
+	}
+	return fmt.Sprintf("%s %s: %s", e.Method, e.Kind, msg)
+}
+
+func (e *PaymentError) Unwrap() error { return e.Err }
+
+// ErrorFromHTTPStatus classifies a non-2xx provider response
+func ErrorFromHTTPStatus(method string, statusCode int, message string) *PaymentError {
+	kind := ErrKindValidation
+	switch {
+	case statusCode == http.StatusPaymentRequired:
+		kind = ErrKindDeclined
+	case statusCode == http.StatusNotFound:
+		kind = ErrKindNotFound
+	case statusCode == http.StatusRequestTimeout || statusCode == http.StatusGatewayTimeout:
+		kind = ErrKindTimeout
+	case statusCode == http.StatusTooManyRequests || statusCode >= 500:
+		kind = ErrKindProvider
+	}
+	return &PaymentError{Kind: kind, Method: method, Message: message, StatusCode: statusCode}
+}
+
+// WrapTransportError classifies an error returned by http.Client.Do
+func WrapTransportError(method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return NewPaymentError(ErrKindTimeout, method, "request timed out", err)
+	}
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	return NewPaymentError(ErrKindProvider, method, "provider unreachable", err)
+}
+
+// HTTPStatusForError maps an error to the HTTP status a REST handler should return
+func HTTPStatusForError(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return http.StatusBadRequest
+	}
+
+	var perr *PaymentError
+	if errors.As(err, &perr) {
+		switch perr.Kind {
+		case ErrKindDeclined:
+			return http.StatusPaymentRequired
+		case ErrKindValidation:
+			return http.StatusBadRequest
+		case ErrKindProvider:
+			return http.StatusBadGateway
+		case ErrKindTimeout:
+			return http.StatusGatewayTimeout
+		case ErrKindNotFound:
+			return http.StatusNotFound
+		case ErrKindUnsupported:
+			return http.StatusNotImplemented
+		}
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrGatewayNotRegistered), errors.Is(err, ErrTransactionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrIdempotencyConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrAmountMismatch):
+		return http.StatusPaymentRequired
+	case errors.Is(err, ErrOrderMismatch):
+		return http.StatusConflict
+	case errors.Is(err, ErrRefundExceedsCaptured):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrInvalidCallbackSignature), errors.Is(err, ErrMissingVerificationData), errors.Is(err, ErrUnsupportedCurrency),
+		errors.Is(err, ErrCountryCurrencyMismatch):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrTooManyRequests):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -45,8 +45,9 @@ func example1BasicRegionSupport() {
 		},
 		// International gateways (don't work in Nepal!)
 		"stripe": {
-			APIKey:  "sk_test_xxx",
-			Sandbox: true,
+			APIKey:        "sk_test_xxx",
+			WebhookSecret: "whsec_xxx",
+			Sandbox:       true,
 		},
 		"paypal": {
 			APIKey:  "paypal_client_id",
@@ -257,13 +258,15 @@ func setupTestPaymentManager() *payment.PaymentManager {
 			Sandbox:    true,
 		},
 		"razorpay": {
-			APIKey:    "rzp_test_xxx",
-			SecretKey: "secret_xxx",
-			Sandbox:   true,
+			APIKey:        "rzp_test_xxx",
+			SecretKey:     "secret_xxx",
+			WebhookSecret: "whsec_xxx",
+			Sandbox:       true,
 		},
 		"stripe": {
-			APIKey:  "sk_test_xxx",
-			Sandbox: true,
+			APIKey:        "sk_test_xxx",
+			WebhookSecret: "whsec_xxx",
+			Sandbox:       true,
 		},
 		"paypal": {
 			APIKey:     "paypal_client_id",
@@ -0,0 +1,86 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// SetFailoverChain sets an explicit, ordered list of methods to try for a
+// country in InitiatePaymentWithFallback, overriding registry priority order.
+// Calling it with no methods clears the chain.
+func (pm *PaymentManager) SetFailoverChain(country Country, methods ...string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if len(methods) == 0 {
+		delete(pm.failover, country)
+		return
+	}
+	chain := make([]string, len(methods))
+	for i, method := range methods {
+		chain[i] = NormalizeMethod(method)
+	}
+	pm.failover[country] = chain
+}
+
+// GetFailoverChain returns the methods InitiatePaymentWithFallback tries for
+// a country, in order
+func (pm *PaymentManager) GetFailoverChain(country Country) []string {
+	pm.mu.RLock()
+	chain, ok := pm.failover[country]
+	pm.mu.RUnlock()
+
+	if ok {
+		return append([]string(nil), chain...)
+	}
+	return pm.GetAvailableGatewaysForCountry(country)
+}
+
+// InitiatePaymentWithFallback tries each gateway in the country's failover
+// chain until one succeeds, returning the response and the method used.
+// Unconfigured methods in the chain are skipped. Only failures that another
+// gateway might not share, as reported by failsOver, move on to the next
+// gateway; validation errors, declines and unsuccessful responses are
+// returned as they are.
+func (pm *PaymentManager) InitiatePaymentWithFallback(ctx context.Context, country Country, req *PaymentRequest) (*PaymentResponse, string, error) {
+	chain := pm.GetFailoverChain(country)
+	if len(chain) == 0 {
+		return nil, "", fmt.Errorf("no gateways available for country %s", country)
+	}
+
+	var errs []error
+	for _, method := range chain {
+		if _, err := pm.GetGateway(method); err != nil {
+			continue
+		}
+
+		resp, err := pm.InitiatePayment(ctx, method, req)
+		if err == nil && resp.Success {
+			return resp, method, nil
+		}
+		if err == nil {
+			return resp, method, fmt.Errorf("gateway %s: %s", method, resp.Message)
+		}
+		if !failsOver(err) {
+			return resp, method, err
+		}
+		errs = append(errs, err)
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, "", fmt.Errorf("no configured gateways in failover chain for country %s", country)
+	}
+	return nil, "", fmt.Errorf("all gateways failed for country %s: %w", country, errors.Join(errs...))
+}
+
+// failsOver reports whether err means the gateway is unavailable rather than
+// the payment unacceptable: a transient provider or network failure, an
+// open circuit or a local concurrency or rate limit
+func failsOver(err error) bool {
+	return IsTransient(err) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrTooManyRequests)
+}
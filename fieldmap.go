@@ -0,0 +1,43 @@
+package payment
+
+// ExtraConfigResponseFields is the ExtraConfig key used to override the
+// provider field names a gateway reads from responses
+const ExtraConfigResponseFields = "response_fields"
+
+// FieldMap maps logical response fields to the provider's JSON field names
+type FieldMap map[string]string
+
+// Get returns the provider field name for a logical field, or the logical
+// name itself if it isn't mapped
+func (m FieldMap) Get(field string) string {
+	if name, ok := m[field]; ok && name != "" {
+		return name
+	}
+	return field
+}
+
+// ResponseFieldMap returns defaults overridden by any entries in
+// config.ExtraConfig["response_fields"]
+func ResponseFieldMap(config *GatewayConfig, defaults FieldMap) FieldMap {
+	fields := make(FieldMap, len(defaults))
+	for k, v := range defaults {
+		fields[k] = v
+	}
+	if config == nil {
+		return fields
+	}
+
+	switch overrides := config.ExtraConfig[ExtraConfigResponseFields].(type) {
+	case map[string]string:
+		for k, v := range overrides {
+			fields[k] = v
+		}
+	case map[string]interface{}:
+		for k, v := range overrides {
+			if name, ok := v.(string); ok {
+				fields[k] = name
+			}
+		}
+	}
+	return fields
+}
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/oarkflow/money"
@@ -20,6 +21,17 @@ import (
 type Gateway struct {
 	config *payment.GatewayConfig
 	client *http.Client
+	fields payment.FieldMap
+}
+
+// DefaultResponseFields are the ConnectIPS response field names. Override
+// entries with ExtraConfig["response_fields"].
+var DefaultResponseFields = payment.FieldMap{
+	"status":       "status",
+	"url":          "url",
+	"token":        "token",
+	"amount":       "amount",
+	"reference_id": "reference_id",
 }
 
 func New(config *payment.GatewayConfig, client *http.Client) payment.Gateway {
@@ -33,37 +45,89 @@ func New(config *payment.GatewayConfig, client *http.Client) payment.Gateway {
 	if config.Currency == "" {
 		config.Currency = "NPR"
 	}
-	return &Gateway{config: config, client: client}
+	return &Gateway{
+		config: config,
+		client: client,
+		fields: payment.ResponseFieldMap(config, DefaultResponseFields),
+	}
 }
 
 func (c *Gateway) GetName() string   { return "ConnectIPS" }
 func (c *Gateway) GetMethod() string { return "connectips" }
 
+// TestMode reports whether the gateway is configured for the sandbox
+func (c *Gateway) TestMode() bool { return c.config.Sandbox }
+
+// Capabilities reports a bank login redirect without refunds
+func (c *Gateway) Capabilities() payment.GatewayCapabilities {
+	return payment.GatewayCapabilities{Flow: payment.FlowRedirect, StatusCheck: true}
+}
+
+// SupportedCurrencies reports that ConnectIPS charges only NPR
+func (c *Gateway) SupportedCurrencies() []string { return []string{"NPR"} }
+
+// displayNames are the localized display names, keyed by locale
+var displayNames = map[string]string{
+	"ne": "कनेक्ट आइपिएस",
+}
+
+// GetDisplayName returns the display name for locale, falling back to GetName
+func (c *Gateway) GetDisplayName(locale string) string {
+	return payment.LocalizedName(displayNames, locale, c.GetName())
+}
+
+// ExtraConfigSchema lists the ExtraConfig keys ConnectIPS reads
+func (c *Gateway) ExtraConfigSchema() payment.ExtraConfigSchema {
+	return payment.ExtraConfigSchema{
+		{Name: payment.ExtraConfigResponseFields, Type: payment.ConfigStringMap, Description: "Overrides for DefaultResponseFields"},
+	}
+}
+
 func (c *Gateway) generateHash(data string) string {
 	h := hmac.New(sha512.New, []byte(c.config.SecretKey))
 	h.Write([]byte(data))
 	return base64.StdEncoding.EncodeToString(h.Sum(nil))
 }
 
-func (c *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.PaymentResponse, error) {
-	txnAmt := req.Amount.Format(money.WithLocale(money.LocaleNeNP), money.WithoutComma(), money.WithoutSymbol())
+// txnAmount formats m as ConnectIPS expects TXNAMT: a plain decimal with
+// exactly two places and no grouping, e.g. "1000.00". The same string must be
+// signed and sent, or the TOKEN fails validation.
+func txnAmount(m money.Money) string {
+	return payment.FormatAmount(m)
+}
 
-	hashData := fmt.Sprintf("%s,%s,%s", c.config.MerchantID, req.OrderID, txnAmt)
+// SignatureBaseString returns the string signed to initiate req:
+// MERCHANTID,REFERENCEID,TXNAMT
+func (c *Gateway) SignatureBaseString(req *payment.PaymentRequest) string {
+	return fmt.Sprintf("%s,%s,%s", c.config.MerchantID, req.OrderID, txnAmount(req.Amount))
+}
+
+// initiatePayload builds the signed initiate payload for req and returns it
+// with the signature base string
+func (c *Gateway) initiatePayload(req *payment.PaymentRequest) (map[string]string, string) {
+	hashData := c.SignatureBaseString(req)
 	signature := c.generateHash(hashData)
+	payment.LogSignature(c.config, c.GetMethod(), "initiate", []string{"MERCHANTID", "REFERENCEID", "TXNAMT"}, hashData, signature)
 
-	payload := map[string]string{
+	return map[string]string{
 		"MERCHANTID":  c.config.MerchantID,
 		"APPID":       c.config.APIKey,
 		"REFERENCEID": req.OrderID,
-		"TXNAMT":      txnAmt,
+		"TXNAMT":      txnAmount(req.Amount),
 		"REMARKS":     req.Description,
 		"PARTICULARS": req.Description,
 		"TOKEN":       signature,
-	}
+	}, hashData
+}
+
+func (c *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.PaymentResponse, error) {
+	payload, hashData := c.initiatePayload(req)
 
 	jsonData, _ := json.Marshal(payload)
+	initiateURL := c.config.BaseURL + "/api/ips/initiate"
+	dbg := payment.NewDebugRequest(c.config, http.MethodPost, initiateURL, payload, hashData)
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/api/ips/initiate", bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", initiateURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
@@ -71,37 +135,123 @@ func (c *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentReque
 
 	resp, err := c.client.Do(httpReq)
 	if err != nil {
-		return nil, err
+		return nil, payment.WithDebugRequest(c.GetMethod(), payment.WrapTransportError(c.GetMethod(), err), dbg)
 	}
 	defer resp.Body.Close()
 
+	body, err := payment.ReadResponseBody(c.GetMethod(), resp)
+	if err != nil {
+		return nil, payment.WithDebugRequest(c.GetMethod(), err, dbg)
+	}
+	presp, err := c.parseInitiateResponse(body, req.OrderID)
+	if err != nil {
+		return nil, payment.WithDebugRequest(c.GetMethod(), err, dbg)
+	}
+	return presp, nil
+}
+
+// parseInitiateResponse builds the response for orderID from an initiate
+// response body. A successful response must carry the payment URL and token.
+func (c *Gateway) parseInitiateResponse(body []byte, orderID string) (*payment.PaymentResponse, error) {
 	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, err
 	}
 
+	status, _ := result[c.fields.Get("status")].(string)
+	if status != "success" {
+		return &payment.PaymentResponse{
+			Success: false,
+			OrderID: orderID,
+			Message: fmt.Sprintf("connectips initiate status %q", status),
+		}, nil
+	}
+
+	paymentURL, err := stringField(result, c.fields.Get("url"))
+	if err != nil {
+		return nil, err
+	}
+	token, err := stringField(result, c.fields.Get("token"))
+	if err != nil {
+		return nil, err
+	}
 	return &payment.PaymentResponse{
-		Success:       result["status"] == "success",
-		PaymentURL:    result["url"].(string),
-		TransactionID: result["token"].(string),
-		OrderID:       req.OrderID,
+		Success:       true,
+		PaymentURL:    paymentURL,
+		TransactionID: token,
+		OrderID:       orderID,
 	}, nil
 }
 
+// stringField returns the non-empty string result[key]
+func stringField(result map[string]interface{}, key string) (string, error) {
+	v, ok := result[key]
+	if !ok || v == nil {
+		return "", fmt.Errorf("connectips: response is missing %q", key)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("connectips: response field %q is %T, want string", key, v)
+	}
+	if s == "" {
+		return "", fmt.Errorf("connectips: response field %q is empty", key)
+	}
+	return s, nil
+}
+
+// RequiredVerificationFields reports that verification needs the TXNID
+func (c *Gateway) RequiredVerificationFields() []string {
+	return []string{"TXNID|transaction_id"}
+}
+
+// VerifyPayment validates the transaction with ConnectIPS, which
+// authenticates it server-side; nothing in the redirect is trusted. The
+// validated reference_id and amount must match req.OrderID and req.Amount
+// when those are set, or the payment fails with ErrOrderMismatch or
+// ErrAmountMismatch.
 func (c *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRequest) (*payment.VerificationResponse, error) {
-	hashData := fmt.Sprintf("%s,%s", c.config.MerchantID, req.TransactionID)
+	txnID := req.TransactionID
+	if txnID == "" {
+		txnID = req.RawData["TXNID"]
+	}
+	vresp, err := c.validate(ctx, txnID, req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case req.OrderID != "" && vresp.OrderID != req.OrderID:
+		err = fmt.Errorf("%w: connectips validated order %q, expected %q", payment.ErrOrderMismatch, vresp.OrderID, req.OrderID)
+	case !req.Amount.IsZero() && !c.config.AmountTolerance.Allows(req.Amount, vresp.PaidAmount):
+		err = fmt.Errorf("%w: connectips validated %s, expected %s", payment.ErrAmountMismatch, vresp.PaidAmount, req.Amount)
+	}
+	if err != nil {
+		vresp.Status = payment.StatusFailed
+		vresp.Success = false
+		vresp.Message = err.Error()
+		return vresp, err
+	}
+	return vresp, nil
+}
+
+// validate asks ConnectIPS for the state of txnID. amount is the amount we
+// requested.
+func (c *Gateway) validate(ctx context.Context, txnID string, amount money.Money) (*payment.VerificationResponse, error) {
+	hashData := fmt.Sprintf("%s,%s", c.config.MerchantID, txnID)
 	signature := c.generateHash(hashData)
+	payment.LogSignature(c.config, c.GetMethod(), "verify", []string{"MERCHANTID", "TXNID"}, hashData, signature)
 
 	payload := map[string]string{
 		"MERCHANTID": c.config.MerchantID,
 		"APPID":      c.config.APIKey,
-		"TXNID":      req.TransactionID,
+		"TXNID":      txnID,
 		"TOKEN":      signature,
 	}
 
 	jsonData, _ := json.Marshal(payload)
+	validateURL := c.config.BaseURL + "/api/ips/validate"
+	dbg := payment.NewDebugRequest(c.config, http.MethodPost, validateURL, payload, hashData)
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/api/ips/validate", bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", validateURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
@@ -109,33 +259,62 @@ func (c *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRe
 
 	resp, err := c.client.Do(httpReq)
 	if err != nil {
-		return nil, err
+		return nil, payment.WithDebugRequest(c.GetMethod(), payment.WrapTransportError(c.GetMethod(), err), dbg)
 	}
 	defer resp.Body.Close()
 
+	body, err := payment.ReadResponseBody(c.GetMethod(), resp)
+	if err != nil {
+		return nil, payment.WithDebugRequest(c.GetMethod(), err, dbg)
+	}
+	vresp, err := c.parseVerifyResponse(body, txnID, amount)
+	if err != nil {
+		return nil, payment.WithDebugRequest(c.GetMethod(), err, dbg)
+	}
+	return vresp, nil
+}
+
+// parseVerifyResponse builds the verification of txnID from a validate
+// response body. amount is the amount we requested.
+func (c *Gateway) parseVerifyResponse(body []byte, txnID string, amount money.Money) (*payment.VerificationResponse, error) {
 	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, err
 	}
 
 	status := payment.StatusFailed
-	if result["status"] == "SUCCESS" {
+	if result[c.fields.Get("status")] == "SUCCESS" {
 		status = payment.StatusCompleted
 	}
 
-	var amount money.Money
-	if amt, ok := result["amount"].(string); ok {
+	var paidAmount money.Money
+	if amt, ok := result[c.fields.Get("amount")].(string); ok {
 		if floatAmt, err := strconv.ParseFloat(amt, 64); err == nil {
-			amount = money.New(int64(floatAmt*100), money.MustCurrency(c.config.Currency))
+			paidAmount = money.NewFromFloat(floatAmt, money.MustCurrency(c.config.Currency))
 		}
 	}
 
-	return &payment.VerificationResponse{
-		Success:       status == payment.StatusCompleted,
-		Status:        status,
-		TransactionID: req.TransactionID,
-		OrderID:       result["reference_id"].(string),
-		Amount:        amount,
+	orderID, _ := result[c.fields.Get("reference_id")].(string)
+	return payment.NewVerificationResponse(
+		payment.WithStatus(status),
+		payment.WithTransactionID(txnID),
+		payment.WithOrderID(orderID),
+		payment.WithAmount(amount),
+		payment.WithPaidAmount(paidAmount),
+		payment.WithCurrency(c.config.Currency),
+	), nil
+}
+
+// ParseReturnURL reads ConnectIPS's return redirect (TXNID). VerifyPayment
+// validates the transaction with ConnectIPS, so nothing else is read.
+func (c *Gateway) ParseReturnURL(values url.Values) (*payment.VerificationRequest, error) {
+	txnID := values.Get("TXNID")
+	if txnID == "" {
+		return nil, errors.New("connectips: return URL is missing TXNID")
+	}
+	return &payment.VerificationRequest{
+		TransactionID: txnID,
+		RawData:       payment.ValuesToRawData(values),
 	}, nil
 }
 
@@ -143,9 +322,12 @@ func (c *Gateway) RefundPayment(ctx context.Context, req *payment.RefundRequest)
 	return nil, errors.New("refund not implemented for ConnectIPS")
 }
 
-func (c *Gateway) GetStatus(ctx context.Context, txnID string) (*payment.StatusResponse, error) {
-	vReq := &payment.VerificationRequest{TransactionID: txnID}
-	vResp, err := c.VerifyPayment(context.Background(), vReq)
+func (c *Gateway) GetStatus(ctx context.Context, req *payment.StatusRequest) (*payment.StatusResponse, error) {
+	txnID := req.TransactionID
+	if txnID == "" {
+		txnID = req.RawData["TXNID"]
+	}
+	vResp, err := c.validate(ctx, txnID, req.Amount)
 	if err != nil {
 		return nil, err
 	}
@@ -153,6 +335,6 @@ func (c *Gateway) GetStatus(ctx context.Context, txnID string) (*payment.StatusR
 		Status:        vResp.Status,
 		TransactionID: vResp.TransactionID,
 		OrderID:       vResp.OrderID,
-		Amount:        vResp.Amount,
+		Amount:        vResp.PaidAmount,
 	}, nil
 }
@@ -0,0 +1,196 @@
+package connectips
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+	"github.com/oarkflow/payment/internal/golden"
+	"github.com/oarkflow/payment/paymenttest"
+)
+
+// TestParseVerifyResponse checks parsing of recorded validate responses against
+// testdata/*.golden. Run with -update after an intended schema change.
+func TestParseVerifyResponse(t *testing.T) {
+	g := New(&payment.GatewayConfig{}, nil).(*Gateway)
+	amount := money.New(1000, money.MustCurrency("NPR"))
+
+	for _, name := range []string{"success", "failed", "error"} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := g.parseVerifyResponse(golden.Fixture(t, "validate_"+name+".json"), "T1", amount)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := resp.Validate(); err != nil {
+				t.Errorf("Invalid response: %v", err)
+			}
+			golden.AssertJSON(t, "validate_"+name+".golden", resp)
+		})
+	}
+}
+
+func TestParseInitiateResponse(t *testing.T) {
+	g := New(&payment.GatewayConfig{}, nil).(*Gateway)
+
+	resp, err := g.parseInitiateResponse([]byte(`{"status":"success","url":"https://pay.example/1","token":"T1"}`), "O1")
+	if err != nil || !resp.Success || resp.PaymentURL != "https://pay.example/1" || resp.TransactionID != "T1" {
+		t.Errorf("Unexpected response %+v, %v", resp, err)
+	}
+	resp, err = g.parseInitiateResponse([]byte(`{"status":"failed"}`), "O1")
+	if err != nil || resp.Success {
+		t.Errorf("Expected an unsuccessful response, got %+v, %v", resp, err)
+	}
+
+	for name, body := range map[string]string{
+		"missing url":   `{"status":"success","token":"T1"}`,
+		"null token":    `{"status":"success","url":"https://pay.example/1","token":null}`,
+		"numeric token": `{"status":"success","url":"https://pay.example/1","token":42}`,
+	} {
+		if _, err := g.parseInitiateResponse([]byte(body), "O1"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestInitiatePayloadAmount(t *testing.T) {
+	g := New(&payment.GatewayConfig{MerchantID: "M1", SecretKey: "secret"}, nil).(*Gateway)
+	npr := money.MustCurrency("NPR")
+
+	tests := []struct {
+		amount money.Money
+		want   string
+	}{
+		{money.New(1000, npr), "1000.00"},
+		{money.NewFromFloat(1234.5, npr), "1234.50"},
+		{money.NewFromFloat(100000.05, npr), "100000.05"},
+	}
+	for _, tt := range tests {
+		payload, hashData := g.initiatePayload(&payment.PaymentRequest{OrderID: "O1", Amount: tt.amount})
+		if payload["TXNAMT"] != tt.want {
+			t.Errorf("TXNAMT = %q, want %q", payload["TXNAMT"], tt.want)
+		}
+		if want := "M1,O1," + payload["TXNAMT"]; hashData != want {
+			t.Errorf("Signed %q, want %q", hashData, want)
+		}
+		if payload["TOKEN"] != g.generateHash(hashData) {
+			t.Errorf("TOKEN does not sign %q", hashData)
+		}
+	}
+}
+
+// TestRequests checks the exact requests sent to ConnectIPS, including the
+// signed TOKEN, using an in-memory transport
+func TestRequests(t *testing.T) {
+	npr := money.MustCurrency("NPR")
+	initiated := `{"status":"success","url":"https://pay.example/1","token":"T1"}`
+	jsonHeader := http.Header{"Content-Type": {"application/json"}}
+	// The validate TOKEN signs M1,T1
+	validateToken := "RZhWRbT1QqBI2iBCzVM3G37j9d84a8QajS0XAB9s/TZBzKbNjlSAHV+AjF8yIsUxgLTXjM1QCjh00n29MNquBg=="
+
+	tests := []struct {
+		name     string
+		response string
+		call     func(g payment.Gateway) error
+		want     paymenttest.Request
+	}{
+		{
+			name:     "initiate",
+			response: initiated,
+			call: func(g payment.Gateway) error {
+				_, err := g.InitiatePayment(context.Background(), &payment.PaymentRequest{OrderID: "O1", Amount: money.New(1000, npr), Description: "Order 1"})
+				return err
+			},
+			want: paymenttest.Request{
+				Method: http.MethodPost,
+				URL:    "https://connectips.test/api/ips/initiate",
+				Header: jsonHeader,
+				Body:   []byte(`{"APPID":"APP1","MERCHANTID":"M1","PARTICULARS":"Order 1","REFERENCEID":"O1","REMARKS":"Order 1","TOKEN":"g18APaRSBtvlGXZFDtmYocCjf4heSsXuWXrOHxSx7LPJF5lTUxLWPVJhLpJqyQzPOiO23PQJ/44hVQsALrlRWQ==","TXNAMT":"1000.00"}`),
+			},
+		},
+		{
+			name:     "initiate fractional amount",
+			response: initiated,
+			call: func(g payment.Gateway) error {
+				_, err := g.InitiatePayment(context.Background(), &payment.PaymentRequest{OrderID: "O2", Amount: money.NewFromFloat(12.5, npr)})
+				return err
+			},
+			want: paymenttest.Request{
+				Method: http.MethodPost,
+				URL:    "https://connectips.test/api/ips/initiate",
+				Header: jsonHeader,
+				Body:   []byte(`{"APPID":"APP1","MERCHANTID":"M1","PARTICULARS":"","REFERENCEID":"O2","REMARKS":"","TOKEN":"hJMB8jbnGQWgesQh8N959wQ80Oe8ssn004INOcY0m9ExRLRxm5t6Yx+rdsu8VF7zPeE5bb7mLdHXSWnFHxtcGg==","TXNAMT":"12.50"}`),
+			},
+		},
+		{
+			name:     "validate",
+			response: string(golden.Fixture(t, "validate_success.json")),
+			call: func(g payment.Gateway) error {
+				_, err := g.VerifyPayment(context.Background(), &payment.VerificationRequest{TransactionID: "T1", OrderID: "O1", Amount: money.New(1000, npr)})
+				return err
+			},
+			want: paymenttest.Request{
+				Method: http.MethodPost,
+				URL:    "https://connectips.test/api/ips/validate",
+				Header: jsonHeader,
+				Body:   []byte(`{"APPID":"APP1","MERCHANTID":"M1","TOKEN":"` + validateToken + `","TXNID":"T1"}`),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &paymenttest.Transport{Handler: paymenttest.RespondJSON(http.StatusOK, tt.response)}
+			g := New(&payment.GatewayConfig{BaseURL: "https://connectips.test", MerchantID: "M1", APIKey: "APP1", SecretKey: "secret"}, tr.Client())
+			if err := tt.call(g); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			requests := tr.Requests()
+			if len(requests) != 1 {
+				t.Fatalf("Expected one request, got %d", len(requests))
+			}
+			got := requests[0]
+			if got.Method != tt.want.Method || got.URL != tt.want.URL {
+				t.Errorf("Expected %s %s, got %s %s", tt.want.Method, tt.want.URL, got.Method, got.URL)
+			}
+			if !reflect.DeepEqual(got.Header, tt.want.Header) {
+				t.Errorf("Expected headers %v, got %v", tt.want.Header, got.Header)
+			}
+			if string(got.Body) != string(tt.want.Body) {
+				t.Errorf("Expected body\n%s\ngot\n%s", tt.want.Body, got.Body)
+			}
+		})
+	}
+}
+
+func TestVerifyPaymentCrossChecks(t *testing.T) {
+	npr := money.MustCurrency("NPR")
+	tr := &paymenttest.Transport{Handler: paymenttest.RespondJSON(http.StatusOK, string(golden.Fixture(t, "validate_success.json")))}
+	g := New(&payment.GatewayConfig{BaseURL: "https://connectips.test", MerchantID: "M1", SecretKey: "secret"}, tr.Client())
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		req  *payment.VerificationRequest
+		want error
+	}{
+		// ConnectIPS redirects with the TXNID alone
+		{"redirect", &payment.VerificationRequest{RawData: map[string]string{"TXNID": "T1"}}, nil},
+		{"match", &payment.VerificationRequest{TransactionID: "T1", OrderID: "O1", Amount: money.New(1000, npr)}, nil},
+		{"other order", &payment.VerificationRequest{TransactionID: "T1", OrderID: "O2"}, payment.ErrOrderMismatch},
+		{"other amount", &payment.VerificationRequest{TransactionID: "T1", Amount: money.New(5000, npr)}, payment.ErrAmountMismatch},
+	}
+	for _, tt := range tests {
+		resp, err := g.VerifyPayment(ctx, tt.req)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+			continue
+		}
+		if resp.Success != (tt.want == nil) {
+			t.Errorf("%s: unexpected response %+v", tt.name, resp)
+		}
+	}
+}
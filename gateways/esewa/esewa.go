@@ -2,12 +2,16 @@ package esewa
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/oarkflow/money"
 	"github.com/oarkflow/payment"
@@ -36,70 +40,313 @@ func New(config *payment.GatewayConfig, client *http.Client) payment.Gateway {
 func (e *Gateway) GetName() string   { return "eSewa" }
 func (e *Gateway) GetMethod() string { return "esewa" }
 
-func (e *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.PaymentResponse, error) {
-	params := url.Values{}
-	amountStr := req.Amount.Format(money.WithLocale(money.LocaleNeNP), money.WithoutComma(), money.WithoutSymbol())
-	params.Set("amt", amountStr)
-	params.Set("psc", "0")
-	params.Set("pdc", "0")
-	params.Set("txAmt", "0")
-	params.Set("tAmt", amountStr)
-	params.Set("pid", req.OrderID)
-	params.Set("scd", e.config.MerchantID)
-	params.Set("su", req.SuccessURL)
-	params.Set("fu", req.FailureURL)
-
-	paymentURL := fmt.Sprintf("%s/api/epay/main/v2/form?%s", e.config.BaseURL, params.Encode())
+// TestMode reports whether the gateway is configured for the sandbox
+func (e *Gateway) TestMode() bool { return e.config.Sandbox }
+
+// Capabilities reports a hosted-form redirect without refunds
+func (e *Gateway) Capabilities() payment.GatewayCapabilities {
+	return payment.GatewayCapabilities{Flow: payment.FlowRedirect, StatusCheck: true}
+}
+
+// SupportedCurrencies reports that eSewa charges only NPR
+func (e *Gateway) SupportedCurrencies() []string { return []string{"NPR"} }
+
+// displayNames are the localized display names, keyed by locale
+var displayNames = map[string]string{
+	"ne": "इसेवा",
+}
+
+// GetDisplayName returns the display name for locale, falling back to GetName
+func (e *Gateway) GetDisplayName(locale string) string {
+	return payment.LocalizedName(displayNames, locale, e.GetName())
+}
+
+// ExtraConfigSchema reports that no gateway-specific ExtraConfig keys are used
+func (e *Gateway) ExtraConfigSchema() payment.ExtraConfigSchema { return nil }
+
+// SignatureBaseString returns the string eSewa's v2 API signs for req, in
+// signed_field_names order (total_amount,transaction_uuid,product_code).
+// Compare it with the signature in the callback's data parameter.
+func (e *Gateway) SignatureBaseString(req *payment.PaymentRequest) string {
+	amountStr := payment.FormatAmount(req.Amount)
+	return fmt.Sprintf("total_amount=%s,transaction_uuid=%s,product_code=%s", amountStr, req.OrderID, e.config.MerchantID)
+}
 
+// InitiatePayment returns eSewa's v2 checkout form for req, signed over
+// the fields SignatureBaseString lists. eSewa only accepts the form by
+// POST, so the customer's browser must submit FormFields to PaymentURL.
+func (e *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.PaymentResponse, error) {
+	amountStr := payment.FormatAmount(req.Amount)
 	return &payment.PaymentResponse{
 		Success:    true,
-		PaymentURL: paymentURL,
+		PaymentURL: e.config.BaseURL + "/api/epay/main/v2/form",
 		OrderID:    req.OrderID,
+		FormFields: map[string]string{
+			"amount":                  amountStr,
+			"tax_amount":              "0",
+			"product_service_charge":  "0",
+			"product_delivery_charge": "0",
+			"total_amount":            amountStr,
+			"transaction_uuid":        req.OrderID,
+			"product_code":            e.config.MerchantID,
+			"success_url":             req.SuccessURL,
+			"failure_url":             req.FailureURL,
+			"signed_field_names":      "total_amount,transaction_uuid,product_code",
+			"signature":               e.sign(e.SignatureBaseString(req)),
+		},
 	}, nil
 }
 
+// ResumePayment rebuilds the signed payment form for txn. eSewa keeps no
+// session, so the form stays valid until the order is paid.
+func (e *Gateway) ResumePayment(ctx context.Context, txn *payment.Transaction) (*payment.PaymentResponse, error) {
+	if txn.Request == nil {
+		return nil, payment.ErrPaymentExpired
+	}
+	return e.InitiatePayment(ctx, txn.Request)
+}
+
+// RequiredVerificationFields reports that verification needs the signed
+// data parameter of the v2 redirect
+func (e *Gateway) RequiredVerificationFields() []string {
+	return []string{"data"}
+}
+
+// VerifyPayment checks the signed data parameter of the redirect and looks
+// the payment up by the order id and amount it carries. Unsigned fields of
+// the redirect are never trusted; req.OrderID and req.Amount, when set, must
+// match the signed values.
 func (e *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRequest) (*payment.VerificationResponse, error) {
-	data := url.Values{}
-	amountStr := req.Amount.Format(money.WithLocale(money.LocaleNeNP), money.WithoutComma(), money.WithoutSymbol())
-	data.Set("amt", amountStr)
-	data.Set("rid", req.RawData["refId"])
-	data.Set("pid", req.OrderID)
-	data.Set("scd", e.config.MerchantID)
+	fields, err := e.verifyCallbackSignature(req.RawData["data"])
+	if err != nil {
+		return nil, err
+	}
 
-	verifyURL := fmt.Sprintf("%s/api/epay/transaction/status/", e.config.BaseURL)
+	refID, _ := fields["transaction_code"].(string)
+	orderID, _ := fields["transaction_uuid"].(string)
+	var amount money.Money
+	if amt, ok := parseAmount(fields["total_amount"]); ok {
+		amount = money.NewFromFloat(amt, money.MustCurrency(e.config.Currency))
+	}
+	if orderID == "" || amount.IsZero() {
+		return nil, fmt.Errorf("%w: esewa: signed data has no order id or amount", payment.ErrInvalidCallbackSignature)
+	}
+	if req.OrderID != "" && req.OrderID != orderID {
+		return nil, fmt.Errorf("%w: esewa callback is for order %q, expected %q", payment.ErrOrderMismatch, orderID, req.OrderID)
+	}
+	if !req.Amount.IsZero() && !e.config.AmountTolerance.Allows(req.Amount, amount) {
+		return nil, fmt.Errorf("%w: esewa callback is for %s, expected %s", payment.ErrAmountMismatch, amount, req.Amount)
+	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "GET", verifyURL+"?"+data.Encode(), nil)
+	vresp, err := e.queryStatus(ctx, e.statusQuery(orderID, amount), refID, orderID, amount)
 	if err != nil {
 		return nil, err
 	}
+	if err := crossCheck(vresp, refID, orderID, amount, e.config.AmountTolerance); err != nil {
+		return vresp, err
+	}
+	return vresp, nil
+}
 
-	resp, err := e.client.Do(httpReq)
+// statusQuery returns the parameters eSewa's v2 status endpoint looks
+// orderID up by
+func (e *Gateway) statusQuery(orderID string, amount money.Money) url.Values {
+	return url.Values{
+		"product_code":     {e.config.MerchantID},
+		"total_amount":     {payment.FormatAmount(amount)},
+		"transaction_uuid": {orderID},
+	}
+}
+
+// queryStatus calls the transaction status endpoint with data and parses
+// the response for refID and orderID, see parseVerifyResponse
+func (e *Gateway) queryStatus(ctx context.Context, data url.Values, refID, orderID string, amount money.Money) (*payment.VerificationResponse, error) {
+	statusURL := fmt.Sprintf("%s/api/epay/transaction/status/", e.config.BaseURL)
+	dbg := payment.NewDebugRequest(e.config, http.MethodGet, statusURL, payment.ValuesToRawData(data), "")
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", statusURL+"?"+data.Encode(), nil)
 	if err != nil {
 		return nil, err
 	}
+
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return nil, payment.WithDebugRequest(e.GetMethod(), payment.WrapTransportError(e.GetMethod(), err), dbg)
+	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := payment.ReadResponseBody(e.GetMethod(), resp)
 	if err != nil {
-		return nil, err
+		return nil, payment.WithDebugRequest(e.GetMethod(), err, dbg)
+	}
+	vresp, err := e.parseVerifyResponse(body, refID, orderID, amount)
+	if err != nil {
+		return nil, payment.WithDebugRequest(e.GetMethod(), err, dbg)
 	}
+	return vresp, nil
+}
 
+// parseVerifyResponse builds the verification of refID for orderID from a
+// status response body. amount is the amount the status was queried with.
+// The ref_id, transaction_uuid and total_amount eSewa reports, when present,
+// are returned in place of ours so crossCheck can compare them. eSewa only
+// finds a payment whose total_amount matches the query, so a response
+// without total_amount still confirms amount as paid.
+func (e *Gateway) parseVerifyResponse(body []byte, refID, orderID string, amount money.Money) (*payment.VerificationResponse, error) {
 	var result map[string]interface{}
 	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, err
 	}
 
 	status := payment.StatusFailed
-	if result["status"] == "COMPLETE" {
+	switch result["status"] {
+	case "COMPLETE":
 		status = payment.StatusCompleted
+	case "PENDING", "AMBIGUOUS":
+		status = payment.StatusPending
+	case "FULL_REFUND":
+		status = payment.StatusRefunded
+	case "PARTIAL_REFUND":
+		status = payment.StatusPartiallyRefunded
+	case "CANCELED":
+		status = payment.StatusCanceled
+	}
+
+	if reported, _ := result["ref_id"].(string); reported != "" {
+		refID = reported
+	}
+	if reported, _ := result["transaction_uuid"].(string); reported != "" {
+		orderID = reported
+	}
+	var paidAmount money.Money
+	if paid, ok := parseAmount(result["total_amount"]); ok {
+		paidAmount = money.NewFromFloat(paid, money.MustCurrency(e.config.Currency))
+	}
+
+	return payment.NewVerificationResponse(
+		payment.WithStatus(status),
+		payment.WithTransactionID(refID),
+		payment.WithOrderID(orderID),
+		payment.WithAmount(amount),
+		payment.WithPaidAmount(paidAmount),
+		payment.WithCurrency(e.config.Currency),
+	), nil
+}
+
+// crossCheck fails vresp when eSewa reported a different payment, order or
+// amount than expected, beyond tolerance. Values unknown on either side are
+// not compared.
+func crossCheck(vresp *payment.VerificationResponse, refID, orderID string, amount money.Money, tolerance payment.AmountTolerance) error {
+	var err error
+	switch {
+	case refID != "" && vresp.TransactionID != refID:
+		err = fmt.Errorf("%w: esewa reported ref_id %q, expected %q", payment.ErrOrderMismatch, vresp.TransactionID, refID)
+	case orderID != "" && vresp.OrderID != orderID:
+		err = fmt.Errorf("%w: esewa reported order %q, expected %q", payment.ErrOrderMismatch, vresp.OrderID, orderID)
+	case !amount.IsZero() && !vresp.PaidAmount.IsZero() && !tolerance.Allows(amount, vresp.PaidAmount):
+		err = fmt.Errorf("%w: esewa reported %s, expected %s", payment.ErrAmountMismatch, vresp.PaidAmount, amount)
+	}
+	if err != nil {
+		vresp.Status = payment.StatusFailed
+		vresp.Success = false
+		vresp.Message = err.Error()
+	}
+	return err
+}
+
+// verifyCallbackSignature checks the signature in the v2 redirect's base64
+// data parameter against its signed_field_names and returns the decoded
+// fields. A missing data parameter fails, as nothing else in the redirect is
+// signed.
+func (e *Gateway) verifyCallbackSignature(data string) (map[string]interface{}, error) {
+	if data == "" {
+		return nil, fmt.Errorf("%w: esewa: missing data parameter", payment.ErrInvalidCallbackSignature)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: esewa: undecodable data parameter", payment.ErrInvalidCallbackSignature)
+	}
+	// Keep numbers as sent, since the signature covers their exact text
+	dec := json.NewDecoder(strings.NewReader(string(decoded)))
+	dec.UseNumber()
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("%w: esewa: undecodable data parameter", payment.ErrInvalidCallbackSignature)
+	}
+
+	signature, _ := fields["signature"].(string)
+	names, _ := fields["signed_field_names"].(string)
+	if signature == "" || names == "" {
+		return nil, fmt.Errorf("%w: esewa: data parameter is not signed", payment.ErrInvalidCallbackSignature)
+	}
+	order := strings.Split(names, ",")
+	parts := []string{}
+	for _, name := range order {
+		parts = append(parts, fmt.Sprintf("%s=%v", name, fields[name]))
+	}
+	base := strings.Join(parts, ",")
+	computed := e.sign(base)
+	payment.LogSignature(e.config, e.GetMethod(), "callback", order, base, computed)
+	if !hmac.Equal([]byte(computed), []byte(signature)) {
+		return nil, fmt.Errorf("%w: esewa", payment.ErrInvalidCallbackSignature)
+	}
+	return fields, nil
+}
+
+// sign returns the base64 HMAC-SHA256 of data keyed with the secret key
+func (e *Gateway) sign(data string) string {
+	h := hmac.New(sha256.New, []byte(e.config.SecretKey))
+	h.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// parseAmount reads an amount that eSewa may encode as a number or a string
+func parseAmount(v interface{}) (float64, bool) {
+	switch amt := v.(type) {
+	case float64:
+		return amt, true
+	case json.Number:
+		f, err := amt.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(amt, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// ParseReturnURL reads eSewa's v2 success redirect, whose base64 "data"
+// parameter carries the signed transaction_code, transaction_uuid and
+// total_amount. Legacy redirects with unsigned oid, amt and refId are
+// rejected, as VerifyPayment can't trust them.
+func (e *Gateway) ParseReturnURL(values url.Values) (*payment.VerificationRequest, error) {
+	data := values.Get("data")
+	if data == "" {
+		return nil, errors.New("esewa: return URL is missing the signed data parameter")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("esewa: invalid data parameter: %w", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(decoded, &fields); err != nil {
+		return nil, fmt.Errorf("esewa: invalid data parameter: %w", err)
 	}
 
-	return &payment.VerificationResponse{
-		Success:       status == payment.StatusCompleted,
-		Status:        status,
-		TransactionID: req.RawData["refId"],
-		OrderID:       req.OrderID,
-		Amount:        req.Amount,
+	raw := payment.ValuesToRawData(values)
+	for k, v := range fields {
+		raw[k] = fmt.Sprint(v)
+	}
+	var amount money.Money
+	if amt, ok := parseAmount(fields["total_amount"]); ok {
+		amount = money.NewFromFloat(amt, money.MustCurrency(e.config.Currency))
+	}
+
+	return &payment.VerificationRequest{
+		TransactionID: raw["transaction_code"],
+		OrderID:       raw["transaction_uuid"],
+		Amount:        amount,
+		RawData:       raw,
 	}, nil
 }
 
@@ -107,6 +354,26 @@ func (e *Gateway) RefundPayment(ctx context.Context, req *payment.RefundRequest)
 	return nil, errors.New("refund not supported by eSewa API")
 }
 
-func (e *Gateway) GetStatus(ctx context.Context, txnID string) (*payment.StatusResponse, error) {
-	return nil, errors.New("status check requires order details")
+// GetStatus looks the payment up by req.OrderID and req.Amount, as eSewa
+// has no lookup by id. PaymentManager.GetStatus fills both in from the
+// stored transaction.
+func (e *Gateway) GetStatus(ctx context.Context, req *payment.StatusRequest) (*payment.StatusResponse, error) {
+	orderID, amount := req.OrderID, req.Amount
+	if orderID == "" || amount.Currency().Code == "" {
+		return nil, fmt.Errorf("%w: esewa status check needs the order id and amount", payment.ErrMissingVerificationData)
+	}
+	refID := req.RawData["transaction_code"]
+	vresp, err := e.queryStatus(ctx, e.statusQuery(orderID, amount), refID, orderID, amount)
+	if err != nil {
+		return nil, err
+	}
+	if err := crossCheck(vresp, refID, orderID, amount, e.config.AmountTolerance); err != nil {
+		return nil, err
+	}
+	return &payment.StatusResponse{
+		Status:        vresp.Status,
+		TransactionID: vresp.TransactionID,
+		OrderID:       vresp.OrderID,
+		Amount:        vresp.PaidAmount,
+	}, nil
 }
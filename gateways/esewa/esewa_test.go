@@ -0,0 +1,204 @@
+package esewa
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+	"github.com/oarkflow/payment/paymenttest"
+)
+
+// signedData returns the base64 data parameter of a v2 redirect for order
+// O1 and ref R1, signed by g
+func signedData(g *Gateway, amount string) string {
+	body := map[string]string{
+		"transaction_code":   "R1",
+		"status":             "COMPLETE",
+		"total_amount":       amount,
+		"transaction_uuid":   "O1",
+		"product_code":       g.config.MerchantID,
+		"signed_field_names": "transaction_code,status,total_amount,transaction_uuid,product_code,signed_field_names",
+	}
+	var parts []string
+	for _, name := range strings.Split(body["signed_field_names"], ",") {
+		parts = append(parts, name+"="+body[name])
+	}
+	body["signature"] = g.sign(strings.Join(parts, ","))
+	data, _ := json.Marshal(body)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestVerifyPaymentCrossChecks(t *testing.T) {
+	npr := money.MustCurrency("NPR")
+	tests := []struct {
+		name   string
+		body   string
+		amount money.Money
+		want   error
+		paid   money.Money
+	}{
+		{"match", `{"status":"COMPLETE","ref_id":"R1","transaction_uuid":"O1","total_amount":100.0}`, money.New(100, npr), nil, money.New(100, npr)},
+		{"string amount", `{"status":"COMPLETE","ref_id":"R1","transaction_uuid":"O1","total_amount":"100.00"}`, money.New(100, npr), nil, money.New(100, npr)},
+		{"no reported amount", `{"status":"COMPLETE","ref_id":"R1","transaction_uuid":"O1"}`, money.New(100, npr), nil, money.New(100, npr)},
+		{"other amount", `{"status":"COMPLETE","ref_id":"R1","transaction_uuid":"O1","total_amount":10.0}`, money.New(100, npr), payment.ErrAmountMismatch, money.New(10, npr)},
+		{"other ref_id", `{"status":"COMPLETE","ref_id":"R2","transaction_uuid":"O1","total_amount":100.0}`, money.New(100, npr), payment.ErrOrderMismatch, money.New(100, npr)},
+		{"other order", `{"status":"COMPLETE","ref_id":"R1","transaction_uuid":"O2","total_amount":100.0}`, money.New(100, npr), payment.ErrOrderMismatch, money.New(100, npr)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			g := New(&payment.GatewayConfig{BaseURL: srv.URL, MerchantID: "EPAYTEST", SecretKey: "secret"}, srv.Client()).(*Gateway)
+
+			req := &payment.VerificationRequest{OrderID: "O1", Amount: tt.amount, RawData: map[string]string{"data": signedData(g, "100.0")}}
+			resp, err := g.VerifyPayment(context.Background(), req)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, err)
+			}
+			if want := tt.want == nil; resp.Success != want || (resp.Status == payment.StatusCompleted) != want {
+				t.Errorf("Unexpected response %+v", resp)
+			}
+			if !resp.PaidAmount.Equals(tt.paid) || !resp.Amount.Equals(tt.amount) {
+				t.Errorf("Expected paid %s of %s, got %s of %s", tt.paid, tt.amount, resp.PaidAmount, resp.Amount)
+			}
+		})
+	}
+}
+
+func TestVerifyPaymentTrustsOnlySignedData(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if q := r.URL.Query(); q.Get("transaction_uuid") != "O1" || q.Get("total_amount") != "100.00" {
+			t.Errorf("Expected the signed order and amount to be queried, got %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"status":"COMPLETE","ref_id":"R1","transaction_uuid":"O1","total_amount":100.0}`))
+	}))
+	defer srv.Close()
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL, MerchantID: "EPAYTEST", SecretKey: "secret"}, srv.Client()).(*Gateway)
+	npr := money.MustCurrency("NPR")
+	data := signedData(g, "100.0")
+
+	tests := []struct {
+		name string
+		req  *payment.VerificationRequest
+		want error
+	}{
+		{"unsigned fields only", &payment.VerificationRequest{RawData: map[string]string{"refId": "R1", "oid": "O1", "amt": "100"}}, payment.ErrInvalidCallbackSignature},
+		{"unsigned fields ignored", &payment.VerificationRequest{RawData: map[string]string{"data": data, "oid": "O9", "amt": "1"}}, nil},
+		{"other expected order", &payment.VerificationRequest{OrderID: "O2", RawData: map[string]string{"data": data}}, payment.ErrOrderMismatch},
+		{"other expected amount", &payment.VerificationRequest{Amount: money.New(500, npr), RawData: map[string]string{"data": data}}, payment.ErrAmountMismatch},
+	}
+	for _, tt := range tests {
+		if _, err := g.VerifyPayment(context.Background(), tt.req); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestInitiatePaymentRoundTrip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		w.Write([]byte(`{"status":"COMPLETE","ref_id":"R1","transaction_uuid":"` + q.Get("transaction_uuid") + `","total_amount":"` + q.Get("total_amount") + `"}`))
+	}))
+	defer srv.Close()
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL, MerchantID: "EPAYTEST", SecretKey: "secret"}, srv.Client()).(*Gateway)
+	ctx := context.Background()
+
+	amount := money.New(100, money.MustCurrency("NPR"))
+	resp, err := g.InitiatePayment(ctx, &payment.PaymentRequest{OrderID: "O7", Amount: amount, SuccessURL: "https://shop.example.com/ok", FailureURL: "https://shop.example.com/fail"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	form := resp.FormFields
+	if resp.PaymentURL != srv.URL+"/api/epay/main/v2/form" || form["total_amount"] != "100.00" || form["transaction_uuid"] != "O7" || form["product_code"] != "EPAYTEST" {
+		t.Fatalf("Unexpected form %s %v", resp.PaymentURL, form)
+	}
+
+	// eSewa checks the form's signature over its signed_field_names
+	var parts []string
+	for _, name := range strings.Split(form["signed_field_names"], ",") {
+		parts = append(parts, name+"="+form[name])
+	}
+	if form["signature"] != g.sign(strings.Join(parts, ",")) {
+		t.Fatalf("Form signature %q doesn't match its signed fields", form["signature"])
+	}
+
+	// and redirects with the paid form's values, signed with the same key
+	body := map[string]string{
+		"transaction_code":   "R1",
+		"status":             "COMPLETE",
+		"total_amount":       form["total_amount"],
+		"transaction_uuid":   form["transaction_uuid"],
+		"product_code":       form["product_code"],
+		"signed_field_names": "transaction_code,status,total_amount,transaction_uuid,product_code,signed_field_names",
+	}
+	parts = nil
+	for _, name := range strings.Split(body["signed_field_names"], ",") {
+		parts = append(parts, name+"="+body[name])
+	}
+	body["signature"] = g.sign(strings.Join(parts, ","))
+	data, _ := json.Marshal(body)
+
+	req, err := g.ParseReturnURL(url.Values{"data": {base64.StdEncoding.EncodeToString(data)}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	req.Amount = amount
+	vresp, err := g.VerifyPayment(ctx, req)
+	if err != nil || !vresp.Success || vresp.OrderID != "O7" || !vresp.PaidAmount.Equals(amount) {
+		t.Errorf("Expected the redirect to verify, got %+v, %v", vresp, err)
+	}
+}
+
+func TestParseVerifyResponseStatuses(t *testing.T) {
+	g := New(&payment.GatewayConfig{}, nil).(*Gateway)
+	for status, want := range map[string]payment.PaymentStatus{
+		"COMPLETE":       payment.StatusCompleted,
+		"PENDING":        payment.StatusPending,
+		"FULL_REFUND":    payment.StatusRefunded,
+		"PARTIAL_REFUND": payment.StatusPartiallyRefunded,
+		"CANCELED":       payment.StatusCanceled,
+		"NOT_FOUND":      payment.StatusFailed,
+	} {
+		resp, err := g.parseVerifyResponse([]byte(`{"status":"`+status+`"}`), "R1", "O1", money.Money{})
+		if err != nil {
+			t.Fatalf("%s: %v", status, err)
+		}
+		if resp.Status != want {
+			t.Errorf("%s: expected %s, got %s", status, want, resp.Status)
+		}
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("transaction_uuid") != "O1" || q.Get("total_amount") != "100.00" || q.Get("product_code") != "EPAYTEST" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"status":"COMPLETE","ref_id":"R1","transaction_uuid":"O1","total_amount":100.0}`))
+	}))
+	defer srv.Close()
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL, MerchantID: "EPAYTEST"}, srv.Client())
+
+	amount := money.New(100, money.MustCurrency("NPR"))
+	resp, err := g.GetStatus(context.Background(), &payment.StatusRequest{OrderID: "O1", Amount: amount})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := &payment.StatusResponse{Status: payment.StatusCompleted, TransactionID: "R1", OrderID: "O1", Amount: amount}
+	paymenttest.AssertResponseEqual(t, want, resp)
+
+	if _, err := g.GetStatus(context.Background(), &payment.StatusRequest{TransactionID: "R1"}); !errors.Is(err, payment.ErrMissingVerificationData) {
+		t.Errorf("Expected ErrMissingVerificationData without the order and amount, got %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+)
+
+// fakePayment is a payment created by InitiatePayment
+type fakePayment struct {
+	id         string
+	orderID    string
+	amount     money.Money
+	refunded   money.Money
+	status     payment.PaymentStatus
+	successURL string
+	failureURL string
+}
+
+// Gateway is an in-memory payment.Gateway for local development. It runs
+// the whole redirect flow without a provider: InitiatePayment returns a URL
+// on the checkout page served by Handler, paying there redirects the
+// customer to the request's SuccessURL, and VerifyPayment then reports the
+// payment completed. BaseURL is where Handler is served, e.g.
+// "http://localhost:8080/fake".
+type Gateway struct {
+	config *payment.GatewayConfig
+
+	payments map[string]*fakePayment
+	mu       sync.Mutex
+	nextID   atomic.Int64
+}
+
+// New creates a fake gateway. It is always in sandbox mode, so
+// payment.DefaultSandboxAmounts trigger simulated failures.
+func New(config *payment.GatewayConfig, client *http.Client) payment.Gateway {
+	if config.BaseURL == "" {
+		config.BaseURL = "http://localhost:8080/fake"
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+	config.Sandbox = true
+	return &Gateway{config: config, payments: make(map[string]*fakePayment)}
+}
+
+func (f *Gateway) GetName() string   { return "Fake" }
+func (f *Gateway) GetMethod() string { return "fake" }
+
+// TestMode reports that the fake gateway never moves real money
+func (f *Gateway) TestMode() bool { return true }
+
+// Capabilities reports a redirect flow with partial refunds
+func (f *Gateway) Capabilities() payment.GatewayCapabilities {
+	return payment.GatewayCapabilities{
+		Flow:          payment.FlowRedirect,
+		Refund:        true,
+		PartialRefund: true,
+		StatusCheck:   true,
+	}
+}
+
+// ExtraConfigSchema reports that no gateway-specific ExtraConfig keys are used
+func (f *Gateway) ExtraConfigSchema() payment.ExtraConfigSchema { return nil }
+
+// InitiatePayment records a pending payment and returns its checkout URL
+func (f *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.PaymentResponse, error) {
+	if err := payment.SandboxError(f.config, f.GetMethod(), req.Amount); err != nil {
+		return nil, err
+	}
+	id := fmt.Sprintf("fake_%d_%d", f.config.Now().Unix(), f.nextID.Add(1))
+	f.mu.Lock()
+	f.payments[id] = &fakePayment{
+		id:         id,
+		orderID:    req.OrderID,
+		amount:     req.Amount,
+		status:     payment.StatusPending,
+		successURL: req.SuccessURL,
+		failureURL: req.FailureURL,
+	}
+	f.mu.Unlock()
+
+	return &payment.PaymentResponse{
+		Success:       true,
+		PaymentURL:    f.config.BaseURL + "/checkout/" + id,
+		TransactionID: id,
+		OrderID:       req.OrderID,
+		Message:       "Fake checkout created",
+	}, nil
+}
+
+// lookup returns a copy of the payment id
+func (f *Gateway) lookup(id string) (fakePayment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.payments[id]
+	if !ok {
+		return fakePayment{}, payment.NewPaymentError(payment.ErrKindNotFound, f.GetMethod(), "no payment "+id, nil)
+	}
+	return *p, nil
+}
+
+// RequiredVerificationFields reports that verification needs the transaction id
+func (f *Gateway) RequiredVerificationFields() []string {
+	return []string{"transaction_id"}
+}
+
+// VerifyPayment reports the payment's current status
+func (f *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRequest) (*payment.VerificationResponse, error) {
+	p, err := f.lookup(req.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+	opts := []payment.VerificationOption{
+		payment.WithStatus(p.status),
+		payment.WithTransactionID(p.id),
+		payment.WithOrderID(p.orderID),
+		payment.WithAmount(p.amount),
+		payment.WithCurrency(p.amount.Currency().Code),
+	}
+	if p.status == payment.StatusCanceled {
+		opts = append(opts, payment.WithDecline("canceled"), payment.WithMessage("Customer canceled the fake checkout"))
+	}
+	return payment.NewVerificationResponse(opts...), nil
+}
+
+// ParseReturnURL reads the redirect Handler sends the customer back with
+// (transaction_id, order_id)
+func (f *Gateway) ParseReturnURL(values url.Values) (*payment.VerificationRequest, error) {
+	id := values.Get("transaction_id")
+	if id == "" {
+		return nil, errors.New("fake: return URL is missing transaction_id")
+	}
+	return &payment.VerificationRequest{
+		TransactionID: id,
+		OrderID:       values.Get("order_id"),
+		RawData:       payment.ValuesToRawData(values),
+	}, nil
+}
+
+// RefundPayment refunds a completed payment. A zero amount refunds the
+// remaining balance.
+func (f *Gateway) RefundPayment(ctx context.Context, req *payment.RefundRequest) (*payment.RefundResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.payments[req.TransactionID]
+	if !ok {
+		return nil, payment.NewPaymentError(payment.ErrKindNotFound, f.GetMethod(), "no payment "+req.TransactionID, nil)
+	}
+	if p.status != payment.StatusCompleted && p.status != payment.StatusPartiallyRefunded {
+		return nil, payment.NewPaymentError(payment.ErrKindValidation, f.GetMethod(), "payment "+p.id+" is "+string(p.status), nil)
+	}
+
+	refunded := p.refunded
+	if refunded.Currency().Code == "" {
+		refunded = money.NewFromMinor(0, p.amount.Currency())
+	}
+	remaining, err := p.amount.Sub(refunded)
+	if err != nil {
+		return nil, err
+	}
+	amount := req.Amount
+	if amount.IsZero() {
+		amount = remaining
+	}
+	if cmp, err := amount.Cmp(remaining); err != nil || cmp > 0 {
+		return nil, fmt.Errorf("%w: fake: %s refundable", payment.ErrRefundExceedsCaptured, remaining)
+	}
+	if p.refunded, err = refunded.Add(amount); err != nil {
+		return nil, err
+	}
+	p.status = payment.StatusPartiallyRefunded
+	if p.refunded.Equals(p.amount) {
+		p.status = payment.StatusRefunded
+	}
+	return &payment.RefundResponse{
+		Success:  true,
+		RefundID: fmt.Sprintf("fake_refund_%d", f.nextID.Add(1)),
+		Message:  "Refunded " + amount.String(),
+	}, nil
+}
+
+// GetStatus reports the payment's current status
+func (f *Gateway) GetStatus(ctx context.Context, req *payment.StatusRequest) (*payment.StatusResponse, error) {
+	p, err := f.lookup(req.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+	return &payment.StatusResponse{
+		Status:        p.status,
+		TransactionID: p.id,
+		OrderID:       p.orderID,
+		Amount:        p.amount,
+	}, nil
+}
+
+// checkoutPage is the fake hosted payment page
+var checkoutPage = template.Must(template.New("checkout").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Fake checkout</title></head>
+<body>
+<h1>Fake checkout</h1>
+<p>Order {{.OrderID}}: {{.Amount}}</p>
+<form method="post">
+<button name="action" value="pay">Pay</button>
+<button name="action" value="cancel">Cancel</button>
+</form>
+</body>
+</html>
+`))
+
+// Handler serves the checkout pages at /checkout/{id}. Mount it at the path
+// of BaseURL, e.g.
+//
+//	mux.Handle("/fake/", http.StripPrefix("/fake", g.Handler()))
+//
+// Paying redirects to the request's SuccessURL and canceling to its
+// FailureURL, falling back to SuccessURL, with transaction_id and order_id
+// added to the query.
+func (f *Gateway) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /checkout/{id}", func(w http.ResponseWriter, r *http.Request) {
+		p, err := f.lookup(r.PathValue("id"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if p.status != payment.StatusPending {
+			http.Error(w, "payment is "+string(p.status), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		checkoutPage.Execute(w, map[string]string{"OrderID": p.orderID, "Amount": p.amount.String()})
+	})
+	mux.HandleFunc("POST /checkout/{id}", func(w http.ResponseWriter, r *http.Request) {
+		status := payment.StatusCompleted
+		if r.FormValue("action") == "cancel" {
+			status = payment.StatusCanceled
+		}
+		p, ok := f.complete(r.PathValue("id"), status)
+		if !ok {
+			http.Error(w, "payment is not pending", http.StatusConflict)
+			return
+		}
+		target := p.successURL
+		if status == payment.StatusCanceled && p.failureURL != "" {
+			target = p.failureURL
+		}
+		if target == "" {
+			w.Write([]byte("Payment " + string(status) + "\n"))
+			return
+		}
+		http.Redirect(w, r, returnURL(target, p), http.StatusSeeOther)
+	})
+	return mux
+}
+
+// complete moves a pending payment to status and returns it
+func (f *Gateway) complete(id string, status payment.PaymentStatus) (fakePayment, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.payments[id]
+	if !ok || p.status != payment.StatusPending {
+		return fakePayment{}, false
+	}
+	p.status = status
+	return *p, true
+}
+
+// returnURL adds the transaction and order ids to target's query
+func returnURL(target string, p fakePayment) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	q := u.Query()
+	q.Set("transaction_id", p.id)
+	q.Set("order_id", p.orderID)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
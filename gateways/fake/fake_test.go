@@ -0,0 +1,133 @@
+package fake
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+)
+
+// checkout serves g's checkout pages and returns a client that doesn't
+// follow redirects
+func checkout(t *testing.T) (*Gateway, *http.Client) {
+	t.Helper()
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL + "/fake/"}, nil).(*Gateway)
+	mux.Handle("/fake/", http.StripPrefix("/fake", g.Handler()))
+
+	client := srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return g, client
+}
+
+// submit posts action to the checkout page and returns the redirect target
+func submit(t *testing.T, client *http.Client, pageURL, action string) *url.URL {
+	t.Helper()
+	resp, err := client.PostForm(pageURL, url.Values{"action": {action}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect, got %d", resp.StatusCode)
+	}
+	target, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return target
+}
+
+func TestRedirectFlow(t *testing.T) {
+	g, client := checkout(t)
+	pm := payment.NewPaymentManager(0)
+	pm.RegisterGateway("fake", g)
+	ctx := context.Background()
+
+	amount := money.New(100, money.MustCurrency("USD"))
+	init, err := pm.InitiatePayment(ctx, "fake", &payment.PaymentRequest{
+		OrderID:    "O1",
+		Amount:     amount,
+		SuccessURL: "https://shop.example.com/success?cart=7",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !init.TestMode {
+		t.Error("Expected the fake gateway to report test mode")
+	}
+
+	resp, err := client.Get(init.PaymentURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("Expected the checkout page, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	target := submit(t, client, init.PaymentURL, "pay")
+	if target.Host != "shop.example.com" || target.Query().Get("cart") != "7" {
+		t.Errorf("Expected a redirect to the success URL, got %s", target)
+	}
+	vreq, err := g.ParseReturnURL(target.Query())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vresp, err := pm.VerifyPayment(ctx, "fake", vreq)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if vresp.Status != payment.StatusCompleted || vresp.OrderID != "O1" || !vresp.PaidAmount.Equals(amount) {
+		t.Errorf("Unexpected verification %+v", vresp)
+	}
+
+	// The page can't be paid twice
+	if resp, err := client.PostForm(init.PaymentURL, url.Values{"action": {"pay"}}); err != nil || resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected a conflict paying twice, got %v", resp.StatusCode)
+	}
+
+	if _, err := pm.RefundPayment(ctx, "fake", &payment.RefundRequest{TransactionID: init.TransactionID, Amount: money.New(40, money.MustCurrency("USD"))}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status, _ := g.GetStatus(ctx, &payment.StatusRequest{TransactionID: init.TransactionID}); status.Status != payment.StatusPartiallyRefunded {
+		t.Errorf("Expected partially refunded, got %s", status.Status)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	g, client := checkout(t)
+	ctx := context.Background()
+	init, err := g.InitiatePayment(ctx, &payment.PaymentRequest{
+		OrderID:    "O2",
+		Amount:     money.New(5, money.MustCurrency("NPR")),
+		SuccessURL: "https://shop.example.com/success",
+		FailureURL: "https://shop.example.com/failure",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := submit(t, client, init.PaymentURL, "cancel")
+	if target.Path != "/failure" {
+		t.Errorf("Expected a redirect to the failure URL, got %s", target)
+	}
+	vresp, err := g.VerifyPayment(ctx, &payment.VerificationRequest{TransactionID: init.TransactionID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vresp.Success || vresp.Status != payment.StatusCanceled {
+		t.Errorf("Expected a canceled payment, got %+v", vresp)
+	}
+
+	if _, err := g.VerifyPayment(ctx, &payment.VerificationRequest{TransactionID: "missing"}); payment.HTTPStatusForError(err) != http.StatusNotFound {
+		t.Errorf("Expected not found, got %v", err)
+	}
+}
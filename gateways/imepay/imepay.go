@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -20,6 +21,14 @@ import (
 type Gateway struct {
 	config *payment.GatewayConfig
 	client *http.Client
+	fields payment.FieldMap
+}
+
+// DefaultResponseFields are the IMEPay response field names. Override
+// entries with ExtraConfig["response_fields"].
+var DefaultResponseFields = payment.FieldMap{
+	"response_code": "ResponseCode",
+	"amount":        "Amount",
 }
 
 func New(config *payment.GatewayConfig, client *http.Client) payment.Gateway {
@@ -33,24 +42,65 @@ func New(config *payment.GatewayConfig, client *http.Client) payment.Gateway {
 	if config.Currency == "" {
 		config.Currency = "NPR"
 	}
-	return &Gateway{config: config, client: client}
+	return &Gateway{
+		config: config,
+		client: client,
+		fields: payment.ResponseFieldMap(config, DefaultResponseFields),
+	}
 }
 
 func (i *Gateway) GetName() string   { return "IMEPay" }
 func (i *Gateway) GetMethod() string { return "imepay" }
 
+// TestMode reports whether the gateway is configured for the sandbox
+func (i *Gateway) TestMode() bool { return i.config.Sandbox }
+
+// Capabilities reports that IMEPay needs the customer's wallet phone number
+// and has no refund API
+func (i *Gateway) Capabilities() payment.GatewayCapabilities {
+	return payment.GatewayCapabilities{Flow: payment.FlowRedirect, RequiresPhone: true, StatusCheck: true}
+}
+
+// SupportedCurrencies reports that IMEPay charges only NPR
+func (i *Gateway) SupportedCurrencies() []string { return []string{"NPR"} }
+
+// displayNames are the localized display names, keyed by locale
+var displayNames = map[string]string{
+	"ne": "आइएमई पे",
+}
+
+// GetDisplayName returns the display name for locale, falling back to GetName
+func (i *Gateway) GetDisplayName(locale string) string {
+	return payment.LocalizedName(displayNames, locale, i.GetName())
+}
+
+// ExtraConfigSchema lists the ExtraConfig keys IMEPay reads
+func (i *Gateway) ExtraConfigSchema() payment.ExtraConfigSchema {
+	return payment.ExtraConfigSchema{
+		{Name: payment.ExtraConfigResponseFields, Type: payment.ConfigStringMap, Description: "Overrides for DefaultResponseFields"},
+	}
+}
+
 func (i *Gateway) generateToken(data string) string {
 	h := sha256.New()
 	h.Write([]byte(data + i.config.SecretKey))
 	return strings.ToUpper(fmt.Sprintf("%x", h.Sum(nil)))
 }
 
+// SignatureBaseString returns the string hashed to initiate req. The secret
+// key is appended to it before hashing and is not included here.
+func (i *Gateway) SignatureBaseString(req *payment.PaymentRequest) string {
+	amount := req.Amount.Format(money.WithLocale(money.LocaleNeNP), money.WithoutComma(), money.WithoutSymbol())
+	return fmt.Sprintf("MerchantCode=%s,RefId=%s,TranAmount=%s", i.config.MerchantID, req.OrderID, amount)
+}
+
 func (i *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.PaymentResponse, error) {
 	amount := req.Amount.Format(money.WithLocale(money.LocaleNeNP), money.WithoutComma(), money.WithoutSymbol())
 	refID := req.OrderID
 
-	tokenData := fmt.Sprintf("MerchantCode=%s,RefId=%s,TranAmount=%s", i.config.MerchantID, refID, amount)
+	tokenData := i.SignatureBaseString(req)
 	token := i.generateToken(tokenData)
+	payment.LogSignature(i.config, i.GetMethod(), "initiate", []string{"MerchantCode", "RefId", "TranAmount"}, tokenData+i.config.SecretKey, token)
 
 	params := url.Values{}
 	params.Set("MerchantCode", i.config.MerchantID)
@@ -70,6 +120,11 @@ func (i *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentReque
 	}, nil
 }
 
+// RequiredVerificationFields reports that verification needs the Msisdn, RefId and TransactionId callback fields
+func (i *Gateway) RequiredVerificationFields() []string {
+	return []string{"Msisdn", "RefId", "TransactionId"}
+}
+
 func (i *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRequest) (*payment.VerificationResponse, error) {
 	msisdn := req.RawData["Msisdn"]
 	refID := req.RawData["RefId"]
@@ -77,6 +132,7 @@ func (i *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRe
 
 	tokenData := fmt.Sprintf("Msisdn=%s,RefId=%s,TransactionId=%s", msisdn, refID, txnID)
 	token := i.generateToken(tokenData)
+	payment.LogSignature(i.config, i.GetMethod(), "verify", []string{"Msisdn", "RefId", "TransactionId"}, tokenData+i.config.SecretKey, token)
 
 	payload := map[string]string{
 		"MerchantCode":  i.config.MerchantID,
@@ -87,8 +143,10 @@ func (i *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRe
 	}
 
 	jsonData, _ := json.Marshal(payload)
+	reconfirmURL := i.config.BaseURL + "/Reconfirm"
+	dbg := payment.NewDebugRequest(i.config, http.MethodPost, reconfirmURL, payload, tokenData+i.config.SecretKey)
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", i.config.BaseURL+"/Reconfirm", bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", reconfirmURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
@@ -96,33 +154,53 @@ func (i *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRe
 
 	resp, err := i.client.Do(httpReq)
 	if err != nil {
-		return nil, err
+		return nil, payment.WithDebugRequest(i.GetMethod(), payment.WrapTransportError(i.GetMethod(), err), dbg)
 	}
 	defer resp.Body.Close()
 
 	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+	if err := payment.DecodeJSONResponse(i.GetMethod(), resp, &result); err != nil {
+		return nil, payment.WithDebugRequest(i.GetMethod(), err, dbg)
 	}
 
 	status := payment.StatusFailed
-	if result["ResponseCode"] == "0" {
+	if result[i.fields.Get("response_code")] == "0" {
 		status = payment.StatusCompleted
 	}
 
-	var amount money.Money
-	if amt, ok := result["Amount"].(string); ok {
+	var paidAmount money.Money
+	if amt, ok := result[i.fields.Get("amount")].(string); ok {
 		if floatAmt, err := strconv.ParseFloat(amt, 64); err == nil {
-			amount = money.New(int64(floatAmt*100), money.MustCurrency(i.config.Currency))
+			paidAmount = money.NewFromFloat(floatAmt, money.MustCurrency(i.config.Currency))
 		}
 	}
 
-	return &payment.VerificationResponse{
-		Success:       status == payment.StatusCompleted,
-		Status:        status,
-		TransactionID: txnID,
-		OrderID:       refID,
+	return payment.NewVerificationResponse(
+		payment.WithStatus(status),
+		payment.WithTransactionID(txnID),
+		payment.WithOrderID(refID),
+		payment.WithAmount(req.Amount),
+		payment.WithPaidAmount(paidAmount),
+		payment.WithCurrency(i.config.Currency),
+	), nil
+}
+
+// ParseReturnURL reads IMEPay's response redirect (Msisdn, RefId, TransactionId)
+func (i *Gateway) ParseReturnURL(values url.Values) (*payment.VerificationRequest, error) {
+	if values.Get("RefId") == "" || values.Get("TransactionId") == "" {
+		return nil, errors.New("imepay: return URL is missing RefId or TransactionId")
+	}
+
+	var amount money.Money
+	if amt, err := strconv.ParseFloat(values.Get("TranAmount"), 64); err == nil {
+		amount = money.NewFromFloat(amt, money.MustCurrency(i.config.Currency))
+	}
+
+	return &payment.VerificationRequest{
+		TransactionID: values.Get("TransactionId"),
+		OrderID:       values.Get("RefId"),
 		Amount:        amount,
+		RawData:       payment.ValuesToRawData(values),
 	}, nil
 }
 
@@ -130,6 +208,34 @@ func (i *Gateway) RefundPayment(ctx context.Context, req *payment.RefundRequest)
 	return nil, errors.New("refund not implemented for IMEPay")
 }
 
-func (i *Gateway) GetStatus(ctx context.Context, txnID string) (*payment.StatusResponse, error) {
-	return nil, errors.New("status check requires additional data for IMEPay")
+// GetStatus reconfirms the payment, which IMEPay looks up by the callback's
+// Msisdn, RefId and TransactionId. They default to req.CustomerPhone,
+// req.OrderID and req.TransactionID.
+func (i *Gateway) GetStatus(ctx context.Context, req *payment.StatusRequest) (*payment.StatusResponse, error) {
+	raw := make(map[string]string, len(req.RawData)+3)
+	maps.Copy(raw, req.RawData)
+	if raw["Msisdn"] == "" {
+		raw["Msisdn"] = req.CustomerPhone
+	}
+	if raw["RefId"] == "" {
+		raw["RefId"] = req.OrderID
+	}
+	if raw["TransactionId"] == "" {
+		raw["TransactionId"] = req.TransactionID
+	}
+	vreq := &payment.VerificationRequest{TransactionID: req.TransactionID, OrderID: req.OrderID, RawData: raw}
+	if missing := vreq.MissingFields(i.RequiredVerificationFields()); len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", payment.ErrMissingVerificationData, strings.Join(missing, ", "))
+	}
+
+	vResp, err := i.VerifyPayment(ctx, vreq)
+	if err != nil {
+		return nil, err
+	}
+	return &payment.StatusResponse{
+		Status:        vResp.Status,
+		TransactionID: vResp.TransactionID,
+		OrderID:       vResp.OrderID,
+		Amount:        vResp.PaidAmount,
+	}, nil
 }
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/oarkflow/money"
 	"github.com/oarkflow/payment"
@@ -35,9 +37,34 @@ func New(config *payment.GatewayConfig, client *http.Client) payment.Gateway {
 func (k *Gateway) GetName() string   { return "Khalti" }
 func (k *Gateway) GetMethod() string { return "khalti" }
 
+// TestMode reports whether the gateway is configured for the sandbox
+func (k *Gateway) TestMode() bool { return k.config.Sandbox }
+
+// Capabilities reports that Khalti needs the customer's wallet phone number
+// and has no refund API
+func (k *Gateway) Capabilities() payment.GatewayCapabilities {
+	return payment.GatewayCapabilities{Flow: payment.FlowRedirect, RequiresPhone: true, StatusCheck: true}
+}
+
+// SupportedCurrencies reports that Khalti charges only NPR
+func (k *Gateway) SupportedCurrencies() []string { return []string{"NPR"} }
+
+// displayNames are the localized display names, keyed by locale
+var displayNames = map[string]string{
+	"ne": "खल्ती",
+}
+
+// GetDisplayName returns the display name for locale, falling back to GetName
+func (k *Gateway) GetDisplayName(locale string) string {
+	return payment.LocalizedName(displayNames, locale, k.GetName())
+}
+
+// ExtraConfigSchema reports that no gateway-specific ExtraConfig keys are used
+func (k *Gateway) ExtraConfigSchema() payment.ExtraConfigSchema { return nil }
+
 func (k *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.PaymentResponse, error) {
-	// Khalti expects amount in paisa (1 NPR = 100 paisa)
-	amountInPaisa := req.Amount.Amount()
+	// Khalti expects amount in paisa (1 NPR = 100 paisa), with no fractions
+	amountInPaisa := payment.AmountInMinorUnits(k.config, payment.RoundForDisplay(req.Amount))
 
 	payload := map[string]interface{}{
 		"return_url":          req.SuccessURL,
@@ -57,7 +84,10 @@ func (k *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentReque
 		return nil, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", k.config.BaseURL+"/epayment/initiate/", bytes.NewBuffer(jsonData))
+	initiateURL := k.config.BaseURL + "/epayment/initiate/"
+	dbg := payment.NewDebugRequest(k.config, http.MethodPost, initiateURL, debugParams(payload), "")
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", initiateURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
@@ -67,32 +97,54 @@ func (k *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentReque
 
 	resp, err := k.client.Do(httpReq)
 	if err != nil {
-		return nil, err
+		return nil, payment.WithDebugRequest(k.GetMethod(), payment.WrapTransportError(k.GetMethod(), err), dbg)
 	}
 	defer resp.Body.Close()
 
 	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+	if err := payment.DecodeJSONResponse(k.GetMethod(), resp, &result); err != nil {
+		return nil, payment.WithDebugRequest(k.GetMethod(), err, dbg)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("khalti error: %v", result)
+	paymentURL, _ := result["payment_url"].(string)
+	pidx, _ := result["pidx"].(string)
+	if paymentURL == "" || pidx == "" {
+		return nil, payment.WithDebugRequest(k.GetMethod(), errors.New("khalti: initiate response is missing payment_url or pidx"), dbg)
 	}
 
 	return &payment.PaymentResponse{
 		Success:       true,
-		PaymentURL:    result["payment_url"].(string),
-		TransactionID: result["pidx"].(string),
+		PaymentURL:    paymentURL,
+		TransactionID: pidx,
 		OrderID:       req.OrderID,
 	}, nil
 }
 
+// debugParams flattens a JSON payload for payment.NewDebugRequest
+func debugParams(payload map[string]interface{}) map[string]string {
+	params := make(map[string]string, len(payload))
+	for key, v := range payload {
+		params[key] = fmt.Sprint(v)
+	}
+	return params
+}
+
+// RequiredVerificationFields reports that verification needs the pidx
+func (k *Gateway) RequiredVerificationFields() []string {
+	return []string{"pidx|transaction_id"}
+}
+
 func (k *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRequest) (*payment.VerificationResponse, error) {
-	payload := map[string]string{"pidx": req.TransactionID}
+	pidx := req.TransactionID
+	if pidx == "" {
+		pidx = req.RawData["pidx"]
+	}
+	payload := map[string]string{"pidx": pidx}
 	jsonData, _ := json.Marshal(payload)
+	lookupURL := k.config.BaseURL + "/epayment/lookup/"
+	dbg := payment.NewDebugRequest(k.config, http.MethodPost, lookupURL, payload, "")
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", k.config.BaseURL+"/epayment/lookup/", bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", lookupURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
@@ -102,41 +154,105 @@ func (k *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRe
 
 	resp, err := k.client.Do(httpReq)
 	if err != nil {
-		return nil, err
+		return nil, payment.WithDebugRequest(k.GetMethod(), payment.WrapTransportError(k.GetMethod(), err), dbg)
 	}
 	defer resp.Body.Close()
 
+	body, err := payment.ReadResponseBody(k.GetMethod(), resp)
+	if err != nil {
+		return nil, payment.WithDebugRequest(k.GetMethod(), err, dbg)
+	}
+	vresp, err := k.parseVerifyResponse(body, pidx, req.Amount)
+	if err != nil {
+		return nil, payment.WithDebugRequest(k.GetMethod(), err, dbg)
+	}
+	if err := crossCheck(vresp, req, k.config.AmountTolerance); err != nil {
+		return vresp, err
+	}
+	return vresp, nil
+}
+
+// crossCheck fails vresp when the lookup is for a different order or amount
+// than req expects, beyond tolerance. Unknown values on either side are not
+// compared; Khalti's lookup response carries no purchase_order_id, so the
+// order is only checked when a response does report one. The manager binds
+// the pidx to the order it recorded at initiation.
+func crossCheck(vresp *payment.VerificationResponse, req *payment.VerificationRequest, tolerance payment.AmountTolerance) error {
+	var err error
+	if req.OrderID != "" && vresp.OrderID != "" && vresp.OrderID != req.OrderID {
+		err = fmt.Errorf("%w: khalti reported order %q, expected %q", payment.ErrOrderMismatch, vresp.OrderID, req.OrderID)
+	} else if !req.Amount.IsZero() && !vresp.PaidAmount.IsZero() && !tolerance.Allows(req.Amount, vresp.PaidAmount) {
+		err = fmt.Errorf("%w: khalti reported %s, expected %s", payment.ErrAmountMismatch, vresp.PaidAmount, req.Amount)
+	}
+	if err != nil {
+		vresp.Status = payment.StatusFailed
+		vresp.Success = false
+		vresp.Message = err.Error()
+	}
+	return err
+}
+
+// parseVerifyResponse builds the verification of pidx from a lookup
+// response body. amount is the amount we requested.
+func (k *Gateway) parseVerifyResponse(body []byte, pidx string, amount money.Money) (*payment.VerificationResponse, error) {
 	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, err
 	}
 
-	status := payment.StatusPending
-	if result["status"] == payment.StatusCompleted {
+	// Khalti reports capitalized statuses such as "Completed" and "Pending"
+	status := payment.StatusFailed
+	switch result["status"] {
+	case "Completed":
 		status = payment.StatusCompleted
-	} else if result["status"] == payment.StatusPending {
+	case "Pending", "Initiated":
 		status = payment.StatusPending
-	} else {
-		status = payment.StatusFailed
+	case "Refunded":
+		status = payment.StatusRefunded
+	case "Partially Refunded":
+		status = payment.StatusPartiallyRefunded
 	}
 
-	var amount money.Money
+	// Khalti reports total_amount in paisa
+	var paidAmount money.Money
 	if amt, ok := result["total_amount"].(float64); ok {
-		amount = money.New(int64(amt), money.MustCurrency(k.config.Currency))
+		paidAmount = payment.AmountFromMinorUnits(k.config, int64(amt), money.MustCurrency(k.config.Currency))
 	}
 
 	var fee money.Money
 	if feeAmt, ok := result["fee"].(float64); ok {
-		fee = money.New(int64(feeAmt), money.MustCurrency(k.config.Currency))
+		fee = payment.AmountFromMinorUnits(k.config, int64(feeAmt), money.MustCurrency(k.config.Currency))
+	}
+
+	orderID, _ := result["purchase_order_id"].(string)
+	return payment.NewVerificationResponse(
+		payment.WithStatus(status),
+		payment.WithTransactionID(pidx),
+		payment.WithOrderID(orderID),
+		payment.WithAmount(amount),
+		payment.WithPaidAmount(paidAmount),
+		payment.WithFee(fee),
+		payment.WithCurrency(k.config.Currency),
+	), nil
+}
+
+// ParseReturnURL reads Khalti's return redirect (pidx, purchase_order_id, amount in paisa)
+func (k *Gateway) ParseReturnURL(values url.Values) (*payment.VerificationRequest, error) {
+	pidx := values.Get("pidx")
+	if pidx == "" {
+		return nil, errors.New("khalti: return URL is missing pidx")
+	}
+
+	var amount money.Money
+	if amt, err := strconv.ParseInt(values.Get("amount"), 10, 64); err == nil {
+		amount = payment.AmountFromMinorUnits(k.config, amt, money.MustCurrency(k.config.Currency))
 	}
 
-	return &payment.VerificationResponse{
-		Success:       status == payment.StatusCompleted,
-		Status:        status,
-		TransactionID: req.TransactionID,
-		OrderID:       result["purchase_order_id"].(string),
+	return &payment.VerificationRequest{
+		TransactionID: pidx,
+		OrderID:       values.Get("purchase_order_id"),
 		Amount:        amount,
-		Fee:           fee,
+		RawData:       payment.ValuesToRawData(values),
 	}, nil
 }
 
@@ -144,9 +260,9 @@ func (k *Gateway) RefundPayment(ctx context.Context, req *payment.RefundRequest)
 	return nil, errors.New("refund not implemented for Khalti")
 }
 
-func (k *Gateway) GetStatus(ctx context.Context, txnID string) (*payment.StatusResponse, error) {
-	vReq := &payment.VerificationRequest{TransactionID: txnID}
-	vResp, err := k.VerifyPayment(context.Background(), vReq)
+func (k *Gateway) GetStatus(ctx context.Context, req *payment.StatusRequest) (*payment.StatusResponse, error) {
+	vReq := &payment.VerificationRequest{TransactionID: req.TransactionID, RawData: req.RawData}
+	vResp, err := k.VerifyPayment(ctx, vReq)
 	if err != nil {
 		return nil, err
 	}
@@ -154,6 +270,6 @@ func (k *Gateway) GetStatus(ctx context.Context, txnID string) (*payment.StatusR
 		Status:        vResp.Status,
 		TransactionID: vResp.TransactionID,
 		OrderID:       vResp.OrderID,
-		Amount:        vResp.Amount,
+		Amount:        vResp.PaidAmount,
 	}, nil
 }
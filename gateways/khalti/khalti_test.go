@@ -0,0 +1,227 @@
+package khalti
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+	"github.com/oarkflow/payment/internal/golden"
+	"github.com/oarkflow/payment/paymenttest"
+)
+
+// TestParseVerifyResponse checks parsing of recorded lookup responses against
+// testdata/*.golden. Run with -update after an intended schema change.
+func TestParseVerifyResponse(t *testing.T) {
+	g := New(&payment.GatewayConfig{}, nil).(*Gateway)
+	amount := money.New(10, money.MustCurrency("NPR"))
+
+	for _, name := range []string{"completed", "pending", "expired", "refunded", "partially_refunded"} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := g.parseVerifyResponse(golden.Fixture(t, "lookup_"+name+".json"), "HT6o6PEZRWFJ5ygavzHWd5", amount)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := resp.Validate(); err != nil {
+				t.Errorf("Invalid response: %v", err)
+			}
+			golden.AssertJSON(t, "lookup_"+name+".golden", resp)
+		})
+	}
+}
+
+func TestVerifyPaymentCrossChecks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(golden.Fixture(t, "lookup_completed.json"))
+	}))
+	defer srv.Close()
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL}, srv.Client())
+	npr := money.MustCurrency("NPR")
+
+	tests := []struct {
+		name    string
+		orderID string
+		amount  money.Money
+		want    error
+	}{
+		{"match", "O1", money.New(10, npr), nil},
+		{"unknown expectations", "", money.Money{}, nil},
+		{"unreported order", "O2", money.New(10, npr), nil},
+		{"other amount", "O1", money.New(20, npr), payment.ErrAmountMismatch},
+		{"other currency", "O1", money.New(10, money.MustCurrency("USD")), payment.ErrAmountMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := g.VerifyPayment(context.Background(), &payment.VerificationRequest{TransactionID: "pidx", OrderID: tt.orderID, Amount: tt.amount})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, err)
+			}
+			if want := tt.want == nil; resp.Success != want || (resp.Status == payment.StatusFailed) == want {
+				t.Errorf("Unexpected response %+v", resp)
+			}
+			if !resp.PaidAmount.Equals(money.New(10, npr)) {
+				t.Errorf("Expected paid amount 10 NPR, got %s", resp.PaidAmount)
+			}
+		})
+	}
+}
+
+// TestVerifyPaymentReportedOrder checks the order is compared when a
+// lookup response does report purchase_order_id
+func TestVerifyPaymentReportedOrder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"pidx":"pidx","total_amount":1000,"status":"Completed","purchase_order_id":"O1"}`))
+	}))
+	defer srv.Close()
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL}, srv.Client())
+	amount := money.New(10, money.MustCurrency("NPR"))
+
+	if _, err := g.VerifyPayment(context.Background(), &payment.VerificationRequest{TransactionID: "pidx", OrderID: "O1", Amount: amount}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	_, err := g.VerifyPayment(context.Background(), &payment.VerificationRequest{TransactionID: "pidx", OrderID: "O2", Amount: amount})
+	if !errors.Is(err, payment.ErrOrderMismatch) {
+		t.Errorf("Expected ErrOrderMismatch, got %v", err)
+	}
+}
+
+func TestVerifyPaymentAmountTolerance(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(golden.Fixture(t, "lookup_completed.json"))
+	}))
+	defer srv.Close()
+	npr := money.MustCurrency("NPR")
+	req := &payment.VerificationRequest{TransactionID: "pidx", OrderID: "O1", Amount: money.NewFromMinor(1001, npr)}
+
+	strict := New(&payment.GatewayConfig{BaseURL: srv.URL}, srv.Client())
+	if _, err := strict.VerifyPayment(context.Background(), req); !errors.Is(err, payment.ErrAmountMismatch) {
+		t.Errorf("Expected ErrAmountMismatch, got %v", err)
+	}
+	tolerant := New(&payment.GatewayConfig{BaseURL: srv.URL, AmountTolerance: payment.AmountTolerance{Minor: 1}}, srv.Client())
+	if resp, err := tolerant.VerifyPayment(context.Background(), req); err != nil || !resp.Success {
+		t.Errorf("Expected a paisa difference to verify, got %+v, %v", resp, err)
+	}
+}
+
+// TestRequests checks the exact requests sent to Khalti using an in-memory
+// transport
+func TestRequests(t *testing.T) {
+	npr := money.MustCurrency("NPR")
+	initiated := `{"pidx":"P1","payment_url":"https://pay.khalti.com/?pidx=P1"}`
+	header := http.Header{
+		"Authorization": {"Key secret"},
+		"Content-Type":  {"application/json"},
+	}
+
+	tests := []struct {
+		name     string
+		response string
+		call     func(g payment.Gateway) error
+		want     paymenttest.Request
+	}{
+		{
+			name:     "initiate",
+			response: initiated,
+			call: func(g payment.Gateway) error {
+				_, err := g.InitiatePayment(context.Background(), &payment.PaymentRequest{
+					OrderID:       "O1",
+					Amount:        money.New(1000, npr),
+					Description:   "Order 1",
+					SuccessURL:    "https://shop.example/success",
+					ReturnURL:     "https://shop.example",
+					CustomerName:  "Ram",
+					CustomerEmail: "ram@example.com",
+					CustomerPhone: "9800000001",
+				})
+				return err
+			},
+			want: paymenttest.Request{
+				Method: http.MethodPost,
+				URL:    "https://khalti.test/epayment/initiate/",
+				Header: header,
+				Body:   []byte(`{"amount":100000,"customer_info":{"email":"ram@example.com","name":"Ram","phone":"9800000001"},"purchase_order_id":"O1","purchase_order_name":"Order 1","return_url":"https://shop.example/success","website_url":"https://shop.example"}`),
+			},
+		},
+		{
+			name:     "initiate fractional amount",
+			response: initiated,
+			call: func(g payment.Gateway) error {
+				_, err := g.InitiatePayment(context.Background(), &payment.PaymentRequest{OrderID: "O2", Amount: money.NewFromFloat(12.5, npr)})
+				return err
+			},
+			want: paymenttest.Request{
+				Method: http.MethodPost,
+				URL:    "https://khalti.test/epayment/initiate/",
+				Header: header,
+				Body:   []byte(`{"amount":1250,"customer_info":{"email":"","name":"","phone":""},"purchase_order_id":"O2","purchase_order_name":"","return_url":"","website_url":""}`),
+			},
+		},
+		{
+			name:     "lookup",
+			response: string(golden.Fixture(t, "lookup_completed.json")),
+			call: func(g payment.Gateway) error {
+				_, err := g.VerifyPayment(context.Background(), &payment.VerificationRequest{TransactionID: "P1"})
+				return err
+			},
+			want: paymenttest.Request{
+				Method: http.MethodPost,
+				URL:    "https://khalti.test/epayment/lookup/",
+				Header: header,
+				Body:   []byte(`{"pidx":"P1"}`),
+			},
+		},
+		{
+			name:     "lookup from callback",
+			response: string(golden.Fixture(t, "lookup_completed.json")),
+			call: func(g payment.Gateway) error {
+				_, err := g.VerifyPayment(context.Background(), &payment.VerificationRequest{RawData: map[string]string{"pidx": "P2"}})
+				return err
+			},
+			want: paymenttest.Request{
+				Method: http.MethodPost,
+				URL:    "https://khalti.test/epayment/lookup/",
+				Header: header,
+				Body:   []byte(`{"pidx":"P2"}`),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &paymenttest.Transport{Handler: paymenttest.RespondJSON(http.StatusOK, tt.response)}
+			g := New(&payment.GatewayConfig{BaseURL: "https://khalti.test", SecretKey: "secret"}, tr.Client())
+			if err := tt.call(g); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			requests := tr.Requests()
+			if len(requests) != 1 {
+				t.Fatalf("Expected one request, got %d", len(requests))
+			}
+			got := requests[0]
+			if got.Method != tt.want.Method || got.URL != tt.want.URL {
+				t.Errorf("Expected %s %s, got %s %s", tt.want.Method, tt.want.URL, got.Method, got.URL)
+			}
+			if !reflect.DeepEqual(got.Header, tt.want.Header) {
+				t.Errorf("Expected headers %v, got %v", tt.want.Header, got.Header)
+			}
+			if string(got.Body) != string(tt.want.Body) {
+				t.Errorf("Expected body\n%s\ngot\n%s", tt.want.Body, got.Body)
+			}
+		})
+	}
+}
+
+func TestInitiatePaymentMalformedResponse(t *testing.T) {
+	for _, body := range []string{`{}`, `{"pidx":"P1"}`, `{"pidx":7,"payment_url":"https://pay.khalti.com/?pidx=P1"}`} {
+		tr := &paymenttest.Transport{Handler: paymenttest.RespondJSON(http.StatusOK, body)}
+		g := New(&payment.GatewayConfig{BaseURL: "https://khalti.test"}, tr.Client())
+		_, err := g.InitiatePayment(context.Background(), &payment.PaymentRequest{OrderID: "O1", Amount: money.New(10, money.MustCurrency("NPR"))})
+		if err == nil {
+			t.Errorf("%s: expected an error, not a panic or empty response", body)
+		}
+	}
+}
@@ -0,0 +1,481 @@
+package mpesa
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+)
+
+// Gateway implements payment.Gateway for Safaricom M-Pesa through the Daraja
+// STK Push API. MerchantID is the business short code, APIKey and SecretKey
+// the Daraja consumer key and secret.
+type Gateway struct {
+	config *payment.GatewayConfig
+	client *http.Client
+
+	token       string
+	tokenExpiry time.Time
+	tokenMu     sync.Mutex
+}
+
+// New creates a new M-Pesa gateway instance
+func New(config *payment.GatewayConfig, client *http.Client) payment.Gateway {
+	if config.BaseURL == "" {
+		if config.Sandbox {
+			config.BaseURL = "https://sandbox.safaricom.co.ke"
+		} else {
+			config.BaseURL = "https://api.safaricom.co.ke"
+		}
+	}
+	if config.Currency == "" {
+		config.Currency = "KES"
+	}
+	return &Gateway{config: config, client: client}
+}
+
+func (m *Gateway) GetName() string   { return "M-Pesa" }
+func (m *Gateway) GetMethod() string { return "mpesa" }
+
+// TestMode reports whether the gateway is configured for the sandbox
+func (m *Gateway) TestMode() bool { return m.config.Sandbox }
+
+// Capabilities reports that the customer approves an STK push on the phone
+// number in the request, and that refunds are not supported
+func (m *Gateway) Capabilities() payment.GatewayCapabilities {
+	return payment.GatewayCapabilities{Flow: payment.FlowPush, RequiresPhone: true, StatusCheck: true}
+}
+
+// SupportedCurrencies reports that M-Pesa charges only KES
+func (m *Gateway) SupportedCurrencies() []string { return []string{"KES"} }
+
+// ExtraConfigPasskey is the Lipa na M-Pesa Online passkey used to build the
+// request password. It is required.
+const ExtraConfigPasskey = "passkey"
+
+// ExtraConfigTransactionType selects "CustomerPayBillOnline" (the default)
+// for pay bill short codes or "CustomerBuyGoodsOnline" for till numbers
+const ExtraConfigTransactionType = "transaction_type"
+
+// ExtraConfigSchema lists the ExtraConfig keys M-Pesa reads
+func (m *Gateway) ExtraConfigSchema() payment.ExtraConfigSchema {
+	return payment.ExtraConfigSchema{
+		{Name: ExtraConfigPasskey, Type: payment.ConfigString, Description: "Lipa na M-Pesa Online passkey"},
+		{Name: ExtraConfigTransactionType, Type: payment.ConfigString, Description: `"CustomerPayBillOnline" or "CustomerBuyGoodsOnline"`},
+	}
+}
+
+func (m *Gateway) transactionType() string {
+	if t, ok := m.config.ExtraConfig[ExtraConfigTransactionType].(string); ok && t != "" {
+		return t
+	}
+	return "CustomerPayBillOnline"
+}
+
+// password returns the STK password for timestamp:
+// base64(shortcode + passkey + timestamp)
+func (m *Gateway) password(timestamp string) string {
+	passkey, _ := m.config.ExtraConfig[ExtraConfigPasskey].(string)
+	return base64.StdEncoding.EncodeToString([]byte(m.config.MerchantID + passkey + timestamp))
+}
+
+// timestamp returns t in Daraja's yyyyMMddHHmmss format, in Kenyan time
+func timestamp(t time.Time) string {
+	return t.In(time.FixedZone("EAT", 3*60*60)).Format("20060102150405")
+}
+
+// WholeShillings converts amount to the whole shillings M-Pesa charges.
+// Cents are truncated, not rounded: KES 100.99 converts to 100. Payments
+// with cents are rejected rather than undercharged; see HasCents.
+func WholeShillings(amount money.Money) int64 {
+	scale := int64(math.Pow10(int(amount.Currency().Decimals)))
+	return amount.Minor() / scale
+}
+
+// HasCents reports whether amount isn't a whole number of shillings, which
+// M-Pesa can't charge
+func HasCents(amount money.Money) bool {
+	scale := int64(math.Pow10(int(amount.Currency().Decimals)))
+	return amount.Minor()%scale != 0
+}
+
+// normalizePhone returns phone as M-Pesa expects it, 2547XXXXXXXX
+func normalizePhone(phone string) string {
+	phone = strings.NewReplacer(" ", "", "-", "").Replace(phone)
+	phone = strings.TrimPrefix(phone, "+")
+	if strings.HasPrefix(phone, "0") {
+		phone = "254" + phone[1:]
+	}
+	return phone
+}
+
+// phonePattern matches a normalized Safaricom number
+var phonePattern = regexp.MustCompile(`^254[17]\d{8}$`)
+
+// ValidateRequest checks that the customer phone is a Kenyan mobile number
+// and that the amount is a whole number of shillings, so the amount charged
+// is the amount recorded
+func (m *Gateway) ValidateRequest(req *payment.PaymentRequest) []payment.FieldError {
+	var fields []payment.FieldError
+	if req.CustomerPhone != "" && !phonePattern.MatchString(normalizePhone(req.CustomerPhone)) {
+		fields = append(fields, payment.FieldError{Field: "customer_phone", Message: "must be a Kenyan mobile number, e.g. 254712345678"})
+	}
+	if req.Amount.IsPositive() && HasCents(req.Amount) {
+		fields = append(fields, payment.FieldError{Field: "amount", Message: "must be a whole number of shillings"})
+	}
+	return fields
+}
+
+// accessToken returns a cached OAuth token, fetching a new one with the
+// consumer key and secret when it has expired
+func (m *Gateway) accessToken(ctx context.Context) (string, error) {
+	m.tokenMu.Lock()
+	defer m.tokenMu.Unlock()
+	if m.token != "" && m.config.Now().Before(m.tokenExpiry) {
+		return m.token, nil
+	}
+
+	tokenURL := m.config.BaseURL + "/oauth/v1/generate?grant_type=client_credentials"
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", tokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	httpReq.SetBasicAuth(m.config.APIKey, m.config.SecretKey)
+
+	resp, err := m.client.Do(httpReq)
+	if err != nil {
+		return "", payment.WrapTransportError(m.GetMethod(), err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	if err := payment.DecodeJSONResponse(m.GetMethod(), resp, &result); err != nil {
+		return "", err
+	}
+	if result.AccessToken == "" {
+		return "", errors.New("mpesa: token response is missing access_token")
+	}
+	expiresIn, err := result.ExpiresIn.Int64()
+	if err != nil || expiresIn <= 0 {
+		expiresIn = 3599
+	}
+	// Refresh a minute early so in-flight requests don't race the expiry
+	m.token = result.AccessToken
+	m.tokenExpiry = m.config.Now().Add(time.Duration(expiresIn)*time.Second - time.Minute)
+	return m.token, nil
+}
+
+// post sends payload to path with a bearer token and returns the status
+// code and body. Non-2xx responses are returned rather than turned into
+// errors, as the STK query reports pending payments with a 500.
+func (m *Gateway) post(ctx context.Context, path string, payload map[string]interface{}, dbg *payment.DebugRequest) (int, []byte, error) {
+	token, err := m.accessToken(ctx)
+	if err != nil {
+		return 0, nil, payment.WithDebugRequest(m.GetMethod(), err, dbg)
+	}
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", m.config.BaseURL+path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(httpReq)
+	if err != nil {
+		return 0, nil, payment.WithDebugRequest(m.GetMethod(), payment.WrapTransportError(m.GetMethod(), err), dbg)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, payment.WithDebugRequest(m.GetMethod(), err, dbg)
+	}
+	return resp.StatusCode, body, nil
+}
+
+// debugParams flattens a JSON payload for payment.NewDebugRequest
+func debugParams(payload map[string]interface{}) map[string]string {
+	params := make(map[string]string, len(payload))
+	for key, v := range payload {
+		params[key] = fmt.Sprint(v)
+	}
+	return params
+}
+
+// InitiatePayment sends an STK push to req.CustomerPhone. There is no
+// payment page: PaymentURL is empty and the customer approves the prompt
+// on their phone. Amounts with cents are rejected, as M-Pesa only charges
+// whole shillings.
+func (m *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.PaymentResponse, error) {
+	if req.CustomerPhone == "" {
+		return nil, payment.NewPaymentError(payment.ErrKindValidation, m.GetMethod(), "customer phone is required for STK push", nil)
+	}
+	if HasCents(req.Amount) {
+		return nil, payment.NewPaymentError(payment.ErrKindValidation, m.GetMethod(), "amount must be a whole number of shillings", nil)
+	}
+	amount := WholeShillings(req.Amount)
+	if amount < 1 {
+		return nil, payment.NewPaymentError(payment.ErrKindValidation, m.GetMethod(), "amount must be at least 1 shilling", nil)
+	}
+
+	ts := timestamp(m.config.Now())
+	phone := normalizePhone(req.CustomerPhone)
+	description := req.Description
+	if description == "" {
+		description = "Payment " + req.OrderID
+	}
+	payload := map[string]interface{}{
+		"BusinessShortCode": m.config.MerchantID,
+		"Password":          m.password(ts),
+		"Timestamp":         ts,
+		"TransactionType":   m.transactionType(),
+		"Amount":            amount,
+		"PartyA":            phone,
+		"PartyB":            m.config.MerchantID,
+		"PhoneNumber":       phone,
+		"CallBackURL":       req.WebhookURL,
+		"AccountReference":  req.OrderID,
+		"TransactionDesc":   description,
+	}
+	const path = "/mpesa/stkpush/v1/processrequest"
+	dbg := payment.NewDebugRequest(m.config, http.MethodPost, m.config.BaseURL+path, debugParams(payload), "")
+
+	status, body, err := m.post(ctx, path, payload, dbg)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		CheckoutRequestID   string `json:"CheckoutRequestID"`
+		MerchantRequestID   string `json:"MerchantRequestID"`
+		ResponseCode        string `json:"ResponseCode"`
+		ResponseDescription string `json:"ResponseDescription"`
+		CustomerMessage     string `json:"CustomerMessage"`
+		ErrorCode           string `json:"errorCode"`
+		ErrorMessage        string `json:"errorMessage"`
+	}
+	if status < 200 || status > 299 {
+		_ = json.Unmarshal(body, &result)
+		return nil, payment.WithDebugRequest(m.GetMethod(), payment.ErrorFromHTTPStatus(m.GetMethod(), status, fmt.Sprintf("mpesa error: %s %s", result.ErrorCode, result.ErrorMessage)), dbg)
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, payment.WithDebugRequest(m.GetMethod(), fmt.Errorf("mpesa: invalid STK push response: %w", err), dbg)
+	}
+	if result.ResponseCode != "0" || result.CheckoutRequestID == "" {
+		return &payment.PaymentResponse{
+			Success: false,
+			OrderID: req.OrderID,
+			Message: result.ResponseDescription,
+		}, nil
+	}
+
+	return &payment.PaymentResponse{
+		Success:       true,
+		TransactionID: result.CheckoutRequestID,
+		SessionID:     result.MerchantRequestID,
+		OrderID:       req.OrderID,
+		Message:       result.CustomerMessage,
+	}, nil
+}
+
+// RequiredVerificationFields reports that verification needs the
+// CheckoutRequestID returned by InitiatePayment
+func (m *Gateway) RequiredVerificationFields() []string {
+	return []string{"CheckoutRequestID|transaction_id"}
+}
+
+// VerifyPayment queries the STK push with the STK query API
+func (m *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRequest) (*payment.VerificationResponse, error) {
+	checkoutID := req.TransactionID
+	if checkoutID == "" {
+		checkoutID = req.RawData["CheckoutRequestID"]
+	}
+
+	ts := timestamp(m.config.Now())
+	payload := map[string]interface{}{
+		"BusinessShortCode": m.config.MerchantID,
+		"Password":          m.password(ts),
+		"Timestamp":         ts,
+		"CheckoutRequestID": checkoutID,
+	}
+	const path = "/mpesa/stkpushquery/v1/query"
+	dbg := payment.NewDebugRequest(m.config, http.MethodPost, m.config.BaseURL+path, debugParams(payload), "")
+
+	status, body, err := m.post(ctx, path, payload, dbg)
+	if err != nil {
+		return nil, err
+	}
+	vresp, err := m.parseVerifyResponse(status, body, checkoutID, req)
+	if err != nil {
+		return nil, payment.WithDebugRequest(m.GetMethod(), err, dbg)
+	}
+	return vresp, nil
+}
+
+// errProcessing is the STK query error code for a push the customer hasn't
+// answered yet
+const errProcessing = "500.001.1001"
+
+// resultCodes maps STK ResultCodes to payment statuses. Other codes are
+// failures.
+var resultCodes = map[string]payment.PaymentStatus{
+	"0":    payment.StatusCompleted,
+	"1032": payment.StatusCanceled, // request cancelled by user
+}
+
+// declineCodes maps STK ResultCodes to decline codes understood by
+// payment.NormalizeDeclineCode
+var declineCodes = map[string]string{
+	"1":    "insufficient_balance",
+	"1032": "payment_cancelled",
+	"1037": "authentication_failed", // no response from the phone
+	"2001": "incorrect_pin",
+}
+
+// parseVerifyResponse builds the verification of checkoutID from an STK
+// query response with the given HTTP status
+func (m *Gateway) parseVerifyResponse(status int, body []byte, checkoutID string, req *payment.VerificationRequest) (*payment.VerificationResponse, error) {
+	var result struct {
+		ResponseCode string      `json:"ResponseCode"`
+		ResultCode   json.Number `json:"ResultCode"`
+		ResultDesc   string      `json:"ResultDesc"`
+		ErrorCode    string      `json:"errorCode"`
+		ErrorMessage string      `json:"errorMessage"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil && status >= 200 && status <= 299 {
+		return nil, fmt.Errorf("mpesa: invalid STK query response: %w", err)
+	}
+
+	opts := []payment.VerificationOption{
+		payment.WithTransactionID(checkoutID),
+		payment.WithOrderID(req.OrderID),
+		payment.WithAmount(req.Amount),
+		payment.WithCurrency(m.config.Currency),
+	}
+	if result.ErrorCode == errProcessing {
+		opts = append(opts, payment.WithStatus(payment.StatusPending), payment.WithMessage(result.ErrorMessage))
+		return payment.NewVerificationResponse(opts...), nil
+	}
+	if status < 200 || status > 299 {
+		return nil, payment.ErrorFromHTTPStatus(m.GetMethod(), status, fmt.Sprintf("mpesa error: %s %s", result.ErrorCode, result.ErrorMessage))
+	}
+
+	code := result.ResultCode.String()
+	paymentStatus, ok := resultCodes[code]
+	if !ok {
+		paymentStatus = payment.StatusFailed
+	}
+	opts = append(opts, payment.WithStatus(paymentStatus), payment.WithMessage(result.ResultDesc))
+	if paymentStatus == payment.StatusCompleted {
+		paid, err := m.paidAmount(req)
+		if err != nil {
+			return nil, err
+		}
+		if paid.Currency().Code != "" {
+			opts = append(opts, payment.WithPaidAmount(paid))
+		}
+	}
+	if paymentStatus != payment.StatusCompleted {
+		decline, ok := declineCodes[code]
+		if !ok {
+			decline = code
+		}
+		opts = append(opts, payment.WithDecline(decline))
+	}
+	return payment.NewVerificationResponse(opts...), nil
+}
+
+// paidAmount returns the Amount M-Pesa reported in the STK callback, passed
+// in req.RawData by ParseCallback. The query doesn't echo the amount, so
+// without a callback it is what the push charged for req.Amount, if known.
+func (m *Gateway) paidAmount(req *payment.VerificationRequest) (money.Money, error) {
+	if value := req.RawData["Amount"]; value != "" {
+		paid, err := money.Parse(m.config.Currency + " " + value)
+		if err != nil {
+			return money.Money{}, fmt.Errorf("mpesa: invalid callback amount %q: %w", value, err)
+		}
+		return paid, nil
+	}
+	if req.Amount.Currency().Code == "" {
+		return money.Money{}, nil
+	}
+	return money.New(WholeShillings(req.Amount), req.Amount.Currency()), nil
+}
+
+// ParseCallback reads the STK Push result M-Pesa posts to the request's
+// WebhookURL into a verification request: TransactionID is the
+// CheckoutRequestID, and RawData holds ResultCode, ResultDesc and the
+// CallbackMetadata items, e.g. Amount and MpesaReceiptNumber
+func ParseCallback(body []byte) (*payment.VerificationRequest, error) {
+	var callback struct {
+		Body struct {
+			StkCallback struct {
+				CheckoutRequestID string      `json:"CheckoutRequestID"`
+				ResultCode        json.Number `json:"ResultCode"`
+				ResultDesc        string      `json:"ResultDesc"`
+				CallbackMetadata  struct {
+					Item []struct {
+						Name  string          `json:"Name"`
+						Value json.RawMessage `json:"Value"`
+					} `json:"Item"`
+				} `json:"CallbackMetadata"`
+			} `json:"stkCallback"`
+		} `json:"Body"`
+	}
+	if err := json.Unmarshal(body, &callback); err != nil {
+		return nil, fmt.Errorf("mpesa: invalid STK callback: %w", err)
+	}
+	result := callback.Body.StkCallback
+	if result.CheckoutRequestID == "" {
+		return nil, errors.New("mpesa: STK callback is missing CheckoutRequestID")
+	}
+	raw := map[string]string{
+		"CheckoutRequestID": result.CheckoutRequestID,
+		"ResultCode":        result.ResultCode.String(),
+		"ResultDesc":        result.ResultDesc,
+	}
+	// Amounts and phone numbers are JSON numbers, receipts strings
+	for _, item := range result.CallbackMetadata.Item {
+		var value string
+		if err := json.Unmarshal(item.Value, &value); err != nil {
+			value = string(item.Value)
+		}
+		raw[item.Name] = value
+	}
+	return &payment.VerificationRequest{TransactionID: result.CheckoutRequestID, RawData: raw}, nil
+}
+
+func (m *Gateway) RefundPayment(ctx context.Context, req *payment.RefundRequest) (*payment.RefundResponse, error) {
+	return nil, errors.New("refund not implemented for M-Pesa")
+}
+
+// GetStatus queries the STK push txnID, the CheckoutRequestID
+func (m *Gateway) GetStatus(ctx context.Context, req *payment.StatusRequest) (*payment.StatusResponse, error) {
+	vResp, err := m.VerifyPayment(ctx, &payment.VerificationRequest{TransactionID: req.TransactionID, RawData: req.RawData})
+	if err != nil {
+		return nil, err
+	}
+	return &payment.StatusResponse{
+		Status:        vResp.Status,
+		TransactionID: vResp.TransactionID,
+		OrderID:       vResp.OrderID,
+		Amount:        vResp.PaidAmount,
+	}, nil
+}
@@ -0,0 +1,189 @@
+package mpesa
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+)
+
+func TestWholeShillings(t *testing.T) {
+	kes := money.MustCurrency("KES")
+	tests := []struct {
+		amount money.Money
+		want   int64
+	}{
+		{money.New(100, kes), 100},
+		{money.NewFromMinor(10099, kes), 100},
+		{money.NewFromMinor(99, kes), 0},
+	}
+	for _, tt := range tests {
+		if got := WholeShillings(tt.amount); got != tt.want {
+			t.Errorf("WholeShillings(%s) = %d, want %d", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	g := New(&payment.GatewayConfig{}, nil).(*Gateway)
+	kes := money.MustCurrency("KES")
+	tests := []struct {
+		name   string
+		req    payment.PaymentRequest
+		fields []string
+	}{
+		{"valid", payment.PaymentRequest{Amount: money.New(1, kes), CustomerPhone: "+254 712 345678"}, nil},
+		{"local format", payment.PaymentRequest{Amount: money.New(1, kes), CustomerPhone: "0112345678"}, nil},
+		{"foreign phone", payment.PaymentRequest{Amount: money.New(1, kes), CustomerPhone: "+14155550100"}, []string{"customer_phone"}},
+		{"cents only", payment.PaymentRequest{Amount: money.NewFromMinor(99, kes), CustomerPhone: "0712345678"}, []string{"amount"}},
+		{"cents", payment.PaymentRequest{Amount: money.NewFromMinor(10099, kes), CustomerPhone: "0712345678"}, []string{"amount"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, f := range g.ValidateRequest(&tt.req) {
+			got = append(got, f.Field)
+		}
+		if !slices.Equal(got, tt.fields) {
+			t.Errorf("%s: invalid fields %v, want %v", tt.name, got, tt.fields)
+		}
+	}
+}
+
+// darajaStub serves the OAuth endpoint and answers STK requests with body
+// and status, recording the last STK payload
+func darajaStub(t *testing.T, status int, body string, last *map[string]interface{}) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/oauth/v1/generate" {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "key" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"access_token":"tok","expires_in":"3599"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			t.Errorf("Missing bearer token on %s", r.URL.Path)
+		}
+		if last != nil {
+			json.NewDecoder(r.Body).Decode(last)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestGateway(srv *httptest.Server) payment.Gateway {
+	return New(&payment.GatewayConfig{
+		BaseURL:     srv.URL,
+		MerchantID:  "174379",
+		APIKey:      "key",
+		SecretKey:   "secret",
+		ExtraConfig: map[string]interface{}{ExtraConfigPasskey: "passkey"},
+	}, srv.Client())
+}
+
+func TestInitiatePayment(t *testing.T) {
+	var sent map[string]interface{}
+	srv := darajaStub(t, http.StatusOK, `{"MerchantRequestID":"29115-34620561-1","CheckoutRequestID":"ws_CO_1","ResponseCode":"0","ResponseDescription":"Success. Request accepted for processing","CustomerMessage":"Success. Request accepted for processing"}`, &sent)
+	resp, err := newTestGateway(srv).InitiatePayment(context.Background(), &payment.PaymentRequest{
+		OrderID:       "O1",
+		Amount:        money.New(100, money.MustCurrency("KES")),
+		CustomerPhone: "0712 345678",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !resp.Success || resp.TransactionID != "ws_CO_1" || resp.PaymentURL != "" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+	if sent["Amount"] != float64(100) || sent["PhoneNumber"] != "254712345678" || sent["AccountReference"] != "O1" {
+		t.Errorf("Unexpected STK payload %v", sent)
+	}
+	password, _ := base64.StdEncoding.DecodeString(sent["Password"].(string))
+	if want := "174379passkey" + sent["Timestamp"].(string); string(password) != want {
+		t.Errorf("Password decodes to %q, want %q", password, want)
+	}
+
+	if _, err := newTestGateway(srv).InitiatePayment(context.Background(), &payment.PaymentRequest{OrderID: "O1", Amount: money.New(100, money.MustCurrency("KES"))}); payment.HTTPStatusForError(err) != http.StatusBadRequest {
+		t.Errorf("Expected a validation error without a phone, got %v", err)
+	}
+	// Charging KES 100 for a KES 100.99 order would undercharge it
+	if _, err := newTestGateway(srv).InitiatePayment(context.Background(), &payment.PaymentRequest{OrderID: "O1", Amount: money.NewFromMinor(10099, money.MustCurrency("KES")), CustomerPhone: "0712345678"}); payment.HTTPStatusForError(err) != http.StatusBadRequest {
+		t.Errorf("Expected a validation error for cents, got %v", err)
+	}
+}
+
+func TestVerifyPayment(t *testing.T) {
+	kes := money.MustCurrency("KES")
+	ctx := context.Background()
+	req := &payment.VerificationRequest{TransactionID: "ws_CO_1", Amount: money.New(100, kes)}
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   payment.PaymentStatus
+		reason payment.DeclineReason
+	}{
+		{"completed", http.StatusOK, `{"ResponseCode":"0","ResultCode":"0","ResultDesc":"The service request is processed successfully."}`, payment.StatusCompleted, ""},
+		{"canceled", http.StatusOK, `{"ResponseCode":"0","ResultCode":"1032","ResultDesc":"Request cancelled by user"}`, payment.StatusCanceled, payment.DeclineCanceled},
+		{"insufficient", http.StatusOK, `{"ResponseCode":"0","ResultCode":"1","ResultDesc":"The balance is insufficient for the transaction."}`, payment.StatusFailed, payment.DeclineInsufficientFunds},
+		{"processing", http.StatusInternalServerError, `{"requestId":"1","errorCode":"500.001.1001","errorMessage":"The transaction is being processed"}`, payment.StatusPending, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := newTestGateway(darajaStub(t, tt.status, tt.body, nil)).VerifyPayment(ctx, req)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if resp.Status != tt.want || resp.DeclineReason != tt.reason {
+				t.Errorf("Got %s (%s), want %s (%s)", resp.Status, resp.DeclineReason, tt.want, tt.reason)
+			}
+			if err := resp.Validate(); err != nil {
+				t.Errorf("Invalid response: %v", err)
+			}
+		})
+	}
+
+	srv := darajaStub(t, http.StatusServiceUnavailable, `{"errorCode":"503.001.01","errorMessage":"Service unavailable"}`, nil)
+	if _, err := newTestGateway(srv).VerifyPayment(ctx, req); payment.HTTPStatusForError(err) != http.StatusBadGateway {
+		t.Errorf("Expected a provider error, got %v", err)
+	}
+}
+
+func TestVerifyPaymentCallbackAmount(t *testing.T) {
+	callback := `{"Body":{"stkCallback":{"MerchantRequestID":"29115-34620561-1","CheckoutRequestID":"ws_CO_1","ResultCode":0,"ResultDesc":"The service request is processed successfully.",` +
+		`"CallbackMetadata":{"Item":[{"Name":"Amount","Value":99.00},{"Name":"MpesaReceiptNumber","Value":"NLJ7RT61SV"},{"Name":"PhoneNumber","Value":254712345678}]}}}}`
+	req, err := ParseCallback([]byte(callback))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if req.TransactionID != "ws_CO_1" || req.RawData["MpesaReceiptNumber"] != "NLJ7RT61SV" || req.RawData["PhoneNumber"] != "254712345678" {
+		t.Errorf("Unexpected verification request %+v", req)
+	}
+
+	kes := money.MustCurrency("KES")
+	req.Amount = money.New(100, kes)
+	srv := darajaStub(t, http.StatusOK, `{"ResponseCode":"0","ResultCode":"0","ResultDesc":"The service request is processed successfully."}`, nil)
+	resp, err := newTestGateway(srv).VerifyPayment(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := money.New(99, kes); !resp.PaidAmount.Equals(want) {
+		t.Errorf("Expected the reported %s, got %s", want, resp.PaidAmount)
+	}
+
+	if _, err := ParseCallback([]byte(`{"Body":{}}`)); err == nil {
+		t.Error("Expected an error for a callback without CheckoutRequestID")
+	}
+}
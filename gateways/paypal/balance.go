@@ -0,0 +1,92 @@
+package paypal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+)
+
+// balanceAmount is a PayPal money object
+type balanceAmount struct {
+	CurrencyCode string `json:"currency_code"`
+	Value        string `json:"value"`
+}
+
+// GetBalance retrieves the account balances from /v1/reporting/balances
+func (p *Gateway) GetBalance(ctx context.Context) ([]payment.Balance, error) {
+	balanceURL := p.config.BaseURL + "/v1/reporting/balances"
+	dbg := payment.NewDebugRequest(p.config, http.MethodGet, balanceURL, nil, "")
+
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return nil, payment.WithDebugRequest(p.GetMethod(), err, dbg)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", balanceURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, payment.WithDebugRequest(p.GetMethod(), payment.WrapTransportError(p.GetMethod(), err), dbg)
+	}
+	defer resp.Body.Close()
+
+	body, err := payment.ReadResponseBody(p.GetMethod(), resp)
+	if err != nil {
+		return nil, payment.WithDebugRequest(p.GetMethod(), err, dbg)
+	}
+	return parseBalance(body)
+}
+
+// parseBalance returns one Balance per currency, sorted by currency. Funds
+// PayPal withholds, e.g. for disputes, are reported as pending.
+func parseBalance(body []byte) ([]payment.Balance, error) {
+	var result struct {
+		Balances []struct {
+			Currency         string        `json:"currency"`
+			AvailableBalance balanceAmount `json:"available_balance"`
+			WithheldBalance  balanceAmount `json:"withheld_balance"`
+		} `json:"balances"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("paypal: invalid balance: %w", err)
+	}
+
+	balances := make([]payment.Balance, 0, len(result.Balances))
+	for _, b := range result.Balances {
+		available, err := parseAmount(b.Currency, b.AvailableBalance)
+		if err != nil {
+			return nil, err
+		}
+		pending, err := parseAmount(b.Currency, b.WithheldBalance)
+		if err != nil {
+			return nil, err
+		}
+		balances = append(balances, payment.Balance{Currency: b.Currency, Available: available, Pending: pending})
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].Currency < balances[j].Currency })
+	return balances, nil
+}
+
+// parseAmount parses a balance amount, which is zero in currency when
+// PayPal omits it
+func parseAmount(currency string, a balanceAmount) (money.Money, error) {
+	if a.Value == "" {
+		a = balanceAmount{CurrencyCode: currency, Value: "0"}
+	}
+	if a.CurrencyCode == "" {
+		a.CurrencyCode = currency
+	}
+	m, err := money.Parse(a.CurrencyCode + " " + a.Value)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("paypal: invalid amount %s %q: %w", a.CurrencyCode, a.Value, err)
+	}
+	return m, nil
+}
@@ -1,18 +1,31 @@
 package paypal
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/oarkflow/money"
 	"github.com/oarkflow/payment"
 )
 
-// Gateway implements payment.Gateway for PayPal
+// Gateway implements payment.Gateway for PayPal. APIKey and SecretKey are
+// the REST app's client id and secret.
 type Gateway struct {
 	config *payment.GatewayConfig
+	client *http.Client
+
+	token       string
+	tokenExpiry time.Time
+	tokenMu     sync.Mutex
 }
 
 // New creates a new PayPal gateway instance
@@ -27,58 +40,439 @@ func New(config *payment.GatewayConfig, client *http.Client) payment.Gateway {
 	if config.Currency == "" {
 		config.Currency = "USD"
 	}
-	return &Gateway{config: config}
+	return &Gateway{config: config, client: client}
 }
 
 func (p *Gateway) GetName() string   { return "PayPal" }
 func (p *Gateway) GetMethod() string { return "paypal" }
 
-// InitiatePayment initiates a payment through PayPal
+// TestMode reports whether the gateway is configured for the sandbox
+func (p *Gateway) TestMode() bool { return p.config.Sandbox }
+
+// Capabilities reports an approval redirect with order lookups and full or
+// partial refunds of the captured payment
+func (p *Gateway) Capabilities() payment.GatewayCapabilities {
+	return payment.GatewayCapabilities{
+		Flow:          payment.FlowRedirect,
+		Refund:        true,
+		PartialRefund: true,
+		StatusCheck:   true,
+	}
+}
+
+// supportedCurrencies are the currencies PayPal accepts payments in
+var supportedCurrencies = []string{
+	"AUD", "BRL", "CAD", "CHF", "CNY", "CZK", "DKK", "EUR", "GBP", "HKD",
+	"HUF", "ILS", "JPY", "MXN", "MYR", "NOK", "NZD", "PHP", "PLN", "SEK",
+	"SGD", "THB", "TWD", "USD",
+}
+
+// SupportedCurrencies returns the currencies PayPal accepts payments in
+func (p *Gateway) SupportedCurrencies() []string { return supportedCurrencies }
+
+// displayNames are the localized display names, keyed by locale
+var displayNames = map[string]string{
+	"ja": "ペイパル",
+	"zh": "贝宝",
+}
+
+// GetDisplayName returns the display name for locale, falling back to GetName
+func (p *Gateway) GetDisplayName(locale string) string {
+	return payment.LocalizedName(displayNames, locale, p.GetName())
+}
+
+// ExtraConfigSchema reports that no gateway-specific ExtraConfig keys are used
+func (p *Gateway) ExtraConfigSchema() payment.ExtraConfigSchema { return nil }
+
+// maxCustomID is the length limit of a purchase unit's custom_id
+const maxCustomID = 127
+
+// InitiatePayment creates an order with PayPal's Orders API and returns its
+// approval URL. Metadata is namespaced and sent as the purchase unit's
+// URL-encoded custom_id, PayPal's only free-form field, which must fit in
+// 127 characters.
 func (p *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.PaymentResponse, error) {
-	// In a real implementation, this would call PayPal's Orders API
-	orderID := fmt.Sprintf("PAYPAL-%d", time.Now().UnixNano())
-	paymentURL := fmt.Sprintf("%s/checkoutnow?token=%s", p.config.BaseURL, orderID)
+	if err := payment.SandboxError(p.config, p.GetMethod(), req.Amount); err != nil {
+		return nil, err
+	}
+	unit := map[string]interface{}{
+		"reference_id": req.OrderID,
+		"amount": balanceAmount{
+			CurrencyCode: req.Amount.Currency().Code,
+			Value:        payment.FormatAmount(req.Amount),
+		},
+	}
+	if md := payment.NamespaceMetadata(req.Metadata); md != nil {
+		values := url.Values{}
+		for k, v := range md {
+			values.Set(k, v)
+		}
+		customID := values.Encode()
+		if len(customID) > maxCustomID {
+			return nil, payment.NewPaymentError(payment.ErrKindValidation, p.GetMethod(),
+				fmt.Sprintf("metadata encodes to %d characters, over PayPal's custom_id limit of %d", len(customID), maxCustomID), nil)
+		}
+		unit["custom_id"] = customID
+	}
+	cancelURL := req.FailureURL
+	if cancelURL == "" {
+		cancelURL = req.SuccessURL
+	}
+	payload := map[string]interface{}{
+		"intent":         "CAPTURE",
+		"purchase_units": []interface{}{unit},
+		"application_context": map[string]string{
+			"return_url": req.SuccessURL,
+			"cancel_url": cancelURL,
+		},
+	}
+
+	body, err := p.call(ctx, http.MethodPost, "/v2/checkout/orders", payload, "")
+	if err != nil {
+		return nil, err
+	}
+	var order struct {
+		ID    string `json:"id"`
+		Links []struct {
+			Href string `json:"href"`
+			Rel  string `json:"rel"`
+		} `json:"links"`
+	}
+	if err := json.Unmarshal(body, &order); err != nil {
+		return nil, fmt.Errorf("paypal: invalid order: %w", err)
+	}
+	var approveURL string
+	for _, link := range order.Links {
+		if link.Rel == "approve" || link.Rel == "payer-action" {
+			approveURL = link.Href
+			break
+		}
+	}
+	if order.ID == "" || approveURL == "" {
+		return nil, errors.New("paypal: order response is missing id or approval link")
+	}
 
 	return &payment.PaymentResponse{
 		Success:       true,
-		PaymentURL:    paymentURL,
-		TransactionID: orderID,
+		PaymentURL:    approveURL,
+		TransactionID: order.ID,
 		OrderID:       req.OrderID,
 		Message:       "PayPal order created successfully",
 	}, nil
 }
 
-// VerifyPayment verifies a payment with PayPal
+// RequiredVerificationFields reports that verification needs the transaction id
+func (p *Gateway) RequiredVerificationFields() []string {
+	return []string{"transaction_id"}
+}
+
+// VerifyPayment looks the order up and captures it once the payer has
+// approved it. The capture is sent with a PayPal-Request-Id derived from
+// the order id, so a retried verification returns the first capture rather
+// than failing or charging again. Status, paid amount and metadata come
+// from PayPal's order, never from the redirect.
 func (p *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRequest) (*payment.VerificationResponse, error) {
-	// In a real implementation, this would call PayPal's Orders API to capture the payment
-	return &payment.VerificationResponse{
-		Success:       true,
-		Status:        payment.StatusCompleted,
-		TransactionID: req.TransactionID,
-		OrderID:       req.OrderID,
-		Amount:        req.Amount,
-		PaidAmount:    req.Amount,
-		Message:       "Payment captured successfully",
+	orderPath := "/v2/checkout/orders/" + url.PathEscape(req.TransactionID)
+	body, err := p.call(ctx, http.MethodGet, orderPath, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	var o order
+	if err := json.Unmarshal(body, &o); err != nil {
+		return nil, fmt.Errorf("paypal: invalid order: %w", err)
+	}
+	if o.Status == "APPROVED" {
+		if body, err = p.call(ctx, http.MethodPost, orderPath+"/capture", struct{}{}, "capture-"+req.TransactionID); err != nil {
+			return nil, err
+		}
+		o = order{}
+		if err := json.Unmarshal(body, &o); err != nil {
+			return nil, fmt.Errorf("paypal: invalid capture: %w", err)
+		}
+	}
+	return parseVerifyResponse(&o)
+}
+
+// order is the part of a PayPal order verification and refunds read
+type order struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	PurchaseUnits []struct {
+		ReferenceID string        `json:"reference_id"`
+		CustomID    string        `json:"custom_id"`
+		Amount      balanceAmount `json:"amount"`
+		Payments    struct {
+			Captures []capture `json:"captures"`
+		} `json:"payments"`
+	} `json:"purchase_units"`
+}
+
+// capture is a captured payment of an order
+type capture struct {
+	ID       string        `json:"id"`
+	Status   string        `json:"status"`
+	Amount   balanceAmount `json:"amount"`
+	CustomID string        `json:"custom_id"`
+}
+
+// captureStatuses maps PayPal capture statuses to payment statuses
+var captureStatuses = map[string]payment.PaymentStatus{
+	"COMPLETED":          payment.StatusCompleted,
+	"PENDING":            payment.StatusPending,
+	"DECLINED":           payment.StatusFailed,
+	"FAILED":             payment.StatusFailed,
+	"REFUNDED":           payment.StatusRefunded,
+	"PARTIALLY_REFUNDED": payment.StatusPartiallyRefunded,
+}
+
+// parseVerifyResponse builds the verification of o from its first purchase
+// unit. Until the order has a capture its status is the order's; once
+// captured it is the capture's, and PaidAmount is the captured amount.
+func parseVerifyResponse(o *order) (*payment.VerificationResponse, error) {
+	if len(o.PurchaseUnits) == 0 {
+		return nil, fmt.Errorf("paypal: order %s has no purchase units", o.ID)
+	}
+	unit := o.PurchaseUnits[0]
+	amount, err := parseAmount(unit.Amount.CurrencyCode, unit.Amount)
+	if err != nil {
+		return nil, err
+	}
+	opts := []payment.VerificationOption{
+		payment.WithTransactionID(o.ID),
+		payment.WithOrderID(unit.ReferenceID),
+		payment.WithAmount(amount),
+		payment.WithCurrency(amount.Currency().Code),
+	}
+
+	customID := unit.CustomID
+	if captures := unit.Payments.Captures; len(captures) > 0 {
+		c := captures[0]
+		status, ok := captureStatuses[c.Status]
+		if !ok {
+			status = payment.StatusPending
+		}
+		paid, err := parseAmount(amount.Currency().Code, c.Amount)
+		if err != nil {
+			return nil, err
+		}
+		if c.CustomID != "" {
+			customID = c.CustomID
+		}
+		opts = append(opts, payment.WithStatus(status), payment.WithPaidAmount(paid),
+			payment.WithMessage("Capture "+strings.ToLower(c.Status)))
+	} else {
+		status, ok := orderStatuses[o.Status]
+		if !ok {
+			status = payment.StatusPending
+		}
+		opts = append(opts, payment.WithStatus(status), payment.WithMessage("Order "+strings.ToLower(o.Status)))
+	}
+
+	if customID != "" {
+		values, err := url.ParseQuery(customID)
+		if err != nil {
+			return nil, fmt.Errorf("paypal: invalid custom_id %q: %w", customID, err)
+		}
+		opts = append(opts, payment.WithMetadata(payment.StripMetadataNamespace(payment.ValuesToRawData(values))))
+	}
+	return payment.NewVerificationResponse(opts...), nil
+}
+
+// ParseReturnURL reads PayPal's approval redirect (token, PayerID)
+func (p *Gateway) ParseReturnURL(values url.Values) (*payment.VerificationRequest, error) {
+	token := values.Get("token")
+	if token == "" {
+		return nil, errors.New("paypal: return URL is missing token")
+	}
+	return &payment.VerificationRequest{
+		TransactionID: token,
+		RawData:       payment.ValuesToRawData(values),
 	}, nil
 }
 
-// RefundPayment processes a refund through PayPal
+// RefundPayment refunds the capture of order req.TransactionID, in full
+// when req.Amount is zero
 func (p *Gateway) RefundPayment(ctx context.Context, req *payment.RefundRequest) (*payment.RefundResponse, error) {
-	// In a real implementation, this would call PayPal's refund API
+	body, err := p.call(ctx, http.MethodGet, "/v2/checkout/orders/"+url.PathEscape(req.TransactionID), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	var o order
+	if err := json.Unmarshal(body, &o); err != nil {
+		return nil, fmt.Errorf("paypal: invalid order: %w", err)
+	}
+	if len(o.PurchaseUnits) == 0 || len(o.PurchaseUnits[0].Payments.Captures) == 0 {
+		return nil, payment.NewPaymentError(payment.ErrKindValidation, p.GetMethod(),
+			fmt.Sprintf("order %s has not been captured", req.TransactionID), nil)
+	}
+	captureID := o.PurchaseUnits[0].Payments.Captures[0].ID
+
+	payload := map[string]interface{}{}
+	if !req.Amount.IsZero() {
+		payload["amount"] = balanceAmount{
+			CurrencyCode: req.Amount.Currency().Code,
+			Value:        payment.FormatAmount(req.Amount),
+		}
+	}
+	if req.Reason != "" {
+		payload["note_to_payer"] = req.Reason
+	}
+	if body, err = p.call(ctx, http.MethodPost, "/v2/payments/captures/"+url.PathEscape(captureID)+"/refund", payload, ""); err != nil {
+		return nil, err
+	}
+	var refund struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &refund); err != nil {
+		return nil, fmt.Errorf("paypal: invalid refund: %w", err)
+	}
 	return &payment.RefundResponse{
-		Success:  true,
-		RefundID: fmt.Sprintf("REF-%d", time.Now().UnixNano()),
-		Message:  "Refund processed successfully",
+		Success:  refund.Status != "FAILED" && refund.Status != "CANCELLED",
+		RefundID: refund.ID,
+		Message:  "Refund " + strings.ToLower(refund.Status),
 	}, nil
 }
 
-// GetStatus retrieves the status of a payment from PayPal
-func (p *Gateway) GetStatus(ctx context.Context, txnID string) (*payment.StatusResponse, error) {
-	// In a real implementation, this would call PayPal's Orders API to get order details
-	amount:= money.New(0, money.MustCurrency(p.config.Currency))
+// call sends payload, if any, as JSON to path with the OAuth token and
+// returns the response body. A non-empty requestID is sent as the
+// PayPal-Request-Id header, which makes retries of the call idempotent.
+func (p *Gateway) call(ctx context.Context, method, path string, payload interface{}, requestID string) ([]byte, error) {
+	endpoint := p.config.BaseURL + path
+	dbg := payment.NewDebugRequest(p.config, method, endpoint, nil, "")
+
+	var reqBody io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(jsonData)
+	}
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return nil, payment.WithDebugRequest(p.GetMethod(), err, dbg)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, endpoint, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if requestID != "" {
+		httpReq.Header.Set("PayPal-Request-Id", requestID)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, payment.WithDebugRequest(p.GetMethod(), payment.WrapTransportError(p.GetMethod(), err), dbg)
+	}
+	defer resp.Body.Close()
+	body, err := payment.ReadResponseBody(p.GetMethod(), resp)
+	if err != nil {
+		return nil, payment.WithDebugRequest(p.GetMethod(), err, dbg)
+	}
+	return body, nil
+}
+
+// accessToken returns a cached OAuth token, fetching a new one with the
+// client id and secret when it has expired
+func (p *Gateway) accessToken(ctx context.Context) (string, error) {
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+	if p.token != "" && p.config.Now().Before(p.tokenExpiry) {
+		return p.token, nil
+	}
+
+	tokenURL := p.config.BaseURL + "/v1/oauth2/token"
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		return "", err
+	}
+	httpReq.SetBasicAuth(p.config.APIKey, p.config.SecretKey)
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return "", payment.WrapTransportError(p.GetMethod(), err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := payment.DecodeJSONResponse(p.GetMethod(), resp, &result); err != nil {
+		return "", err
+	}
+	if result.AccessToken == "" {
+		return "", errors.New("paypal: token response is missing access_token")
+	}
+	if result.ExpiresIn <= 0 {
+		result.ExpiresIn = 3600
+	}
+	// Refresh a minute early so in-flight requests don't race the expiry
+	p.token = result.AccessToken
+	p.tokenExpiry = p.config.Now().Add(time.Duration(result.ExpiresIn)*time.Second - time.Minute)
+	return p.token, nil
+}
+
+// GetStatus retrieves the order from PayPal's Orders API
+func (p *Gateway) GetStatus(ctx context.Context, req *payment.StatusRequest) (*payment.StatusResponse, error) {
+	body, err := p.call(ctx, http.MethodGet, "/v2/checkout/orders/"+url.PathEscape(req.TransactionID), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return parseStatusResponse(body)
+}
+
+// orderStatuses maps PayPal order statuses to payment statuses. Approved
+// orders still have to be captured.
+var orderStatuses = map[string]payment.PaymentStatus{
+	"CREATED":               payment.StatusPending,
+	"SAVED":                 payment.StatusPending,
+	"APPROVED":              payment.StatusPending,
+	"PAYER_ACTION_REQUIRED": payment.StatusRequiresAction,
+	"COMPLETED":             payment.StatusCompleted,
+	"VOIDED":                payment.StatusCanceled,
+}
+
+// parseStatusResponse builds the status of an order. The amount is the
+// first purchase unit's, in its currency.
+func parseStatusResponse(body []byte) (*payment.StatusResponse, error) {
+	var order struct {
+		ID            string `json:"id"`
+		Status        string `json:"status"`
+		PurchaseUnits []struct {
+			ReferenceID string `json:"reference_id"`
+			Amount      struct {
+				CurrencyCode string `json:"currency_code"`
+				Value        string `json:"value"`
+			} `json:"amount"`
+		} `json:"purchase_units"`
+	}
+	if err := json.Unmarshal(body, &order); err != nil {
+		return nil, fmt.Errorf("paypal: invalid order: %w", err)
+	}
+	if len(order.PurchaseUnits) == 0 {
+		return nil, fmt.Errorf("paypal: order %s has no purchase units", order.ID)
+	}
+	unit := order.PurchaseUnits[0]
+	amount, err := money.Parse(unit.Amount.CurrencyCode + " " + unit.Amount.Value)
+	if err != nil {
+		return nil, fmt.Errorf("paypal: invalid amount %s %q: %w", unit.Amount.CurrencyCode, unit.Amount.Value, err)
+	}
+
+	status, ok := orderStatuses[order.Status]
+	if !ok {
+		status = payment.StatusPending
+	}
 	return &payment.StatusResponse{
-		Status:        payment.StatusCompleted,
-		TransactionID: txnID,
+		Status:        status,
+		TransactionID: order.ID,
+		OrderID:       unit.ReferenceID,
 		Amount:        amount,
 	}, nil
 }
@@ -0,0 +1,200 @@
+package paypal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+)
+
+func TestGetStatus(t *testing.T) {
+	tokens := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v1/oauth2/token" {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "client" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			tokens++
+			w.Write([]byte(`{"access_token":"tok","token_type":"Bearer","expires_in":32400}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/checkout/orders/5O190127TN364715T":
+			w.Write([]byte(`{"id":"5O190127TN364715T","status":"COMPLETED","purchase_units":[{"reference_id":"O1","amount":{"currency_code":"EUR","value":"12.34"}}]}`))
+		case "/v2/checkout/orders/8AB1":
+			w.Write([]byte(`{"id":"8AB1","status":"APPROVED","purchase_units":[{"reference_id":"O2","amount":{"currency_code":"JPY","value":"1500"}}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"name":"RESOURCE_NOT_FOUND"}`))
+		}
+	}))
+	defer srv.Close()
+
+	// The configured currency is USD; each order's currency wins
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL, APIKey: "client", SecretKey: "secret"}, srv.Client())
+	tests := []struct {
+		id     string
+		status payment.PaymentStatus
+		order  string
+		amount money.Money
+	}{
+		{"5O190127TN364715T", payment.StatusCompleted, "O1", money.NewFromMinor(1234, money.MustCurrency("EUR"))},
+		{"8AB1", payment.StatusPending, "O2", money.New(1500, money.MustCurrency("JPY"))},
+	}
+	for _, tt := range tests {
+		status, err := g.GetStatus(context.Background(), &payment.StatusRequest{TransactionID: tt.id})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.id, err)
+		}
+		if status.Status != tt.status || status.TransactionID != tt.id || status.OrderID != tt.order || !status.Amount.Equals(tt.amount) {
+			t.Errorf("%s: unexpected status %+v, want %s %s", tt.id, status, tt.status, tt.amount)
+		}
+	}
+	if tokens != 1 {
+		t.Errorf("Expected the token to be cached, fetched %d times", tokens)
+	}
+
+	if _, err := g.GetStatus(context.Background(), &payment.StatusRequest{TransactionID: "missing"}); payment.HTTPStatusForError(err) != http.StatusNotFound {
+		t.Errorf("Expected not found, got %v", err)
+	}
+}
+
+// orderStub serves PayPal's token endpoint and order O1 for order 5O1,
+// which is approved until it is captured
+func orderStub(t *testing.T, captureIDs *[]string) *httptest.Server {
+	const unit = `"reference_id":"O1","custom_id":"m_cart=C9","amount":{"currency_code":"USD","value":"12.34"}`
+	captured := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/oauth2/token":
+			w.Write([]byte(`{"access_token":"tok","expires_in":32400}`))
+		case "GET /v2/checkout/orders/5O1":
+			if !captured {
+				w.Write([]byte(`{"id":"5O1","status":"APPROVED","purchase_units":[{` + unit + `}]}`))
+				return
+			}
+			fallthrough
+		case "POST /v2/checkout/orders/5O1/capture":
+			if r.Method == http.MethodPost {
+				*captureIDs = append(*captureIDs, r.Header.Get("PayPal-Request-Id"))
+				captured = true
+			}
+			w.Write([]byte(`{"id":"5O1","status":"COMPLETED","purchase_units":[{` + unit + `,
+				"payments":{"captures":[{"id":"CAP1","status":"COMPLETED","amount":{"currency_code":"USD","value":"12.00"}}]}}]}`))
+		case "GET /v2/checkout/orders/CREATED1":
+			w.Write([]byte(`{"id":"CREATED1","status":"CREATED","purchase_units":[{` + unit + `}]}`))
+		case "POST /v2/payments/captures/CAP1/refund":
+			var body map[string]any
+			json.NewDecoder(r.Body).Decode(&body)
+			if amount, _ := body["amount"].(map[string]any); amount["value"] != "5.00" || body["note_to_payer"] != "damaged" {
+				t.Errorf("Unexpected refund %v", body)
+			}
+			w.Write([]byte(`{"id":"REF1","status":"COMPLETED"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"name":"RESOURCE_NOT_FOUND"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestVerifyPaymentCaptures(t *testing.T) {
+	var captureIDs []string
+	srv := orderStub(t, &captureIDs)
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL}, srv.Client())
+	ctx := context.Background()
+
+	// The redirect's metadata is ignored; the order's custom_id is used
+	req := &payment.VerificationRequest{TransactionID: "5O1", RawData: map[string]string{"m_cart": "forged"}}
+	resp, err := g.VerifyPayment(ctx, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	usd := money.MustCurrency("USD")
+	if resp.Status != payment.StatusCompleted || resp.OrderID != "O1" || !resp.Amount.Equals(money.NewFromMinor(1234, usd)) ||
+		!resp.PaidAmount.Equals(money.NewFromMinor(1200, usd)) || resp.Metadata["cart"] != "C9" {
+		t.Errorf("Unexpected verification %+v", resp)
+	}
+
+	// A repeated verification reads the captured order instead of capturing
+	if _, err := g.VerifyPayment(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(captureIDs) != 1 || captureIDs[0] != "capture-5O1" {
+		t.Errorf("Expected one capture with a request id, got %q", captureIDs)
+	}
+
+	// An order the payer hasn't approved is not paid, whatever the return
+	// URL claims
+	resp, err = g.VerifyPayment(ctx, &payment.VerificationRequest{TransactionID: "CREATED1"})
+	if err != nil || resp.Success || resp.Status != payment.StatusPending {
+		t.Errorf("Expected a pending order, got %+v, %v", resp, err)
+	}
+}
+
+func TestRefundPayment(t *testing.T) {
+	var captureIDs []string
+	srv := orderStub(t, &captureIDs)
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL}, srv.Client())
+	ctx := context.Background()
+
+	refund := &payment.RefundRequest{TransactionID: "5O1", Amount: money.New(5, money.MustCurrency("USD")), Reason: "damaged"}
+	if _, err := g.RefundPayment(ctx, refund); payment.HTTPStatusForError(err) != http.StatusBadRequest {
+		t.Errorf("Expected an uncaptured order to be rejected, got %v", err)
+	}
+	if _, err := g.VerifyPayment(ctx, &payment.VerificationRequest{TransactionID: "5O1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp, err := g.RefundPayment(ctx, refund)
+	if err != nil || !resp.Success || resp.RefundID != "REF1" {
+		t.Errorf("Unexpected refund %+v, %v", resp, err)
+	}
+}
+
+func TestGetBalance(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/v1/oauth2/token":
+			w.Write([]byte(`{"access_token":"tok","expires_in":32400}`))
+		case r.URL.Path == "/v1/reporting/balances" && r.Header.Get("Authorization") == "Bearer tok":
+			w.Write([]byte(`{"balances":[` +
+				`{"currency":"USD","primary":true,"total_balance":{"currency_code":"USD","value":"130.50"},"available_balance":{"currency_code":"USD","value":"120.50"},"withheld_balance":{"currency_code":"USD","value":"10.00"}},` +
+				`{"currency":"EUR","total_balance":{"currency_code":"EUR","value":"7.00"},"available_balance":{"currency_code":"EUR","value":"7.00"}}]}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL, APIKey: "client", SecretKey: "secret"}, srv.Client()).(*Gateway)
+	balances, err := g.GetBalance(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	eur, usd := money.MustCurrency("EUR"), money.MustCurrency("USD")
+	want := []payment.Balance{
+		{Currency: "EUR", Available: money.NewFromMinor(700, eur), Pending: money.NewFromMinor(0, eur)},
+		{Currency: "USD", Available: money.NewFromMinor(12050, usd), Pending: money.NewFromMinor(1000, usd)},
+	}
+	if len(balances) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, balances)
+	}
+	for i, b := range balances {
+		if b.Currency != want[i].Currency || !b.Available.Equals(want[i].Available) || !b.Pending.Equals(want[i].Pending) {
+			t.Errorf("Balance %d: expected %+v, got %+v", i, want[i], b)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package paytm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// checksumIV is the fixed AES-CBC IV of Paytm's checksum scheme
+var checksumIV = []byte("@@@@&&&&####$$$$")
+
+// saltLength is the length of the random salt appended to each hash
+const saltLength = 4
+
+// generateChecksum signs data with the merchant key the way Paytm's
+// checksum library does: sha256(data|salt) in hex, followed by the salt,
+// AES-CBC encrypted with the key and base64 encoded
+func generateChecksum(data, key string) (string, error) {
+	raw := make([]byte, 3)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	salt := base64.StdEncoding.EncodeToString(raw)[:saltLength]
+	return encrypt(checksumHash(data, salt), key)
+}
+
+// verifyChecksum reports whether checksum signs data under key
+func verifyChecksum(data, key, checksum string) bool {
+	hash, err := decrypt(checksum, key)
+	if err != nil || len(hash) < saltLength {
+		return false
+	}
+	salt := hash[len(hash)-saltLength:]
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(checksumHash(data, salt))) == 1
+}
+
+func checksumHash(data, salt string) string {
+	sum := sha256.Sum256([]byte(data + "|" + salt))
+	return hex.EncodeToString(sum[:]) + salt
+}
+
+// paramsString joins params' values in key order with "|", as Paytm signs
+// form callbacks. The checksum itself is excluded.
+func paramsString(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k != "CHECKSUMHASH" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		if v := params[k]; v != "null" {
+			values[i] = v
+		}
+	}
+	return strings.Join(values, "|")
+}
+
+func encrypt(plain, key string) (string, error) {
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		return "", err
+	}
+	pad := aes.BlockSize - len(plain)%aes.BlockSize
+	data := append([]byte(plain), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, checksumIV).CryptBlocks(data, data)
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func decrypt(encoded, key string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		return "", err
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return "", errors.New("paytm: malformed checksum")
+	}
+	cipher.NewCBCDecrypter(block, checksumIV).CryptBlocks(data, data)
+	pad := int(data[len(data)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return "", errors.New("paytm: malformed checksum")
+	}
+	return string(data[:len(data)-pad]), nil
+}
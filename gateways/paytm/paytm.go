@@ -0,0 +1,343 @@
+package paytm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+)
+
+// Gateway implements payment.Gateway for Paytm. MerchantID is the MID and
+// SecretKey the merchant key.
+type Gateway struct {
+	config *payment.GatewayConfig
+	client *http.Client
+}
+
+// New creates a new Paytm gateway instance
+func New(config *payment.GatewayConfig, client *http.Client) payment.Gateway {
+	if config.BaseURL == "" {
+		if config.Sandbox {
+			config.BaseURL = "https://securegw-stage.paytm.in"
+		} else {
+			config.BaseURL = "https://securegw.paytm.in"
+		}
+	}
+	if config.Currency == "" {
+		config.Currency = "INR"
+	}
+	return &Gateway{config: config, client: client}
+}
+
+func (p *Gateway) GetName() string   { return "Paytm" }
+func (p *Gateway) GetMethod() string { return "paytm" }
+
+// TestMode reports whether the gateway is configured for the staging host
+func (p *Gateway) TestMode() bool { return p.config.Sandbox }
+
+// Capabilities reports a hosted payment page redirect without refunds
+func (p *Gateway) Capabilities() payment.GatewayCapabilities {
+	return payment.GatewayCapabilities{Flow: payment.FlowRedirect, StatusCheck: true}
+}
+
+// SupportedCurrencies reports that Paytm charges only INR
+func (p *Gateway) SupportedCurrencies() []string { return []string{"INR"} }
+
+// displayNames are the localized display names, keyed by locale
+var displayNames = map[string]string{
+	"hi": "पेटीएम",
+}
+
+// GetDisplayName returns the display name for locale, falling back to GetName
+func (p *Gateway) GetDisplayName(locale string) string {
+	return payment.LocalizedName(displayNames, locale, p.GetName())
+}
+
+// ExtraConfigWebsite is the website name Paytm assigned to the merchant,
+// "WEBSTAGING" on the staging host and usually "DEFAULT" in production
+const ExtraConfigWebsite = "website"
+
+// ExtraConfigSchema lists the ExtraConfig keys Paytm reads
+func (p *Gateway) ExtraConfigSchema() payment.ExtraConfigSchema {
+	return payment.ExtraConfigSchema{
+		{Name: ExtraConfigWebsite, Type: payment.ConfigString, Description: "Website name assigned by Paytm"},
+	}
+}
+
+// website returns ExtraConfigWebsite or the host's default
+func (p *Gateway) website() string {
+	if website, ok := p.config.ExtraConfig[ExtraConfigWebsite].(string); ok && website != "" {
+		return website
+	}
+	if p.config.Sandbox {
+		return "WEBSTAGING"
+	}
+	return "DEFAULT"
+}
+
+// resultInfo is the outcome block of every Paytm API response
+type resultInfo struct {
+	ResultStatus string `json:"resultStatus"`
+	ResultCode   string `json:"resultCode"`
+	ResultMsg    string `json:"resultMsg"`
+}
+
+// apiResponse is a Paytm API response. Body is kept raw because the head
+// signature covers its exact bytes.
+type apiResponse struct {
+	Head struct {
+		Signature string `json:"signature"`
+	} `json:"head"`
+	Body json.RawMessage `json:"body"`
+}
+
+// call posts body, signed with the merchant key, to path and returns the
+// response body once its signature is checked. op names the call in
+// signature logs.
+func (p *Gateway) call(ctx context.Context, op, path string, query url.Values, body interface{}) ([]byte, error) {
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := generateChecksum(string(bodyJSON), p.config.SecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("paytm: signing request: %w", err)
+	}
+	payment.LogSignature(p.config, p.GetMethod(), op, []string{"body"}, string(bodyJSON), signature)
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"body": json.RawMessage(bodyJSON),
+		"head": map[string]string{"signature": signature},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := p.config.BaseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	dbg := payment.NewDebugRequest(p.config, http.MethodPost, endpoint, map[string]string{"body": string(bodyJSON)}, string(bodyJSON))
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, payment.WithDebugRequest(p.GetMethod(), payment.WrapTransportError(p.GetMethod(), err), dbg)
+	}
+	defer resp.Body.Close()
+
+	var result apiResponse
+	if err := payment.DecodeJSONResponse(p.GetMethod(), resp, &result); err != nil {
+		return nil, payment.WithDebugRequest(p.GetMethod(), err, dbg)
+	}
+	if !verifyChecksum(string(result.Body), p.config.SecretKey, result.Head.Signature) {
+		return nil, fmt.Errorf("%w: paytm %s response", payment.ErrInvalidCallbackSignature, op)
+	}
+	return result.Body, nil
+}
+
+// InitiatePayment creates a transaction token with Paytm's
+// initiateTransaction API and returns the hosted payment page for it
+func (p *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.PaymentResponse, error) {
+	custID := req.Metadata[payment.MetadataCustomerID]
+	if custID == "" {
+		custID = "CUST_" + req.OrderID
+	}
+	body := map[string]interface{}{
+		"requestType": "Payment",
+		"mid":         p.config.MerchantID,
+		"websiteName": p.website(),
+		"orderId":     req.OrderID,
+		"callbackUrl": req.SuccessURL,
+		"txnAmount": map[string]string{
+			"value":    payment.FormatAmount(req.Amount),
+			"currency": req.Amount.Currency().Code,
+		},
+		"userInfo": map[string]string{
+			"custId":    custID,
+			"mobile":    req.CustomerPhone,
+			"email":     req.CustomerEmail,
+			"firstName": req.CustomerName,
+		},
+	}
+	query := url.Values{"mid": {p.config.MerchantID}, "orderId": {req.OrderID}}
+	raw, err := p.call(ctx, "initiate", "/theia/api/v1/initiateTransaction", query, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		ResultInfo resultInfo `json:"resultInfo"`
+		TxnToken   string     `json:"txnToken"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("paytm: invalid initiateTransaction response: %w", err)
+	}
+	if result.ResultInfo.ResultStatus != "S" || result.TxnToken == "" {
+		return &payment.PaymentResponse{
+			Success: false,
+			OrderID: req.OrderID,
+			Message: fmt.Sprintf("paytm: %s (%s)", result.ResultInfo.ResultMsg, result.ResultInfo.ResultCode),
+		}, nil
+	}
+
+	query.Set("txnToken", result.TxnToken)
+	return &payment.PaymentResponse{
+		Success:    true,
+		PaymentURL: p.config.BaseURL + "/theia/api/v1/showPaymentPage?" + query.Encode(),
+		// Paytm identifies payments by order id until one is made
+		TransactionID: req.OrderID,
+		SessionID:     result.TxnToken,
+		OrderID:       req.OrderID,
+	}, nil
+}
+
+// RequiredVerificationFields reports that verification needs the order id
+func (p *Gateway) RequiredVerificationFields() []string {
+	return []string{"ORDERID|order_id|transaction_id"}
+}
+
+// VerifyPayment checks the callback CHECKSUMHASH, when present, and fetches
+// the payment with Paytm's transaction status API
+func (p *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRequest) (*payment.VerificationResponse, error) {
+	orderID := req.RawData["ORDERID"]
+	if orderID == "" {
+		orderID = req.OrderID
+	}
+	if orderID == "" {
+		orderID = req.TransactionID
+	}
+
+	if checksum, ok := req.RawData["CHECKSUMHASH"]; ok {
+		params := make(map[string]string, len(req.RawData))
+		for k, v := range req.RawData {
+			if k != payment.MetadataAccount {
+				params[k] = v
+			}
+		}
+		if !verifyChecksum(paramsString(params), p.config.SecretKey, checksum) {
+			return nil, fmt.Errorf("%w: paytm", payment.ErrInvalidCallbackSignature)
+		}
+	}
+
+	body := map[string]string{"mid": p.config.MerchantID, "orderId": orderID}
+	raw, err := p.call(ctx, "verify", "/v3/order/status", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	return p.parseVerifyResponse(raw, orderID, req.Amount)
+}
+
+// statusRecordNotFound is the result code for an order Paytm has no
+// payment for yet
+const statusRecordNotFound = "334"
+
+// txnStatuses maps Paytm result statuses to payment statuses
+var txnStatuses = map[string]payment.PaymentStatus{
+	"TXN_SUCCESS": payment.StatusCompleted,
+	"PENDING":     payment.StatusPending,
+	"TXN_FAILURE": payment.StatusFailed,
+}
+
+// parseVerifyResponse builds the verification of orderID from a transaction
+// status response body. amount is the amount we requested.
+func (p *Gateway) parseVerifyResponse(body []byte, orderID string, amount money.Money) (*payment.VerificationResponse, error) {
+	var result struct {
+		ResultInfo  resultInfo `json:"resultInfo"`
+		TxnID       string     `json:"txnId"`
+		OrderID     string     `json:"orderId"`
+		TxnAmount   string     `json:"txnAmount"`
+		PaymentMode string     `json:"paymentMode"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("paytm: invalid transaction status: %w", err)
+	}
+	if result.ResultInfo.ResultCode == statusRecordNotFound {
+		return nil, payment.NewPaymentError(payment.ErrKindNotFound, p.GetMethod(), "no payment for order "+orderID, nil)
+	}
+
+	status, ok := txnStatuses[result.ResultInfo.ResultStatus]
+	if !ok {
+		status = payment.StatusFailed
+	}
+	if result.OrderID != "" {
+		orderID = result.OrderID
+	}
+
+	var paidAmount money.Money
+	if status == payment.StatusCompleted {
+		if amt, err := strconv.ParseFloat(result.TxnAmount, 64); err == nil {
+			paidAmount = money.NewFromFloat(amt, money.MustCurrency(p.config.Currency))
+		}
+	}
+	metadata := map[string]string{}
+	if result.PaymentMode != "" {
+		metadata[payment.MetadataPaymentMethodType] = result.PaymentMode
+	}
+
+	return payment.NewVerificationResponse(
+		payment.WithStatus(status),
+		payment.WithTransactionID(result.TxnID),
+		payment.WithOrderID(orderID),
+		payment.WithAmount(amount),
+		payment.WithPaidAmount(paidAmount),
+		payment.WithMetadata(metadata),
+		payment.WithMessage(result.ResultInfo.ResultMsg),
+		payment.WithCurrency(p.config.Currency),
+	), nil
+}
+
+// ParseReturnURL reads Paytm's callback (ORDERID, TXNID, TXNAMOUNT,
+// CHECKSUMHASH, ...)
+func (p *Gateway) ParseReturnURL(values url.Values) (*payment.VerificationRequest, error) {
+	orderID := values.Get("ORDERID")
+	if orderID == "" {
+		return nil, errors.New("paytm: return URL is missing ORDERID")
+	}
+
+	var amount money.Money
+	if amt, err := strconv.ParseFloat(values.Get("TXNAMOUNT"), 64); err == nil {
+		amount = money.NewFromFloat(amt, money.MustCurrency(p.config.Currency))
+	}
+
+	return &payment.VerificationRequest{
+		TransactionID: values.Get("TXNID"),
+		OrderID:       orderID,
+		Amount:        amount,
+		RawData:       payment.ValuesToRawData(values),
+	}, nil
+}
+
+func (p *Gateway) RefundPayment(ctx context.Context, req *payment.RefundRequest) (*payment.RefundResponse, error) {
+	return nil, errors.New("refund not implemented for Paytm")
+}
+
+// GetStatus looks up txnID, the order id returned by InitiatePayment
+func (p *Gateway) GetStatus(ctx context.Context, req *payment.StatusRequest) (*payment.StatusResponse, error) {
+	orderID := req.OrderID
+	if orderID == "" {
+		orderID = req.TransactionID
+	}
+	vResp, err := p.VerifyPayment(ctx, &payment.VerificationRequest{OrderID: orderID})
+	if err != nil {
+		return nil, err
+	}
+	return &payment.StatusResponse{
+		Status:        vResp.Status,
+		TransactionID: vResp.TransactionID,
+		OrderID:       vResp.OrderID,
+		Amount:        vResp.PaidAmount,
+	}, nil
+}
@@ -0,0 +1,119 @@
+package paytm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+)
+
+const testKey = "0123456789abcdef"
+
+func TestChecksum(t *testing.T) {
+	checksum, err := generateChecksum(`{"mid":"M1"}`, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifyChecksum(`{"mid":"M1"}`, testKey, checksum) {
+		t.Error("Expected the checksum to verify")
+	}
+	if verifyChecksum(`{"mid":"M2"}`, testKey, checksum) {
+		t.Error("Expected a checksum over different data to fail")
+	}
+	if verifyChecksum(`{"mid":"M1"}`, "fedcba9876543210", checksum) {
+		t.Error("Expected a checksum under a different key to fail")
+	}
+	if verifyChecksum(`{"mid":"M1"}`, testKey, "") {
+		t.Error("Expected an empty checksum to fail")
+	}
+	if got := paramsString(map[string]string{"TXNID": "T1", "MID": "M1", "CHECKSUMHASH": "x", "BANKNAME": "null"}); got != "|M1|T1" {
+		t.Errorf("paramsString = %q", got)
+	}
+}
+
+// paytmStub checks the signature of each request and answers with body,
+// signed unless unsigned is set
+func paytmStub(t *testing.T, body string, unsigned bool) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Body json.RawMessage `json:"body"`
+			Head struct {
+				Signature string `json:"signature"`
+			} `json:"head"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !verifyChecksum(string(req.Body), testKey, req.Head.Signature) {
+			t.Errorf("Request to %s is not signed", r.URL.Path)
+		}
+		signature, _ := generateChecksum(body, testKey)
+		if unsigned {
+			signature = ""
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"head":{"signature":"` + signature + `"},"body":` + body + `}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestGateway(srv *httptest.Server) *Gateway {
+	return New(&payment.GatewayConfig{BaseURL: srv.URL, MerchantID: "M1", SecretKey: testKey}, srv.Client()).(*Gateway)
+}
+
+func TestInitiatePayment(t *testing.T) {
+	srv := paytmStub(t, `{"resultInfo":{"resultStatus":"S","resultCode":"0000","resultMsg":"Success"},"txnToken":"tok1"}`, false)
+	g := newTestGateway(srv)
+
+	resp, err := g.InitiatePayment(context.Background(), &payment.PaymentRequest{OrderID: "O1", Amount: money.New(100, money.MustCurrency("INR"))})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !resp.Success || resp.SessionID != "tok1" || resp.TransactionID != "O1" || !strings.Contains(resp.PaymentURL, "txnToken=tok1") {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+}
+
+func TestVerifyPayment(t *testing.T) {
+	inr := money.MustCurrency("INR")
+	ctx := context.Background()
+
+	srv := paytmStub(t, `{"resultInfo":{"resultStatus":"TXN_SUCCESS","resultCode":"01","resultMsg":"Txn Success"},"txnId":"T1","orderId":"O1","txnAmount":"100.00","paymentMode":"UPI"}`, false)
+	g := newTestGateway(srv)
+	resp, err := g.VerifyPayment(ctx, &payment.VerificationRequest{OrderID: "O1", Amount: money.New(100, inr)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !resp.Success || resp.TransactionID != "T1" || !resp.PaidAmount.Equals(money.New(100, inr)) || resp.Metadata[payment.MetadataPaymentMethodType] != "UPI" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+	if err := resp.Validate(); err != nil {
+		t.Errorf("Invalid response: %v", err)
+	}
+
+	// Callback checksums are checked before the status call
+	callback := map[string]string{"ORDERID": "O1", "TXNID": "T1", "STATUS": "TXN_SUCCESS"}
+	callback["CHECKSUMHASH"], _ = generateChecksum(paramsString(callback), testKey)
+	if _, err := g.VerifyPayment(ctx, &payment.VerificationRequest{RawData: callback}); err != nil {
+		t.Errorf("Unexpected error for a signed callback: %v", err)
+	}
+	callback["STATUS"] = "TXN_FAILURE"
+	if _, err := g.VerifyPayment(ctx, &payment.VerificationRequest{RawData: callback}); !errors.Is(err, payment.ErrInvalidCallbackSignature) {
+		t.Errorf("Expected ErrInvalidCallbackSignature for a tampered callback, got %v", err)
+	}
+
+	unsigned := newTestGateway(paytmStub(t, `{"resultInfo":{"resultStatus":"TXN_SUCCESS"}}`, true))
+	if _, err := unsigned.VerifyPayment(ctx, &payment.VerificationRequest{OrderID: "O1"}); !errors.Is(err, payment.ErrInvalidCallbackSignature) {
+		t.Errorf("Expected an unsigned response to be rejected, got %v", err)
+	}
+
+	missing := newTestGateway(paytmStub(t, `{"resultInfo":{"resultStatus":"TXN_FAILURE","resultCode":"334","resultMsg":"Invalid Order Id."}}`, false))
+	if _, err := missing.VerifyPayment(ctx, &payment.VerificationRequest{OrderID: "O2"}); payment.HTTPStatusForError(err) != http.StatusNotFound {
+		t.Errorf("Expected not found, got %v", err)
+	}
+}
@@ -0,0 +1,344 @@
+package phonepe
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+)
+
+// Gateway implements payment.Gateway for PhonePe's Standard Checkout.
+// MerchantID is the merchant id and SecretKey the salt key.
+type Gateway struct {
+	config *payment.GatewayConfig
+	client *http.Client
+}
+
+// New creates a new PhonePe gateway instance
+func New(config *payment.GatewayConfig, client *http.Client) payment.Gateway {
+	if config.BaseURL == "" {
+		if config.Sandbox {
+			config.BaseURL = "https://api-preprod.phonepe.com/apis/pg-sandbox"
+		} else {
+			config.BaseURL = "https://api.phonepe.com/apis/hermes"
+		}
+	}
+	if config.Currency == "" {
+		config.Currency = "INR"
+	}
+	return &Gateway{config: config, client: client}
+}
+
+func (p *Gateway) GetName() string   { return "PhonePe" }
+func (p *Gateway) GetMethod() string { return "phonepe" }
+
+// TestMode reports whether the gateway is configured for the sandbox
+func (p *Gateway) TestMode() bool { return p.config.Sandbox }
+
+// Capabilities reports a hosted pay page redirect without refunds
+func (p *Gateway) Capabilities() payment.GatewayCapabilities {
+	return payment.GatewayCapabilities{Flow: payment.FlowRedirect, StatusCheck: true}
+}
+
+// SupportedCurrencies reports that PhonePe charges only INR
+func (p *Gateway) SupportedCurrencies() []string { return []string{"INR"} }
+
+// displayNames are the localized display names, keyed by locale
+var displayNames = map[string]string{
+	"hi": "फ़ोनपे",
+}
+
+// GetDisplayName returns the display name for locale, falling back to GetName
+func (p *Gateway) GetDisplayName(locale string) string {
+	return payment.LocalizedName(displayNames, locale, p.GetName())
+}
+
+// ExtraConfigSaltIndex is the index of the salt key in SecretKey. It
+// defaults to 1.
+const ExtraConfigSaltIndex = "salt_index"
+
+// ExtraConfigSchema lists the ExtraConfig keys PhonePe reads
+func (p *Gateway) ExtraConfigSchema() payment.ExtraConfigSchema {
+	return payment.ExtraConfigSchema{
+		{Name: ExtraConfigSaltIndex, Type: payment.ConfigInt, Description: "Index of the salt key, default 1"},
+	}
+}
+
+// saltIndex returns ExtraConfigSaltIndex as sent in X-VERIFY
+func (p *Gateway) saltIndex() string {
+	switch n := p.config.ExtraConfig[ExtraConfigSaltIndex].(type) {
+	case int:
+		return strconv.Itoa(n)
+	case int32:
+		return strconv.FormatInt(int64(n), 10)
+	case int64:
+		return strconv.FormatInt(n, 10)
+	case float64:
+		return strconv.FormatInt(int64(n), 10)
+	}
+	return "1"
+}
+
+// xVerify returns the X-VERIFY header for a request: SHA256 of the base64
+// payload (empty for GETs), the API path and the salt key, followed by
+// "###" and the salt index
+func (p *Gateway) xVerify(payload, path string) string {
+	base := payload + path + p.config.SecretKey
+	sum := sha256.Sum256([]byte(base))
+	signature := hex.EncodeToString(sum[:]) + "###" + p.saltIndex()
+	payment.LogSignature(p.config, p.GetMethod(), path, []string{"payload", "path", "salt"}, base, signature)
+	return signature
+}
+
+// apiResponse is the envelope of every PhonePe API response
+type apiResponse struct {
+	Success bool            `json:"success"`
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// payPath is the Standard Checkout pay API
+const payPath = "/pg/v1/pay"
+
+// InitiatePayment creates a pay page for req and returns its redirect URL
+func (p *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.PaymentResponse, error) {
+	// PhonePe expects amount in paise
+	request := map[string]interface{}{
+		"merchantId":            p.config.MerchantID,
+		"merchantTransactionId": req.OrderID,
+		"merchantUserId":        "MUID_" + req.OrderID,
+		"amount":                payment.AmountInMinorUnits(p.config, req.Amount),
+		"redirectUrl":           req.SuccessURL,
+		"redirectMode":          "REDIRECT",
+		"callbackUrl":           req.WebhookURL,
+		"mobileNumber":          req.CustomerPhone,
+		"paymentInstrument":     map[string]string{"type": "PAY_PAGE"},
+	}
+	if id := req.Metadata[payment.MetadataCustomerID]; id != "" {
+		request["merchantUserId"] = id
+	}
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(requestJSON)
+	signature := p.xVerify(encoded, payPath)
+
+	payURL := p.config.BaseURL + payPath
+	dbg := payment.NewDebugRequest(p.config, http.MethodPost, payURL, map[string]string{"request": string(requestJSON)}, encoded+payPath)
+	jsonData, _ := json.Marshal(map[string]string{"request": encoded})
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", payURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-VERIFY", signature)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, payment.WithDebugRequest(p.GetMethod(), payment.WrapTransportError(p.GetMethod(), err), dbg)
+	}
+	defer resp.Body.Close()
+
+	var result apiResponse
+	if err := payment.DecodeJSONResponse(p.GetMethod(), resp, &result); err != nil {
+		return nil, payment.WithDebugRequest(p.GetMethod(), err, dbg)
+	}
+	if !result.Success {
+		return &payment.PaymentResponse{
+			Success: false,
+			OrderID: req.OrderID,
+			Message: fmt.Sprintf("phonepe: %s (%s)", result.Message, result.Code),
+		}, nil
+	}
+
+	var data struct {
+		MerchantTransactionID string `json:"merchantTransactionId"`
+		InstrumentResponse    struct {
+			RedirectInfo struct {
+				URL string `json:"url"`
+			} `json:"redirectInfo"`
+		} `json:"instrumentResponse"`
+	}
+	if err := json.Unmarshal(result.Data, &data); err != nil {
+		return nil, payment.WithDebugRequest(p.GetMethod(), fmt.Errorf("phonepe: invalid pay response: %w", err), dbg)
+	}
+	if data.InstrumentResponse.RedirectInfo.URL == "" {
+		return nil, payment.WithDebugRequest(p.GetMethod(), errors.New("phonepe: pay response is missing the redirect URL"), dbg)
+	}
+
+	txnID := data.MerchantTransactionID
+	if txnID == "" {
+		txnID = req.OrderID
+	}
+	return &payment.PaymentResponse{
+		Success:       true,
+		PaymentURL:    data.InstrumentResponse.RedirectInfo.URL,
+		TransactionID: txnID,
+		OrderID:       req.OrderID,
+		Message:       result.Message,
+	}, nil
+}
+
+// RequiredVerificationFields reports that verification needs the merchant
+// transaction id
+func (p *Gateway) RequiredVerificationFields() []string {
+	return []string{"transactionId|transaction_id"}
+}
+
+// VerifyPayment fetches the payment with PhonePe's status API. The
+// redirect's own parameters are not trusted.
+func (p *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRequest) (*payment.VerificationResponse, error) {
+	txnID := req.TransactionID
+	if txnID == "" {
+		txnID = req.RawData["transactionId"]
+	}
+
+	path := fmt.Sprintf("/pg/v1/status/%s/%s", url.PathEscape(p.config.MerchantID), url.PathEscape(txnID))
+	signature := p.xVerify("", path)
+	statusURL := p.config.BaseURL + path
+	dbg := payment.NewDebugRequest(p.config, http.MethodGet, statusURL, nil, path)
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", statusURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-VERIFY", signature)
+	httpReq.Header.Set("X-MERCHANT-ID", p.config.MerchantID)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, payment.WithDebugRequest(p.GetMethod(), payment.WrapTransportError(p.GetMethod(), err), dbg)
+	}
+	defer resp.Body.Close()
+
+	body, err := payment.ReadResponseBody(p.GetMethod(), resp)
+	if err != nil {
+		return nil, payment.WithDebugRequest(p.GetMethod(), err, dbg)
+	}
+	vresp, err := p.parseVerifyResponse(body, txnID, req)
+	if err != nil {
+		return nil, payment.WithDebugRequest(p.GetMethod(), err, dbg)
+	}
+	return vresp, nil
+}
+
+// statusCodes maps PhonePe status codes to payment statuses
+var statusCodes = map[string]payment.PaymentStatus{
+	"PAYMENT_SUCCESS":      payment.StatusCompleted,
+	"PAYMENT_PENDING":      payment.StatusPending,
+	"PAYMENT_INITIATED":    payment.StatusPending,
+	"PAYMENT_ERROR":        payment.StatusFailed,
+	"PAYMENT_DECLINED":     payment.StatusFailed,
+	"AUTHORIZATION_FAILED": payment.StatusFailed,
+	"TIMED_OUT":            payment.StatusFailed,
+}
+
+// parseVerifyResponse builds the verification of txnID from a status
+// response body
+func (p *Gateway) parseVerifyResponse(body []byte, txnID string, req *payment.VerificationRequest) (*payment.VerificationResponse, error) {
+	var result apiResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("phonepe: invalid status response: %w", err)
+	}
+	if result.Code == "TRANSACTION_NOT_FOUND" {
+		return nil, payment.NewPaymentError(payment.ErrKindNotFound, p.GetMethod(), "no payment for transaction "+txnID, nil)
+	}
+
+	var data struct {
+		TransactionID     string `json:"transactionId"`
+		Amount            int64  `json:"amount"`
+		ResponseCode      string `json:"responseCode"`
+		PaymentInstrument struct {
+			Type string `json:"type"`
+		} `json:"paymentInstrument"`
+	}
+	if len(result.Data) > 0 {
+		if err := json.Unmarshal(result.Data, &data); err != nil {
+			return nil, fmt.Errorf("phonepe: invalid status data: %w", err)
+		}
+	}
+
+	status, ok := statusCodes[result.Code]
+	if !ok {
+		status = payment.StatusFailed
+	}
+	// The merchant transaction id is the order id we initiated with
+	orderID := req.OrderID
+	if orderID == "" {
+		orderID = txnID
+	}
+	metadata := map[string]string{}
+	if data.PaymentInstrument.Type != "" {
+		metadata[payment.MetadataPaymentMethodType] = data.PaymentInstrument.Type
+	}
+
+	opts := []payment.VerificationOption{
+		payment.WithStatus(status),
+		payment.WithTransactionID(txnID),
+		payment.WithOrderID(orderID),
+		payment.WithAmount(req.Amount),
+		payment.WithMetadata(metadata),
+		payment.WithMessage(result.Message),
+		payment.WithCurrency(p.config.Currency),
+	}
+	if status == payment.StatusCompleted {
+		opts = append(opts, payment.WithPaidAmount(payment.AmountFromMinorUnits(p.config, data.Amount, money.MustCurrency(p.config.Currency))))
+	}
+	if status == payment.StatusFailed && data.ResponseCode != "" {
+		opts = append(opts, payment.WithDecline(data.ResponseCode))
+	}
+	return payment.NewVerificationResponse(opts...), nil
+}
+
+// ParseReturnURL reads PhonePe's redirect (code, merchantId, transactionId,
+// amount in paise, providerReferenceId)
+func (p *Gateway) ParseReturnURL(values url.Values) (*payment.VerificationRequest, error) {
+	txnID := values.Get("transactionId")
+	if txnID == "" {
+		return nil, errors.New("phonepe: return URL is missing transactionId")
+	}
+
+	var amount money.Money
+	if amt, err := strconv.ParseInt(values.Get("amount"), 10, 64); err == nil {
+		amount = payment.AmountFromMinorUnits(p.config, amt, money.MustCurrency(p.config.Currency))
+	}
+
+	return &payment.VerificationRequest{
+		TransactionID: txnID,
+		OrderID:       txnID,
+		Amount:        amount,
+		RawData:       payment.ValuesToRawData(values),
+	}, nil
+}
+
+func (p *Gateway) RefundPayment(ctx context.Context, req *payment.RefundRequest) (*payment.RefundResponse, error) {
+	return nil, errors.New("refund not implemented for PhonePe")
+}
+
+// GetStatus looks up txnID with the status API
+func (p *Gateway) GetStatus(ctx context.Context, req *payment.StatusRequest) (*payment.StatusResponse, error) {
+	vResp, err := p.VerifyPayment(ctx, &payment.VerificationRequest{TransactionID: req.TransactionID, RawData: req.RawData})
+	if err != nil {
+		return nil, err
+	}
+	return &payment.StatusResponse{
+		Status:        vResp.Status,
+		TransactionID: vResp.TransactionID,
+		OrderID:       vResp.OrderID,
+		Amount:        vResp.PaidAmount,
+	}, nil
+}
@@ -0,0 +1,91 @@
+package phonepe
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+)
+
+const testSalt = "099eb0cd-02cf-4e2a-8aca-3e6c6aff0399"
+
+// phonepeStub checks each request's X-VERIFY header and answers with body
+func phonepeStub(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := ""
+		if r.Method == http.MethodPost {
+			var req struct {
+				Request string `json:"request"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			payload = req.Request
+			if decoded, err := base64.StdEncoding.DecodeString(payload); err != nil || !json.Valid(decoded) {
+				t.Errorf("Expected a base64 JSON payload, got %q", payload)
+			}
+		}
+		sum := sha256.Sum256([]byte(payload + r.URL.Path + testSalt))
+		if want := hex.EncodeToString(sum[:]) + "###2"; r.Header.Get("X-VERIFY") != want {
+			t.Errorf("X-VERIFY for %s = %q, want %q", r.URL.Path, r.Header.Get("X-VERIFY"), want)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestGateway(srv *httptest.Server) payment.Gateway {
+	return New(&payment.GatewayConfig{
+		BaseURL:     srv.URL,
+		MerchantID:  "PGTESTPAYUAT",
+		SecretKey:   testSalt,
+		ExtraConfig: map[string]interface{}{ExtraConfigSaltIndex: 2},
+	}, srv.Client())
+}
+
+func TestInitiatePayment(t *testing.T) {
+	srv := phonepeStub(t, `{"success":true,"code":"PAYMENT_INITIATED","message":"Payment initiated","data":{"merchantId":"PGTESTPAYUAT","merchantTransactionId":"O1","instrumentResponse":{"type":"PAY_PAGE","redirectInfo":{"url":"https://mercury.example/pay/1","method":"GET"}}}}`)
+	resp, err := newTestGateway(srv).InitiatePayment(context.Background(), &payment.PaymentRequest{OrderID: "O1", Amount: money.New(100, money.MustCurrency("INR"))})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !resp.Success || resp.PaymentURL != "https://mercury.example/pay/1" || resp.TransactionID != "O1" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+}
+
+func TestVerifyPayment(t *testing.T) {
+	inr := money.MustCurrency("INR")
+	ctx := context.Background()
+
+	srv := phonepeStub(t, `{"success":true,"code":"PAYMENT_SUCCESS","message":"Your payment is successful.","data":{"merchantTransactionId":"O1","transactionId":"T1","amount":10000,"state":"COMPLETED","responseCode":"SUCCESS","paymentInstrument":{"type":"UPI"}}}`)
+	resp, err := newTestGateway(srv).VerifyPayment(ctx, &payment.VerificationRequest{TransactionID: "O1", Amount: money.New(100, inr)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !resp.Success || !resp.PaidAmount.Equals(money.New(100, inr)) || resp.OrderID != "O1" || resp.Metadata[payment.MetadataPaymentMethodType] != "UPI" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+	if err := resp.Validate(); err != nil {
+		t.Errorf("Invalid response: %v", err)
+	}
+
+	srv = phonepeStub(t, `{"success":false,"code":"PAYMENT_ERROR","message":"Payment Failed","data":{"merchantTransactionId":"O1","amount":10000,"state":"FAILED","responseCode":"INSUFFICIENT_FUNDS"}}`)
+	resp, err = newTestGateway(srv).VerifyPayment(ctx, &payment.VerificationRequest{TransactionID: "O1"})
+	if err != nil || resp.Success || resp.DeclineReason != payment.DeclineInsufficientFunds {
+		t.Errorf("Expected a declined payment, got %+v, %v", resp, err)
+	}
+
+	srv = phonepeStub(t, `{"success":false,"code":"TRANSACTION_NOT_FOUND","message":"No Transaction found with the given details."}`)
+	if _, err := newTestGateway(srv).VerifyPayment(ctx, &payment.VerificationRequest{TransactionID: "O2"}); payment.HTTPStatusForError(err) != http.StatusNotFound {
+		t.Errorf("Expected not found, got %v", err)
+	}
+}
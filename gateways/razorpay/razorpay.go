@@ -1,10 +1,17 @@
 package razorpay
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"time"
+	"net/url"
+	"strconv"
 
 	"github.com/oarkflow/money"
 	"github.com/oarkflow/payment"
@@ -13,6 +20,7 @@ import (
 // Gateway implements payment.Gateway for Razorpay
 type Gateway struct {
 	config *payment.GatewayConfig
+	client *http.Client
 }
 
 // New creates a new Razorpay gateway instance
@@ -23,58 +31,364 @@ func New(config *payment.GatewayConfig, client *http.Client) payment.Gateway {
 	if config.Currency == "" {
 		config.Currency = "INR"
 	}
-	return &Gateway{config: config}
+	return &Gateway{config: config, client: client}
 }
 
 func (r *Gateway) GetName() string   { return "Razorpay" }
 func (r *Gateway) GetMethod() string { return "razorpay" }
 
-// InitiatePayment initiates a payment through Razorpay
+// TestMode reports whether the gateway is configured for the sandbox
+func (r *Gateway) TestMode() bool { return r.config.Sandbox }
+
+// Capabilities reports that Razorpay Checkout opens in-page and supports
+// partial refunds, webhooks and recurring billing through subscriptions
+func (r *Gateway) Capabilities() payment.GatewayCapabilities {
+	return payment.GatewayCapabilities{
+		Flow:          payment.FlowInApp,
+		Refund:        true,
+		PartialRefund: true,
+		StatusCheck:   true,
+		Webhook:       true,
+		Recurring:     true,
+	}
+}
+
+// SupportedCurrencies reports that Razorpay charges only INR
+func (r *Gateway) SupportedCurrencies() []string { return []string{"INR"} }
+
+// displayNames are the localized display names, keyed by locale
+var displayNames = map[string]string{
+	"hi": "रेज़रपे",
+	"ta": "ரேசர்பே",
+	"bn": "রেজরপে",
+}
+
+// GetDisplayName returns the display name for locale, falling back to GetName
+func (r *Gateway) GetDisplayName(locale string) string {
+	return payment.LocalizedName(displayNames, locale, r.GetName())
+}
+
+// ExtraConfigRefundSpeed selects the refund speed: "normal" (the default) or
+// "instant", which Razorpay calls optimum and honours where the payment
+// method supports it
+const ExtraConfigRefundSpeed = "refund_speed"
+
+// ExtraConfigSchema lists the ExtraConfig keys Razorpay reads
+func (r *Gateway) ExtraConfigSchema() payment.ExtraConfigSchema {
+	return payment.ExtraConfigSchema{
+		{Name: ExtraConfigRefundSpeed, Type: payment.ConfigString, Description: `Refund speed, "normal" or "instant"`},
+	}
+}
+
+// refundSpeed returns the Razorpay speed for ExtraConfigRefundSpeed
+func (r *Gateway) refundSpeed() string {
+	switch r.config.ExtraConfig[ExtraConfigRefundSpeed] {
+	case "instant", "optimum":
+		return "optimum"
+	}
+	return "normal"
+}
+
+// MetadataKeyID is the PaymentResponse.Metadata key carrying the public key
+// id that Razorpay Checkout is opened with, alongside the order id
+const MetadataKeyID = "key_id"
+
+// InitiatePayment creates a Razorpay order for the payment, sending
+// req.IdempotencyKey as the Idempotency-Key header. Checkout opens in-page
+// with the order id, returned as SessionID, so there is no payment URL. The
+// payment id is only known once Checkout calls back, so TransactionID is
+// left empty.
 func (r *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.PaymentResponse, error) {
-	// In a real implementation, this would call Razorpay's Orders API
-	orderID := fmt.Sprintf("order_%d", time.Now().UnixNano())
-	paymentURL := fmt.Sprintf("%s/checkout/%s", r.config.BaseURL, orderID)
+	if err := payment.SandboxError(r.config, r.GetMethod(), req.Amount); err != nil {
+		return nil, err
+	}
+	currency := req.Amount.Currency().Code
+	if currency == "" {
+		currency = r.config.Currency
+	}
+	payload := map[string]interface{}{
+		"amount":   payment.AmountInMinorUnits(r.config, req.Amount),
+		"currency": currency,
+		"receipt":  req.OrderID,
+	}
+	if notes := payment.NamespaceMetadata(req.Metadata); notes != nil {
+		payload["notes"] = notes
+	}
+
+	var order struct {
+		ID string `json:"id"`
+	}
+	if err := r.callIdempotent(ctx, http.MethodPost, "/v1/orders", payload, req.IdempotencyKey, &order); err != nil {
+		return nil, err
+	}
+	if order.ID == "" {
+		return nil, errors.New("razorpay: order response is missing id")
+	}
 
 	return &payment.PaymentResponse{
-		Success:       true,
-		PaymentURL:    paymentURL,
-		TransactionID: orderID,
-		OrderID:       req.OrderID,
-		Message:       "Order created successfully",
+		Success:   true,
+		SessionID: order.ID,
+		OrderID:   req.OrderID,
+		Message:   "Order created successfully",
+		Metadata:  map[string]string{MetadataKeyID: r.config.APIKey},
 	}, nil
 }
 
-// VerifyPayment verifies a payment with Razorpay
+// ForwardsIdempotencyKey reports that InitiatePayment sends the
+// Idempotency-Key header, so retrying it is safe
+func (r *Gateway) ForwardsIdempotencyKey() bool { return true }
+
+// RequiredVerificationFields reports that verification needs the payment id,
+// order id and Checkout signature
+func (r *Gateway) RequiredVerificationFields() []string {
+	return []string{"razorpay_payment_id|transaction_id", "razorpay_order_id|session_id", "razorpay_signature"}
+}
+
+// checkoutSignature returns the hex HMAC-SHA256 Razorpay Checkout signs its
+// callback with: order_id|payment_id keyed by the API secret
+func (r *Gateway) checkoutSignature(orderID, paymentID string) string {
+	mac := hmac.New(sha256.New, []byte(r.config.SecretKey))
+	mac.Write([]byte(orderID + "|" + paymentID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyPayment checks the Checkout callback signature, then fetches the
+// payment from Razorpay and reports its status
 func (r *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRequest) (*payment.VerificationResponse, error) {
-	// In a real implementation, this would verify the signature and call Razorpay's API
-	return &payment.VerificationResponse{
-		Success:       true,
-		Status:        payment.StatusCompleted,
-		TransactionID: req.TransactionID,
-		OrderID:       req.OrderID,
-		Amount:        req.Amount,
-		PaidAmount:    req.Amount,
-		Message:       "Payment verified successfully",
+	paymentID := req.RawData["razorpay_payment_id"]
+	if paymentID == "" {
+		paymentID = req.TransactionID
+	}
+	orderID := req.RawData["razorpay_order_id"]
+	if orderID == "" {
+		orderID = req.SessionID
+	}
+	expected := r.checkoutSignature(orderID, paymentID)
+	if !hmac.Equal([]byte(req.RawData["razorpay_signature"]), []byte(expected)) {
+		return payment.NewVerificationResponse(
+			payment.WithStatus(payment.StatusFailed),
+			payment.WithTransactionID(paymentID),
+			payment.WithOrderID(req.OrderID),
+			payment.WithAmount(req.Amount),
+			payment.WithMessage("razorpay_signature does not match order "+orderID+" and payment "+paymentID),
+			payment.WithCurrency(r.config.Currency),
+		), fmt.Errorf("%w: razorpay: signature does not match order %s and payment %s", payment.ErrInvalidCallbackSignature, orderID, paymentID)
+	}
+
+	var raw json.RawMessage
+	if err := r.call(ctx, http.MethodGet, "/v1/payments/"+url.PathEscape(paymentID), nil, &raw); err != nil {
+		return nil, err
+	}
+	return r.parseVerifyResponse(raw, req.Amount)
+}
+
+// paymentStatuses maps Razorpay payment statuses to payment statuses
+var paymentStatuses = map[string]payment.PaymentStatus{
+	"created":    payment.StatusPending,
+	"authorized": payment.StatusAuthorized,
+	"captured":   payment.StatusCompleted,
+	"refunded":   payment.StatusRefunded,
+	"failed":     payment.StatusFailed,
+}
+
+// parseVerifyResponse builds the verification from a fetched payment entity.
+// amount is the amount we requested.
+func (r *Gateway) parseVerifyResponse(body []byte, amount money.Money) (*payment.VerificationResponse, error) {
+	var pay paymentEntity
+	if err := json.Unmarshal(body, &pay); err != nil {
+		return nil, fmt.Errorf("razorpay: invalid payment: %w", err)
+	}
+
+	status, ok := paymentStatuses[pay.Status]
+	if !ok {
+		status = payment.StatusPending
+	}
+	// A partially refunded payment stays captured with refund_status partial
+	if status == payment.StatusCompleted && pay.RefundStatus == "partial" {
+		status = payment.StatusPartiallyRefunded
+	}
+
+	metadata := payment.StripMetadataNamespace(pay.Notes)
+	if pay.Method != "" {
+		metadata[payment.MetadataPaymentMethodType] = pay.Method
+	}
+	currency := pay.Currency
+	if currency == "" {
+		currency = r.config.Currency
+	}
+	// Without an expected amount, report the amount the payment was for
+	if amount.Currency().Code == "" {
+		amount = r.minorAmount(pay.Amount, currency)
+	}
+
+	opts := []payment.VerificationOption{
+		payment.WithStatus(status),
+		payment.WithTransactionID(pay.ID),
+		payment.WithOrderID(pay.OrderID),
+		payment.WithAmount(amount),
+		payment.WithMetadata(metadata),
+		payment.WithCurrency(currency),
+	}
+	// error_reason is specific (e.g. insufficient_balance); error_code is
+	// only the error class
+	if code := pay.ErrorReason; code != "" || pay.ErrorCode != "" {
+		if code == "" {
+			code = pay.ErrorCode
+		}
+		opts = append(opts, payment.WithDecline(code))
+		if pay.ErrorDescription != "" {
+			opts = append(opts, payment.WithMessage(pay.ErrorDescription))
+		}
+	}
+	if status != payment.StatusPending && status != payment.StatusFailed {
+		opts = append(opts,
+			payment.WithPaidAmount(r.minorAmount(pay.Amount, currency)),
+			payment.WithFee(r.minorAmount(pay.Fee, currency)),
+		)
+	}
+	return payment.NewVerificationResponse(opts...), nil
+}
+
+// ParseReturnURL reads Razorpay's callback (razorpay_payment_id, razorpay_order_id, razorpay_signature)
+func (r *Gateway) ParseReturnURL(values url.Values) (*payment.VerificationRequest, error) {
+	paymentID := values.Get("razorpay_payment_id")
+	if paymentID == "" {
+		return nil, errors.New("razorpay: return URL is missing razorpay_payment_id")
+	}
+	return &payment.VerificationRequest{
+		TransactionID: paymentID,
+		SessionID:     values.Get("razorpay_order_id"),
+		RawData:       payment.ValuesToRawData(values),
 	}, nil
 }
 
 // RefundPayment processes a refund through Razorpay
 func (r *Gateway) RefundPayment(ctx context.Context, req *payment.RefundRequest) (*payment.RefundResponse, error) {
-	// In a real implementation, this would call Razorpay's refund API
+	speed := r.refundSpeed()
+	payload := map[string]interface{}{"speed": speed}
+	params := map[string]string{"speed": speed}
+	// Without an amount Razorpay refunds the full unrefunded balance
+	if !req.Amount.IsZero() {
+		amount := payment.AmountInMinorUnits(r.config, req.Amount)
+		payload["amount"] = amount
+		params["amount"] = strconv.FormatInt(amount, 10)
+	}
+	if req.Reason != "" {
+		payload["notes"] = map[string]string{"reason": req.Reason}
+	}
+
+	jsonData, _ := json.Marshal(payload)
+	refundURL := fmt.Sprintf("%s/v1/payments/%s/refund", r.config.BaseURL, url.PathEscape(req.TransactionID))
+	dbg := payment.NewDebugRequest(r.config, http.MethodPost, refundURL, params, "")
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, refundURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.SetBasicAuth(r.config.APIKey, r.config.SecretKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		return nil, payment.WithDebugRequest(r.GetMethod(), payment.WrapTransportError(r.GetMethod(), err), dbg)
+	}
+	defer resp.Body.Close()
+
+	// Razorpay rejects amounts above the refundable balance with a 400,
+	// whose body carries the error code and description
+	var result struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := payment.DecodeJSONResponse(r.GetMethod(), resp, &result); err != nil {
+		return nil, payment.WithDebugRequest(r.GetMethod(), err, dbg)
+	}
+
 	return &payment.RefundResponse{
-		Success:  true,
-		RefundID: fmt.Sprintf("rfnd_%d", time.Now().UnixNano()),
-		Message:  "Refund processed successfully",
+		Success:  result.Status != "failed",
+		RefundID: result.ID,
+		Message:  "Refund " + result.Status,
 	}, nil
 }
 
-// GetStatus retrieves the status of a payment from Razorpay
-func (r *Gateway) GetStatus(ctx context.Context, txnID string) (*payment.StatusResponse, error) {
-	// In a real implementation, this would call Razorpay's API
-	amount:= money.New(0, money.MustCurrency(r.config.Currency))
+// GetStatus retrieves the status of a payment from Razorpay. Without a
+// TransactionID the payments of the order in req.SessionID are listed
+// instead.
+func (r *Gateway) GetStatus(ctx context.Context, req *payment.StatusRequest) (*payment.StatusResponse, error) {
+	if req.TransactionID == "" && req.SessionID != "" {
+		return r.orderStatus(ctx, req)
+	}
+	paymentURL := fmt.Sprintf("%s/v1/payments/%s", r.config.BaseURL, url.PathEscape(req.TransactionID))
+	dbg := payment.NewDebugRequest(r.config, http.MethodGet, paymentURL, nil, "")
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, paymentURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.SetBasicAuth(r.config.APIKey, r.config.SecretKey)
+
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		return nil, payment.WithDebugRequest(r.GetMethod(), payment.WrapTransportError(r.GetMethod(), err), dbg)
+	}
+	defer resp.Body.Close()
+
+	body, err := payment.ReadResponseBody(r.GetMethod(), resp)
+	if err != nil {
+		return nil, payment.WithDebugRequest(r.GetMethod(), err, dbg)
+	}
+	return r.parseStatusResponse(body)
+}
+
+// orderStatus reports the status of the order in req.SessionID from its
+// payments: the captured one if any, else the latest attempt. An order
+// without payments is pending.
+func (r *Gateway) orderStatus(ctx context.Context, req *payment.StatusRequest) (*payment.StatusResponse, error) {
+	var payments struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := r.call(ctx, http.MethodGet, "/v1/orders/"+url.PathEscape(req.SessionID)+"/payments", nil, &payments); err != nil {
+		return nil, err
+	}
+	if len(payments.Items) == 0 {
+		return &payment.StatusResponse{
+			Status:  payment.StatusPending,
+			OrderID: req.SessionID,
+			Amount:  req.Amount,
+		}, nil
+	}
+
+	// Razorpay lists the latest attempt first
+	chosen := payments.Items[0]
+	for _, item := range payments.Items {
+		var pay paymentEntity
+		if json.Unmarshal(item, &pay) == nil && pay.Status == "captured" {
+			chosen = item
+			break
+		}
+	}
+	return r.parseStatusResponse(chosen)
+}
+
+// parseStatusResponse builds the status of a fetched payment entity. The
+// amount is the payment's, in the payment's currency.
+func (r *Gateway) parseStatusResponse(body []byte) (*payment.StatusResponse, error) {
+	var pay paymentEntity
+	if err := json.Unmarshal(body, &pay); err != nil {
+		return nil, fmt.Errorf("razorpay: invalid payment: %w", err)
+	}
+	currency := pay.Currency
+	if currency == "" {
+		currency = r.config.Currency
+	}
+	vresp, err := r.parseVerifyResponse(body, r.minorAmount(pay.Amount, currency))
+	if err != nil {
+		return nil, err
+	}
 	return &payment.StatusResponse{
-		Status:        payment.StatusCompleted,
-		TransactionID: txnID,
-		Amount:        amount,
+		Status:        vresp.Status,
+		TransactionID: vresp.TransactionID,
+		OrderID:       vresp.OrderID,
+		Amount:        vresp.Amount,
 	}, nil
 }
@@ -0,0 +1,236 @@
+package razorpay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+	"github.com/oarkflow/payment/internal/golden"
+	"github.com/oarkflow/payment/paymenttest"
+)
+
+// TestParseVerifyResponse checks parsing of recorded payment entity responses against
+// testdata/*.golden. Run with -update after an intended schema change.
+func TestParseVerifyResponse(t *testing.T) {
+	g := New(&payment.GatewayConfig{}, nil).(*Gateway)
+	amount := money.New(500, money.MustCurrency("INR"))
+
+	for _, name := range []string{"captured", "created", "failed", "refunded", "partially_refunded"} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := g.parseVerifyResponse(golden.Fixture(t, "payment_"+name+".json"), amount)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := resp.Validate(); err != nil {
+				t.Errorf("Invalid response: %v", err)
+			}
+			golden.AssertJSON(t, "payment_"+name+".golden", resp)
+		})
+	}
+}
+
+func TestVerifyPaymentSignature(t *testing.T) {
+	tr := &paymenttest.Transport{Handler: paymenttest.RespondJSON(http.StatusOK, string(golden.Fixture(t, "payment_captured.json")))}
+	g := New(&payment.GatewayConfig{BaseURL: "https://api.razorpay.test", SecretKey: "EnLs21M47BllR3X8PSFtjtbd"}, tr.Client())
+	callback := func(orderID, paymentID string) *payment.VerificationRequest {
+		return &payment.VerificationRequest{RawData: map[string]string{
+			"razorpay_order_id":   orderID,
+			"razorpay_payment_id": paymentID,
+			"razorpay_signature":  "972592aed892074d7fb0c0bb8ee7dd8736eb02d3c281fc503cf6fd8d3af443df",
+		}}
+	}
+
+	resp, err := g.VerifyPayment(context.Background(), callback("order_9A33XWu170gUtm", "pay_29QQoUBi66xm2f"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !resp.Success || resp.TransactionID != "pay_29QQoUBi66xm2f" {
+		t.Errorf("Expected verified payment, got %+v", resp)
+	}
+	if reqs := tr.Requests(); len(reqs) != 1 || reqs[0].URL != "https://api.razorpay.test/v1/payments/pay_29QQoUBi66xm2f" {
+		t.Errorf("Expected the payment to be fetched, got %+v", reqs)
+	}
+	if want := money.New(500, money.MustCurrency("INR")); !resp.PaidAmount.Equals(want) {
+		t.Errorf("Expected the provider's paid amount %s, got %s", want, resp.PaidAmount)
+	}
+
+	resp, err = g.VerifyPayment(context.Background(), callback("order_9A33XWu170gUtm", "pay_forged"))
+	if !errors.Is(err, payment.ErrInvalidCallbackSignature) {
+		t.Errorf("Expected ErrInvalidCallbackSignature, got %v", err)
+	}
+	if resp == nil || resp.Success || resp.Status != payment.StatusFailed {
+		t.Errorf("Expected failed response, got %+v", resp)
+	}
+}
+
+func TestRefundPayment(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/payments/pay_1/refund" {
+			t.Errorf("Unexpected path %s", req.URL.Path)
+		}
+		if key, secret, _ := req.BasicAuth(); key != "rzp_test" || secret != "secret" {
+			t.Errorf("Unexpected credentials %s:%s", key, secret)
+		}
+		got = nil
+		json.NewDecoder(req.Body).Decode(&got)
+		if got["amount"] == 60000.0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":"BAD_REQUEST_ERROR","description":"The refund amount provided is greater than amount captured"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"rfnd_FP8QHiV938haTz","entity":"refund","amount":20000,"payment_id":"pay_1","status":"processed"}`))
+	}))
+	defer srv.Close()
+
+	inr := money.MustCurrency("INR")
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL, APIKey: "rzp_test", SecretKey: "secret",
+		ExtraConfig: map[string]interface{}{ExtraConfigRefundSpeed: "instant"}}, srv.Client())
+
+	resp, err := g.RefundPayment(context.Background(), &payment.RefundRequest{TransactionID: "pay_1", Amount: money.New(200, inr)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !resp.Success || resp.RefundID != "rfnd_FP8QHiV938haTz" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+	if got["amount"] != 20000.0 || got["speed"] != "optimum" {
+		t.Errorf("Unexpected request %v", got)
+	}
+
+	_, err = g.RefundPayment(context.Background(), &payment.RefundRequest{TransactionID: "pay_1", Amount: money.New(600, inr)})
+	if err == nil || payment.HTTPStatusForError(err) != http.StatusBadRequest {
+		t.Errorf("Expected refund above the balance to fail, got %v", err)
+	}
+
+	// A zero amount refunds the balance
+	if _, err := g.RefundPayment(context.Background(), &payment.RefundRequest{TransactionID: "pay_1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := got["amount"]; ok {
+		t.Errorf("Expected no amount for a full refund, got %v", got)
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "rzp_key" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v1/payments/pay_29QQoUBi66xm2f" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(golden.Fixture(t, "payment_captured.json"))
+	}))
+	defer srv.Close()
+
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL, APIKey: "rzp_key", SecretKey: "secret", Currency: "USD"}, srv.Client())
+	status, err := g.GetStatus(context.Background(), &payment.StatusRequest{TransactionID: "pay_29QQoUBi66xm2f"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status.Status != payment.StatusCompleted || status.TransactionID != "pay_29QQoUBi66xm2f" || status.OrderID != "order_9A33XWu170gUtm" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if want := money.NewFromMinor(50000, money.MustCurrency("INR")); !status.Amount.Equals(want) {
+		t.Errorf("Expected amount %s, got %s", want, status.Amount)
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	var cancel map[string]int
+	var plans int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/plans":
+			// An existing plan for another amount is never reused
+			items := `{"id":"plan_0","period":"yearly","interval":1,"item":{"name":"Subscription","amount":100,"currency":"INR"}}`
+			if plans > 0 {
+				items += `,{"id":"plan_1","period":"yearly","interval":1,"item":{"name":"Subscription","amount":99900,"currency":"INR"}}`
+			}
+			w.Write([]byte(`{"items":[` + items + `]}`))
+		case "POST /v1/plans":
+			plans++
+			item, _ := body["item"].(map[string]any)
+			if body["period"] != "yearly" || item["amount"] != 99900.0 || item["currency"] != "INR" {
+				t.Errorf("Unexpected plan %v", body)
+			}
+			fallthrough
+		case "GET /v1/plans/plan_1":
+			w.Write([]byte(`{"id":"plan_1","period":"yearly","interval":1,"item":{"amount":99900,"currency":"INR"}}`))
+		case "POST /v1/subscriptions":
+			if body["plan_id"] != "plan_1" || body["total_count"] != 10.0 || body["start_at"] != 1700604800.0 {
+				t.Errorf("Unexpected subscription %v", body)
+			}
+			fallthrough
+		case "GET /v1/subscriptions/sub_1":
+			w.Write([]byte(`{"id":"sub_1","plan_id":"plan_1","status":"created","short_url":"https://rzp.io/i/1","current_end":null}`))
+		case "POST /v1/subscriptions/sub_1/cancel":
+			cancel = map[string]int{"cancel_at_cycle_end": int(body["cancel_at_cycle_end"].(float64))}
+			w.Write([]byte(`{"id":"sub_1","status":"cancelled"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	// The seven day trial starts the subscription at 1700604800
+	clock := payment.FixedClock(time.Unix(1700000000, 0))
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL, APIKey: "rzp_key", SecretKey: "secret", Clock: clock}, srv.Client()).(*Gateway)
+	ctx := context.Background()
+
+	amount := money.New(999, money.MustCurrency("INR"))
+	want := &payment.SubscriptionResponse{
+		ID:         "sub_1",
+		Status:     payment.SubscriptionPending,
+		Amount:     amount,
+		Interval:   payment.IntervalYearly,
+		PaymentURL: "https://rzp.io/i/1",
+	}
+	req := &payment.SubscriptionRequest{Amount: amount, Interval: payment.IntervalYearly, CustomerEmail: "a@example.com", TrialDays: 7}
+	resp, err := g.CreateSubscription(ctx, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	paymenttest.AssertResponseEqual(t, want, resp)
+
+	// A second subscription to the same plan reuses it
+	if _, err := g.CreateSubscription(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if plans != 1 {
+		t.Errorf("Expected the plan to be reused, created %d", plans)
+	}
+
+	resp, err = g.GetSubscription(ctx, "sub_1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	paymenttest.AssertResponseEqual(t, want, resp)
+
+	if err := g.CancelSubscription(ctx, "sub_1"); err != nil || cancel["cancel_at_cycle_end"] != 0 {
+		t.Errorf("Expected an immediate cancellation, got %v (%v)", err, cancel)
+	}
+}
+
+func TestSubscriptionResponseTrial(t *testing.T) {
+	g := New(&payment.GatewayConfig{}, nil).(*Gateway)
+	now := time.Unix(1700000000, 0)
+	sub := &subscription{ID: "sub_1", Status: "authenticated", StartAt: now.Add(time.Hour).Unix()}
+	resp := g.subscriptionResponse(sub, &plan{Period: "monthly"}, now)
+	if resp.Status != payment.SubscriptionTrialing || !resp.TrialEnd.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected a trial until the start, got %+v", resp)
+	}
+	if resp := g.subscriptionResponse(sub, &plan{}, now.Add(2*time.Hour)); resp.Status != payment.SubscriptionPending || !resp.TrialEnd.IsZero() {
+		t.Errorf("Expected no trial after the start, got %+v", resp)
+	}
+}
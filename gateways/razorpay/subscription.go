@@ -0,0 +1,240 @@
+package razorpay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/oarkflow/payment"
+)
+
+// defaultCycles is the total_count Razorpay requires when the request sets
+// no limit: ten years of charges
+var defaultCycles = map[payment.SubscriptionInterval]int{
+	payment.IntervalMonthly: 120,
+	payment.IntervalYearly:  10,
+}
+
+// subscriptionStatuses maps Razorpay subscription statuses to ours.
+// authenticated is reported as trialing until the first charge is due.
+var subscriptionStatuses = map[string]payment.SubscriptionStatus{
+	"created":       payment.SubscriptionPending,
+	"authenticated": payment.SubscriptionPending,
+	"active":        payment.SubscriptionActive,
+	"pending":       payment.SubscriptionPastDue,
+	"halted":        payment.SubscriptionPastDue,
+	"paused":        payment.SubscriptionPaused,
+	"cancelled":     payment.SubscriptionCanceled,
+	"expired":       payment.SubscriptionCanceled,
+	"completed":     payment.SubscriptionCompleted,
+}
+
+// plan is the subset of a Razorpay plan entity we read
+type plan struct {
+	ID       string `json:"id"`
+	Period   string `json:"period"`
+	Interval int    `json:"interval"`
+	Item     struct {
+		Name     string `json:"name"`
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+	} `json:"item"`
+}
+
+// subscription is the subset of a Razorpay subscription entity we read
+type subscription struct {
+	ID         string `json:"id"`
+	PlanID     string `json:"plan_id"`
+	Status     string `json:"status"`
+	ShortURL   string `json:"short_url"`
+	StartAt    int64  `json:"start_at"`
+	CurrentEnd int64  `json:"current_end"`
+}
+
+// CreateSubscription subscribes the customer to the plan for the amount and
+// interval, created on first use. The customer authorizes the mandate at the
+// response's PaymentURL; a trial delays the first charge by starting the
+// subscription later.
+func (r *Gateway) CreateSubscription(ctx context.Context, req *payment.SubscriptionRequest) (*payment.SubscriptionResponse, error) {
+	if err := payment.SandboxError(r.config, r.GetMethod(), req.Amount); err != nil {
+		return nil, err
+	}
+	cycles, ok := defaultCycles[req.Interval]
+	if !ok {
+		return nil, fmt.Errorf("razorpay: unsupported subscription interval %q", req.Interval)
+	}
+	if req.Cycles > 0 {
+		cycles = req.Cycles
+	}
+
+	p, err := r.subscriptionPlan(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]interface{}{
+		"plan_id":         p.ID,
+		"total_count":     cycles,
+		"customer_notify": 1,
+		"notify_info":     map[string]string{"notify_email": req.CustomerEmail},
+	}
+	if req.TrialDays > 0 {
+		payload["start_at"] = r.config.Now().AddDate(0, 0, req.TrialDays).Unix()
+	}
+	if notes := payment.NamespaceMetadata(req.Metadata); notes != nil {
+		payload["notes"] = notes
+	}
+	var sub subscription
+	if err := r.call(ctx, http.MethodPost, "/v1/subscriptions", payload, &sub); err != nil {
+		return nil, err
+	}
+	return r.subscriptionResponse(&sub, p, r.config.Now()), nil
+}
+
+// plansPageSize is how many plans subscriptionPlan reads per page
+const plansPageSize = 100
+
+// subscriptionPlan returns the plan billing req's amount every interval
+// under its description, creating it if no existing plan matches, so
+// subscriptions to the same plan share it
+func (r *Gateway) subscriptionPlan(ctx context.Context, req *payment.SubscriptionRequest) (*plan, error) {
+	name := req.Description
+	if name == "" {
+		name = "Subscription"
+	}
+	amount := payment.AmountInMinorUnits(r.config, req.Amount)
+	currency := req.Amount.Currency().Code
+
+	for skip := 0; ; skip += plansPageSize {
+		var page struct {
+			Items []plan `json:"items"`
+		}
+		query := url.Values{"count": {strconv.Itoa(plansPageSize)}, "skip": {strconv.Itoa(skip)}}
+		if err := r.call(ctx, http.MethodGet, "/v1/plans?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		for i, p := range page.Items {
+			if p.Period == string(req.Interval) && p.Interval == 1 && p.Item.Name == name &&
+				p.Item.Amount == amount && p.Item.Currency == currency {
+				return &page.Items[i], nil
+			}
+		}
+		if len(page.Items) < plansPageSize {
+			break
+		}
+	}
+
+	payload := map[string]interface{}{
+		"period":   string(req.Interval),
+		"interval": 1,
+		"item": map[string]interface{}{
+			"name":     name,
+			"amount":   amount,
+			"currency": currency,
+		},
+	}
+	var p plan
+	if err := r.call(ctx, http.MethodPost, "/v1/plans", payload, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CancelSubscription cancels the subscription immediately rather than at
+// the end of the current cycle
+func (r *Gateway) CancelSubscription(ctx context.Context, id string) error {
+	path := fmt.Sprintf("/v1/subscriptions/%s/cancel", url.PathEscape(id))
+	return r.call(ctx, http.MethodPost, path, map[string]int{"cancel_at_cycle_end": 0}, nil)
+}
+
+// GetSubscription fetches a subscription and, for its amount, its plan
+func (r *Gateway) GetSubscription(ctx context.Context, id string) (*payment.SubscriptionResponse, error) {
+	var sub subscription
+	if err := r.call(ctx, http.MethodGet, "/v1/subscriptions/"+url.PathEscape(id), nil, &sub); err != nil {
+		return nil, err
+	}
+	var p plan
+	if err := r.call(ctx, http.MethodGet, "/v1/plans/"+url.PathEscape(sub.PlanID), nil, &p); err != nil {
+		return nil, err
+	}
+	return r.subscriptionResponse(&sub, &p, r.config.Now()), nil
+}
+
+// subscriptionResponse converts a Razorpay subscription on plan p. A start
+// after now is the end of the trial. Unknown statuses are reported as
+// pending.
+func (r *Gateway) subscriptionResponse(sub *subscription, p *plan, now time.Time) *payment.SubscriptionResponse {
+	resp := &payment.SubscriptionResponse{
+		ID:         sub.ID,
+		Status:     subscriptionStatuses[sub.Status],
+		Amount:     r.minorAmount(p.Item.Amount, p.Item.Currency),
+		Interval:   payment.SubscriptionInterval(p.Period),
+		PaymentURL: sub.ShortURL,
+	}
+	if resp.Status == "" {
+		resp.Status = payment.SubscriptionPending
+	}
+	if start := time.Unix(sub.StartAt, 0); sub.StartAt > 0 && start.After(now) {
+		resp.TrialEnd = start
+		if sub.Status == "authenticated" {
+			resp.Status = payment.SubscriptionTrialing
+		}
+	}
+	if sub.CurrentEnd > 0 {
+		resp.CurrentPeriodEnd = time.Unix(sub.CurrentEnd, 0)
+	}
+	return resp
+}
+
+// call sends payload, if any, as JSON to the Razorpay API and decodes the
+// response into out, unless it is nil
+func (r *Gateway) call(ctx context.Context, method, path string, payload, out any) error {
+	return r.callIdempotent(ctx, method, path, payload, "", out)
+}
+
+// callIdempotent is call with idempotencyKey, if any, sent as the
+// Idempotency-Key header so Razorpay replays a retried request
+func (r *Gateway) callIdempotent(ctx context.Context, method, path string, payload any, idempotencyKey string, out any) error {
+	endpoint := r.config.BaseURL + path
+	dbg := payment.NewDebugRequest(r.config, method, endpoint, nil, "")
+
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(jsonData)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	httpReq.SetBasicAuth(r.config.APIKey, r.config.SecretKey)
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if idempotencyKey != "" {
+		httpReq.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		return payment.WithDebugRequest(r.GetMethod(), payment.WrapTransportError(r.GetMethod(), err), dbg)
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		out = &json.RawMessage{}
+	}
+	if err := payment.DecodeJSONResponse(r.GetMethod(), resp, out); err != nil {
+		return payment.WithDebugRequest(r.GetMethod(), err, dbg)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package razorpay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+)
+
+// event is the subset of a Razorpay webhook we read
+type event struct {
+	Event   string `json:"event"`
+	Payload struct {
+		Payment struct {
+			Entity paymentEntity `json:"entity"`
+		} `json:"payment"`
+		Refund struct {
+			Entity refundEntity `json:"entity"`
+		} `json:"refund"`
+		Dispute struct {
+			Entity disputeEntity `json:"entity"`
+		} `json:"dispute"`
+	} `json:"payload"`
+}
+
+type paymentEntity struct {
+	ID       string            `json:"id"`
+	OrderID  string            `json:"order_id"`
+	Amount   int64             `json:"amount"`
+	Currency string            `json:"currency"`
+	Status   string            `json:"status"`
+	Method   string            `json:"method"`
+	Notes    map[string]string `json:"notes"`
+	// Set on fetched payments
+	Fee            int64  `json:"fee"`
+	AmountRefunded int64  `json:"amount_refunded"`
+	RefundStatus   string `json:"refund_status"`
+	// Set on failed payments
+	ErrorCode        string `json:"error_code"`
+	ErrorDescription string `json:"error_description"`
+	ErrorReason      string `json:"error_reason"`
+}
+
+type refundEntity struct {
+	ID        string            `json:"id"`
+	PaymentID string            `json:"payment_id"`
+	Amount    int64             `json:"amount"`
+	Currency  string            `json:"currency"`
+	Status    string            `json:"status"`
+	Notes     map[string]string `json:"notes"`
+}
+
+type disputeEntity struct {
+	ID                string `json:"id"`
+	PaymentID         string `json:"payment_id"`
+	Amount            int64  `json:"amount"`
+	Currency          string `json:"currency"`
+	ReasonCode        string `json:"reason_code"`
+	ReasonDescription string `json:"reason_description"`
+	RespondBy         int64  `json:"respond_by"`
+	Phase             string `json:"phase"`
+}
+
+// ValidateWebhook verifies the X-Razorpay-Signature header
+func (r *Gateway) ValidateWebhook(req *http.Request) error {
+	body, err := payment.ReadWebhookBody(req)
+	if err != nil {
+		return err
+	}
+
+	signature := req.Header.Get("X-Razorpay-Signature")
+	if signature == "" {
+		return errors.New("razorpay: missing X-Razorpay-Signature header")
+	}
+
+	mac := hmac.New(sha256.New, []byte(r.config.GetWebhookSecret()))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return errors.New("razorpay: signature mismatch")
+	}
+	return nil
+}
+
+// ParseWebhook parses payment, refund and dispute events. Other events fail
+// with payment.ErrWebhookEventIgnored.
+func (r *Gateway) ParseWebhook(req *http.Request) (*payment.WebhookData, error) {
+	body, err := payment.ReadWebhookBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var evt event
+	if err := json.Unmarshal(body, &evt); err != nil {
+		return nil, fmt.Errorf("razorpay: invalid webhook payload: %w", err)
+	}
+	pay := evt.Payload.Payment.Entity
+	refund := evt.Payload.Refund.Entity
+
+	data := &payment.WebhookData{
+		ProviderEvent: evt.Event,
+		RawData:       map[string]string{"event": evt.Event},
+	}
+
+	switch evt.Event {
+	case "payment.captured", "payment.authorized", "payment.failed":
+		data.EventType = payment.EventPayment
+		data.TransactionID = pay.ID
+		data.OrderID = pay.OrderID
+		data.Amount = r.minorAmount(pay.Amount, pay.Currency)
+		data.Metadata = payment.StripMetadataNamespace(pay.Notes)
+		data.Status = map[string]payment.PaymentStatus{
+			"payment.captured":   payment.StatusCompleted,
+			"payment.authorized": payment.StatusPending,
+			"payment.failed":     payment.StatusFailed,
+		}[evt.Event]
+		data.RawData["method"] = pay.Method
+	case "refund.created", "refund.processed", "refund.failed":
+		data.EventType = payment.EventRefund
+		data.RefundID = refund.ID
+		data.TransactionID = refund.PaymentID
+		data.OrderID = pay.OrderID
+		data.Amount = r.minorAmount(refund.Amount, refund.Currency)
+		data.Metadata = payment.StripMetadataNamespace(refund.Notes)
+		data.Status = map[string]payment.PaymentStatus{
+			"refund.created":   payment.StatusPending,
+			"refund.processed": payment.StatusRefunded,
+			"refund.failed":    payment.StatusFailed,
+		}[evt.Event]
+	case "payment.dispute.created", "payment.dispute.action_required", "payment.dispute.under_review":
+		dispute := evt.Payload.Dispute.Entity
+		data.EventType = payment.EventDispute
+		if dispute.Phase == "chargeback" {
+			data.EventType = payment.EventChargeback
+		}
+		data.DisputeID = dispute.ID
+		data.TransactionID = dispute.PaymentID
+		data.OrderID = pay.OrderID
+		data.Reason = dispute.ReasonCode
+		if dispute.ReasonDescription != "" {
+			data.Reason = dispute.ReasonCode + ": " + dispute.ReasonDescription
+		}
+		data.Amount = r.minorAmount(dispute.Amount, dispute.Currency)
+		data.Status = payment.StatusDisputed
+		if dispute.RespondBy > 0 {
+			data.DueBy = time.Unix(dispute.RespondBy, 0)
+		}
+	default:
+		return nil, fmt.Errorf("%w: razorpay %s", payment.ErrWebhookEventIgnored, evt.Event)
+	}
+
+	return data, nil
+}
+
+// minorAmount builds money from a Razorpay amount in paise or the
+// currency's other minor unit, honouring the minor_units override
+func (r *Gateway) minorAmount(amount int64, currency string) money.Money {
+	c, ok := money.GetCurrency(currency)
+	if !ok {
+		c = money.MustCurrency(r.config.Currency)
+	}
+	return payment.AmountFromMinorUnits(r.config, amount, c)
+}
@@ -0,0 +1,84 @@
+package stripe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/oarkflow/payment"
+)
+
+// balanceFunds is one currency's entry in a Stripe balance list
+type balanceFunds struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// GetBalance retrieves the account balance from /v1/balance
+func (s *Gateway) GetBalance(ctx context.Context) ([]payment.Balance, error) {
+	balanceURL := s.config.BaseURL + "/v1/balance"
+	dbg := payment.NewDebugRequest(s.config, http.MethodGet, balanceURL, nil, "")
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", balanceURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+s.config.SecretKey)
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return nil, payment.WithDebugRequest(s.GetMethod(), payment.WrapTransportError(s.GetMethod(), err), dbg)
+	}
+	defer resp.Body.Close()
+
+	body, err := payment.ReadResponseBody(s.GetMethod(), resp)
+	if err != nil {
+		return nil, payment.WithDebugRequest(s.GetMethod(), err, dbg)
+	}
+	return s.parseBalance(body)
+}
+
+// parseBalance merges a balance object's available and pending lists into
+// one Balance per currency, sorted by currency
+func (s *Gateway) parseBalance(body []byte) ([]payment.Balance, error) {
+	var result struct {
+		Available []balanceFunds `json:"available"`
+		Pending   []balanceFunds `json:"pending"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("stripe: invalid balance: %w", err)
+	}
+
+	byCurrency := map[string]*payment.Balance{}
+	entry := func(currency string) *payment.Balance {
+		code := strings.ToUpper(currency)
+		b, ok := byCurrency[code]
+		if !ok {
+			b = &payment.Balance{
+				Currency:  code,
+				Available: s.minorAmount(0, code),
+				Pending:   s.minorAmount(0, code),
+			}
+			byCurrency[code] = b
+		}
+		return b
+	}
+	for _, f := range result.Available {
+		b := entry(f.Currency)
+		b.Available = s.minorAmount(f.Amount, b.Currency)
+	}
+	for _, f := range result.Pending {
+		b := entry(f.Currency)
+		b.Pending = s.minorAmount(f.Amount, b.Currency)
+	}
+
+	balances := make([]payment.Balance, 0, len(byCurrency))
+	for _, b := range byCurrency {
+		balances = append(balances, *b)
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].Currency < balances[j].Currency })
+	return balances, nil
+}
@@ -2,8 +2,13 @@ package stripe
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/oarkflow/money"
@@ -18,12 +23,9 @@ type Gateway struct {
 
 // New creates a new Stripe gateway instance
 func New(config *payment.GatewayConfig, client *http.Client) payment.Gateway {
+	// Test mode is selected by the sk_test_ key, not the host
 	if config.BaseURL == "" {
-		if config.Sandbox {
-			config.BaseURL = "https://api.stripe.com/test"
-		} else {
-			config.BaseURL = "https://api.stripe.com"
-		}
+		config.BaseURL = "https://api.stripe.com"
 	}
 	if config.Currency == "" {
 		config.Currency = "USD"
@@ -34,52 +36,628 @@ func New(config *payment.GatewayConfig, client *http.Client) payment.Gateway {
 func (s *Gateway) GetName() string   { return "Stripe" }
 func (s *Gateway) GetMethod() string { return "stripe" }
 
-// InitiatePayment initiates a payment through Stripe
+// TestMode reports whether the gateway is configured for the sandbox
+func (s *Gateway) TestMode() bool { return s.config.Sandbox }
+
+// Capabilities reports a Checkout redirect with partial refunds, webhooks
+// and recurring billing of saved customers through subscriptions
+func (s *Gateway) Capabilities() payment.GatewayCapabilities {
+	return payment.GatewayCapabilities{
+		Flow:          payment.FlowRedirect,
+		Refund:        true,
+		PartialRefund: true,
+		StatusCheck:   true,
+		Webhook:       true,
+		Recurring:     true,
+	}
+}
+
+// supportedCurrencies are the presentment currencies Stripe charges in
+var supportedCurrencies = []string{
+	"AED", "AUD", "BDT", "BRL", "CAD", "CHF", "CNY", "CZK", "DKK", "EGP",
+	"EUR", "GBP", "HKD", "HUF", "IDR", "ILS", "INR", "JPY", "KES", "KRW",
+	"LKR", "MXN", "MYR", "NGN", "NOK", "NPR", "NZD", "PHP", "PKR", "PLN",
+	"QAR", "RON", "SAR", "SEK", "SGD", "THB", "TRY", "TWD", "USD", "VND",
+	"ZAR",
+}
+
+// SupportedCurrencies returns the currencies Stripe charges in
+func (s *Gateway) SupportedCurrencies() []string { return supportedCurrencies }
+
+// ExtraConfigSchema reports that no gateway-specific ExtraConfig keys are used
+func (s *Gateway) ExtraConfigSchema() payment.ExtraConfigSchema { return nil }
+
+// InitiatePayment creates a Stripe Checkout Session for the payment,
+// sending req.IdempotencyKey as the Idempotency-Key header. Tax is sent as
+// its own line item, see lineItems.
 func (s *Gateway) InitiatePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.PaymentResponse, error) {
-	// In a real implementation, this would create a Stripe Checkout Session
-	paymentURL := fmt.Sprintf("%s/checkout/%s", s.config.BaseURL, req.OrderID)
+	if err := payment.SandboxError(s.config, s.GetMethod(), req.Amount); err != nil {
+		return nil, err
+	}
+	items := s.lineItems(req)
+	form := s.sessionForm(req, items)
 
+	var session checkoutSession
+	if err := s.callIdempotent(ctx, http.MethodPost, "/v1/checkout/sessions", form, req.IdempotencyKey, &session); err != nil {
+		return nil, err
+	}
+	if session.ID == "" || session.URL == "" {
+		return nil, errors.New("stripe: Checkout Session response is missing id or url")
+	}
+	// Sessions created on API versions that defer the PaymentIntent have no
+	// transaction id yet; they are verified by SessionID, which resolves it
 	return &payment.PaymentResponse{
 		Success:       true,
-		PaymentURL:    paymentURL,
-		TransactionID: fmt.Sprintf("pi_%d", time.Now().UnixNano()),
+		PaymentURL:    session.URL,
+		TransactionID: session.PaymentIntent,
+		SessionID:     session.ID,
 		OrderID:       req.OrderID,
 		Message:       "Payment session created successfully",
+		Metadata:      items,
 	}, nil
 }
 
-// VerifyPayment verifies a payment with Stripe
-func (s *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRequest) (*payment.VerificationResponse, error) {
-	// In a real implementation, this would call Stripe's API to verify the payment
-	return &payment.VerificationResponse{
+// checkoutSession is the subset of a Checkout Session initiation reads
+type checkoutSession struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	Status        string `json:"status"`
+	PaymentIntent string `json:"payment_intent"`
+}
+
+// sessionForm returns the Checkout Session parameters for req, one line
+// item per entry of items
+func (s *Gateway) sessionForm(req *payment.PaymentRequest, items map[string]string) url.Values {
+	cancelURL := req.FailureURL
+	if cancelURL == "" {
+		cancelURL = req.SuccessURL
+	}
+	form := url.Values{
+		"mode":                {"payment"},
+		"success_url":         {req.SuccessURL},
+		"cancel_url":          {cancelURL},
+		"client_reference_id": {req.OrderID},
+	}
+	if id := req.Metadata[payment.MetadataCustomerID]; id != "" {
+		form.Set("customer", id)
+	} else if req.CustomerEmail != "" {
+		form.Set("customer_email", req.CustomerEmail)
+	}
+	// Copy metadata to the PaymentIntent too, which verification reads
+	for k, v := range payment.NamespaceMetadata(req.Metadata) {
+		form.Set("metadata["+k+"]", v)
+		form.Set("payment_intent_data[metadata]["+k+"]", v)
+	}
+
+	name := req.Description
+	if name == "" {
+		name = "Order " + req.OrderID
+	}
+	currency := strings.ToLower(req.Amount.Currency().Code)
+	if currency == "" {
+		currency = strings.ToLower(s.config.Currency)
+	}
+	for i, item := range []struct{ key, name string }{{"line_item_order", name}, {"line_item_tax", "Tax"}} {
+		amount, ok := items[item.key]
+		if !ok {
+			continue
+		}
+		prefix := fmt.Sprintf("line_items[%d]", i)
+		form.Set(prefix+"[quantity]", "1")
+		form.Set(prefix+"[price_data][currency]", currency)
+		form.Set(prefix+"[price_data][unit_amount]", amount)
+		form.Set(prefix+"[price_data][product_data][name]", item.name)
+	}
+	return form
+}
+
+// ResumePayment retrieves txn's Checkout Session and returns its URL while
+// the session is still open. Completed and expired sessions can't be
+// resumed and return payment.ErrPaymentExpired.
+func (s *Gateway) ResumePayment(ctx context.Context, txn *payment.Transaction) (*payment.PaymentResponse, error) {
+	if txn.SessionID == "" {
+		return nil, payment.ErrPaymentExpired
+	}
+	var session checkoutSession
+	if err := s.call(ctx, http.MethodGet, "/v1/checkout/sessions/"+url.PathEscape(txn.SessionID), nil, &session); err != nil {
+		return nil, err
+	}
+	if session.Status != "open" || session.URL == "" {
+		return nil, payment.ErrPaymentExpired
+	}
+	return &payment.PaymentResponse{
 		Success:       true,
-		Status:        payment.StatusCompleted,
-		TransactionID: req.TransactionID,
+		PaymentURL:    session.URL,
+		TransactionID: txn.ProviderID(),
+		SessionID:     txn.SessionID,
+		OrderID:       txn.OrderID,
+		Message:       "Payment session resumed",
+	}, nil
+}
+
+// SupportsTaxLineItems reports that Stripe itemizes req.TaxAmount
+func (s *Gateway) SupportsTaxLineItems() bool { return true }
+
+// lineItems returns the Checkout line item amounts in minor units, echoed in
+// the response metadata. Exclusive tax is added as a separate tax item;
+// inclusive tax is split out of the order amount so the items still sum to
+// the total.
+func (s *Gateway) lineItems(req *payment.PaymentRequest) map[string]string {
+	items := map[string]string{"line_item_order": strconv.FormatInt(payment.AmountInMinorUnits(s.config, req.Amount), 10)}
+	if !req.HasTax() {
+		return items
+	}
+	net := payment.AmountInMinorUnits(s.config, req.Amount)
+	if req.TaxInclusive {
+		net -= payment.AmountInMinorUnits(s.config, req.TaxAmount)
+	}
+	items["line_item_order"] = strconv.FormatInt(net, 10)
+	items["line_item_tax"] = strconv.FormatInt(payment.AmountInMinorUnits(s.config, req.TaxAmount), 10)
+	return items
+}
+
+// ForwardsIdempotencyKey reports that InitiatePayment sends the
+// Idempotency-Key header, so retrying it is safe
+func (s *Gateway) ForwardsIdempotencyKey() bool { return true }
+
+// RequiredVerificationFields reports that verification needs the PaymentIntent or Checkout Session id
+func (s *Gateway) RequiredVerificationFields() []string {
+	return []string{"transaction_id|session_id"}
+}
+
+// VerifyPayment retrieves the PaymentIntent, or the Checkout Session with
+// its PaymentIntent expanded when only SessionID is known, and reports its
+// status. A session that has no PaymentIntent yet is pending, or canceled
+// once expired.
+func (s *Gateway) VerifyPayment(ctx context.Context, req *payment.VerificationRequest) (*payment.VerificationResponse, error) {
+	var (
+		body []byte
+		err  error
+	)
+	orderID := req.OrderID
+	if req.TransactionID != "" {
+		body, err = s.retrieve(ctx, "/v1/payment_intents/"+url.PathEscape(req.TransactionID)+"?expand[]=latest_charge.balance_transaction")
+	} else {
+		var session *sessionIntent
+		session, err = s.retrieveSessionIntent(ctx, req.SessionID)
+		if err == nil {
+			body = session.PaymentIntent
+			if orderID == "" {
+				orderID = session.ClientReferenceID
+			}
+		}
+	}
+	switch {
+	case errors.Is(err, errSessionExpired):
+		return s.unpaidSession(req, orderID, payment.StatusCanceled), nil
+	case err != nil:
+		return nil, err
+	case body == nil:
+		return s.unpaidSession(req, orderID, payment.StatusPending), nil
+	}
+
+	vresp, err := s.parseVerifyResponse(body, req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if vresp.OrderID == "" {
+		vresp.OrderID = orderID
+	}
+	return vresp, nil
+}
+
+// errSessionExpired reports a Checkout Session that expired unpaid
+var errSessionExpired = errors.New("stripe: checkout session expired")
+
+// sessionIntent is the subset of a Checkout Session, with payment_intent
+// expanded, that verification reads
+type sessionIntent struct {
+	Status            string          `json:"status"`
+	ClientReferenceID string          `json:"client_reference_id"`
+	PaymentIntent     json.RawMessage `json:"payment_intent"`
+}
+
+// retrieveSessionIntent returns a Checkout Session with its PaymentIntent
+// expanded, which is nil when the session has none yet, or
+// errSessionExpired if it expired without one
+func (s *Gateway) retrieveSessionIntent(ctx context.Context, sessionID string) (*sessionIntent, error) {
+	body, err := s.retrieve(ctx, "/v1/checkout/sessions/"+url.PathEscape(sessionID)+"?expand[]=payment_intent.latest_charge.balance_transaction")
+	if err != nil {
+		return nil, err
+	}
+	var session sessionIntent
+	if err := json.Unmarshal(body, &session); err != nil {
+		return nil, fmt.Errorf("stripe: invalid Checkout Session: %w", err)
+	}
+	if string(session.PaymentIntent) == "null" {
+		session.PaymentIntent = nil
+	}
+	if session.PaymentIntent == nil && session.Status == "expired" {
+		return nil, errSessionExpired
+	}
+	return &session, nil
+}
+
+// unpaidSession reports a Checkout Session without a PaymentIntent
+func (s *Gateway) unpaidSession(req *payment.VerificationRequest, orderID string, status payment.PaymentStatus) *payment.VerificationResponse {
+	return payment.NewVerificationResponse(
+		payment.WithStatus(status),
+		payment.WithOrderID(orderID),
+		payment.WithAmount(req.Amount),
+		payment.WithCurrency(s.config.Currency),
+	)
+}
+
+// retrieve GETs path from the Stripe API and returns the response body
+func (s *Gateway) retrieve(ctx context.Context, path string) ([]byte, error) {
+	endpoint := s.config.BaseURL + path
+	dbg := payment.NewDebugRequest(s.config, http.MethodGet, endpoint, nil, "")
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+s.config.SecretKey)
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return nil, payment.WithDebugRequest(s.GetMethod(), payment.WrapTransportError(s.GetMethod(), err), dbg)
+	}
+	defer resp.Body.Close()
+
+	body, err := payment.ReadResponseBody(s.GetMethod(), resp)
+	if err != nil {
+		return nil, payment.WithDebugRequest(s.GetMethod(), err, dbg)
+	}
+	return body, nil
+}
+
+// paymentIntent is the subset of a PaymentIntent, with latest_charge
+// expanded, that verification reads
+type paymentIntent struct {
+	ID             string            `json:"id"`
+	Status         string            `json:"status"`
+	Amount         int64             `json:"amount"`
+	AmountReceived int64             `json:"amount_received"`
+	Currency       string            `json:"currency"`
+	Metadata       map[string]string `json:"metadata"`
+	// LastPaymentError explains the most recent failed attempt
+	LastPaymentError struct {
+		Code        string `json:"code"`
+		DeclineCode string `json:"decline_code"`
+		Message     string `json:"message"`
+	} `json:"last_payment_error"`
+	LatestCharge struct {
+		AmountRefunded     int64 `json:"amount_refunded"`
+		Refunded           bool  `json:"refunded"`
+		BalanceTransaction struct {
+			Fee int64 `json:"fee"`
+		} `json:"balance_transaction"`
+		PaymentMethodDetails struct {
+			Type string `json:"type"`
+		} `json:"payment_method_details"`
+	} `json:"latest_charge"`
+}
+
+// intentStatuses maps PaymentIntent statuses to payment statuses
+var intentStatuses = map[string]payment.PaymentStatus{
+	"succeeded":               payment.StatusCompleted,
+	"processing":              payment.StatusPending,
+	"requires_payment_method": payment.StatusFailed,
+	"requires_confirmation":   payment.StatusPending,
+	"requires_action":         payment.StatusRequiresAction,
+	"requires_capture":        payment.StatusAuthorized,
+	"canceled":                payment.StatusCanceled,
+}
+
+// parseVerifyResponse builds the verification from a retrieved
+// PaymentIntent. amount is the amount we requested.
+func (s *Gateway) parseVerifyResponse(body []byte, amount money.Money) (*payment.VerificationResponse, error) {
+	var pi paymentIntent
+	if err := json.Unmarshal(body, &pi); err != nil {
+		return nil, fmt.Errorf("stripe: invalid PaymentIntent: %w", err)
+	}
+
+	status, ok := intentStatuses[pi.Status]
+	if !ok {
+		status = payment.StatusPending
+	}
+	charge := pi.LatestCharge
+	if status == payment.StatusCompleted && charge.AmountRefunded > 0 {
+		status = payment.StatusPartiallyRefunded
+		if charge.Refunded {
+			status = payment.StatusRefunded
+		}
+	}
+
+	metadata := payment.StripMetadataNamespace(pi.Metadata)
+	if charge.PaymentMethodDetails.Type != "" {
+		metadata[payment.MetadataPaymentMethodType] = charge.PaymentMethodDetails.Type
+	}
+	currency := strings.ToUpper(pi.Currency)
+	if currency == "" {
+		currency = s.config.Currency
+	}
+	// Without an expected amount, report the amount the intent was for
+	if amount.Currency().Code == "" {
+		amount = s.minorAmount(pi.Amount, currency)
+	}
+
+	opts := []payment.VerificationOption{
+		payment.WithStatus(status),
+		payment.WithTransactionID(pi.ID),
+		payment.WithAmount(amount),
+		payment.WithMetadata(metadata),
+		payment.WithCurrency(currency),
+	}
+	// Card declines carry a decline_code; other failures only a code
+	if lastErr := pi.LastPaymentError; lastErr.Code != "" || lastErr.DeclineCode != "" {
+		code := lastErr.DeclineCode
+		if code == "" {
+			code = lastErr.Code
+		}
+		opts = append(opts, payment.WithDecline(code))
+		if lastErr.Message != "" {
+			opts = append(opts, payment.WithMessage(lastErr.Message))
+		}
+	}
+	if pi.AmountReceived > 0 {
+		opts = append(opts,
+			payment.WithPaidAmount(s.minorAmount(pi.AmountReceived, currency)),
+			payment.WithFee(s.minorAmount(charge.BalanceTransaction.Fee, currency)),
+		)
+	}
+	return payment.NewVerificationResponse(opts...), nil
+}
+
+// GetOrCreateCustomer returns the Stripe customer for ref, creating it if missing
+func (s *Gateway) GetOrCreateCustomer(ctx context.Context, ref payment.CustomerRef) (string, error) {
+	if ref.ExternalID == "" && ref.Email == "" {
+		return "", errors.New("stripe: customer needs an external id or email")
+	}
+	return s.findOrCreateCustomer(ctx, ref)
+}
+
+// findOrCreateCustomer returns the id of the customer matching ref, creating
+// one if there is none. Customers are found by metadata['external_id'] when
+// ref has an ExternalID, else by email.
+func (s *Gateway) findOrCreateCustomer(ctx context.Context, ref payment.CustomerRef) (string, error) {
+	var found list
+	if ref.ExternalID != "" {
+		query := url.Values{
+			"query": {"metadata['external_id']:'" + strings.ReplaceAll(ref.ExternalID, "'", `\'`) + "'"},
+			"limit": {"1"},
+		}
+		if err := s.call(ctx, http.MethodGet, "/v1/customers/search?"+query.Encode(), nil, &found); err != nil {
+			return "", err
+		}
+	} else {
+		query := url.Values{"email": {ref.Email}, "limit": {"1"}}
+		if err := s.call(ctx, http.MethodGet, "/v1/customers?"+query.Encode(), nil, &found); err != nil {
+			return "", err
+		}
+	}
+	if len(found.Data) > 0 {
+		return found.Data[0].ID, nil
+	}
+
+	form := url.Values{}
+	if ref.Email != "" {
+		form.Set("email", ref.Email)
+	}
+	if ref.Name != "" {
+		form.Set("name", ref.Name)
+	}
+	if ref.Phone != "" {
+		form.Set("phone", ref.Phone)
+	}
+	if ref.ExternalID != "" {
+		form.Set("metadata[external_id]", ref.ExternalID)
+	}
+	var customer struct {
+		ID string `json:"id"`
+	}
+	if err := s.call(ctx, http.MethodPost, "/v1/customers", form, &customer); err != nil {
+		return "", err
+	}
+	return customer.ID, nil
+}
+
+// ParseReturnURL reads the Checkout success redirect (session_id) or the
+// PaymentIntent redirect (payment_intent)
+func (s *Gateway) ParseReturnURL(values url.Values) (*payment.VerificationRequest, error) {
+	sessionID := values.Get("session_id")
+	intentID := values.Get("payment_intent")
+	if sessionID == "" && intentID == "" {
+		return nil, errors.New("stripe: return URL is missing session_id and payment_intent")
+	}
+	return &payment.VerificationRequest{
+		TransactionID: intentID,
+		SessionID:     sessionID,
+		RawData:       payment.ValuesToRawData(values),
+	}, nil
+}
+
+// authorizationValidity is how long Stripe holds uncaptured card payments
+const authorizationValidity = 7 * 24 * time.Hour
+
+// MetadataPaymentMethod is the PaymentRequest.Metadata key carrying the
+// saved Stripe PaymentMethod (pm_…) that AuthorizePayment places the hold on
+const MetadataPaymentMethod = "payment_method"
+
+// heldIntent is the subset of a PaymentIntent authorization reads
+type heldIntent struct {
+	ID               string `json:"id"`
+	Status           string `json:"status"`
+	Amount           int64  `json:"amount"`
+	AmountCapturable int64  `json:"amount_capturable"`
+	AmountReceived   int64  `json:"amount_received"`
+	Currency         string `json:"currency"`
+	LastPaymentError struct {
+		Message string `json:"message"`
+	} `json:"last_payment_error"`
+}
+
+// AuthorizePayment places a hold by confirming a PaymentIntent with
+// capture_method=manual on the PaymentMethod in
+// req.Metadata[MetadataPaymentMethod]. The hold is placed only if the
+// intent reaches requires_capture; one needing customer action such as 3-D
+// Secure is reported unsuccessful.
+func (s *Gateway) AuthorizePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.AuthorizationResponse, error) {
+	if err := payment.SandboxError(s.config, s.GetMethod(), req.Amount); err != nil {
+		return nil, err
+	}
+	paymentMethod := req.Metadata[MetadataPaymentMethod]
+	if paymentMethod == "" {
+		return nil, payment.NewPaymentError(payment.ErrKindValidation, s.GetMethod(), "authorization needs metadata "+MetadataPaymentMethod, nil)
+	}
+	currency := strings.ToLower(req.Amount.Currency().Code)
+	if currency == "" {
+		currency = strings.ToLower(s.config.Currency)
+	}
+	form := url.Values{
+		"amount":               {strconv.FormatInt(payment.AmountInMinorUnits(s.config, req.Amount), 10)},
+		"currency":             {currency},
+		"capture_method":       {"manual"},
+		"payment_method":       {paymentMethod},
+		"payment_method_types": {"card"},
+		"confirm":              {"true"},
+	}
+	if req.OrderID != "" {
+		form.Set("metadata[order_id]", req.OrderID)
+	}
+	if id := req.Metadata[payment.MetadataCustomerID]; id != "" {
+		form.Set("customer", id)
+	}
+	if req.Description != "" {
+		form.Set("description", req.Description)
+	}
+	for k, v := range payment.NamespaceMetadata(req.Metadata) {
+		form.Set("metadata["+k+"]", v)
+	}
+
+	var pi heldIntent
+	if err := s.callIdempotent(ctx, http.MethodPost, "/v1/payment_intents", form, req.IdempotencyKey, &pi); err != nil {
+		return nil, err
+	}
+	resp := &payment.AuthorizationResponse{
+		Success:       pi.Status == "requires_capture",
+		TransactionID: pi.ID,
 		OrderID:       req.OrderID,
-		Amount:        req.Amount,
-		PaidAmount:    req.Amount,
-		Message:       "Payment verified successfully",
+		Amount:        s.minorAmount(pi.AmountCapturable, strings.ToUpper(pi.Currency)),
+		Message:       "Payment authorized successfully",
+	}
+	if !resp.Success {
+		resp.Amount = req.Amount
+		resp.Message = "PaymentIntent is " + pi.Status
+		if pi.LastPaymentError.Message != "" {
+			resp.Message = pi.LastPaymentError.Message
+		}
+		return resp, nil
+	}
+	resp.ExpiresAt = s.config.Now().Add(authorizationValidity)
+	return resp, nil
+}
+
+// CapturePayment captures a held PaymentIntent. A zero req.Amount captures
+// the full hold.
+func (s *Gateway) CapturePayment(ctx context.Context, req *payment.CaptureRequest) (*payment.CaptureResponse, error) {
+	form := url.Values{}
+	if !req.Amount.IsZero() {
+		form.Set("amount_to_capture", strconv.FormatInt(payment.AmountInMinorUnits(s.config, req.Amount), 10))
+	}
+	var pi heldIntent
+	if err := s.call(ctx, http.MethodPost, "/v1/payment_intents/"+url.PathEscape(req.TransactionID)+"/capture", form, &pi); err != nil {
+		return nil, err
+	}
+	return &payment.CaptureResponse{
+		Success:       pi.Status == "succeeded",
+		TransactionID: pi.ID,
+		Amount:        s.minorAmount(pi.AmountReceived, strings.ToUpper(pi.Currency)),
+		Message:       "PaymentIntent is " + pi.Status,
 	}, nil
 }
 
-// RefundPayment processes a refund through Stripe
+// VoidAuthorization cancels a held PaymentIntent, releasing the hold
+func (s *Gateway) VoidAuthorization(ctx context.Context, txnID string) error {
+	var pi heldIntent
+	if err := s.call(ctx, http.MethodPost, "/v1/payment_intents/"+url.PathEscape(txnID)+"/cancel", url.Values{}, &pi); err != nil {
+		return err
+	}
+	if pi.Status != "canceled" {
+		return fmt.Errorf("stripe: PaymentIntent %s is %s, not canceled", txnID, pi.Status)
+	}
+	return nil
+}
+
+// RefundPayment refunds a PaymentIntent through Stripe
 func (s *Gateway) RefundPayment(ctx context.Context, req *payment.RefundRequest) (*payment.RefundResponse, error) {
-	// In a real implementation, this would call Stripe's refund API
+	form := url.Values{"payment_intent": {req.TransactionID}}
+	// Without an amount Stripe refunds the full unrefunded balance
+	if !req.Amount.IsZero() {
+		form.Set("amount", strconv.FormatInt(payment.AmountInMinorUnits(s.config, req.Amount), 10))
+	}
+	// Stripe's reason is an enum; free-text reasons go in metadata
+	if req.Reason != "" {
+		form.Set("metadata[reason]", req.Reason)
+	}
+
+	var refund struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := s.call(ctx, http.MethodPost, "/v1/refunds", form, &refund); err != nil {
+		return nil, err
+	}
 	return &payment.RefundResponse{
-		Success:  true,
-		RefundID: fmt.Sprintf("re_%d", time.Now().UnixNano()),
-		Message:  "Refund processed successfully",
+		Success:  refund.Status != "failed" && refund.Status != "canceled",
+		RefundID: refund.ID,
+		Message:  "Refund " + refund.Status,
 	}, nil
 }
 
-// GetStatus retrieves the status of a payment from Stripe
-func (s *Gateway) GetStatus(ctx context.Context, txnID string) (*payment.StatusResponse, error) {
-	// In a real implementation, this would call Stripe's API to get payment status
-	// For now, return a mock response
-	amount:= money.New(0, money.MustCurrency(s.config.Currency))
+// GetStatus retrieves the status of a payment from Stripe. Without a
+// TransactionID the Checkout Session in req.SessionID is looked up instead,
+// as VerifyPayment does.
+func (s *Gateway) GetStatus(ctx context.Context, req *payment.StatusRequest) (*payment.StatusResponse, error) {
+	if req.TransactionID == "" && req.SessionID != "" {
+		vresp, err := s.VerifyPayment(ctx, &payment.VerificationRequest{SessionID: req.SessionID, OrderID: req.OrderID, Amount: req.Amount})
+		if err != nil {
+			return nil, err
+		}
+		return &payment.StatusResponse{
+			Status:        vresp.Status,
+			TransactionID: vresp.TransactionID,
+			OrderID:       vresp.OrderID,
+			Amount:        vresp.Amount,
+		}, nil
+	}
+	body, err := s.retrieve(ctx, "/v1/payment_intents/"+url.PathEscape(req.TransactionID)+"?expand[]=latest_charge.balance_transaction")
+	if err != nil {
+		return nil, err
+	}
+	return s.parseStatusResponse(body)
+}
+
+// parseStatusResponse builds the status of a retrieved PaymentIntent. The
+// amount is the intent's, in the intent's currency.
+func (s *Gateway) parseStatusResponse(body []byte) (*payment.StatusResponse, error) {
+	var pi paymentIntent
+	if err := json.Unmarshal(body, &pi); err != nil {
+		return nil, fmt.Errorf("stripe: invalid PaymentIntent: %w", err)
+	}
+	currency := strings.ToUpper(pi.Currency)
+	if currency == "" {
+		currency = s.config.Currency
+	}
+	vresp, err := s.parseVerifyResponse(body, s.minorAmount(pi.Amount, currency))
+	if err != nil {
+		return nil, err
+	}
 	return &payment.StatusResponse{
-		Status:        payment.StatusCompleted,
-		TransactionID: txnID,
-		Amount:        amount,
+		Status:        vresp.Status,
+		TransactionID: vresp.TransactionID,
+		OrderID:       vresp.OrderID,
+		Amount:        vresp.Amount,
 	}, nil
 }
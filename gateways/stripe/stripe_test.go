@@ -0,0 +1,448 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+	"github.com/oarkflow/payment/internal/golden"
+	"github.com/oarkflow/payment/paymenttest"
+)
+
+// TestParseVerifyResponse checks parsing of recorded PaymentIntent responses against
+// testdata/*.golden. Run with -update after an intended schema change.
+func TestParseVerifyResponse(t *testing.T) {
+	g := New(&payment.GatewayConfig{}, nil).(*Gateway)
+	amount := money.New(20, money.MustCurrency("USD"))
+
+	for _, name := range []string{"succeeded", "processing", "failed", "refunded", "partially_refunded"} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := g.parseVerifyResponse(golden.Fixture(t, "intent_"+name+".json"), amount)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := resp.Validate(); err != nil {
+				t.Errorf("Invalid response: %v", err)
+			}
+			golden.AssertJSON(t, "intent_"+name+".golden", resp)
+		})
+	}
+}
+
+func TestGetBalance(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/balance" || r.Header.Get("Authorization") != "Bearer sk_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"object":"balance","available":[{"amount":12050,"currency":"usd"},{"amount":700,"currency":"eur"}],"pending":[{"amount":300,"currency":"usd"}]}`))
+	}))
+	defer srv.Close()
+
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL, SecretKey: "sk_test"}, srv.Client()).(*Gateway)
+	balances, err := g.GetBalance(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	eur, usd := money.MustCurrency("EUR"), money.MustCurrency("USD")
+	want := []payment.Balance{
+		{Currency: "EUR", Available: money.NewFromMinor(700, eur), Pending: money.NewFromMinor(0, eur)},
+		{Currency: "USD", Available: money.NewFromMinor(12050, usd), Pending: money.NewFromMinor(300, usd)},
+	}
+	if len(balances) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, balances)
+	}
+	for i, b := range balances {
+		if b.Currency != want[i].Currency || !b.Available.Equals(want[i].Available) || !b.Pending.Equals(want[i].Pending) {
+			t.Errorf("Balance %d: expected %+v, got %+v", i, want[i], b)
+		}
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/payment_intents/pi_3Mtw" || r.Header.Get("Authorization") != "Bearer sk_test" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"id":"pi_3Mtw","amount":1500,"amount_received":0,"currency":"jpy","status":"processing"}`))
+	}))
+	defer srv.Close()
+
+	// The configured currency is USD; the intent's currency wins
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL, SecretKey: "sk_test"}, srv.Client())
+	status, err := g.GetStatus(context.Background(), &payment.StatusRequest{TransactionID: "pi_3Mtw"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status.Status != payment.StatusPending || status.TransactionID != "pi_3Mtw" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if want := money.NewFromMinor(1500, money.MustCurrency("JPY")); !status.Amount.Equals(want) {
+		t.Errorf("Expected amount %s, got %s", want, status.Amount)
+	}
+
+	if _, err := g.GetStatus(context.Background(), &payment.StatusRequest{TransactionID: "pi_missing"}); payment.HTTPStatusForError(err) != http.StatusNotFound {
+		t.Errorf("Expected not found, got %v", err)
+	}
+}
+
+func TestVerifyBySession(t *testing.T) {
+	session := `{"id":"cs_1","url":"https://checkout.stripe.com/c/pay/cs_1","status":"open","client_reference_id":"O1","payment_intent":null}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(session))
+	}))
+	defer srv.Close()
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL, SecretKey: "sk_test"}, srv.Client())
+
+	// The PaymentIntent is created on confirmation, so there is no
+	// transaction id yet
+	resp, err := g.InitiatePayment(context.Background(), &payment.PaymentRequest{
+		Amount:  money.New(10, money.MustCurrency("USD")),
+		OrderID: "O1",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.TransactionID != "" || resp.SessionID != "cs_1" {
+		t.Errorf("Expected only a session id, got %q / %q", resp.TransactionID, resp.SessionID)
+	}
+
+	vresp, err := g.VerifyPayment(context.Background(), &payment.VerificationRequest{SessionID: "cs_1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if vresp.Status != payment.StatusPending || vresp.TransactionID != "" || vresp.OrderID != "O1" {
+		t.Errorf("Expected a pending order O1, got %+v", vresp)
+	}
+
+	session = `{"id":"cs_1","status":"complete","client_reference_id":"O1","payment_intent":{"id":"pi_1","amount":1000,"amount_received":1000,"currency":"usd","status":"succeeded"}}`
+	vresp, err = g.VerifyPayment(context.Background(), &payment.VerificationRequest{SessionID: "cs_1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !vresp.Success || vresp.TransactionID != "pi_1" || vresp.OrderID != "O1" {
+		t.Errorf("Expected PaymentIntent pi_1 for order O1, got %+v", vresp)
+	}
+
+	session = `{"id":"cs_1","status":"expired","client_reference_id":"O1","payment_intent":null}`
+	vresp, err = g.VerifyPayment(context.Background(), &payment.VerificationRequest{SessionID: "cs_1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if vresp.Status != payment.StatusCanceled {
+		t.Errorf("Expected an expired session to be canceled, got %s", vresp.Status)
+	}
+}
+
+func TestRefundPayment(t *testing.T) {
+	tr := &paymenttest.Transport{Handler: paymenttest.RespondJSON(http.StatusOK, `{"id":"re_1","status":"succeeded"}`)}
+	g := New(&payment.GatewayConfig{SecretKey: "sk_test"}, tr.Client())
+
+	resp, err := g.RefundPayment(context.Background(), &payment.RefundRequest{
+		TransactionID: "pi_1",
+		Amount:        money.New(5, money.MustCurrency("USD")),
+		Reason:        "damaged",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !resp.Success || resp.RefundID != "re_1" {
+		t.Errorf("Expected refund re_1, got %+v", resp)
+	}
+	reqs := tr.Requests()
+	if len(reqs) != 1 || !strings.HasSuffix(reqs[0].URL, "/v1/refunds") {
+		t.Fatalf("Expected a POST to /v1/refunds, got %+v", reqs)
+	}
+	if body := string(reqs[0].Body); body != "amount=500&metadata%5Breason%5D=damaged&payment_intent=pi_1" {
+		t.Errorf("Unexpected refund form %s", body)
+	}
+}
+
+func TestParseStatusResponse(t *testing.T) {
+	g := New(&payment.GatewayConfig{Currency: "EUR"}, nil).(*Gateway)
+	status, err := g.parseStatusResponse(golden.Fixture(t, "intent_succeeded.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := money.NewFromMinor(2000, money.MustCurrency("USD")); status.Status != payment.StatusCompleted || !status.Amount.Equals(want) {
+		t.Errorf("Expected completed %s, got %+v", want, status)
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	var customers, prices int
+	var lookupKey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/customers":
+			if r.Form.Get("email") != "a@example.com" {
+				t.Errorf("Unexpected customer lookup %v", r.Form)
+			}
+			if customers == 0 {
+				w.Write([]byte(`{"data":[]}`))
+				return
+			}
+			w.Write([]byte(`{"data":[{"id":"cus_1"}]}`))
+		case "POST /v1/customers":
+			customers++
+			w.Write([]byte(`{"id":"cus_1"}`))
+		case "GET /v1/prices":
+			if got := r.Form.Get("lookup_keys[]"); got != lookupKey && lookupKey != "" {
+				t.Errorf("Expected lookup key %q, got %q", lookupKey, got)
+			}
+			if prices == 0 {
+				w.Write([]byte(`{"data":[]}`))
+				return
+			}
+			w.Write([]byte(`{"data":[{"id":"price_1"}]}`))
+		case "POST /v1/prices":
+			prices++
+			lookupKey = r.Form.Get("lookup_key")
+			if r.Form.Get("unit_amount") != "1500" || r.Form.Get("currency") != "usd" || r.Form.Get("recurring[interval]") != "month" || lookupKey == "" {
+				t.Errorf("Unexpected price %v", r.Form)
+			}
+			w.Write([]byte(`{"id":"price_1"}`))
+		case "POST /v1/subscriptions":
+			if r.Form.Get("customer") != "cus_1" || r.Form.Get("items[0][price]") != "price_1" || r.Form.Get("trial_period_days") != "14" {
+				t.Errorf("Unexpected subscription %v", r.Form)
+			}
+			fallthrough
+		case "GET /v1/subscriptions/sub_1":
+			w.Write([]byte(`{"id":"sub_1","status":"trialing","trial_end":1700000000,"current_period_end":1700000000,
+				"items":{"data":[{"price":{"unit_amount":1500,"currency":"usd","recurring":{"interval":"month"}}}]},
+				"latest_invoice":{"hosted_invoice_url":"https://invoice.stripe.com/i/1"}}`))
+		case "DELETE /v1/subscriptions/sub_1":
+			w.Write([]byte(`{"id":"sub_1","status":"canceled"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"message":"No such subscription"}}`))
+		}
+	}))
+	defer srv.Close()
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL, SecretKey: "sk_test"}, srv.Client()).(*Gateway)
+	ctx := context.Background()
+
+	amount := money.NewFromMinor(1500, money.MustCurrency("USD"))
+	want := &payment.SubscriptionResponse{
+		ID:               "sub_1",
+		Status:           payment.SubscriptionTrialing,
+		Amount:           amount,
+		Interval:         payment.IntervalMonthly,
+		PaymentURL:       "https://invoice.stripe.com/i/1",
+		TrialEnd:         time.Unix(1700000000, 0),
+		CurrentPeriodEnd: time.Unix(1700000000, 0),
+	}
+	req := &payment.SubscriptionRequest{Amount: amount, Interval: payment.IntervalMonthly, CustomerEmail: "a@example.com", TrialDays: 14}
+	resp, err := g.CreateSubscription(ctx, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	paymenttest.AssertResponseEqual(t, want, resp)
+
+	// A second subscription for the same customer and price reuses both
+	if _, err := g.CreateSubscription(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if customers != 1 || prices != 1 {
+		t.Errorf("Expected the customer and price to be reused, created %d and %d", customers, prices)
+	}
+
+	resp, err = g.GetSubscription(ctx, "sub_1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	paymenttest.AssertResponseEqual(t, want, resp)
+
+	if err := g.CancelSubscription(ctx, "sub_1"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := g.GetSubscription(ctx, "sub_missing"); payment.HTTPStatusForError(err) != http.StatusNotFound {
+		t.Errorf("Expected a 404 for an unknown subscription, got %v", err)
+	}
+}
+
+func TestResumePayment(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/checkout/sessions/cs_open":
+			w.Write([]byte(`{"id":"cs_open","status":"open","url":"https://checkout.stripe.com/c/pay/cs_open"}`))
+		case "/v1/checkout/sessions/cs_expired":
+			w.Write([]byte(`{"id":"cs_expired","status":"expired","url":null}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL, SecretKey: "sk_test"}, srv.Client()).(*Gateway)
+	ctx := context.Background()
+	resp, err := g.ResumePayment(ctx, &payment.Transaction{ID: "cs_open", OrderID: "O1", SessionID: "cs_open"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.PaymentURL != "https://checkout.stripe.com/c/pay/cs_open" || resp.TransactionID != "" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+	if _, err := g.ResumePayment(ctx, &payment.Transaction{ID: "cs_expired", SessionID: "cs_expired"}); !errors.Is(err, payment.ErrPaymentExpired) {
+		t.Errorf("Expected ErrPaymentExpired, got %v", err)
+	}
+}
+
+func TestAuthorizeCaptureVoid(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/payment_intents":
+			if r.Form.Get("capture_method") != "manual" || r.Form.Get("confirm") != "true" || r.Form.Get("payment_method") != "pm_card_visa" || r.Form.Get("amount") != "2500" {
+				t.Errorf("Unexpected PaymentIntent %v", r.Form)
+			}
+			w.Write([]byte(`{"id":"pi_1","status":"requires_capture","amount":2500,"amount_capturable":2500,"currency":"usd"}`))
+		case "POST /v1/payment_intents/pi_1/capture":
+			if r.Form.Get("amount_to_capture") != "2000" {
+				t.Errorf("Unexpected capture %v", r.Form)
+			}
+			w.Write([]byte(`{"id":"pi_1","status":"succeeded","amount":2500,"amount_received":2000,"currency":"usd"}`))
+		case "POST /v1/payment_intents/pi_2/cancel":
+			w.Write([]byte(`{"id":"pi_2","status":"canceled","currency":"usd"}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL, SecretKey: "sk_test"}, srv.Client()).(*Gateway)
+	ctx := context.Background()
+	usd := money.MustCurrency("USD")
+
+	if _, err := g.AuthorizePayment(ctx, &payment.PaymentRequest{OrderID: "O1", Amount: money.New(25, usd)}); err == nil {
+		t.Error("Expected an error without a payment method")
+	}
+	auth, err := g.AuthorizePayment(ctx, &payment.PaymentRequest{
+		OrderID:  "O1",
+		Amount:   money.New(25, usd),
+		Metadata: map[string]string{MetadataPaymentMethod: "pm_card_visa"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !auth.Success || auth.TransactionID != "pi_1" || !auth.Amount.Equals(money.New(25, usd)) || auth.ExpiresAt.IsZero() {
+		t.Errorf("Unexpected authorization %+v", auth)
+	}
+
+	capture, err := g.CapturePayment(ctx, &payment.CaptureRequest{TransactionID: "pi_1", Amount: money.New(20, usd)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !capture.Success || !capture.Amount.Equals(money.New(20, usd)) {
+		t.Errorf("Unexpected capture %+v", capture)
+	}
+
+	if err := g.VoidAuthorization(ctx, "pi_2"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestGetOrCreateCustomer(t *testing.T) {
+	created := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/customers/search":
+			if r.Form.Get("query") != "metadata['external_id']:'u1'" {
+				t.Errorf("Unexpected customer search %v", r.Form)
+			}
+			if len(created) == 0 {
+				w.Write([]byte(`{"data":[]}`))
+				return
+			}
+			w.Write([]byte(`{"data":[{"id":"cus_1"}]}`))
+		case "POST /v1/customers":
+			created["external_id"] = r.Form.Get("metadata[external_id]")
+			created["email"] = r.Form.Get("email")
+			w.Write([]byte(`{"id":"cus_1"}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	g := New(&payment.GatewayConfig{BaseURL: srv.URL, SecretKey: "sk_test"}, srv.Client()).(*Gateway)
+	ref := payment.CustomerRef{ExternalID: "u1", Email: "a@example.com"}
+	for range 2 {
+		id, err := g.GetOrCreateCustomer(context.Background(), ref)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if id != "cus_1" {
+			t.Errorf("Expected cus_1, got %q", id)
+		}
+	}
+	if created["external_id"] != "u1" || created["email"] != "a@example.com" {
+		t.Errorf("Unexpected customer %v", created)
+	}
+	if _, err := g.GetOrCreateCustomer(context.Background(), payment.CustomerRef{}); err == nil {
+		t.Error("Expected an error without an external id or email")
+	}
+}
+
+func TestParseWebhookIgnoresUnknownEvents(t *testing.T) {
+	g := New(&payment.GatewayConfig{}, nil).(*Gateway)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":"evt_1","type":"customer.created","data":{"object":{"id":"cus_1"}}}`))
+	if _, err := g.ParseWebhook(req); !errors.Is(err, payment.ErrWebhookEventIgnored) {
+		t.Errorf("Expected ErrWebhookEventIgnored, got %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":"evt_2","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","amount":100,"currency":"usd"}}}`))
+	data, err := g.ParseWebhook(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data.ProviderEvent != "payment_intent.succeeded" || data.EventType != payment.EventPayment {
+		t.Errorf("Unexpected event %+v", data)
+	}
+}
+
+func TestParseWebhookPartialRefund(t *testing.T) {
+	g := New(&payment.GatewayConfig{}, nil).(*Gateway)
+	parse := func(body string) *payment.WebhookData {
+		t.Helper()
+		data, err := g.ParseWebhook(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return data
+	}
+	usd := money.MustCurrency("USD")
+
+	data := parse(`{"id":"evt_1","type":"charge.refunded","data":{"object":{"id":"ch_1","payment_intent":"pi_1","amount":1000,"amount_refunded":300,"currency":"usd","refunds":{"data":[{"id":"re_1","amount":300}]}}}}`)
+	if data.Status != payment.StatusPartiallyRefunded || data.RefundID != "re_1" || data.TransactionID != "pi_1" {
+		t.Errorf("Expected a partial refund re_1 of pi_1, got %+v", data)
+	}
+	paymenttest.AssertMoneyEqual(t, money.NewFromMinor(300, usd), data.Amount)
+
+	// A second refund reports its own amount, not the running total
+	data = parse(`{"id":"evt_2","type":"charge.refunded","data":{"object":{"id":"ch_1","payment_intent":"pi_1","amount":1000,"amount_refunded":1000,"currency":"usd","refunds":{"data":[{"id":"re_2","amount":700},{"id":"re_1","amount":300}]}}}}`)
+	if data.Status != payment.StatusRefunded || data.RefundID != "re_2" {
+		t.Errorf("Expected the full refund re_2, got %+v", data)
+	}
+	paymenttest.AssertMoneyEqual(t, money.NewFromMinor(700, usd), data.Amount)
+}
+
+func TestSandboxBaseURL(t *testing.T) {
+	// Stripe has one API host; test mode comes from the key
+	config := &payment.GatewayConfig{Sandbox: true}
+	New(config, nil)
+	if config.BaseURL != "https://api.stripe.com" {
+		t.Errorf("Expected the live API host in sandbox, got %q", config.BaseURL)
+	}
+}
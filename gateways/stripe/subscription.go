@@ -0,0 +1,247 @@
+package stripe
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oarkflow/payment"
+)
+
+// subscriptionIntervals maps our intervals to Stripe's recurring[interval]
+var subscriptionIntervals = map[payment.SubscriptionInterval]string{
+	payment.IntervalMonthly: "month",
+	payment.IntervalYearly:  "year",
+}
+
+// subscriptionStatuses maps Stripe subscription statuses to ours
+var subscriptionStatuses = map[string]payment.SubscriptionStatus{
+	"incomplete":         payment.SubscriptionPending,
+	"trialing":           payment.SubscriptionTrialing,
+	"active":             payment.SubscriptionActive,
+	"past_due":           payment.SubscriptionPastDue,
+	"unpaid":             payment.SubscriptionPastDue,
+	"paused":             payment.SubscriptionPaused,
+	"canceled":           payment.SubscriptionCanceled,
+	"incomplete_expired": payment.SubscriptionCanceled,
+}
+
+// subscription is the subset of a Stripe Subscription we read
+type subscription struct {
+	ID               string `json:"id"`
+	Status           string `json:"status"`
+	TrialEnd         int64  `json:"trial_end"`
+	CurrentPeriodEnd int64  `json:"current_period_end"`
+	Items            struct {
+		Data []struct {
+			Price struct {
+				UnitAmount int64  `json:"unit_amount"`
+				Currency   string `json:"currency"`
+				Recurring  struct {
+					Interval string `json:"interval"`
+				} `json:"recurring"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"items"`
+	LatestInvoice struct {
+		HostedInvoiceURL string `json:"hosted_invoice_url"`
+	} `json:"latest_invoice"`
+}
+
+// CreateSubscription subscribes the customer with req.CustomerEmail to a
+// recurring Price for the amount, reusing the customer and price from
+// earlier subscriptions when they exist. The first invoice is left open for
+// the customer to pay at the response's PaymentURL.
+func (s *Gateway) CreateSubscription(ctx context.Context, req *payment.SubscriptionRequest) (*payment.SubscriptionResponse, error) {
+	if err := payment.SandboxError(s.config, s.GetMethod(), req.Amount); err != nil {
+		return nil, err
+	}
+	interval, ok := subscriptionIntervals[req.Interval]
+	if !ok {
+		return nil, fmt.Errorf("stripe: unsupported subscription interval %q", req.Interval)
+	}
+
+	customerID, err := s.findOrCreateCustomer(ctx, payment.CustomerRef{Email: req.CustomerEmail})
+	if err != nil {
+		return nil, err
+	}
+	priceID, err := s.subscriptionPrice(ctx, req, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"customer":         {customerID},
+		"items[0][price]":  {priceID},
+		"payment_behavior": {"default_incomplete"},
+		"expand[]":         {"latest_invoice"},
+	}
+	if req.TrialDays > 0 {
+		form.Set("trial_period_days", strconv.Itoa(req.TrialDays))
+	}
+	if req.Cycles > 0 {
+		start := s.config.Now().AddDate(0, 0, req.TrialDays)
+		form.Set("cancel_at", strconv.FormatInt(cancelAt(start, req.Interval, req.Cycles).Unix(), 10))
+	}
+	for k, v := range payment.NamespaceMetadata(req.Metadata) {
+		form.Set("metadata["+k+"]", v)
+	}
+	var sub subscription
+	if err := s.call(ctx, http.MethodPost, "/v1/subscriptions", form, &sub); err != nil {
+		return nil, err
+	}
+	return s.subscriptionResponse(&sub), nil
+}
+
+// list is a page of a Stripe list endpoint, reduced to object ids
+type list struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// subscriptionPrice returns the id of the recurring Price for req's amount,
+// interval and description, creating it on first use. Prices are found by
+// a lookup_key derived from those, so every subscription to the same plan
+// shares one Price and product.
+func (s *Gateway) subscriptionPrice(ctx context.Context, req *payment.SubscriptionRequest, interval string) (string, error) {
+	name := req.Description
+	if name == "" {
+		name = "Subscription"
+	}
+	unitAmount := strconv.FormatInt(payment.AmountInMinorUnits(s.config, req.Amount), 10)
+	currency := strings.ToLower(req.Amount.Currency().Code)
+	sum := sha256.Sum256([]byte(name))
+	lookupKey := fmt.Sprintf("payment_%s_%s_%s_%s", currency, unitAmount, interval, hex.EncodeToString(sum[:8]))
+
+	var found list
+	query := url.Values{"lookup_keys[]": {lookupKey}, "active": {"true"}, "limit": {"1"}}
+	if err := s.call(ctx, http.MethodGet, "/v1/prices?"+query.Encode(), nil, &found); err != nil {
+		return "", err
+	}
+	if len(found.Data) > 0 {
+		return found.Data[0].ID, nil
+	}
+	var price struct {
+		ID string `json:"id"`
+	}
+	form := url.Values{
+		"unit_amount":         {unitAmount},
+		"currency":            {currency},
+		"recurring[interval]": {interval},
+		"product_data[name]":  {name},
+		"lookup_key":          {lookupKey},
+	}
+	if err := s.call(ctx, http.MethodPost, "/v1/prices", form, &price); err != nil {
+		return "", err
+	}
+	return price.ID, nil
+}
+
+// cancelAt returns the end of the last of cycles billing periods from start
+func cancelAt(start time.Time, interval payment.SubscriptionInterval, cycles int) time.Time {
+	if interval == payment.IntervalYearly {
+		return start.AddDate(cycles, 0, 0)
+	}
+	return start.AddDate(0, cycles, 0)
+}
+
+// CancelSubscription cancels the subscription immediately
+func (s *Gateway) CancelSubscription(ctx context.Context, id string) error {
+	return s.call(ctx, http.MethodDelete, "/v1/subscriptions/"+url.PathEscape(id), nil, nil)
+}
+
+// GetSubscription retrieves a subscription
+func (s *Gateway) GetSubscription(ctx context.Context, id string) (*payment.SubscriptionResponse, error) {
+	var sub subscription
+	query := url.Values{"expand[]": {"latest_invoice"}}
+	if err := s.call(ctx, http.MethodGet, "/v1/subscriptions/"+url.PathEscape(id)+"?"+query.Encode(), nil, &sub); err != nil {
+		return nil, err
+	}
+	return s.subscriptionResponse(&sub), nil
+}
+
+// subscriptionResponse converts a Stripe Subscription. Unknown statuses are
+// reported as pending.
+func (s *Gateway) subscriptionResponse(sub *subscription) *payment.SubscriptionResponse {
+	resp := &payment.SubscriptionResponse{
+		ID:         sub.ID,
+		Status:     subscriptionStatuses[sub.Status],
+		PaymentURL: sub.LatestInvoice.HostedInvoiceURL,
+	}
+	if resp.Status == "" {
+		resp.Status = payment.SubscriptionPending
+	}
+	if sub.TrialEnd > 0 {
+		resp.TrialEnd = time.Unix(sub.TrialEnd, 0)
+	}
+	if sub.CurrentPeriodEnd > 0 {
+		resp.CurrentPeriodEnd = time.Unix(sub.CurrentPeriodEnd, 0)
+	}
+	if len(sub.Items.Data) > 0 {
+		price := sub.Items.Data[0].Price
+		resp.Amount = s.minorAmount(price.UnitAmount, strings.ToUpper(price.Currency))
+		switch price.Recurring.Interval {
+		case "month":
+			resp.Interval = payment.IntervalMonthly
+		case "year":
+			resp.Interval = payment.IntervalYearly
+		}
+	}
+	return resp
+}
+
+// call sends a form-encoded request to the Stripe API and decodes the JSON
+// response into out, unless it is nil
+func (s *Gateway) call(ctx context.Context, method, path string, form url.Values, out any) error {
+	return s.callIdempotent(ctx, method, path, form, "", out)
+}
+
+// callIdempotent is call with idempotencyKey, if any, sent as the
+// Idempotency-Key header so Stripe replays a retried request
+func (s *Gateway) callIdempotent(ctx context.Context, method, path string, form url.Values, idempotencyKey string, out any) error {
+	endpoint := s.config.BaseURL + path
+	dbg := payment.NewDebugRequest(s.config, method, endpoint, payment.ValuesToRawData(form), "")
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+s.config.SecretKey)
+	if form != nil {
+		httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if idempotencyKey != "" {
+		httpReq.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return payment.WithDebugRequest(s.GetMethod(), payment.WrapTransportError(s.GetMethod(), err), dbg)
+	}
+	defer resp.Body.Close()
+
+	data, err := payment.ReadResponseBody(s.GetMethod(), resp)
+	if err != nil {
+		return payment.WithDebugRequest(s.GetMethod(), err, dbg)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return payment.WithDebugRequest(s.GetMethod(), fmt.Errorf("stripe: invalid response from %s: %w", path, err), dbg)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package stripe
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+)
+
+// signatureTolerance is how old a signed webhook timestamp may be
+const signatureTolerance = 5 * time.Minute
+
+// event is the subset of a Stripe webhook event we read
+type event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object eventObject `json:"object"`
+	} `json:"data"`
+}
+
+type eventObject struct {
+	ID             string            `json:"id"`
+	Object         string            `json:"object"`
+	Amount         int64             `json:"amount"`
+	AmountTotal    int64             `json:"amount_total"`
+	AmountRefunded int64             `json:"amount_refunded"`
+	Currency       string            `json:"currency"`
+	Status         string            `json:"status"`
+	PaymentIntent  string            `json:"payment_intent"`
+	Reason         string            `json:"reason"`
+	Metadata       map[string]string `json:"metadata"`
+	// Evidence deadline, set on dispute objects
+	EvidenceDetails struct {
+		DueBy int64 `json:"due_by"`
+	} `json:"evidence_details"`
+	Refunds struct {
+		Data []struct {
+			ID     string `json:"id"`
+			Amount int64  `json:"amount"`
+		} `json:"data"`
+	} `json:"refunds"`
+}
+
+// ValidateWebhook verifies the Stripe-Signature header
+func (s *Gateway) ValidateWebhook(req *http.Request) error {
+	body, err := payment.ReadWebhookBody(req)
+	if err != nil {
+		return err
+	}
+
+	header := req.Header.Get("Stripe-Signature")
+	if header == "" {
+		return errors.New("stripe: missing Stripe-Signature header")
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			timestamp = v
+		case "v1":
+			signatures = append(signatures, v)
+		}
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("stripe: invalid signature timestamp")
+	}
+	if s.config.Now().Sub(time.Unix(ts, 0)) > signatureTolerance {
+		return errors.New("stripe: signature timestamp too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.config.GetWebhookSecret()))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return errors.New("stripe: signature mismatch")
+}
+
+// ParseWebhook parses payment, refund and dispute events. Other events fail
+// with payment.ErrWebhookEventIgnored.
+func (s *Gateway) ParseWebhook(req *http.Request) (*payment.WebhookData, error) {
+	body, err := payment.ReadWebhookBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var evt event
+	if err := json.Unmarshal(body, &evt); err != nil {
+		return nil, fmt.Errorf("stripe: invalid webhook payload: %w", err)
+	}
+	obj := evt.Data.Object
+
+	data := &payment.WebhookData{
+		EventID:       evt.ID,
+		ProviderEvent: evt.Type,
+		Metadata:      payment.StripMetadataNamespace(obj.Metadata),
+		RawData: map[string]string{
+			"event_id":   evt.ID,
+			"event_type": evt.Type,
+			"object_id":  obj.ID,
+		},
+	}
+
+	switch evt.Type {
+	case "checkout.session.completed":
+		data.EventType = payment.EventPayment
+		data.TransactionID = obj.PaymentIntent
+		data.Amount = s.minorAmount(obj.AmountTotal, obj.Currency)
+		data.Status = payment.StatusCompleted
+	case "payment_intent.succeeded", "payment_intent.payment_failed", "payment_intent.canceled":
+		data.EventType = payment.EventPayment
+		data.TransactionID = obj.ID
+		data.Amount = s.minorAmount(obj.Amount, obj.Currency)
+		data.Status = map[string]payment.PaymentStatus{
+			"payment_intent.succeeded":      payment.StatusCompleted,
+			"payment_intent.payment_failed": payment.StatusFailed,
+			"payment_intent.canceled":       payment.StatusCanceled,
+		}[evt.Type]
+	case "charge.refunded":
+		// The charge lists its latest refund first; without the list only
+		// the running total in amount_refunded is known
+		data.EventType = payment.EventRefund
+		data.TransactionID = obj.PaymentIntent
+		refunded := obj.AmountRefunded
+		if len(obj.Refunds.Data) > 0 {
+			data.RefundID = obj.Refunds.Data[0].ID
+			refunded = obj.Refunds.Data[0].Amount
+		}
+		data.Amount = s.minorAmount(refunded, obj.Currency)
+		data.Status = payment.StatusRefunded
+		if obj.AmountRefunded < obj.Amount {
+			data.Status = payment.StatusPartiallyRefunded
+		}
+	case "refund.created", "refund.updated":
+		data.EventType = payment.EventRefund
+		data.RefundID = obj.ID
+		data.TransactionID = obj.PaymentIntent
+		data.Amount = s.minorAmount(obj.Amount, obj.Currency)
+		data.Status = payment.StatusPending
+		if obj.Status == "succeeded" {
+			data.Status = payment.StatusRefunded
+		} else if obj.Status == "failed" || obj.Status == "canceled" {
+			data.Status = payment.StatusFailed
+		}
+	case "charge.dispute.created", "charge.dispute.updated":
+		data.EventType = payment.EventDispute
+		data.DisputeID = obj.ID
+		data.TransactionID = obj.PaymentIntent
+		data.Reason = obj.Reason
+		data.Amount = s.minorAmount(obj.Amount, obj.Currency)
+		data.Status = payment.StatusDisputed
+		if obj.EvidenceDetails.DueBy > 0 {
+			data.DueBy = time.Unix(obj.EvidenceDetails.DueBy, 0)
+		}
+	default:
+		return nil, fmt.Errorf("%w: stripe %s", payment.ErrWebhookEventIgnored, evt.Type)
+	}
+
+	data.OrderID = data.Metadata["order_id"]
+	return data, nil
+}
+
+// minorAmount builds money from a Stripe amount in minor units, honouring
+// the minor_units override
+func (s *Gateway) minorAmount(amount int64, currency string) money.Money {
+	c, ok := money.GetCurrency(currency)
+	if !ok {
+		c = money.MustCurrency(s.config.Currency)
+	}
+	return payment.AmountFromMinorUnits(s.config, amount, c)
+}
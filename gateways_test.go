@@ -0,0 +1,607 @@
+package payment_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+	"github.com/oarkflow/payment/gateways/connectips"
+	"github.com/oarkflow/payment/gateways/esewa"
+	"github.com/oarkflow/payment/gateways/fake"
+	"github.com/oarkflow/payment/gateways/imepay"
+	"github.com/oarkflow/payment/gateways/khalti"
+	"github.com/oarkflow/payment/gateways/paypal"
+	"github.com/oarkflow/payment/gateways/paytm"
+	"github.com/oarkflow/payment/gateways/phonepe"
+	"github.com/oarkflow/payment/gateways/razorpay"
+	"github.com/oarkflow/payment/gateways/stripe"
+	"github.com/oarkflow/payment/paymenttest"
+)
+
+// sign returns the base64 HMAC of data keyed with "secret", as eSewa signs
+// its redirects
+func sign(h func() hash.Hash, data string) string {
+	mac := hmac.New(h, []byte("secret"))
+	mac.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// esewaData returns the base64 data parameter of an eSewa v2 redirect for
+// order O1 and ref R1
+func esewaData(amount, signature string) string {
+	body := `{"transaction_code":"R1","status":"COMPLETE","total_amount":` + amount +
+		`,"transaction_uuid":"O1","product_code":"M1","signed_field_names":"transaction_code,status,total_amount,transaction_uuid,product_code,signed_field_names","signature":"` + signature + `"}`
+	return base64.StdEncoding.EncodeToString([]byte(body))
+}
+
+// providerStub serves a fixed JSON body for every request
+func providerStub(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGatewaysReturnValidVerification(t *testing.T) {
+	npr := money.MustCurrency("NPR")
+	esewaSig := sign(sha256.New, "transaction_code=R1,status=COMPLETE,total_amount=100.0,transaction_uuid=O1,product_code=M1,signed_field_names=transaction_code,status,total_amount,transaction_uuid,product_code,signed_field_names")
+	tests := []struct {
+		name    string
+		factory payment.GatewayFactory
+		body    string
+		req     *payment.VerificationRequest
+	}{
+		{"esewa", esewa.New, `{"status":"COMPLETE","total_amount":"100.0"}`,
+			&payment.VerificationRequest{RawData: map[string]string{"data": esewaData("100.0", esewaSig)}}},
+		{"khalti", khalti.New, `{"status":"Completed","total_amount":10000,"fee":300}`,
+			&payment.VerificationRequest{TransactionID: "pidx1", Amount: money.New(100, npr)}},
+		{"imepay", imepay.New, `{"ResponseCode":"0","Amount":"100"}`,
+			&payment.VerificationRequest{RawData: map[string]string{"Msisdn": "98", "RefId": "O1", "TransactionId": "T1"}}},
+		{"connectips", connectips.New, `{"status":"SUCCESS","amount":"100","reference_id":"O1"}`,
+			&payment.VerificationRequest{TransactionID: "T1"}},
+		{"stripe", stripe.New, `{"id":"pi_1","status":"succeeded","amount":10000,"amount_received":10000,"currency":"usd"}`,
+			&payment.VerificationRequest{TransactionID: "pi_1"}},
+		{"paypal", paypal.New, `{"access_token":"tok","id":"PAY1","status":"COMPLETED","purchase_units":[{"reference_id":"O1","amount":{"currency_code":"USD","value":"100.00"},
+			"payments":{"captures":[{"id":"CAP1","status":"COMPLETED","amount":{"currency_code":"USD","value":"100.00"}}]}}]}`, &payment.VerificationRequest{TransactionID: "PAY1"}},
+		{"razorpay", razorpay.New, `{"id":"pay_1","order_id":"order_1","status":"captured","amount":10000,"currency":"INR"}`, &payment.VerificationRequest{TransactionID: "pay_1", SessionID: "order_1",
+			RawData: map[string]string{"razorpay_signature": "52115a0d3400de9e86aade1f1b6eba9e8974604f4e267a9e9a16633a4c8dd2cb"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := providerStub(t, tt.body)
+			g := tt.factory(&payment.GatewayConfig{BaseURL: srv.URL, MerchantID: "M1", SecretKey: "secret"}, srv.Client())
+
+			resp, err := g.VerifyPayment(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !resp.Success {
+				t.Errorf("Expected success, got %s", resp.Status)
+			}
+			if err := resp.Validate(); err != nil {
+				t.Errorf("Invalid response: %v", err)
+			}
+		})
+	}
+}
+
+// checkoutStub answers Stripe Checkout Session, Razorpay order and PayPal
+// order creation, numbering the objects it creates, and reports a Checkout Session cs_N as
+// paid by PaymentIntent pi_N
+func checkoutStub() *paymenttest.Transport {
+	var n atomic.Int64
+	return &paymenttest.Transport{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := strings.CutPrefix(path.Base(r.URL.Path), "cs_"); ok {
+			fmt.Fprintf(w, `{"id":"cs_%s","status":"complete","payment_intent":{"id":"pi_%s","status":"succeeded","amount":1000,"amount_received":1000,"currency":"usd"}}`, id, id)
+			return
+		}
+		id := n.Add(1)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/v1/checkout/sessions"):
+			fmt.Fprintf(w, `{"id":"cs_%d","url":"https://checkout.stripe.com/c/pay/cs_%d","payment_intent":"pi_%d"}`, id, id, id)
+		case strings.HasSuffix(r.URL.Path, "/v1/orders"):
+			fmt.Fprintf(w, `{"id":"order_%d"}`, id)
+		case strings.HasSuffix(r.URL.Path, "/v1/oauth2/token"):
+			fmt.Fprint(w, `{"access_token":"tok","expires_in":32400}`)
+		case strings.HasSuffix(r.URL.Path, "/v2/checkout/orders"):
+			fmt.Fprintf(w, `{"id":"PP%d","links":[{"rel":"approve","href":"https://www.paypal.com/checkoutnow?token=PP%d"}]}`, id, id)
+		default:
+			http.NotFound(w, r)
+		}
+	})}
+}
+
+func TestStripeSessionID(t *testing.T) {
+	g := stripe.New(&payment.GatewayConfig{}, checkoutStub().Client())
+	resp, err := g.InitiatePayment(context.Background(), &payment.PaymentRequest{
+		Amount:  money.New(10, money.MustCurrency("USD")),
+		OrderID: "O1",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.SessionID == "" || resp.SessionID == resp.TransactionID {
+		t.Errorf("Expected a distinct session id, got %q / %q", resp.SessionID, resp.TransactionID)
+	}
+
+	rp, ok := g.(payment.ReturnURLParser)
+	if !ok {
+		t.Fatal("Expected stripe to parse return URLs")
+	}
+	vreq, err := rp.ParseReturnURL(url.Values{"session_id": {resp.SessionID}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if vreq.SessionID != resp.SessionID || vreq.TransactionID != "" {
+		t.Errorf("Unexpected verification request %+v", vreq)
+	}
+	vresp, err := g.VerifyPayment(context.Background(), vreq)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if vresp.TransactionID != resp.TransactionID || !strings.HasPrefix(vresp.TransactionID, "pi_") {
+		t.Errorf("Expected verification by session to resolve PaymentIntent %q, got %q", resp.TransactionID, vresp.TransactionID)
+	}
+
+	vreq, _ = rp.ParseReturnURL(url.Values{"payment_intent": {"pi_1"}})
+	if vreq.TransactionID != "pi_1" {
+		t.Errorf("Expected payment_intent as transaction id, got %q", vreq.TransactionID)
+	}
+	if _, err := rp.ParseReturnURL(url.Values{}); err == nil {
+		t.Error("Expected error for empty return URL")
+	}
+}
+
+func TestRazorpayRekeyedOnVerify(t *testing.T) {
+	tr := &paymenttest.Transport{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/orders":
+			fmt.Fprint(w, `{"id":"order_1"}`)
+		case "/v1/orders/order_1/payments":
+			fmt.Fprint(w, `{"entity":"collection","count":0,"items":[]}`)
+		case "/v1/payments/pay_1":
+			fmt.Fprint(w, `{"id":"pay_1","order_id":"order_1","status":"captured","amount":10000,"currency":"INR"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})}
+	store := payment.NewMemoryTransactionStore()
+	pm := payment.NewPaymentManager(0)
+	pm.SetTransactionStore(store)
+	pm.RegisterGateway("razorpay", razorpay.New(&payment.GatewayConfig{SecretKey: "secret"}, tr.Client()))
+	ctx := context.Background()
+
+	resp, err := pm.InitiatePayment(ctx, "razorpay", &payment.PaymentRequest{
+		Amount:     money.New(100, money.MustCurrency("INR")),
+		OrderID:    "O1",
+		SuccessURL: "https://shop.example.com/success",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.TransactionID != "" || resp.SessionID != "order_1" {
+		t.Errorf("Expected only the Razorpay order as session, got %q / %q", resp.TransactionID, resp.SessionID)
+	}
+	if _, err := store.Get("order_1"); err != nil {
+		t.Fatalf("Expected the payment stored under its order: %v", err)
+	}
+
+	// Until Checkout calls back, the status comes from the order's payments
+	status, err := pm.GetStatus(ctx, "razorpay", &payment.StatusRequest{TransactionID: "order_1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status.Status != payment.StatusPending {
+		t.Errorf("Expected pending, got %s", status.Status)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("order_1|pay_1"))
+	if _, err := pm.VerifyPayment(ctx, "razorpay", &payment.VerificationRequest{
+		TransactionID: "pay_1",
+		SessionID:     "order_1",
+		RawData:       map[string]string{"razorpay_signature": hex.EncodeToString(mac.Sum(nil))},
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	txn, err := store.Get("pay_1")
+	if err != nil {
+		t.Fatalf("Expected the payment re-keyed to its payment id: %v", err)
+	}
+	if txn.Status != payment.StatusCompleted || txn.OrderID != "O1" || txn.SessionID != "order_1" {
+		t.Errorf("Unexpected transaction %+v", txn)
+	}
+	if _, err := store.Get("order_1"); !errors.Is(err, payment.ErrTransactionNotFound) {
+		t.Errorf("Expected the order record to be dropped, got %v", err)
+	}
+}
+
+func TestKhaltiPidxBoundToOrder(t *testing.T) {
+	var n atomic.Int64
+	tr := &paymenttest.Transport{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/epayment/initiate/"):
+			id := n.Add(1)
+			fmt.Fprintf(w, `{"pidx":"P%d","payment_url":"https://pay.khalti.com/?pidx=P%d"}`, id, id)
+		case strings.HasSuffix(r.URL.Path, "/epayment/lookup/"):
+			fmt.Fprint(w, `{"status":"Completed","total_amount":10000}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})}
+	pm := payment.NewPaymentManager(0)
+	pm.SetTransactionStore(payment.NewMemoryTransactionStore())
+	pm.RegisterGateway("khalti", khalti.New(&payment.GatewayConfig{Currency: "NPR"}, tr.Client()))
+	ctx := context.Background()
+	for _, orderID := range []string{"O1", "O2"} {
+		if _, err := pm.InitiatePayment(ctx, "khalti", &payment.PaymentRequest{
+			Amount:        money.New(100, money.MustCurrency("NPR")),
+			OrderID:       orderID,
+			SuccessURL:    "https://shop.example.com/success",
+			CustomerPhone: "9800000000",
+		}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// P2 is O2's payment, so it can't settle O1
+	if _, err := pm.VerifyPayment(ctx, "khalti", &payment.VerificationRequest{TransactionID: "P2", OrderID: "O1"}); !errors.Is(err, payment.ErrOrderMismatch) {
+		t.Errorf("Expected ErrOrderMismatch for another order's pidx, got %v", err)
+	}
+	if _, err := pm.VerifyPayment(ctx, "khalti", &payment.VerificationRequest{TransactionID: "P9", OrderID: "O1"}); !errors.Is(err, payment.ErrOrderMismatch) {
+		t.Errorf("Expected ErrOrderMismatch for an unknown pidx, got %v", err)
+	}
+	if _, err := pm.VerifyPayment(ctx, "khalti", &payment.VerificationRequest{TransactionID: "P1", OrderID: "O1"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSandboxAmounts(t *testing.T) {
+	usd := money.MustCurrency("USD")
+	factories := map[string]payment.GatewayFactory{"stripe": stripe.New, "paypal": paypal.New, "razorpay": razorpay.New}
+	tests := []struct {
+		minor int64
+		kind  payment.ErrorKind
+	}{
+		{51, payment.ErrKindDeclined},
+		{52, payment.ErrKindDeclined},
+		{53, payment.ErrKindTimeout},
+		{1000, ""},
+	}
+
+	for name, factory := range factories {
+		g := factory(&payment.GatewayConfig{Sandbox: true}, checkoutStub().Client())
+		for _, tt := range tests {
+			_, err := g.InitiatePayment(context.Background(), &payment.PaymentRequest{
+				Amount:  money.NewFromMinor(tt.minor, usd),
+				OrderID: "O1",
+			})
+			if got := errorKind(err); got != tt.kind {
+				t.Errorf("%s: amount %d: expected kind %q, got %q (%v)", name, tt.minor, tt.kind, got, err)
+			}
+		}
+	}
+
+	// Live mode and custom maps
+	live := stripe.New(&payment.GatewayConfig{}, checkoutStub().Client())
+	if _, err := live.InitiatePayment(context.Background(), &payment.PaymentRequest{Amount: money.NewFromMinor(51, usd)}); err != nil {
+		t.Errorf("Expected no simulated failure outside sandbox, got %v", err)
+	}
+	custom := stripe.New(&payment.GatewayConfig{Sandbox: true, SandboxAmounts: map[int64]payment.SandboxOutcome{999: payment.SandboxDecline}}, checkoutStub().Client())
+	if _, err := custom.InitiatePayment(context.Background(), &payment.PaymentRequest{Amount: money.NewFromMinor(51, usd)}); err != nil {
+		t.Errorf("Expected default amounts to be replaced, got %v", err)
+	}
+	if _, err := custom.InitiatePayment(context.Background(), &payment.PaymentRequest{Amount: money.NewFromMinor(999, usd)}); errorKind(err) != payment.ErrKindDeclined {
+		t.Errorf("Expected custom decline, got %v", err)
+	}
+}
+
+// errorKind returns the PaymentError kind of err, or "" if it has none
+func errorKind(err error) payment.ErrorKind {
+	var perr *payment.PaymentError
+	if errors.As(err, &perr) {
+		return perr.Kind
+	}
+	return ""
+}
+
+func TestReturnURLSignatures(t *testing.T) {
+	esewaSig := sign(sha256.New, "transaction_code=R1,status=COMPLETE,total_amount=100.0,transaction_uuid=O1,product_code=M1,signed_field_names=transaction_code,status,total_amount,transaction_uuid,product_code,signed_field_names")
+
+	tests := []struct {
+		name    string
+		factory payment.GatewayFactory
+		body    string
+		values  url.Values
+		valid   bool
+	}{
+		{"esewa signed", esewa.New, `{"status":"COMPLETE","total_amount":"100.0"}`, url.Values{"data": {esewaData("100.0", esewaSig)}}, true},
+		{"esewa tampered amount", esewa.New, `{"status":"COMPLETE","total_amount":"1.0"}`, url.Values{"data": {esewaData("1.0", esewaSig)}}, false},
+		{"esewa unsigned", esewa.New, `{}`, url.Values{"data": {esewaData("100.0", "")}}, false},
+		// ConnectIPS's redirect is unsigned; the validate call authenticates it
+		{"connectips", connectips.New, `{"status":"SUCCESS","amount":"100","reference_id":"O1"}`, url.Values{"TXNID": {"T1"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := providerStub(t, tt.body)
+			g := tt.factory(&payment.GatewayConfig{BaseURL: srv.URL, MerchantID: "M1", SecretKey: "secret"}, srv.Client())
+			vreq, err := g.(payment.ReturnURLParser).ParseReturnURL(tt.values)
+			if err != nil {
+				t.Fatalf("Unexpected parse error: %v", err)
+			}
+			_, err = g.VerifyPayment(context.Background(), vreq)
+			if tt.valid && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, payment.ErrInvalidCallbackSignature) {
+				t.Errorf("Expected ErrInvalidCallbackSignature, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReturnURLsSatisfyRequiredFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		factory payment.GatewayFactory
+		values  url.Values
+	}{
+		{"esewa", esewa.New, url.Values{"data": {esewaData("100.0", "sig")}}},
+		{"khalti", khalti.New, url.Values{"pidx": {"P1"}}},
+		{"imepay", imepay.New, url.Values{"Msisdn": {"98"}, "RefId": {"O1"}, "TransactionId": {"T1"}}},
+		{"connectips", connectips.New, url.Values{"TXNID": {"T1"}}},
+		{"stripe", stripe.New, url.Values{"session_id": {"cs_1"}}},
+		{"razorpay", razorpay.New, url.Values{"razorpay_payment_id": {"pay_1"}, "razorpay_order_id": {"order_1"}, "razorpay_signature": {"sig"}}},
+		{"paytm", paytm.New, url.Values{"ORDERID": {"O1"}, "TXNID": {"T1"}, "CHECKSUMHASH": {"sig"}}},
+		{"phonepe", phonepe.New, url.Values{"code": {"PAYMENT_SUCCESS"}, "transactionId": {"O1"}, "amount": {"10000"}}},
+		{"fake", fake.New, url.Values{"transaction_id": {"fake_1"}, "order_id": {"O1"}}},
+	}
+
+	for _, tt := range tests {
+		g := tt.factory(&payment.GatewayConfig{}, nil)
+		vreq, err := g.(payment.ReturnURLParser).ParseReturnURL(tt.values)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if missing := vreq.MissingFields(payment.RequiredVerificationFields(g)); len(missing) > 0 {
+			t.Errorf("%s: parsed return URL is missing %v", tt.name, missing)
+		}
+	}
+}
+
+func TestInitiatePaymentForwardsIdempotencyKey(t *testing.T) {
+	tr := checkoutStub()
+	pm := payment.NewPaymentManager(0)
+	pm.RegisterGateway("stripe", stripe.New(&payment.GatewayConfig{}, tr.Client()))
+	pm.RegisterGateway("razorpay", razorpay.New(&payment.GatewayConfig{}, tr.Client()))
+	ctx := context.Background()
+	initiate := func(method, orderID, key string) string {
+		if _, err := pm.InitiatePayment(ctx, method, &payment.PaymentRequest{
+			Amount:         money.New(10, money.MustCurrency("INR")),
+			OrderID:        orderID,
+			SuccessURL:     "https://shop.example.com/success",
+			IdempotencyKey: key,
+		}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		reqs := tr.Requests()
+		return reqs[len(reqs)-1].Header.Get("Idempotency-Key")
+	}
+
+	for _, method := range []string{"stripe", "razorpay"} {
+		if got := initiate(method, "O1", "retry-2"); got != "retry-2" {
+			t.Errorf("%s: expected the explicit key to be sent, got %q", method, got)
+		}
+		// A retry after a timeout sends the same default key, so the
+		// provider replays the first payment
+		if a, b := initiate(method, "O1", ""), initiate(method, "O1", ""); a == "" || a != b {
+			t.Errorf("%s: expected a retried order to reuse its key, got %q and %q", method, a, b)
+		}
+		if a, b := initiate(method, "O1", ""), initiate(method, "O2", ""); a == b {
+			t.Errorf("%s: expected distinct orders to differ, both got %q", method, a)
+		}
+	}
+
+	if payment.DefaultIdempotencyKey("stripe", "O1") == payment.DefaultIdempotencyKey("razorpay", "O1") {
+		t.Error("Expected default keys to differ per gateway")
+	}
+}
+
+func TestInitiatePaymentNamespacesMetadata(t *testing.T) {
+	metadata := map[string]string{"cart": "C9"}
+	tests := []struct {
+		name    string
+		factory payment.GatewayFactory
+		want    string
+	}{
+		{"stripe", stripe.New, "metadata%5Bm_cart%5D=C9"},
+		{"stripe", stripe.New, "payment_intent_data%5Bmetadata%5D%5Bm_cart%5D=C9"},
+		{"razorpay", razorpay.New, `"notes":{"m_cart":"C9"}`},
+		{"paypal", paypal.New, `"custom_id":"m_cart=C9"`},
+	}
+	for _, tt := range tests {
+		tr := checkoutStub()
+		g := tt.factory(&payment.GatewayConfig{}, tr.Client())
+		if _, err := g.InitiatePayment(context.Background(), &payment.PaymentRequest{
+			Amount:   money.New(10, money.MustCurrency("USD")),
+			OrderID:  "O1",
+			Metadata: metadata,
+		}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		reqs := tr.Requests()
+		if body := string(reqs[len(reqs)-1].Body); !strings.Contains(body, tt.want) {
+			t.Errorf("%s: expected %s in %s", tt.name, tt.want, body)
+		}
+	}
+
+	long := map[string]string{"note": strings.Repeat("x", 200)}
+	g := paypal.New(&payment.GatewayConfig{}, checkoutStub().Client())
+	_, err := g.InitiatePayment(context.Background(), &payment.PaymentRequest{
+		Amount:   money.New(10, money.MustCurrency("USD")),
+		OrderID:  "O1",
+		Metadata: long,
+	})
+	if errorKind(err) != payment.ErrKindValidation {
+		t.Errorf("Expected a validation error for metadata over PayPal's limit, got %v", err)
+	}
+}
+
+func TestRecommendationCapabilities(t *testing.T) {
+	pm := payment.NewPaymentManager(0)
+	registry := payment.NewGatewayRegistry()
+	for i, method := range []string{"khalti", "imepay", "stripe", "esewa"} {
+		registry.RegisterCountryGateway(payment.CountryNepal, method, i+1)
+	}
+	pm.SetRegistry(registry)
+	pm.RegisterGateway("khalti", khalti.New(&payment.GatewayConfig{}, nil))
+	pm.RegisterGateway("imepay", imepay.New(&payment.GatewayConfig{}, nil))
+	pm.RegisterGateway("stripe", stripe.New(&payment.GatewayConfig{}, nil))
+
+	want := map[string]bool{"khalti": true, "imepay": true, "stripe": false}
+	for _, rec := range pm.GetGatewayRecommendations(payment.CountryNepal) {
+		if rec.Method == "esewa" {
+			if rec.Capabilities != nil {
+				t.Error("Expected no capabilities for an unconfigured gateway")
+			}
+			continue
+		}
+		if rec.Capabilities == nil {
+			t.Fatalf("%s: expected capabilities", rec.Method)
+		}
+		if rec.Capabilities.RequiresPhone != want[rec.Method] {
+			t.Errorf("%s: RequiresPhone = %v", rec.Method, rec.Capabilities.RequiresPhone)
+		}
+		if rec.Capabilities.Refund != (rec.Method == "stripe") {
+			t.Errorf("%s: Refund = %v", rec.Method, rec.Capabilities.Refund)
+		}
+	}
+}
+
+func TestGetCapabilities(t *testing.T) {
+	pm := payment.NewPaymentManager(0)
+	pm.RegisterGateway("esewa", esewa.New(&payment.GatewayConfig{}, nil))
+	pm.RegisterGateway("stripe", stripe.New(&payment.GatewayConfig{}, nil))
+
+	caps, err := pm.GetCapabilities("esewa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Refund || caps.PartialRefund || caps.Webhook || !caps.StatusCheck {
+		t.Errorf("esewa: unexpected capabilities %+v", caps)
+	}
+
+	caps, err = pm.GetCapabilities("stripe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !caps.Refund || !caps.PartialRefund || !caps.Webhook || !caps.StatusCheck || !caps.Recurring {
+		t.Errorf("stripe: unexpected capabilities %+v", caps)
+	}
+
+	if _, err := pm.GetCapabilities("unknown"); !errors.Is(err, payment.ErrGatewayNotRegistered) {
+		t.Errorf("Expected ErrGatewayNotRegistered, got %v", err)
+	}
+}
+
+func TestGatewayOperations(t *testing.T) {
+	pm := payment.NewPaymentManager(0)
+	pm.RegisterGateway("esewa", esewa.New(&payment.GatewayConfig{}, nil))
+	pm.RegisterGateway("stripe", stripe.New(&payment.GatewayConfig{}, nil))
+	pm.RegisterGateway("paypal", paypal.New(&payment.GatewayConfig{}, nil))
+
+	want := map[string][]string{
+		"esewa":  {"initiate", "verify", "status"},
+		"stripe": {"initiate", "verify", "refund", "status", "webhook"},
+		"paypal": {"initiate", "verify", "refund", "status"},
+	}
+	if got := pm.GatewayOperations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestValidateCurrency(t *testing.T) {
+	pm := payment.NewPaymentManager(0)
+	pm.RegisterGateway("esewa", esewa.New(&payment.GatewayConfig{}, nil))
+	pm.RegisterGateway("stripe", stripe.New(&payment.GatewayConfig{}, nil))
+
+	if err := pm.ValidateCurrency("esewa", "NPR"); err != nil {
+		t.Errorf("Expected eSewa to charge NPR: %v", err)
+	}
+	if err := pm.ValidateCurrency("esewa", "USD"); !errors.Is(err, payment.ErrUnsupportedCurrency) {
+		t.Errorf("Expected ErrUnsupportedCurrency, got %v", err)
+	}
+	if err := pm.ValidateCurrency("stripe", "usd"); err != nil {
+		t.Errorf("Expected Stripe to charge USD: %v", err)
+	}
+
+	// A USD amount is rejected rather than sent to eSewa as NPR
+	_, err := pm.InitiatePayment(context.Background(), "esewa", &payment.PaymentRequest{
+		OrderID:    "O1",
+		Amount:     money.New(10, money.MustCurrency("USD")),
+		SuccessURL: "https://shop.example.com/success",
+	})
+	if payment.HTTPStatusForError(err) != http.StatusBadRequest {
+		t.Errorf("Expected a validation error, got %v", err)
+	}
+}
+
+func TestIMEPayStatusUsesStoredPhone(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if r.URL.Path != "/Reconfirm" || json.NewDecoder(r.Body).Decode(&body) != nil || body["Msisdn"] != "9800000001" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ResponseCode":"0","Amount":"100"}`))
+	}))
+	defer srv.Close()
+
+	pm := payment.NewPaymentManager(0)
+	pm.RegisterGateway("imepay", imepay.New(&payment.GatewayConfig{BaseURL: srv.URL, Currency: "NPR"}, srv.Client()))
+	pm.SetTransactionStore(payment.NewMemoryTransactionStore())
+	ctx := context.Background()
+
+	if _, err := pm.InitiatePayment(ctx, "imepay", &payment.PaymentRequest{
+		OrderID:       "O1",
+		Amount:        money.New(100, money.MustCurrency("NPR")),
+		CustomerPhone: "9800000001",
+		SuccessURL:    "https://shop.example.com/success",
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	status, err := pm.GetStatus(ctx, "imepay", &payment.StatusRequest{OrderID: "O1", RawData: map[string]string{"TransactionId": "T1"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status.Status != payment.StatusCompleted {
+		t.Errorf("Expected completed, got %s", status.Status)
+	}
+
+	if _, err := pm.GetStatus(ctx, "imepay", nil); !errors.Is(err, payment.ErrNilRequest) {
+		t.Errorf("Expected ErrNilRequest, got %v", err)
+	}
+}
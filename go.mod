@@ -2,4 +2,7 @@ module github.com/oarkflow/payment
 
 go 1.25.5
 
-require github.com/oarkflow/money v0.0.1 // indirect
+require (
+	github.com/oarkflow/money v0.0.1
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+)
@@ -0,0 +1,97 @@
+package payment
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Provider response headers that signal how to pace and retry requests
+const (
+	HeaderRetryAfter         = "Retry-After"
+	HeaderRateLimitLimit     = "X-Ratelimit-Limit"
+	HeaderRateLimitRemaining = "X-Ratelimit-Remaining"
+	HeaderRateLimitReset     = "X-Ratelimit-Reset"
+	// HeaderStripeShouldRetry is Stripe's verdict on whether a failed request
+	// is safe and worth retrying
+	HeaderStripeShouldRetry = "Stripe-Should-Retry"
+)
+
+// RateLimitHeaders returns the rate-limit and retry headers of a provider
+// response, keyed by canonical name: Retry-After, Stripe-Should-Retry and
+// any header mentioning a rate limit, such as X-RateLimit-Remaining or
+// Razorpay's equivalents. It returns nil if there are none.
+func RateLimitHeaders(resp *http.Response) map[string]string {
+	var headers map[string]string
+	for name, values := range resp.Header {
+		lower := strings.ToLower(name)
+		if len(values) == 0 || !(strings.Contains(lower, "ratelimit") || strings.Contains(lower, "retry")) {
+			continue
+		}
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[http.CanonicalHeaderKey(name)] = values[0]
+	}
+	return headers
+}
+
+// rateLimitTransport reports the RateLimitHeaders of each response it
+// carries to observe
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	method  string
+	observe func(method string, headers map[string]string)
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if headers := RateLimitHeaders(resp); headers != nil {
+		t.observe(t.method, headers)
+	}
+	return resp, nil
+}
+
+// withRateLimitObserver returns client, or a copy whose transport reports
+// rate-limit headers to observe when it is set
+func withRateLimitObserver(client *http.Client, method string, observe func(string, map[string]string)) *http.Client {
+	if observe == nil {
+		return client
+	}
+	observed := &http.Client{}
+	if client != nil {
+		*observed = *client
+	}
+	base := observed.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	observed.Transport = &rateLimitTransport{base: base, method: method, observe: observe}
+	return observed
+}
+
+// RetryAfter returns how long the provider asked to wait before retrying,
+// from the Retry-After header of a PaymentError in err's chain. Both delay
+// seconds and HTTP dates are understood.
+func RetryAfter(err error) (time.Duration, bool) {
+	var perr *PaymentError
+	if !errors.As(err, &perr) {
+		return 0, false
+	}
+	value, ok := perr.Headers[HeaderRetryAfter]
+	if !ok {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,137 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func providerResponse(status int, headers map[string]string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{"error":"busy"}`))}
+	for k, v := range headers {
+		resp.Header.Set(k, v)
+	}
+	return resp
+}
+
+func TestReadResponseBodyHeaders(t *testing.T) {
+	resp := providerResponse(http.StatusTooManyRequests, map[string]string{
+		"Retry-After":           "2",
+		"X-RateLimit-Remaining": "0",
+		"Stripe-Should-Retry":   "true",
+		"Content-Type":          "application/json",
+	})
+	_, err := ReadResponseBody("stripe", resp)
+	var perr *PaymentError
+	if !errors.As(err, &perr) {
+		t.Fatalf("Expected a PaymentError, got %v", err)
+	}
+	want := map[string]string{"Retry-After": "2", "X-Ratelimit-Remaining": "0", "Stripe-Should-Retry": "true"}
+	if len(perr.Headers) != len(want) {
+		t.Errorf("Expected %v, got %v", want, perr.Headers)
+	}
+	for k, v := range want {
+		if perr.Headers[k] != v {
+			t.Errorf("%s: expected %q, got %q", k, v, perr.Headers[k])
+		}
+	}
+	if after, ok := RetryAfter(err); !ok || after != 2*time.Second {
+		t.Errorf("Expected Retry-After 2s, got %s (%v)", after, ok)
+	}
+
+	if _, err := ReadResponseBody("stripe", providerResponse(http.StatusBadGateway, nil)); errors.As(err, &perr) && perr.Headers != nil {
+		t.Errorf("Expected no headers, got %v", perr.Headers)
+	}
+}
+
+func TestRetryAfterDate(t *testing.T) {
+	at := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	err := &PaymentError{Kind: ErrKindProvider, Headers: map[string]string{HeaderRetryAfter: at}}
+	if after, ok := RetryAfter(err); !ok || after <= 58*time.Second || after > time.Minute {
+		t.Errorf("Expected about a minute, got %s (%v)", after, ok)
+	}
+	if _, ok := RetryAfter(errors.New("plain")); ok {
+		t.Error("Expected no Retry-After for a plain error")
+	}
+}
+
+func TestStripeShouldRetry(t *testing.T) {
+	conflict := ErrorFromHTTPStatus("stripe", http.StatusConflict, "HTTP 409")
+	conflict.Headers = map[string]string{HeaderStripeShouldRetry: "true"}
+	if !IsTransient(conflict) {
+		t.Error("Stripe-Should-Retry: true should make a 409 transient")
+	}
+	unavailable := ErrorFromHTTPStatus("stripe", http.StatusServiceUnavailable, "HTTP 503")
+	unavailable.Headers = map[string]string{HeaderStripeShouldRetry: "false"}
+	if IsTransient(unavailable) {
+		t.Error("Stripe-Should-Retry: false should make a 503 permanent")
+	}
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	limited := ErrorFromHTTPStatus("fake", http.StatusTooManyRequests, "HTTP 429")
+	limited.Headers = map[string]string{HeaderRetryAfter: "60"}
+	g := &flakyGateway{fakeGateway: fakeGateway{method: "fake"}, err: limited, failures: 1}
+	pm := NewPaymentManagerWithOptions(WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+	pm.RegisterGateway("fake", g)
+
+	// Waiting longer than MaxDelay is left to the caller
+	if _, err := pm.GetStatus(context.Background(), "fake", &StatusRequest{TransactionID: "t1"}); !errors.Is(err, limited) || g.calls != 1 {
+		t.Errorf("Expected the 429 without retrying, got %v after %d calls", err, g.calls)
+	}
+
+	// The handler passes the provider's Retry-After on
+	srv := httptest.NewServer(NewHTTPHandler(pm))
+	defer srv.Close()
+	g.calls = 0
+	resp, err := http.Get(srv.URL + "/payments/fake/status/t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || resp.Header.Get("Retry-After") != "60" {
+		t.Errorf("Expected 502 with Retry-After 60, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestOnRateLimitHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/limited" {
+			w.Header().Set("X-RateLimit-Remaining", "41")
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	var observed []map[string]string
+	var client *http.Client
+	factory := func(config *GatewayConfig, c *http.Client) Gateway {
+		client = c
+		return &fakeGateway{}
+	}
+	config := &GatewayConfig{OnRateLimitHeaders: func(method string, headers map[string]string) {
+		if method != "stripe" {
+			t.Errorf("Expected method stripe, got %q", method)
+		}
+		observed = append(observed, headers)
+	}}
+	if _, err := newGateway("stripe", factory, srv.Client(), nil, nil, config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, path := range []string{"/limited", "/plain"} {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if len(observed) != 1 || observed[0]["X-Ratelimit-Remaining"] != "41" {
+		t.Errorf("Expected the successful response's rate-limit headers once, got %v", observed)
+	}
+}
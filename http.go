@@ -0,0 +1,135 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// NewHTTPHandler exposes the manager over JSON/HTTP:
+//
+//	POST /payments/{method}/initiate       PaymentRequest      -> PaymentResponse
+//	POST /payments/{method}/verify         VerificationRequest -> VerificationResponse
+//	POST /payments/{method}/refund         RefundRequest       -> RefundResponse
+//	GET  /payments/{method}/status/{txnID}                     -> StatusResponse
+//	GET  /payments/checkout?country=NP&currency=NPR            -> CheckoutOptions
+//
+// Errors are returned as {"error": "...", "kind": "..."} with the status from
+// HTTPStatusForError.
+func NewHTTPHandler(pm *PaymentManager) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /payments/{method}/initiate", func(w http.ResponseWriter, r *http.Request) {
+		var req PaymentRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		resp, err := pm.InitiatePayment(r.Context(), r.PathValue("method"), &req)
+		writeResult(w, resp, err)
+	})
+
+	mux.HandleFunc("POST /payments/{method}/verify", func(w http.ResponseWriter, r *http.Request) {
+		var req VerificationRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		resp, err := pm.VerifyPayment(r.Context(), r.PathValue("method"), &req)
+		writeResult(w, resp, err)
+	})
+
+	mux.HandleFunc("POST /payments/{method}/refund", func(w http.ResponseWriter, r *http.Request) {
+		var req RefundRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		resp, err := pm.RefundPayment(r.Context(), r.PathValue("method"), &req)
+		writeResult(w, resp, err)
+	})
+
+	mux.HandleFunc("GET /payments/{method}/status/{txnID}", func(w http.ResponseWriter, r *http.Request) {
+		resp, err := pm.GetStatus(r.Context(), r.PathValue("method"), &StatusRequest{TransactionID: r.PathValue("txnID")})
+		writeResult(w, resp, err)
+	})
+
+	mux.HandleFunc("GET /payments/checkout", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		resp, err := pm.CheckoutOptions(Country(query.Get("country")), query.Get("currency"))
+		writeResult(w, resp, err)
+	})
+
+	return mux
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid request body: " + err.Error(),
+			"kind":  string(ErrKindValidation),
+		})
+		return false
+	}
+	return true
+}
+
+func writeResult(w http.ResponseWriter, resp interface{}, err error) {
+	if err != nil {
+		body := map[string]string{"error": err.Error()}
+		var perr *PaymentError
+		if errors.As(err, &perr) {
+			body["kind"] = string(perr.Kind)
+		}
+		if after, ok := RetryAfter(err); ok {
+			w.Header().Set(HeaderRetryAfter, strconv.Itoa(int(after.Seconds())))
+		}
+		writeJSON(w, HTTPStatusForError(err), body)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// maxErrorBody is how much of a non-2xx provider response is kept in errors
+const maxErrorBody = 512
+
+// ReadResponseBody reads a provider response for method. A non-2xx status
+// is returned as an ErrorFromHTTPStatus error carrying the status code, the
+// start of the body, so HTML error pages don't reach the JSON decoder, and
+// the response's RateLimitHeaders.
+func ReadResponseBody(method string, resp *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet := bytes.TrimSpace(body)
+		if len(snippet) > maxErrorBody {
+			snippet = append(snippet[:maxErrorBody:maxErrorBody], "..."...)
+		}
+		perr := ErrorFromHTTPStatus(method, resp.StatusCode, fmt.Sprintf("HTTP %d: %s", resp.StatusCode, snippet))
+		perr.Headers = RateLimitHeaders(resp)
+		return nil, perr
+	}
+	return body, nil
+}
+
+// DecodeJSONResponse decodes a provider response for method into v, after
+// checking its status with ReadResponseBody
+func DecodeJSONResponse(method string, resp *http.Response, v interface{}) error {
+	body, err := ReadResponseBody(method, resp)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%s: decoding response: %w", method, err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPStatusForError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{NewPaymentError(ErrKindDeclined, "fake", "insufficient funds", nil), http.StatusPaymentRequired},
+		{NewPaymentError(ErrKindValidation, "fake", "bad amount", nil), http.StatusBadRequest},
+		{ErrorFromHTTPStatus("fake", 503, "down"), http.StatusBadGateway},
+		{WrapTransportError("fake", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{fmt.Errorf("wrapped: %w", ErrIdempotencyConflict), http.StatusConflict},
+		{errors.New("unknown"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		if got := HTTPStatusForError(tt.err); got != tt.want {
+			t.Errorf("HTTPStatusForError(%v) = %d; want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+	pm.GetRegistry().RegisterGlobalGateway("fake", 1)
+	pm.RegisterGateway("declines", &fakeGateway{
+		method:  "declines",
+		initErr: NewPaymentError(ErrKindDeclined, "declines", "card declined", nil),
+	})
+	handler := NewHTTPHandler(pm)
+	validBody := `{"order_id":"O1","amount":{"currency":"NPR","amount":"100.00"},"success_url":"` + testSuccessURL + `"}`
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{"POST", "/payments/fake/initiate", validBody, http.StatusOK},
+		{"POST", "/payments/declines/initiate", validBody, http.StatusPaymentRequired},
+		{"POST", "/payments/missing/initiate", validBody, http.StatusNotFound},
+		{"POST", "/payments/fake/initiate", `{"order_id":"O1"}`, http.StatusBadRequest},
+		{"POST", "/payments/fake/initiate", `not json`, http.StatusBadRequest},
+		{"GET", "/payments/fake/status/txn-1", "", http.StatusOK},
+		{"GET", "/payments/checkout?country=NP", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: got %d, want %d (%s)", tt.method, tt.path, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+}
+
+func TestDecodeJSONResponse(t *testing.T) {
+	respond := func(code int, body string) *http.Response {
+		return &http.Response{StatusCode: code, Body: io.NopCloser(strings.NewReader(body))}
+	}
+
+	var v map[string]string
+	if err := DecodeJSONResponse("fake", respond(200, `{"status":"ok"}`), &v); err != nil || v["status"] != "ok" {
+		t.Errorf("Unexpected result %v, %v", v, err)
+	}
+
+	page := "<html>" + strings.Repeat("x", 2*maxErrorBody) + "</html>"
+	err := DecodeJSONResponse("fake", respond(503, page), &v)
+	if HTTPStatusForError(err) != http.StatusBadGateway || !strings.Contains(err.Error(), "HTTP 503") {
+		t.Fatalf("Expected a provider error with the status code, got %v", err)
+	}
+	if len(err.Error()) > 2*maxErrorBody {
+		t.Errorf("Expected the body to be truncated, got %d bytes", len(err.Error()))
+	}
+
+	if err := DecodeJSONResponse("fake", respond(200, "<html>"), &v); err == nil || HTTPStatusForError(err) == http.StatusBadGateway {
+		t.Errorf("Expected a decode error, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package payment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrIdempotencyConflict is returned when an idempotency key is reused with a
+// different request payload
+var ErrIdempotencyConflict = errors.New("idempotency key reused with a different request")
+
+// IdempotencyRecord stores the outcome of a request made with an idempotency key
+type IdempotencyRecord struct {
+	Key         string
+	Method      string
+	RequestHash string
+	Response    *PaymentResponse
+	CreatedAt   time.Time
+}
+
+// IdempotencyStore persists idempotency records
+type IdempotencyStore interface {
+	Get(key string) (*IdempotencyRecord, bool)
+	Save(record *IdempotencyRecord)
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore
+type MemoryIdempotencyStore struct {
+	records map[string]*IdempotencyRecord
+	mu      sync.RWMutex
+}
+
+// NewMemoryIdempotencyStore creates an empty in-memory idempotency store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]*IdempotencyRecord)}
+}
+
+func (s *MemoryIdempotencyStore) Get(key string) (*IdempotencyRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[key]
+	return rec, ok
+}
+
+func (s *MemoryIdempotencyStore) Save(record *IdempotencyRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.Key] = record
+}
+
+// IdempotencyKeyForwarder is implemented by gateways that send
+// PaymentRequest.IdempotencyKey to their provider, which replays a retried
+// request instead of creating a second payment. InitiatePayment is retried
+// only for these gateways.
+type IdempotencyKeyForwarder interface {
+	ForwardsIdempotencyKey() bool
+}
+
+// forwardsIdempotencyKey reports whether g sends the idempotency key to its
+// provider
+func forwardsIdempotencyKey(g Gateway) bool {
+	f, ok := UnwrapGateway(g).(IdempotencyKeyForwarder)
+	return ok && f.ForwardsIdempotencyKey()
+}
+
+// DefaultIdempotencyKey returns the key InitiatePayment sends to method's
+// gateway for orderID when the request has no IdempotencyKey. It depends
+// only on method and orderID, so a caller retrying after a timeout sends
+// the same key and the provider replays the first payment instead of
+// creating a second one.
+func DefaultIdempotencyKey(method, orderID string) string {
+	sum := sha256.Sum256([]byte(method + "\x00" + orderID))
+	return "order-" + hex.EncodeToString(sum[:16])
+}
+
+// withGatewayIdempotencyKey returns req with IdempotencyKey defaulted from
+// the order id, copying req rather than modifying it
+func withGatewayIdempotencyKey(method string, req *PaymentRequest) *PaymentRequest {
+	if req.IdempotencyKey != "" || req.OrderID == "" {
+		return req
+	}
+	keyed := *req
+	keyed.IdempotencyKey = DefaultIdempotencyKey(method, req.OrderID)
+	return &keyed
+}
+
+// hashPaymentRequest returns a stable hash of the method and request payload
+func hashPaymentRequest(method string, req *PaymentRequest) (string, error) {
+	data, err := json.Marshal(struct {
+		Method  string          `json:"method"`
+		Request *PaymentRequest `json:"request"`
+	}{method, req})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
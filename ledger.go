@@ -0,0 +1,129 @@
+package payment
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/oarkflow/money"
+)
+
+// LedgerEntryType is the kind of money movement a LedgerEntry records
+type LedgerEntryType string
+
+const (
+	LedgerInitiated  LedgerEntryType = "initiated"
+	LedgerAuthorized LedgerEntryType = "authorized"
+	LedgerCaptured   LedgerEntryType = "captured"
+	LedgerRefunded   LedgerEntryType = "refunded"
+)
+
+// LedgerEntry is one normalized row of manager activity. Amounts are always
+// positive; Type gives the direction.
+type LedgerEntry struct {
+	Time          time.Time       `json:"time"`
+	Type          LedgerEntryType `json:"type"`
+	Method        string          `json:"method"`
+	TransactionID string          `json:"transaction_id"`
+	OrderID       string          `json:"order_id,omitempty"`
+	Amount        money.Money     `json:"amount"`
+	Fee           money.Money     `json:"fee,omitempty"`
+	Status        PaymentStatus   `json:"status"`
+	// Reference is the provider id of the movement itself, e.g. a refund id
+	Reference string `json:"reference,omitempty"`
+}
+
+// LedgerStore is implemented by TransactionStores that also keep a ledger
+// of manager activity for ExportLedger
+type LedgerStore interface {
+	AppendLedger(entry LedgerEntry) error
+	// ListLedger returns entries with from <= Time < to, oldest first
+	ListLedger(from, to time.Time) ([]LedgerEntry, error)
+}
+
+// ledgerHeader is the CSV column order written by ExportLedger
+var ledgerHeader = []string{
+	"time", "type", "method", "transaction_id", "order_id",
+	"amount", "fee", "currency", "status", "reference",
+}
+
+// ExportLedger writes the ledger entries with from <= time < to as CSV to w.
+// Amounts are decimal strings in major units of the currency column. The
+// transaction store must implement LedgerStore.
+func (pm *PaymentManager) ExportLedger(from, to time.Time, w io.Writer) error {
+	store, ok := pm.GetTransactionStore().(LedgerStore)
+	if !ok {
+		return NewPaymentError(ErrKindUnsupported, "", "transaction store does not keep a ledger", nil)
+	}
+	entries, err := store.ListLedger(from, to)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(ledgerHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := cw.Write([]string{
+			e.Time.UTC().Format(time.RFC3339),
+			string(e.Type),
+			e.Method,
+			e.TransactionID,
+			e.OrderID,
+			ledgerAmount(e.Amount),
+			ledgerAmount(e.Fee),
+			e.Amount.Currency().Code,
+			string(e.Status),
+			e.Reference,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ledgerAmount formats m as a plain decimal, or "" if it has no currency
+func ledgerAmount(m money.Money) string {
+	if m.Currency().Code == "" {
+		return ""
+	}
+	return m.FormatWith(money.FormatOptions{DecimalSep: "."})
+}
+
+// recordLedger appends entry if the transaction store keeps a ledger
+func (pm *PaymentManager) recordLedger(entry LedgerEntry) {
+	store, ok := pm.GetTransactionStore().(LedgerStore)
+	if !ok {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	_ = store.AppendLedger(entry)
+}
+
+func (s *MemoryTransactionStore) AppendLedger(entry LedgerEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ledger = append(s.ledger, entry)
+	return nil
+}
+
+func (s *MemoryTransactionStore) ListLedger(from, to time.Time) ([]LedgerEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []LedgerEntry{}
+	for _, e := range s.ledger {
+		if !e.Time.Before(from) && e.Time.Before(to) {
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries, nil
+}
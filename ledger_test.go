@@ -0,0 +1,75 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/money"
+)
+
+func TestExportLedger(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+	pm.SetTransactionStore(NewMemoryTransactionStore())
+	ctx := context.Background()
+	from := time.Now().Add(-time.Minute)
+
+	amount := money.New(100, money.MustCurrency("USD"))
+	if _, err := pm.InitiatePayment(ctx, "fake", &PaymentRequest{OrderID: "o1", Amount: amount, SuccessURL: testSuccessURL}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := pm.VerifyPayment(ctx, "fake", &VerificationRequest{TransactionID: "txn-o1", Amount: amount}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := pm.RefundPayment(ctx, "fake", &RefundRequest{TransactionID: "txn-o1", Amount: money.New(40, money.MustCurrency("USD"))}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := pm.ExportLedger(from, time.Now().Add(time.Minute), &buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"initiated", "fake", "txn-o1", "o1", "100.00", "USD", "pending"},
+		{"captured", "fake", "txn-o1", "o1", "100.00", "USD", "completed"},
+		{"refunded", "fake", "txn-o1", "o1", "40.00", "USD", "partially_refunded"},
+	}
+	if len(rows) != len(want)+1 {
+		t.Fatalf("Expected header and %d rows, got %v", len(want), rows)
+	}
+	for i, w := range want {
+		row := rows[i+1]
+		got := []string{row[1], row[2], row[3], row[4], row[5], row[7], row[8]}
+		for j := range w {
+			if got[j] != w[j] {
+				t.Errorf("Row %d: expected %v, got %v", i, w, got)
+				break
+			}
+		}
+	}
+
+	// Entries outside the range are excluded
+	buf.Reset()
+	if err := pm.ExportLedger(time.Now().Add(time.Hour), time.Now().Add(2*time.Hour), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if rows, _ := csv.NewReader(&buf).ReadAll(); len(rows) != 1 {
+		t.Errorf("Expected only the header, got %v", rows)
+	}
+}
+
+func TestExportLedgerUnsupported(t *testing.T) {
+	pm := NewPaymentManager(0)
+	if err := pm.ExportLedger(time.Time{}, time.Now(), &bytes.Buffer{}); HTTPStatusForError(err) != 501 {
+		t.Errorf("Expected unsupported error, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package payment
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+)
+
+// Logger receives the manager's tracing of gateway calls. Messages never
+// include secret keys or card data.
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// nopLogger discards everything. It is the manager's default logger.
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...any) {}
+func (nopLogger) Infof(string, ...any)  {}
+func (nopLogger) Errorf(string, ...any) {}
+
+// NewSlogLogger returns a Logger that writes to l, or to slog.Default()
+// when l is nil
+func NewSlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) logger() *slog.Logger {
+	if s.l == nil {
+		return slog.Default()
+	}
+	return s.l
+}
+
+func (s slogLogger) Debugf(format string, args ...any) {
+	s.logger().Debug(fmt.Sprintf(format, args...))
+}
+
+func (s slogLogger) Infof(format string, args ...any) {
+	s.logger().Info(fmt.Sprintf(format, args...))
+}
+
+func (s slogLogger) Errorf(format string, args ...any) {
+	s.logger().Error(fmt.Sprintf(format, args...))
+}
+
+// SetLogger sets the logger that InitiatePayment, VerifyPayment and
+// RefundPayment log the method, order or transaction id and duration of
+// each call to. Gateways registered with a config afterwards also log
+// signatures to it unless their GatewayConfig.Logger is set. Pass nil to
+// disable logging.
+func (pm *PaymentManager) SetLogger(logger Logger) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.logger = logger
+}
+
+// getLogger returns the configured logger, or a no-op one
+func (pm *PaymentManager) getLogger() Logger {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if pm.logger == nil {
+		return nopLogger{}
+	}
+	return pm.logger
+}
+
+// logCall logs a completed gateway call. ref identifies the payment, see
+// paymentRef. It is deferred, so err points at the call's result.
+func (pm *PaymentManager) logCall(operation, method, ref string, start time.Time, err *error) {
+	logger := pm.getLogger()
+	elapsed := time.Since(start)
+	if *err != nil {
+		logger.Errorf("payment: %s %s %s failed after %s: %v", method, operation, ref, elapsed, *err)
+		return
+	}
+	logger.Infof("payment: %s %s %s took %s", method, operation, ref, elapsed)
+}
+
+// paymentRef identifies a payment in log messages by order id, or by
+// transaction id when the order is unknown
+func paymentRef(orderID, txnID string) string {
+	if orderID != "" || txnID == "" {
+		return "order=" + orderID
+	}
+	return "txn=" + txnID
+}
+
+// WithRedaction wraps logger so that GatewayConfig arguments are logged with
+// their APIKey, SecretKey and WebhookSecret masked, and card numbers in
+// messages keep only their last four digits
+func WithRedaction(logger Logger) Logger {
+	return redactingLogger{logger}
+}
+
+type redactingLogger struct {
+	next Logger
+}
+
+func (l redactingLogger) Debugf(format string, args ...any) {
+	l.next.Debugf("%s", redactMessage(format, args))
+}
+
+func (l redactingLogger) Infof(format string, args ...any) {
+	l.next.Infof("%s", redactMessage(format, args))
+}
+
+func (l redactingLogger) Errorf(format string, args ...any) {
+	l.next.Errorf("%s", redactMessage(format, args))
+}
+
+// panPattern matches digit runs that may be card numbers
+var panPattern = regexp.MustCompile(`\d[\d -]{11,22}\d`)
+
+// redactMessage formats args with configs redacted and masks card numbers
+func redactMessage(format string, args []any) string {
+	redacted := make([]any, len(args))
+	for i, arg := range args {
+		switch c := arg.(type) {
+		case *GatewayConfig:
+			if c != nil {
+				arg = RedactConfig(c)
+			}
+		case GatewayConfig:
+			arg = *RedactConfig(&c)
+		}
+		redacted[i] = arg
+	}
+	return panPattern.ReplaceAllStringFunc(fmt.Sprintf(format, redacted...), func(s string) string {
+		if looksLikePAN(s) {
+			return maskPAN(s)
+		}
+		return s
+	})
+}
+
+// RedactConfig returns a copy of config safe to log: APIKey, SecretKey and
+// WebhookSecret, including the ExtraConfig fallback, are replaced with
+// Redacted
+func RedactConfig(config *GatewayConfig) *GatewayConfig {
+	cp := *config
+	for _, s := range []*string{&cp.APIKey, &cp.SecretKey, &cp.WebhookSecret} {
+		if *s != "" {
+			*s = Redacted
+		}
+	}
+	if _, ok := cp.ExtraConfig["webhook_secret"]; ok {
+		extra := make(map[string]interface{}, len(cp.ExtraConfig))
+		for k, v := range cp.ExtraConfig {
+			extra[k] = v
+		}
+		extra["webhook_secret"] = Redacted
+		cp.ExtraConfig = extra
+	}
+	return &cp
+}
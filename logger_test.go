@@ -0,0 +1,119 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/money"
+)
+
+// recordingLogger keeps every message, prefixed with its level
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...any) {
+	l.lines = append(l.lines, "DEBUG "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Infof(format string, args ...any) {
+	l.lines = append(l.lines, "INFO "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Errorf(format string, args ...any) {
+	l.lines = append(l.lines, "ERROR "+fmt.Sprintf(format, args...))
+}
+
+func TestSetLogger(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+	pm.RegisterGateway("bad", &fakeGateway{method: "bad", initErr: errors.New("declined")})
+	req := &PaymentRequest{OrderID: "O1", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL}
+
+	// The default logger discards calls
+	if _, err := pm.InitiatePayment(context.Background(), "fake", req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	logger := &recordingLogger{}
+	pm.SetLogger(logger)
+	if _, err := pm.InitiatePayment(context.Background(), "fake", req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pm.InitiatePayment(context.Background(), "bad", req)
+
+	if len(logger.lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", logger.lines)
+	}
+	if line := logger.lines[0]; !strings.HasPrefix(line, "INFO payment: fake initiate order=O1 took ") {
+		t.Errorf("Unexpected success line %q", line)
+	}
+	if line := logger.lines[1]; !strings.HasPrefix(line, "ERROR payment: bad initiate order=O1 failed after ") || !strings.HasSuffix(line, ": declined") {
+		t.Errorf("Unexpected failure line %q", line)
+	}
+}
+
+func TestNilRequests(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+	pm.SetLogger(&recordingLogger{})
+	ctx := context.Background()
+
+	_, initErr := pm.InitiatePayment(ctx, "fake", nil)
+	_, verifyErr := pm.VerifyPayment(ctx, "fake", nil)
+	_, refundErr := pm.RefundPayment(ctx, "fake", nil)
+	_, countryErr := pm.InitiatePaymentForCountry(ctx, CountryNepal, nil)
+	_, orderErr := pm.VerifyPaymentForOrder(ctx, nil)
+	for op, err := range map[string]error{"initiate": initErr, "verify": verifyErr, "refund": refundErr, "country": countryErr, "order": orderErr} {
+		if !errors.Is(err, ErrNilRequest) || HTTPStatusForError(err) != 400 {
+			t.Errorf("%s: expected a validation error for a nil request, got %v", op, err)
+		}
+	}
+}
+
+func TestManagerLoggerReceivesSignatures(t *testing.T) {
+	pm := NewPaymentManager(0)
+	logger := &recordingLogger{}
+	pm.SetLogger(logger)
+	var built *GatewayConfig
+	pm.RegisterFactory("fake", func(config *GatewayConfig, client *http.Client) Gateway {
+		built = config
+		return &fakeGateway{method: "fake"}
+	})
+	if err := pm.RegisterGatewayWithConfig("fake", &GatewayConfig{SecretKey: "s3cret", LogSignatures: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	LogSignature(built, "fake", "initiate", []string{"RefId"}, "RefId=R1s3cret", "ABC")
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "signature=ABC") || strings.Contains(logger.lines[0], "s3cret") {
+		t.Errorf("Expected one redacted signature line, got %q", logger.lines)
+	}
+}
+
+func TestWithRedaction(t *testing.T) {
+	logger := &recordingLogger{}
+	config := &GatewayConfig{
+		MerchantID:  "M1",
+		APIKey:      "pk_live_123",
+		SecretKey:   "sk_live_456",
+		ExtraConfig: map[string]interface{}{"webhook_secret": "whsec_789"},
+	}
+	WithRedaction(logger).Infof("config %+v card %s", config, "4242 4242 4242 4242")
+
+	line := logger.lines[0]
+	for _, secret := range []string{"pk_live_123", "sk_live_456", "whsec_789", "4242 4242 4242 4242"} {
+		if strings.Contains(line, secret) {
+			t.Errorf("%q should be redacted from %q", secret, line)
+		}
+	}
+	if !strings.Contains(line, "M1") || !strings.Contains(line, "************4242") {
+		t.Errorf("Expected merchant id and masked card in %q", line)
+	}
+	if config.SecretKey != "sk_live_456" || config.ExtraConfig["webhook_secret"] != "whsec_789" {
+		t.Error("Redaction should not modify the logged config")
+	}
+}
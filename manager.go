@@ -2,8 +2,12 @@ package payment
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -12,9 +16,40 @@ import (
 type PaymentManager struct {
 	gateways  map[string]Gateway
 	factories map[string]GatewayFactory
+	aliases   map[string]string
+	accounts  map[string]map[string]Gateway
+	failover  map[Country][]string
+	weights   map[Country]map[string]int
 	registry  *GatewayRegistry
 	client    *http.Client
 	mu        sync.RWMutex
+
+	idempotency  IdempotencyStore
+	idemLocks    keyLocks // idempotency key -> lock
+	transactions TransactionStore
+	rates        ExchangeRateProvider
+	sla          *SLATracker
+	limiter      *concurrencyLimiter
+	secrets      SecretResolver
+	webhooks     *webhookEvents
+	refundLocks  keyLocks // transaction ID -> lock
+	// subscriptionAccounts maps "method|subscription ID" to the account
+	// the subscription was created on
+	subscriptionAccounts map[string]string
+
+	verifyRetry     VerifyRetryOptions
+	amountTolerance AmountTolerance
+	logger          Logger
+
+	resilience        ResiliencePolicy
+	gatewayResilience map[string]ResiliencePolicy
+	resilienceStates  *resilienceStates
+
+	routingRand *rand.Rand
+	routingMu   sync.Mutex
+
+	reaperCancel context.CancelFunc
+	reaperDone   chan struct{}
 }
 
 func NewPaymentManager(timeout time.Duration) *PaymentManager {
@@ -25,7 +60,17 @@ func NewPaymentManager(timeout time.Duration) *PaymentManager {
 	pm := &PaymentManager{
 		gateways:  make(map[string]Gateway),
 		factories: make(map[string]GatewayFactory),
+		aliases:   make(map[string]string),
+		accounts:  make(map[string]map[string]Gateway),
+		failover:  make(map[Country][]string),
+		weights:   make(map[Country]map[string]int),
 		registry:  NewGatewayRegistry(),
+		webhooks:  newWebhookEvents(),
+
+		subscriptionAccounts: make(map[string]string),
+
+		gatewayResilience: make(map[string]ResiliencePolicy),
+		resilienceStates:  newResilienceStates(),
 		client: &http.Client{
 			Timeout: timeout,
 			Transport: &http.Transport{
@@ -42,7 +87,54 @@ func NewPaymentManager(timeout time.Duration) *PaymentManager {
 	return pm
 }
 
-// SetRegistry sets a custom gateway registry
+// ManagerOption configures a PaymentManager created with
+// NewPaymentManagerWithOptions
+type ManagerOption func(*PaymentManager)
+
+// WithHTTPTimeout sets the timeout of the shared HTTP client (default 30s)
+func WithHTTPTimeout(timeout time.Duration) ManagerOption {
+	return func(pm *PaymentManager) {
+		if timeout > 0 {
+			pm.client.Timeout = timeout
+		}
+	}
+}
+
+// WithHTTPTransport sets the transport of the shared HTTP client, e.g. to
+// record or fake provider traffic in tests. GatewayConfig.Transport
+// overrides it for a single gateway.
+func WithHTTPTransport(transport http.RoundTripper) ManagerOption {
+	return func(pm *PaymentManager) {
+		if transport != nil {
+			pm.client.Transport = transport
+		}
+	}
+}
+
+// WithRetryPolicy sets the retry policy for transient gateway failures, see
+// SetRetryPolicy
+func WithRetryPolicy(policy RetryPolicy) ManagerOption {
+	return func(pm *PaymentManager) { pm.resilience.Retry = policy }
+}
+
+// WithLogger sets the manager's logger, see SetLogger
+func WithLogger(logger Logger) ManagerOption {
+	return func(pm *PaymentManager) { pm.logger = logger }
+}
+
+// NewPaymentManagerWithOptions creates a manager like NewPaymentManager(0)
+// and applies opts in order
+func NewPaymentManagerWithOptions(opts ...ManagerOption) *PaymentManager {
+	pm := NewPaymentManager(0)
+	for _, opt := range opts {
+		opt(pm)
+	}
+	return pm
+}
+
+// SetRegistry sets a custom gateway registry. With a nil registry there is
+// no availability information: every configured gateway is treated as
+// available everywhere, in method name order.
 func (pm *PaymentManager) SetRegistry(registry *GatewayRegistry) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
@@ -56,45 +148,249 @@ func (pm *PaymentManager) GetRegistry() *GatewayRegistry {
 	return pm.registry
 }
 
+// SetIdempotencyStore enables idempotency key handling for InitiatePayment.
+// Concurrent requests with the same key are serialized within this manager;
+// managers sharing a store across processes also need the provider to
+// deduplicate, see IdempotencyKeyForwarder. Pass nil to disable it.
+func (pm *PaymentManager) SetIdempotencyStore(store IdempotencyStore) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.idempotency = store
+}
+
+// SetTransactionStore enables recording of initiated payments. Pass nil to
+// disable it.
+func (pm *PaymentManager) SetTransactionStore(store TransactionStore) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.transactions = store
+}
+
+// GetTransactionStore returns the configured transaction store, if any
+func (pm *PaymentManager) GetTransactionStore() TransactionStore {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.transactions
+}
+
+// SetDefaultRegion sets the fallback region used for countries that are not
+// mapped to a region
+func (pm *PaymentManager) SetDefaultRegion(region Region) {
+	if registry := pm.GetRegistry(); registry != nil {
+		registry.SetDefaultRegion(region)
+	}
+}
+
 // RegisterFactory registers a gateway factory for dynamic gateway creation
 func (pm *PaymentManager) RegisterFactory(method string, factory GatewayFactory) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
-	pm.factories[method] = factory
+	pm.factories[NormalizeMethod(method)] = factory
 }
 
 // RegisterGateway registers a pre-configured gateway instance
 func (pm *PaymentManager) RegisterGateway(method string, gateway Gateway) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
-	pm.gateways[method] = gateway
+	pm.gateways[NormalizeMethod(method)] = gateway
 }
 
-// RegisterGatewayWithConfig creates and registers a gateway using its factory
+// RemoveGateway unregisters the gateway for method, or the method an alias
+// points to, along with its accounts. Calls already in progress complete on
+// the removed instance.
+func (pm *PaymentManager) RemoveGateway(method string) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	resolved := pm.resolveMethod(method)
+	if _, ok := pm.gateways[resolved]; !ok {
+		return fmt.Errorf("gateway %s %w", method, ErrGatewayNotRegistered)
+	}
+	delete(pm.gateways, resolved)
+	delete(pm.accounts, resolved)
+	return nil
+}
+
+// RemoveFactory unregisters the factory for method. Gateways already built
+// with it stay registered.
+func (pm *PaymentManager) RemoveFactory(method string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	delete(pm.factories, NormalizeMethod(method))
+}
+
+// RegisterGatewayWithConfig creates and registers a gateway using its
+// factory. Secret references in config are resolved once, here, with the
+// SetSecretResolver resolver; the gateway keeps those values until it is
+// registered again.
 func (pm *PaymentManager) RegisterGatewayWithConfig(method string, config *GatewayConfig) error {
+	method = NormalizeMethod(method)
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
+	gateway, err := pm.buildGateway(method, config)
+	if err != nil {
+		return err
+	}
+	pm.gateways[method] = gateway
+	return nil
+}
+
+// RegisterGatewaysWithConfig creates the gateways for configs in parallel,
+// for factories that do network work, and registers those that build. Every
+// failure is returned, joined and ordered by method.
+func (pm *PaymentManager) RegisterGatewaysWithConfig(configs map[string]*GatewayConfig) error {
+	configs = normalizeConfigs(configs)
+	pm.mu.RLock()
+	factories := make(map[string]GatewayFactory, len(configs))
+	for method := range configs {
+		if factory, ok := pm.factories[method]; ok {
+			factories[method] = factory
+		}
+	}
+	client := pm.client
+	secrets := pm.secrets
+	logger := pm.logger
+	pm.mu.RUnlock()
+
+	methods := make([]string, 0, len(configs))
+	for method := range configs {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	gateways := make([]Gateway, len(methods))
+	errs := make([]error, len(methods))
+	var wg sync.WaitGroup
+	for i, method := range methods {
+		factory, ok := factories[method]
+		if !ok {
+			errs[i] = fmt.Errorf("no factory registered for method: %s", method)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gateways[i], errs[i] = newGateway(method, factory, client, secrets, logger, configs[method])
+		}()
+	}
+	wg.Wait()
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for i, method := range methods {
+		if errs[i] == nil {
+			pm.gateways[method] = gateways[i]
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NormalizeMethod returns the canonical form of a method name: trimmed and
+// lowercased, so "Stripe" and " stripe" name the same gateway. The manager and
+// registry normalize every method they are given.
+func NormalizeMethod(method string) string {
+	return strings.ToLower(strings.TrimSpace(method))
+}
+
+// normalizeConfigs returns configs keyed by normalized method
+func normalizeConfigs(configs map[string]*GatewayConfig) map[string]*GatewayConfig {
+	normalized := make(map[string]*GatewayConfig, len(configs))
+	for method, config := range configs {
+		normalized[NormalizeMethod(method)] = config
+	}
+	return normalized
+}
+
+// buildGateway creates a gateway from its factory and validates config.
+// Callers must hold pm.mu.
+func (pm *PaymentManager) buildGateway(method string, config *GatewayConfig) (Gateway, error) {
 	factory, ok := pm.factories[method]
 	if !ok {
-		return fmt.Errorf("no factory registered for method: %s", method)
+		return nil, fmt.Errorf("no factory registered for method: %s", method)
 	}
+	return newGateway(method, factory, pm.client, pm.secrets, pm.logger, config)
+}
 
-	gateway := factory(config, pm.client)
-	pm.gateways[method] = gateway
-	return nil
+// newGateway creates a gateway with factory and validates config. Secret
+// references in config are resolved with secrets, if set, and logger is
+// the default for config.Logger.
+func newGateway(method string, factory GatewayFactory, client *http.Client, secrets SecretResolver, logger Logger, config *GatewayConfig) (Gateway, error) {
+	config, err := resolveSecrets(secrets, config)
+	if err != nil {
+		return nil, fmt.Errorf("gateway %s: %w", method, err)
+	}
+	if config.Logger == nil && logger != nil {
+		config.Logger = logger
+	}
+	client = withGatewayTransport(client, config.Transport)
+	client, err = gatewayClient(client, config)
+	if err != nil {
+		return nil, fmt.Errorf("gateway %s: %w", method, err)
+	}
+	client = withRateLimitObserver(client, method, config.OnRateLimitHeaders)
+	client = withGatewayTimeout(client, config.Timeout)
+	gateway := factory(config, client)
+
+	if err := ValidateExtraConfig(gateway, config); err != nil {
+		return nil, fmt.Errorf("gateway %s: %w", method, err)
+	}
+
+	// Gateways that handle webhooks need a secret to verify them
+	if _, ok := UnwrapGateway(gateway).(WebhookHandler); ok && config.GetWebhookSecret() == "" {
+		return nil, fmt.Errorf("gateway %s handles webhooks but no webhook secret is configured", method)
+	}
+
+	return gateway, nil
+}
+
+// RegisterAlias maps an alternative method name (e.g. "esewa_wallet") to a
+// registered method (e.g. "esewa")
+func (pm *PaymentManager) RegisterAlias(alias, method string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.aliases[NormalizeMethod(alias)] = NormalizeMethod(method)
+}
+
+// ResolveMethod returns the method an alias points to, or method itself if it
+// is not an alias
+func (pm *PaymentManager) ResolveMethod(method string) string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.resolveMethod(method)
+}
+
+// resolveMethod normalizes method and resolves aliases. Callers must hold
+// pm.mu.
+func (pm *PaymentManager) resolveMethod(method string) string {
+	method = NormalizeMethod(method)
+	if target, ok := pm.aliases[method]; ok {
+		return target
+	}
+	return method
 }
 
 func (pm *PaymentManager) GetGateway(method string) (Gateway, error) {
 	pm.mu.RLock()
 	defer pm.mu.RUnlock()
-	g, ok := pm.gateways[method]
+	g, ok := pm.gateways[pm.resolveMethod(method)]
 	if !ok {
-		return nil, fmt.Errorf("gateway %s not registered", method)
+		return nil, fmt.Errorf("gateway %s %w", method, ErrGatewayNotRegistered)
 	}
 	return g, nil
 }
 
+// configuredMethods returns the configured methods, sorted. It stands in for
+// registry availability when the registry is nil. Callers must hold pm.mu.
+func (pm *PaymentManager) configuredMethods() []string {
+	methods := make([]string, 0, len(pm.gateways))
+	for method := range pm.gateways {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
 func (pm *PaymentManager) ListGateways() []string {
 	pm.mu.RLock()
 	defer pm.mu.RUnlock()
@@ -106,42 +402,271 @@ func (pm *PaymentManager) ListGateways() []string {
 	return methods
 }
 
-func (pm *PaymentManager) InitiatePayment(ctx context.Context, method string, req *PaymentRequest) (*PaymentResponse, error) {
-	g, err := pm.GetGateway(method)
+// InitiatePayment initiates a payment with the gateway. The account named by
+// req.Metadata[MetadataAccount], if any, is used instead of the default one.
+// Requests failing PaymentRequest.Validate or the gateway's own
+// requirements are rejected with a *ValidationError before reaching it.
+func (pm *PaymentManager) InitiatePayment(ctx context.Context, method string, req *PaymentRequest) (resp *PaymentResponse, err error) {
+	if req == nil {
+		return nil, NewPaymentError(ErrKindValidation, method, "", ErrNilRequest)
+	}
+	defer pm.logCall("initiate", method, paymentRef(req.OrderID, ""), time.Now(), &err)
+	g, err := pm.GetGatewayAccount(method, req.Metadata[MetadataAccount])
+	if err != nil {
+		return nil, err
+	}
+	if err := validateFor(g, req); err != nil {
+		return nil, err
+	}
+	// Gateways without tax line items are sent the total with the tax noted
+	greq, err := prepareTax(g, req)
 	if err != nil {
 		return nil, err
 	}
-	return g.InitiatePayment(ctx, req)
+	greq = withGatewayIdempotencyKey(g.GetMethod(), greq)
+
+	pm.mu.RLock()
+	store := pm.idempotency
+	pm.mu.RUnlock()
+	if store == nil || req.IdempotencyKey == "" {
+		resp, err := pm.initiateWithRetry(ctx, g, greq)
+		if err != nil {
+			return nil, err
+		}
+		resp.TestMode = IsTestMode(g)
+		pm.recordTransaction(g.GetMethod(), greq, resp)
+		return resp, nil
+	}
+
+	// Replay the stored response, or reject the key if the payload changed.
+	// The key is held until the response is saved, so a concurrent retry
+	// waits for it instead of initiating a second payment.
+	hash, err := hashPaymentRequest(g.GetMethod(), req)
+	if err != nil {
+		return nil, err
+	}
+	unlock := pm.idemLocks.lock(req.IdempotencyKey)
+	defer unlock()
+	if rec, ok := store.Get(req.IdempotencyKey); ok {
+		if rec.RequestHash != hash {
+			return nil, fmt.Errorf("%w: %s", ErrIdempotencyConflict, req.IdempotencyKey)
+		}
+		replay := *rec.Response
+		replay.Replayed = true
+		return &replay, nil
+	}
+
+	resp, err = pm.initiateWithRetry(ctx, g, greq)
+	if err != nil {
+		return nil, err
+	}
+	resp.IdempotencyKey = req.IdempotencyKey
+	resp.TestMode = IsTestMode(g)
+	pm.recordTransaction(g.GetMethod(), greq, resp)
+	store.Save(&IdempotencyRecord{
+		Key:         req.IdempotencyKey,
+		Method:      g.GetMethod(),
+		RequestHash: hash,
+		Response:    resp,
+		CreatedAt:   time.Now(),
+	})
+	return resp, nil
 }
 
-func (pm *PaymentManager) VerifyPayment(ctx context.Context, method string, req *VerificationRequest) (*VerificationResponse, error) {
-	g, err := pm.GetGateway(method)
+// initiateWithRetry calls g.InitiatePayment under the gateway's
+// ResiliencePolicy. Transient failures are retried only when g forwards
+// req.IdempotencyKey to its provider, so a retry can't create a second
+// charge.
+func (pm *PaymentManager) initiateWithRetry(ctx context.Context, g Gateway, req *PaymentRequest) (*PaymentResponse, error) {
+	policy := RetryPolicy{}
+	if req.IdempotencyKey != "" && forwardsIdempotencyKey(g) {
+		policy = pm.ResiliencePolicy(g.GetMethod()).Retry
+	}
+	return retryTransient(ctx, policy, func() (*PaymentResponse, error) {
+		ctx, done, err := pm.guard(ctx, g.GetMethod())
+		if err != nil {
+			return nil, err
+		}
+		defer pm.trackLatency(g.GetMethod(), time.Now())
+		resp, err := g.InitiatePayment(ctx, req)
+		done(err)
+		return resp, err
+	})
+}
+
+// VerifyPayment verifies a payment with the gateway. Requests missing fields
+// the gateway declares as required fail with ErrMissingVerificationData.
+// When a TransactionStore is configured, the provider-reported amount is
+// also checked against the initiated amount and ErrAmountMismatch is
+// returned when they differ by more than the SetAmountTolerance tolerance.
+// A payment initiated for another order than req.OrderID fails with
+// ErrOrderMismatch.
+// The account is taken from req.RawData[MetadataAccount] or the stored
+// transaction. See SetVerifyRetry for retrying payments the provider hasn't
+// settled yet.
+func (pm *PaymentManager) VerifyPayment(ctx context.Context, method string, req *VerificationRequest) (resp *VerificationResponse, err error) {
+	if req == nil {
+		return nil, NewPaymentError(ErrKindValidation, method, "", ErrNilRequest)
+	}
+	defer pm.logCall("verify", method, paymentRef(req.OrderID, req.TransactionID), time.Now(), &err)
+	account := req.RawData[MetadataAccount]
+	if account == "" {
+		account = pm.transactionAccount(req.TransactionID, req.SessionID, req.OrderID)
+	}
+	g, err := pm.GetGatewayAccount(method, account)
 	if err != nil {
 		return nil, err
 	}
-	return g.VerifyPayment(ctx, req)
+	if missing := req.MissingFields(RequiredVerificationFields(g)); len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMissingVerificationData, strings.Join(missing, ", "))
+	}
+	resp, err = pm.verifyWithRetry(ctx, g, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.TestMode = IsTestMode(g)
+	if err := pm.checkStoredOrder(req, resp); err != nil {
+		return nil, err
+	}
+	if err := pm.checkStoredAmount(req, resp); err != nil {
+		return nil, err
+	}
+	if resp.Success {
+		pm.recordCapture(g.GetMethod(), req, resp)
+	}
+	return resp, nil
 }
 
-func (pm *PaymentManager) RefundPayment(ctx context.Context, method string, req *RefundRequest) (*RefundResponse, error) {
-	g, err := pm.GetGateway(method)
+// VerifyRawCallback verifies a payment from the provider's redirect/callback
+// payload. params are passed as VerificationRequest.RawData so callers don't
+// need to know each gateway's field names. Required keys per gateway:
+//
+//	esewa:      data (the signed v2 payload)
+//	khalti:     pidx
+//	imepay:     Msisdn, RefId, TransactionId
+//	connectips: TXNID
+func (pm *PaymentManager) VerifyRawCallback(ctx context.Context, method string, params map[string]string) (*VerificationResponse, error) {
+	return pm.VerifyPayment(ctx, method, &VerificationRequest{RawData: params})
+}
+
+// RefundPayment refunds a payment. When a TransactionStore is set, the
+// transaction must be in it, failing with ErrTransactionNotFound otherwise;
+// cumulative refunds are tracked and a refund exceeding the remaining
+// captured amount fails with ErrRefundExceedsCaptured. A zero Amount refunds
+// the remaining balance.
+func (pm *PaymentManager) RefundPayment(ctx context.Context, method string, req *RefundRequest) (resp *RefundResponse, err error) {
+	if req == nil {
+		return nil, NewPaymentError(ErrKindValidation, method, "", ErrNilRequest)
+	}
+	defer pm.logCall("refund", method, paymentRef("", req.TransactionID), time.Now(), &err)
+	g, err := pm.GetGatewayAccount(method, pm.transactionAccount(req.TransactionID))
 	if err != nil {
 		return nil, err
 	}
-	return g.RefundPayment(ctx, req)
+	ctx, done, err := pm.guard(ctx, g.GetMethod())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { done(err) }()
+
+	pm.mu.RLock()
+	store := pm.transactions
+	pm.mu.RUnlock()
+	if store == nil {
+		defer pm.trackLatency(g.GetMethod(), time.Now())
+		return g.RefundPayment(ctx, req)
+	}
+	return pm.refundTracked(ctx, g, store, req)
 }
 
-func (pm *PaymentManager) GetStatus(ctx context.Context, method string, txnID string) (*StatusResponse, error) {
-	g, err := pm.GetGateway(method)
+// GetStatus returns the provider's status of the payment req identifies.
+// The ids, amount and phone req leaves empty are filled in from the stored
+// transaction, for gateways such as eSewa that look payments up by order
+// and amount, or IMEPay by phone.
+func (pm *PaymentManager) GetStatus(ctx context.Context, method string, req *StatusRequest) (*StatusResponse, error) {
+	if req == nil {
+		return nil, NewPaymentError(ErrKindValidation, method, "", ErrNilRequest)
+	}
+	req = pm.completeStatusRequest(req)
+	g, err := pm.GetGatewayAccount(method, pm.transactionAccount(req.TransactionID, req.SessionID, req.OrderID))
 	if err != nil {
 		return nil, err
 	}
-	return g.GetStatus(ctx, txnID)
+	return retryTransient(ctx, pm.ResiliencePolicy(g.GetMethod()).Retry, func() (*StatusResponse, error) {
+		ctx, done, err := pm.guard(ctx, g.GetMethod())
+		if err != nil {
+			return nil, err
+		}
+		defer pm.trackLatency(g.GetMethod(), time.Now())
+		status, err := g.GetStatus(ctx, req)
+		done(err)
+		return status, err
+	})
+}
+
+// completeStatusRequest returns a copy of req with its missing ids, amount
+// and phone taken from the stored transaction, if any. A transaction the
+// provider hasn't assigned a payment id yet is looked up by its session.
+func (pm *PaymentManager) completeStatusRequest(req *StatusRequest) *StatusRequest {
+	cp := *req
+	store := pm.GetTransactionStore()
+	if store == nil {
+		return &cp
+	}
+	txn, ok := findTransaction(store, req.TransactionID, req.SessionID, req.OrderID)
+	if !ok {
+		return &cp
+	}
+	if cp.TransactionID == "" || cp.TransactionID == txn.SessionID {
+		cp.TransactionID = txn.ProviderID()
+	}
+	if cp.SessionID == "" {
+		cp.SessionID = txn.SessionID
+	}
+	if cp.OrderID == "" {
+		cp.OrderID = txn.OrderID
+	}
+	if cp.Amount.Currency().Code == "" {
+		cp.Amount = txn.Amount
+	}
+	if cp.CustomerPhone == "" && txn.Request != nil {
+		cp.CustomerPhone = txn.Request.CustomerPhone
+	}
+	return &cp
+}
+
+// WaitForTerminalStatus polls GetStatus every interval until the payment
+// reaches a terminal status or ctx is done
+func (pm *PaymentManager) WaitForTerminalStatus(ctx context.Context, method, txnID string, interval time.Duration) (*StatusResponse, error) {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		resp, err := pm.GetStatus(ctx, method, &StatusRequest{TransactionID: txnID})
+		if err != nil {
+			return nil, err
+		}
+		if resp.Status.IsTerminal() {
+			return resp, nil
+		}
+		select {
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		case <-ticker.C:
+		}
+	}
 }
 
 // GetAvailableGatewaysForCountry returns all available and configured gateways for a country
 func (pm *PaymentManager) GetAvailableGatewaysForCountry(country Country) []string {
 	pm.mu.RLock()
 	defer pm.mu.RUnlock()
+	if pm.registry == nil {
+		return pm.configuredMethods()
+	}
 
 	// Get all gateways that are available in the registry for this country
 	availableInRegistry := pm.registry.GetAvailableGateways(country)
@@ -157,6 +682,58 @@ func (pm *PaymentManager) GetAvailableGatewaysForCountry(country Country) []stri
 	return configured
 }
 
+// GetGatewaysByTag returns configured gateways available for a country that
+// carry tag, sorted by priority
+func (pm *PaymentManager) GetGatewaysByTag(country Country, tag string) []string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if pm.registry == nil {
+		return []string{}
+	}
+
+	configured := []string{}
+	for _, method := range pm.registry.GetGatewaysByTag(country, tag) {
+		if _, ok := pm.gateways[method]; ok {
+			configured = append(configured, method)
+		}
+	}
+	return configured
+}
+
+// SupportedCountries returns every known country with at least one configured
+// gateway available, including those reachable only via region or global gateways
+func (pm *PaymentManager) SupportedCountries() []Country {
+	countries := []Country{}
+	registry := pm.GetRegistry()
+	if registry == nil {
+		return countries
+	}
+	for _, country := range registry.KnownCountries() {
+		if len(pm.GetAvailableGatewaysForCountry(country)) > 0 {
+			countries = append(countries, country)
+		}
+	}
+	return countries
+}
+
+// GetAvailableGatewaysForCurrency returns configured gateways registered for a currency
+func (pm *PaymentManager) GetAvailableGatewaysForCurrency(currency string) []string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if pm.registry == nil {
+		return pm.configuredMethods()
+	}
+
+	configured := []string{}
+	for _, method := range pm.registry.GetAvailableGatewaysForCurrency(currency) {
+		if _, ok := pm.gateways[method]; ok {
+			configured = append(configured, method)
+		}
+	}
+
+	return configured
+}
+
 // GetRecommendedGateway returns the highest priority gateway for a country
 func (pm *PaymentManager) GetRecommendedGateway(country Country) (string, error) {
 	available := pm.GetAvailableGatewaysForCountry(country)
@@ -166,20 +743,80 @@ func (pm *PaymentManager) GetRecommendedGateway(country Country) (string, error)
 	return available[0], nil
 }
 
-// InitiatePaymentForCountry initiates payment using the best gateway for a country
+// InitiatePaymentForCountry initiates payment using the best gateway for a
+// country, or a weighted pick when routing weights are set for it. Retries
+// of an order whose last payment is still live go to the gateway that
+// initiated it, so they are deduplicated rather than routed elsewhere. The
+// chosen method is recorded with the transaction; see GetMethodForOrder.
+// Payments in a currency other than country.DefaultCurrency() fail with
+// ErrCountryCurrencyMismatch unless req.AllowCurrencyMismatch is set.
 func (pm *PaymentManager) InitiatePaymentForCountry(ctx context.Context, country Country, req *PaymentRequest) (*PaymentResponse, error) {
-	method, err := pm.GetRecommendedGateway(country)
+	if req == nil {
+		return nil, NewPaymentError(ErrKindValidation, "", "", ErrNilRequest)
+	}
+	if err := checkCountryCurrency(country, req); err != nil {
+		return nil, err
+	}
+	if txn, ok := pm.orderTransaction(req.OrderID); ok && !txn.Status.IsTerminal() {
+		if _, err := pm.GetGateway(txn.Method); err == nil {
+			return pm.InitiatePayment(ctx, txn.Method, req)
+		}
+	}
+	method, err := pm.SelectWeightedGateway(country)
 	if err != nil {
 		return nil, err
 	}
 	return pm.InitiatePayment(ctx, method, req)
 }
 
+// GetMethodForOrder returns the method that initiated the latest payment for
+// orderID, as recorded in the TransactionStore. It reports false without a
+// store or a recorded payment.
+func (pm *PaymentManager) GetMethodForOrder(orderID string) (string, bool) {
+	txn, ok := pm.orderTransaction(orderID)
+	if !ok || txn.Method == "" {
+		return "", false
+	}
+	return txn.Method, true
+}
+
+// VerifyPaymentForOrder verifies req with the gateway that initiated
+// req.OrderID
+func (pm *PaymentManager) VerifyPaymentForOrder(ctx context.Context, req *VerificationRequest) (*VerificationResponse, error) {
+	if req == nil {
+		return nil, NewPaymentError(ErrKindValidation, "", "", ErrNilRequest)
+	}
+	method, ok := pm.GetMethodForOrder(req.OrderID)
+	if !ok {
+		return nil, fmt.Errorf("%w: no payment recorded for order %s", ErrTransactionNotFound, req.OrderID)
+	}
+	return pm.VerifyPayment(ctx, method, req)
+}
+
+// orderTransaction returns the latest stored transaction for orderID. Stores
+// that don't implement OrderStore only find transactions whose id is the
+// order id.
+func (pm *PaymentManager) orderTransaction(orderID string) (*Transaction, bool) {
+	store := pm.GetTransactionStore()
+	if store == nil || orderID == "" {
+		return nil, false
+	}
+	if orders, ok := store.(OrderStore); ok {
+		txn, err := orders.GetByOrderID(orderID)
+		return txn, err == nil
+	}
+	return findTransaction(store, orderID)
+}
+
 // InitiatePaymentWithMethod initiates payment with validation for country
 func (pm *PaymentManager) InitiatePaymentWithMethod(ctx context.Context, country Country, method string, req *PaymentRequest) (*PaymentResponse, error) {
+	method = pm.ResolveMethod(method)
+
 	// Validate that the gateway is available for this country
-	if err := pm.registry.ValidateGatewayForCountry(country, method); err != nil {
-		return nil, err
+	if registry := pm.GetRegistry(); registry != nil {
+		if err := registry.ValidateGatewayForCountry(country, method); err != nil {
+			return nil, err
+		}
 	}
 
 	// Check if gateway is configured
@@ -194,13 +831,33 @@ func (pm *PaymentManager) InitiatePaymentWithMethod(ctx context.Context, country
 func (pm *PaymentManager) GetGatewayRecommendations(country Country) []GatewayRecommendation {
 	pm.mu.RLock()
 	defer pm.mu.RUnlock()
+	if pm.registry == nil {
+		recommendations := []GatewayRecommendation{}
+		for i, method := range pm.configuredMethods() {
+			caps := Capabilities(pm.gateways[method])
+			recommendations = append(recommendations, GatewayRecommendation{
+				Method:       method,
+				Name:         pm.gateways[method].GetName(),
+				Scope:        ScopeGlobal,
+				Available:    true,
+				Recommended:  i == 0,
+				Capabilities: &caps,
+			})
+		}
+		return recommendations
+	}
 
 	recommendations := pm.registry.GetRecommendations(country)
 
 	// Update availability based on what's actually configured
 	for i := range recommendations {
-		_, configured := pm.gateways[recommendations[i].Method]
+		g, configured := pm.gateways[recommendations[i].Method]
 		recommendations[i].Available = configured
+		if configured {
+			caps := Capabilities(g)
+			recommendations[i].Name = g.GetName()
+			recommendations[i].Capabilities = &caps
+		}
 	}
 
 	return recommendations
@@ -208,9 +865,13 @@ func (pm *PaymentManager) GetGatewayRecommendations(country Country) []GatewayRe
 
 // ValidateGatewayForCountry checks if a gateway is both available and configured for a country
 func (pm *PaymentManager) ValidateGatewayForCountry(country Country, method string) error {
+	method = pm.ResolveMethod(method)
+
 	// Check registry
-	if err := pm.registry.ValidateGatewayForCountry(country, method); err != nil {
-		return err
+	if registry := pm.GetRegistry(); registry != nil {
+		if err := registry.ValidateGatewayForCountry(country, method); err != nil {
+			return err
+		}
 	}
 
 	// Check if configured
@@ -224,7 +885,15 @@ func (pm *PaymentManager) ValidateGatewayForCountry(country Country, method stri
 }
 
 // IsGatewayAvailable checks if a gateway is available for a country
-// Returns true if the gateway is registered in the registry for that country
+// Returns true if the gateway is registered in the registry for that country,
+// or, without a registry, if it is configured
 func (pm *PaymentManager) IsGatewayAvailable(country Country, method string) bool {
+	method = pm.ResolveMethod(method)
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if pm.registry == nil {
+		_, ok := pm.gateways[method]
+		return ok
+	}
 	return pm.registry.IsGatewayAvailable(country, method)
 }
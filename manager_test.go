@@ -0,0 +1,976 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/money"
+)
+
+func TestVerifyRawCallback(t *testing.T) {
+	pm := NewPaymentManager(0)
+	fake := &fakeGateway{method: "fake"}
+	pm.RegisterGateway("fake", fake)
+
+	params := map[string]string{"refId": "R1", "oid": "O1"}
+	if _, err := pm.VerifyRawCallback(context.Background(), "fake", params); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fake.verifyReq == nil || fake.verifyReq.RawData["refId"] != "R1" {
+		t.Error("Callback params should be passed as RawData")
+	}
+
+	if _, err := pm.VerifyRawCallback(context.Background(), "missing", params); err == nil {
+		t.Error("Expected error for unregistered gateway")
+	}
+}
+
+func TestRegisterAlias(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("esewa", &fakeGateway{method: "esewa"})
+	pm.GetRegistry().RegisterCountryGateway(CountryNepal, "esewa", 1)
+	pm.RegisterAlias("esewa_wallet", "esewa")
+
+	g, err := pm.GetGateway("esewa_wallet")
+	if err != nil {
+		t.Fatalf("Alias should resolve: %v", err)
+	}
+	if g.GetMethod() != "esewa" {
+		t.Errorf("Expected esewa, got %s", g.GetMethod())
+	}
+
+	if !pm.IsGatewayAvailable(CountryNepal, "esewa_wallet") {
+		t.Error("Alias should be available for Nepal")
+	}
+	if err := pm.ValidateGatewayForCountry(CountryNepal, "esewa_wallet"); err != nil {
+		t.Errorf("Alias should validate for Nepal: %v", err)
+	}
+}
+
+func TestMethodNamesAreCaseInsensitive(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("Stripe", &fakeGateway{method: "stripe"})
+	pm.GetRegistry().RegisterCountryGateway(CountryUSA, " Stripe ", 1)
+	pm.RegisterAlias("Card", "STRIPE")
+
+	for _, method := range []string{"stripe", "STRIPE", " stripe", "card"} {
+		if _, err := pm.GetGateway(method); err != nil {
+			t.Errorf("GetGateway(%q): %v", method, err)
+		}
+		if !pm.IsGatewayAvailable(CountryUSA, method) {
+			t.Errorf("%q should be available for the USA", method)
+		}
+	}
+	if got := pm.GetRegistry().GetAvailableGateways(CountryUSA); len(got) != 1 || got[0] != "stripe" {
+		t.Errorf("Expected [stripe], got %v", got)
+	}
+
+	pm.RegisterFactory("Fake", func(config *GatewayConfig, client *http.Client) Gateway {
+		return &fakeGateway{method: "fake"}
+	})
+	if err := pm.RegisterGatewayWithConfig("fake", &GatewayConfig{}); err != nil {
+		t.Fatalf("Factory registered as Fake should build fake: %v", err)
+	}
+	if err := pm.RemoveGateway("FAKE"); err != nil {
+		t.Errorf("RemoveGateway(FAKE): %v", err)
+	}
+}
+
+func TestInitiatePaymentBatch(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("ok", &fakeGateway{method: "ok"})
+	pm.RegisterGateway("bad", &fakeGateway{method: "bad", initErr: errors.New("declined")})
+
+	items := []BatchItem{
+		{Method: "ok", Request: &PaymentRequest{OrderID: "1", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL}},
+		{Method: "bad", Request: &PaymentRequest{OrderID: "2", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL}},
+		{Method: "ok", Request: &PaymentRequest{OrderID: "3", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL}},
+	}
+
+	results := pm.InitiatePaymentBatch(context.Background(), items, BatchOptions{})
+	if results.AllSucceeded() {
+		t.Error("Batch with a failing item should not report all succeeded")
+	}
+	if len(results.Successes()) != 2 {
+		t.Errorf("Expected 2 successes, got %d", len(results.Successes()))
+	}
+	if failed := results.FailedMethods(); len(failed) != 1 || failed[0] != "bad" {
+		t.Errorf("Expected [bad] failed, got %v", failed)
+	}
+
+	results = pm.InitiatePaymentBatch(context.Background(), items, BatchOptions{StopOnFirstError: true})
+	if !errors.Is(results[2].Err, ErrBatchAborted) {
+		t.Errorf("Expected third item to be aborted, got %v", results[2].Err)
+	}
+
+	results = pm.InitiatePaymentBatch(context.Background(), []BatchItem{{Method: "ok"}, items[0]}, BatchOptions{})
+	if !errors.Is(results[0].Err, ErrNilRequest) || !results[1].Succeeded() {
+		t.Errorf("Expected only the nil request to fail, got %v / %v", results[0].Err, results[1].Err)
+	}
+}
+
+func TestIdempotencyConflict(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+	pm.SetIdempotencyStore(NewMemoryIdempotencyStore())
+
+	npr := money.MustCurrency("NPR")
+	req := &PaymentRequest{OrderID: "O1", Amount: money.New(100, npr), IdempotencyKey: "key-1", SuccessURL: testSuccessURL}
+
+	first, err := pm.InitiatePayment(context.Background(), "fake", req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first.IdempotencyKey != "key-1" {
+		t.Errorf("Expected key to be echoed, got %q", first.IdempotencyKey)
+	}
+
+	replay, err := pm.InitiatePayment(context.Background(), "fake", req)
+	if err != nil {
+		t.Fatalf("Unexpected error on replay: %v", err)
+	}
+	if !replay.Replayed || replay.TransactionID != first.TransactionID {
+		t.Error("Same key and payload should replay the stored response")
+	}
+
+	changed := *req
+	changed.Amount = money.New(200, npr)
+	if _, err := pm.InitiatePayment(context.Background(), "fake", &changed); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("Expected ErrIdempotencyConflict, got %v", err)
+	}
+}
+
+// countingGateway counts initiations, taking a moment over each
+type countingGateway struct {
+	fakeGateway
+	calls atomic.Int32
+}
+
+func (g *countingGateway) InitiatePayment(ctx context.Context, req *PaymentRequest) (*PaymentResponse, error) {
+	n := g.calls.Add(1)
+	time.Sleep(5 * time.Millisecond)
+	return &PaymentResponse{Success: true, TransactionID: fmt.Sprintf("T%d", n), OrderID: req.OrderID}, nil
+}
+
+func TestIdempotencyConcurrentRequests(t *testing.T) {
+	g := &countingGateway{fakeGateway: fakeGateway{method: "fake"}}
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", g)
+	pm.SetIdempotencyStore(NewMemoryIdempotencyStore())
+
+	req := &PaymentRequest{OrderID: "O1", Amount: money.New(100, money.MustCurrency("NPR")), IdempotencyKey: "key-1", SuccessURL: testSuccessURL}
+	var wg sync.WaitGroup
+	ids := make([]string, 8)
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp, err := pm.InitiatePayment(context.Background(), "fake", req); err == nil {
+				ids[i] = resp.TransactionID
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := g.calls.Load(); n != 1 {
+		t.Errorf("Expected one initiation for the key, got %d", n)
+	}
+	for i, id := range ids {
+		if id != "T1" {
+			t.Errorf("Request %d: expected T1, got %q", i, id)
+		}
+	}
+}
+
+func TestSupportedCountries(t *testing.T) {
+	pm := NewPaymentManager(0)
+	registry := NewGatewayRegistry()
+	registry.RegisterCountryGateway(CountryNepal, "esewa", 1)
+	registry.RegisterRegionGateway(RegionEurope, "sepa", 5)
+	registry.RegisterCountryGateway(CountryIndia, "razorpay", 1)
+	pm.SetRegistry(registry)
+
+	// razorpay is in the registry but not configured
+	pm.RegisterGateway("esewa", &fakeGateway{method: "esewa"})
+	pm.RegisterGateway("sepa", &fakeGateway{method: "sepa"})
+
+	countries := pm.SupportedCountries()
+	got := map[Country]bool{}
+	for _, c := range countries {
+		got[c] = true
+	}
+
+	if !got[CountryNepal] || !got[CountryGermany] || !got[CountryUK] {
+		t.Errorf("Expected Nepal and European countries, got %v", countries)
+	}
+	if got[CountryIndia] || got[CountryUSA] {
+		t.Errorf("India and USA have no configured gateways, got %v", countries)
+	}
+}
+
+func TestVerifyPaymentAmountMismatch(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+	pm.SetTransactionStore(NewMemoryTransactionStore())
+
+	npr := money.MustCurrency("NPR")
+	ctx := context.Background()
+	resp, err := pm.InitiatePayment(ctx, "fake", &PaymentRequest{OrderID: "O1", Amount: money.New(100, npr), SuccessURL: testSuccessURL})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ok := &VerificationRequest{TransactionID: resp.TransactionID, Amount: money.New(100, npr)}
+	if _, err := pm.VerifyPayment(ctx, "fake", ok); err != nil {
+		t.Errorf("Matching amount should verify: %v", err)
+	}
+
+	tampered := &VerificationRequest{TransactionID: resp.TransactionID, Amount: money.New(1, npr)}
+	if _, err := pm.VerifyPayment(ctx, "fake", tampered); !errors.Is(err, ErrAmountMismatch) {
+		t.Errorf("Expected ErrAmountMismatch, got %v", err)
+	}
+
+	// A paisa short is accepted only within the configured tolerance
+	short := &VerificationRequest{TransactionID: resp.TransactionID, Amount: money.NewFromMinor(9999, npr)}
+	if _, err := pm.VerifyPayment(ctx, "fake", short); !errors.Is(err, ErrAmountMismatch) {
+		t.Errorf("Expected ErrAmountMismatch without tolerance, got %v", err)
+	}
+	pm.SetAmountTolerance(AmountTolerance{Minor: 1})
+	if _, err := pm.VerifyPayment(ctx, "fake", short); err != nil {
+		t.Errorf("Expected a paisa short to verify within tolerance: %v", err)
+	}
+	if _, err := pm.VerifyPayment(ctx, "fake", tampered); !errors.Is(err, ErrAmountMismatch) {
+		t.Errorf("Expected ErrAmountMismatch beyond tolerance, got %v", err)
+	}
+}
+
+func TestInitiatePaymentsForCountries(t *testing.T) {
+	pm := NewPaymentManager(0)
+	registry := NewGatewayRegistry()
+	registry.RegisterCountryGateway(CountryNepal, "esewa", 1)
+	registry.RegisterCountryGateway(CountryIndia, "razorpay", 1)
+	pm.SetRegistry(registry)
+	pm.RegisterGateway("esewa", &fakeGateway{method: "esewa"})
+	pm.RegisterGateway("razorpay", &fakeGateway{method: "razorpay"})
+
+	items := []CountryPaymentItem{
+		{Country: CountryNepal, Request: &PaymentRequest{OrderID: "np-1", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL}},
+		{Country: CountryIndia, Request: &PaymentRequest{OrderID: "in-1", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL}},
+		{Country: CountryUSA, Request: &PaymentRequest{OrderID: "us-1", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL}},
+		{Country: CountryNepal, Request: &PaymentRequest{OrderID: "np-2", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL}},
+		{Country: CountryNepal},
+	}
+
+	results := pm.InitiatePaymentsForCountries(context.Background(), items, 2)
+	expected := []string{"esewa", "razorpay", "", "esewa", ""}
+	for i, want := range expected {
+		if results[i].Method != want {
+			t.Errorf("Item %d: got method %q, want %q", i, results[i].Method, want)
+		}
+	}
+	if results[2].Err == nil {
+		t.Error("Expected error for country without gateways")
+	}
+	if results[3].Response == nil || results[3].Response.OrderID != "np-2" {
+		t.Error("Results should be in input order")
+	}
+	if !errors.Is(results[4].Err, ErrNilRequest) {
+		t.Errorf("Expected ErrNilRequest for an item without a request, got %v", results[4].Err)
+	}
+}
+
+func TestInitiatePaymentWithFallback(t *testing.T) {
+	pm := NewPaymentManager(0)
+	registry := NewGatewayRegistry()
+	registry.RegisterCountryGateway(CountryNepal, "esewa", 1)
+	registry.RegisterCountryGateway(CountryNepal, "khalti", 2)
+	registry.RegisterCountryGateway(CountryNepal, "imepay", 3)
+	pm.SetRegistry(registry)
+
+	pm.RegisterGateway("esewa", &fakeGateway{method: "esewa"})
+	pm.RegisterGateway("khalti", &fakeGateway{method: "khalti", initErr: NewPaymentError(ErrKindProvider, "khalti", "khalti down", nil)})
+	pm.RegisterGateway("imepay", &fakeGateway{method: "imepay"})
+	pm.RegisterGateway("connectips", &fakeGateway{method: "connectips", initErr: NewPaymentError(ErrKindDeclined, "connectips", "insufficient funds", nil)})
+
+	ctx := context.Background()
+	req := &PaymentRequest{OrderID: "O1", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL}
+
+	// Priority order by default
+	_, method, err := pm.InitiatePaymentWithFallback(ctx, CountryNepal, req)
+	if err != nil || method != "esewa" {
+		t.Errorf("Expected esewa, got %q (%v)", method, err)
+	}
+
+	// Explicit chain skips unconfigured and unavailable gateways
+	pm.SetFailoverChain(CountryNepal, "mpesa", "khalti", "imepay", "esewa")
+	_, method, err = pm.InitiatePaymentWithFallback(ctx, CountryNepal, req)
+	if err != nil || method != "imepay" {
+		t.Errorf("Expected imepay, got %q (%v)", method, err)
+	}
+
+	pm.SetFailoverChain(CountryNepal, "khalti")
+	if _, _, err := pm.InitiatePaymentWithFallback(ctx, CountryNepal, req); err == nil {
+		t.Error("Expected error when every gateway in the chain fails")
+	}
+
+	// A decline or an invalid request would fail anywhere
+	pm.SetFailoverChain(CountryNepal, "connectips", "esewa")
+	_, method, err = pm.InitiatePaymentWithFallback(ctx, CountryNepal, req)
+	var perr *PaymentError
+	if method != "connectips" || !errors.As(err, &perr) || perr.Kind != ErrKindDeclined {
+		t.Errorf("Expected connectips's decline without failover, got %q (%v)", method, err)
+	}
+	_, method, err = pm.InitiatePaymentWithFallback(ctx, CountryNepal, &PaymentRequest{Amount: req.Amount, SuccessURL: testSuccessURL})
+	if method != "connectips" || HTTPStatusForError(err) != http.StatusBadRequest {
+		t.Errorf("Expected a validation error without failover, got %q (%v)", method, err)
+	}
+}
+
+// customerGateway counts provider customer creations
+type customerGateway struct {
+	fakeGateway
+	created int
+}
+
+func (c *customerGateway) GetOrCreateCustomer(ctx context.Context, ref CustomerRef) (string, error) {
+	c.created++
+	return "cus_" + ref.Email, nil
+}
+
+func TestGetOrCreateCustomer(t *testing.T) {
+	pm := NewPaymentManager(0)
+	g := &customerGateway{fakeGateway: fakeGateway{method: "cust"}}
+	pm.RegisterGateway("cust", g)
+	pm.RegisterGateway("plain", &fakeGateway{method: "plain"})
+	pm.SetTransactionStore(NewMemoryTransactionStore())
+
+	ctx := context.Background()
+	for _, email := range []string{"a@example.com", "A@Example.com "} {
+		id, err := pm.GetOrCreateCustomer(ctx, "cust", CustomerRef{Email: email})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if id != "cus_a@example.com" {
+			t.Errorf("Expected cached customer id, got %s", id)
+		}
+	}
+	if g.created != 1 {
+		t.Errorf("Expected 1 provider customer, got %d", g.created)
+	}
+
+	if _, err := pm.GetOrCreateCustomer(ctx, "cust", CustomerRef{}); err == nil {
+		t.Error("Expected error for ref without identifier")
+	}
+	if _, err := pm.GetOrCreateCustomer(ctx, "plain", CustomerRef{Email: "a@example.com"}); HTTPStatusForError(err) != 501 {
+		t.Errorf("Expected unsupported error, got %v", err)
+	}
+
+	// Each account has its own customers
+	accounts := map[string]*customerGateway{}
+	pm.RegisterFactory("multi", func(config *GatewayConfig, client *http.Client) Gateway {
+		accounts[config.MerchantID] = &customerGateway{fakeGateway: fakeGateway{method: "multi"}}
+		return accounts[config.MerchantID]
+	})
+	for _, account := range []string{"a", "b"} {
+		if err := pm.RegisterGatewayAccount("multi", account, &GatewayConfig{MerchantID: account}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	for _, account := range []string{"a", "b", "b"} {
+		if _, err := pm.GetOrCreateCustomer(ctx, "multi", CustomerRef{Email: "a@example.com", Account: account}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if accounts["a"].created != 1 || accounts["b"].created != 1 {
+		t.Errorf("Expected 1 customer per account, got %d and %d", accounts["a"].created, accounts["b"].created)
+	}
+	if _, err := pm.GetOrCreateCustomer(ctx, "multi", CustomerRef{Email: "a@example.com", Account: "missing"}); !errors.Is(err, ErrGatewayNotRegistered) {
+		t.Errorf("Expected ErrGatewayNotRegistered, got %v", err)
+	}
+}
+
+func TestGatewayAccounts(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterFactory("fake", func(config *GatewayConfig, client *http.Client) Gateway {
+		return &fakeGateway{method: config.MerchantID}
+	})
+	pm.SetTransactionStore(NewMemoryTransactionStore())
+
+	if err := pm.RegisterGatewayAccount("fake", "brand_a", &GatewayConfig{MerchantID: "a"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := pm.RegisterGatewayAccount("fake", "brand_b", &GatewayConfig{MerchantID: "b"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	g, err := pm.GetGateway("fake")
+	if err != nil || g.GetMethod() != "a" {
+		t.Errorf("First account should be the default, got %v %v", g, err)
+	}
+	if accounts := pm.ListAccounts("fake"); len(accounts) != 2 || accounts[1] != "brand_b" {
+		t.Errorf("Unexpected accounts %v", accounts)
+	}
+	if _, err := pm.GetGatewayAccount("fake", "brand_c"); !errors.Is(err, ErrGatewayNotRegistered) {
+		t.Errorf("Expected ErrGatewayNotRegistered, got %v", err)
+	}
+
+	ctx := context.Background()
+	req := &PaymentRequest{OrderID: "O1", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL, Metadata: map[string]string{MetadataAccount: "brand_b"}}
+	resp, err := pm.InitiatePayment(ctx, "fake", req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := pm.VerifyPayment(ctx, "fake", &VerificationRequest{TransactionID: resp.TransactionID}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	b, _ := pm.GetGatewayAccount("fake", "brand_b")
+	if b.(*fakeGateway).verifyReq == nil {
+		t.Error("Verification should use the account the payment was initiated with")
+	}
+}
+
+func TestRefundPaymentTracksBalance(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+	store := NewMemoryTransactionStore()
+	pm.SetTransactionStore(store)
+
+	npr := money.MustCurrency("NPR")
+	ctx := context.Background()
+	resp, err := pm.InitiatePayment(ctx, "fake", &PaymentRequest{OrderID: "O1", Amount: money.New(100, npr), SuccessURL: testSuccessURL})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	txnID := resp.TransactionID
+
+	// Payments the store doesn't know can't be checked, so aren't refunded
+	if _, err := pm.RefundPayment(ctx, "fake", &RefundRequest{TransactionID: "unknown", Amount: money.New(40, npr)}); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("Expected ErrTransactionNotFound, got %v", err)
+	}
+
+	// Only captured payments are refunded
+	if _, err := pm.RefundPayment(ctx, "fake", &RefundRequest{TransactionID: txnID, Amount: money.New(40, npr)}); HTTPStatusForError(err) != http.StatusBadRequest {
+		t.Errorf("Expected a validation error for a pending payment, got %v", err)
+	}
+	if _, err := pm.VerifyPayment(ctx, "fake", &VerificationRequest{TransactionID: txnID, Amount: money.New(100, npr)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	refund, err := pm.RefundPayment(ctx, "fake", &RefundRequest{TransactionID: txnID, Amount: money.New(40, npr)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !refund.Remaining.Equals(money.New(60, npr)) {
+		t.Errorf("Expected 60 remaining, got %s", refund.Remaining)
+	}
+
+	if _, err := pm.RefundPayment(ctx, "fake", &RefundRequest{TransactionID: txnID, Amount: money.New(70, npr)}); !errors.Is(err, ErrRefundExceedsCaptured) {
+		t.Errorf("Expected ErrRefundExceedsCaptured, got %v", err)
+	}
+
+	// A zero amount refunds the rest
+	refund, err = pm.RefundPayment(ctx, "fake", &RefundRequest{TransactionID: txnID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !refund.Remaining.IsZero() {
+		t.Errorf("Expected nothing remaining, got %s", refund.Remaining)
+	}
+	if txn, _ := store.Get(txnID); txn.Status != StatusRefunded {
+		t.Errorf("Expected refunded status, got %s", txn.Status)
+	}
+
+	if _, err := pm.RefundPayment(ctx, "fake", &RefundRequest{TransactionID: txnID, Amount: money.New(1, npr)}); !errors.Is(err, ErrRefundExceedsCaptured) {
+		t.Errorf("Expected ErrRefundExceedsCaptured after full refund, got %v", err)
+	}
+	if n := len(pm.refundLocks.locks); n != 0 {
+		t.Errorf("Expected refund locks to be released, %d left", n)
+	}
+}
+
+// localizedGateway has a Nepali display name
+type localizedGateway struct{ fakeGateway }
+
+func (l *localizedGateway) GetDisplayName(locale string) string {
+	return LocalizedName(map[string]string{"ne": "खल्ती"}, locale, l.GetName())
+}
+
+func TestGetGatewayRecommendationsForLocale(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("khalti", &localizedGateway{fakeGateway{method: "khalti"}})
+	pm.GetRegistry().RegisterCountryGateway(CountryNepal, "khalti", 1)
+
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"ne-NP", "खल्ती"},
+		{"ne", "खल्ती"},
+		{"en-US", "Fake"},
+		{"", "Fake"},
+	}
+	for _, tt := range tests {
+		recs := pm.GetGatewayRecommendationsForLocale(CountryNepal, tt.locale)
+		if len(recs) != 1 || recs[0].Name != tt.want {
+			t.Errorf("locale %q: got %+v, want name %s", tt.locale, recs, tt.want)
+		}
+	}
+}
+
+func TestGetTransaction(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+	ctx := context.Background()
+
+	// Without a store, only what GetStatus exposes is filled in
+	txn, err := pm.GetTransaction(ctx, "fake", "t1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if txn.ID != "t1" || txn.Method != "fake" || txn.Status != StatusCompleted || txn.Currency() != "" {
+		t.Errorf("Unexpected transaction %+v", txn)
+	}
+	if _, err := pm.GetTransaction(ctx, "missing", "t1"); !errors.Is(err, ErrGatewayNotRegistered) {
+		t.Errorf("Expected ErrGatewayNotRegistered, got %v", err)
+	}
+
+	pm.SetTransactionStore(NewMemoryTransactionStore())
+	npr := money.MustCurrency("NPR")
+	resp, err := pm.InitiatePayment(ctx, "fake", &PaymentRequest{OrderID: "O1", Amount: money.New(100, npr), SuccessURL: testSuccessURL})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := pm.VerifyPayment(ctx, "fake", &VerificationRequest{TransactionID: resp.TransactionID, Amount: money.New(100, npr)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, amount := range []int64{30, 20} {
+		if _, err := pm.RefundPayment(ctx, "fake", &RefundRequest{TransactionID: resp.TransactionID, Amount: money.New(amount, npr)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	txn, err = pm.GetTransaction(ctx, "fake", resp.TransactionID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if txn.OrderID != "O1" || txn.Currency() != "NPR" || !txn.PaidAmount.Equals(money.New(100, npr)) {
+		t.Errorf("Unexpected transaction %+v", txn)
+	}
+	if len(txn.Refunds) != 2 || !txn.Refunds[1].Amount.Equals(money.New(20, npr)) || !txn.Refunded.Equals(money.New(50, npr)) {
+		t.Errorf("Unexpected refunds %+v (total %s)", txn.Refunds, txn.Refunded)
+	}
+}
+
+// detailGateway records the status request, to check the details the
+// manager fills in
+type detailGateway struct {
+	fakeGateway
+	req *StatusRequest
+}
+
+func (d *detailGateway) GetStatus(ctx context.Context, req *StatusRequest) (*StatusResponse, error) {
+	d.req = req
+	return &StatusResponse{Status: StatusCompleted, TransactionID: req.TransactionID, OrderID: req.OrderID, Amount: req.Amount}, nil
+}
+
+func TestGetStatusFillsStoredDetails(t *testing.T) {
+	pm := NewPaymentManager(0)
+	g := &detailGateway{fakeGateway: fakeGateway{method: "fake"}}
+	pm.RegisterGateway("fake", g)
+	pm.SetTransactionStore(NewMemoryTransactionStore())
+	ctx := context.Background()
+
+	amount := money.New(100, money.MustCurrency("NPR"))
+	resp, err := pm.InitiatePayment(ctx, "fake", &PaymentRequest{OrderID: "O1", Amount: amount, SuccessURL: testSuccessURL})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	req := &StatusRequest{TransactionID: resp.TransactionID}
+	if _, err := pm.GetStatus(ctx, "fake", req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if g.req.OrderID != "O1" || !g.req.Amount.Equals(amount) {
+		t.Errorf("Expected the stored order and amount, got %+v", g.req)
+	}
+	if req.OrderID != "" {
+		t.Error("GetStatus should not modify the caller's request")
+	}
+
+	// Unknown transactions are looked up as given
+	if _, err := pm.GetStatus(ctx, "fake", &StatusRequest{TransactionID: "unknown"}); err != nil || g.req.OrderID != "" {
+		t.Errorf("Expected the request as given, got %v (%+v)", err, g.req)
+	}
+}
+
+// fieldsGateway requires IMEPay-style callback fields
+type fieldsGateway struct{ fakeGateway }
+
+func (f *fieldsGateway) RequiredVerificationFields() []string {
+	return []string{"Msisdn", "RefId|order_id"}
+}
+
+func TestVerifyPaymentMissingFields(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fields", &fieldsGateway{fakeGateway{method: "fields"}})
+	ctx := context.Background()
+
+	_, err := pm.VerifyRawCallback(ctx, "fields", map[string]string{"RefId": "R1"})
+	if !errors.Is(err, ErrMissingVerificationData) || !strings.Contains(err.Error(), "Msisdn") {
+		t.Errorf("Expected missing Msisdn, got %v", err)
+	}
+	if HTTPStatusForError(err) != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", HTTPStatusForError(err))
+	}
+
+	// Alternatives may come from RawData or the request fields
+	if _, err := pm.VerifyPayment(ctx, "fields", &VerificationRequest{OrderID: "O1", RawData: map[string]string{"Msisdn": "98"}}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// sandboxGateway reports it is running against a sandbox
+type sandboxGateway struct{ fakeGateway }
+
+func (s *sandboxGateway) TestMode() bool { return true }
+
+func TestResponsesFlagTestMode(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("sandbox", WrapGateway(&sandboxGateway{fakeGateway{method: "sandbox"}}))
+	pm.RegisterGateway("live", &fakeGateway{method: "live"})
+	ctx := context.Background()
+
+	for method, want := range map[string]bool{"sandbox": true, "live": false} {
+		resp, err := pm.InitiatePayment(ctx, method, &PaymentRequest{OrderID: "O1", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if resp.TestMode != want {
+			t.Errorf("%s: initiate TestMode = %v, want %v", method, resp.TestMode, want)
+		}
+		vresp, err := pm.VerifyPayment(ctx, method, &VerificationRequest{TransactionID: resp.TransactionID})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if vresp.TestMode != want {
+			t.Errorf("%s: verify TestMode = %v, want %v", method, vresp.TestMode, want)
+		}
+	}
+}
+
+func TestNilRegistry(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("khalti", &fakeGateway{method: "khalti"})
+	pm.RegisterGateway("esewa", &fakeGateway{method: "esewa"})
+	pm.SetRegistry(nil)
+	pm.SetDefaultRegion(RegionSouthAsia)
+
+	// Every configured gateway is treated as available, in name order
+	if got := pm.GetAvailableGatewaysForCountry(CountryNepal); len(got) != 2 || got[0] != "esewa" {
+		t.Errorf("Expected [esewa khalti], got %v", got)
+	}
+	if !pm.IsGatewayAvailable(CountryIndia, "khalti") || pm.IsGatewayAvailable(CountryIndia, "stripe") {
+		t.Error("Availability should follow configuration without a registry")
+	}
+	if err := pm.ValidateGatewayForCountry(CountryNepal, "stripe"); err == nil {
+		t.Error("Expected unconfigured gateway to fail validation")
+	}
+	if method, err := pm.GetRecommendedGateway(CountryNepal); err != nil || method != "esewa" {
+		t.Errorf("Expected esewa, got %q, %v", method, err)
+	}
+	if recs := pm.GetGatewayRecommendations(CountryNepal); len(recs) != 2 || !recs[0].Recommended {
+		t.Errorf("Unexpected recommendations %+v", recs)
+	}
+	if len(pm.SupportedCountries()) != 0 || len(pm.GetGatewaysByTag(CountryNepal, "wallet")) != 0 {
+		t.Error("Expected no country or tag information without a registry")
+	}
+	if _, err := pm.InitiatePaymentWithMethod(context.Background(), CountryNepal, "khalti", &PaymentRequest{OrderID: "O1", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := pm.CheckoutOptions(CountryNepal, "NPR"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// sessionGateway creates a new session per payment and can resume them
+type sessionGateway struct {
+	fakeGateway
+	n       int
+	expired bool
+}
+
+func (g *sessionGateway) InitiatePayment(ctx context.Context, req *PaymentRequest) (*PaymentResponse, error) {
+	g.n++
+	id := fmt.Sprintf("s%d", g.n)
+	return &PaymentResponse{Success: true, OrderID: req.OrderID, TransactionID: id, PaymentURL: "https://pay.example/" + id}, nil
+}
+
+func (g *sessionGateway) ResumePayment(ctx context.Context, txn *Transaction) (*PaymentResponse, error) {
+	if g.expired {
+		return nil, ErrPaymentExpired
+	}
+	return &PaymentResponse{Success: true, OrderID: txn.OrderID, TransactionID: txn.ID, PaymentURL: txn.PaymentURL}, nil
+}
+
+func TestResumePayment(t *testing.T) {
+	pm := NewPaymentManager(0)
+	g := &sessionGateway{fakeGateway: fakeGateway{method: "fake"}}
+	pm.RegisterGateway("fake", g)
+	ctx := context.Background()
+
+	if _, err := pm.ResumePayment(ctx, "fake", "O1"); HTTPStatusForError(err) != http.StatusNotImplemented {
+		t.Errorf("Expected unsupported without a store, got %v", err)
+	}
+	pm.SetTransactionStore(NewMemoryTransactionStore())
+	if _, err := pm.ResumePayment(ctx, "fake", "O1"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("Expected ErrTransactionNotFound, got %v", err)
+	}
+
+	npr := money.MustCurrency("NPR")
+	first, err := pm.InitiatePayment(ctx, "fake", &PaymentRequest{OrderID: "O1", Amount: money.New(100, npr), ExpiresAt: time.Now().Add(time.Hour), SuccessURL: testSuccessURL})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	resp, err := pm.ResumePayment(ctx, "fake", "O1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !resp.Resumed || resp.PaymentURL != first.PaymentURL {
+		t.Errorf("Expected the existing payment, got %+v", resp)
+	}
+
+	// An expired session is replaced and the old payment canceled
+	g.expired = true
+	resp, err = pm.ResumePayment(ctx, "fake", "O1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.Resumed || resp.TransactionID == first.TransactionID {
+		t.Errorf("Expected a new payment, got %+v", resp)
+	}
+	old, _ := pm.GetTransactionStore().Get(first.TransactionID)
+	if old.Status != StatusCanceled {
+		t.Errorf("Expected old payment canceled, got %s", old.Status)
+	}
+	latest, _ := pm.GetTransactionStore().Get(resp.TransactionID)
+	if !latest.Amount.Equals(money.New(100, npr)) || !latest.ExpiresAt.After(time.Now().Add(59*time.Minute)) {
+		t.Errorf("Expected the original request to be reused, got %+v", latest)
+	}
+
+	if _, err := pm.VerifyPayment(ctx, "fake", &VerificationRequest{TransactionID: resp.TransactionID, Amount: money.New(100, npr)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := pm.ResumePayment(ctx, "fake", "O1"); HTTPStatusForError(err) != http.StatusBadRequest {
+		t.Errorf("Expected paid order to be rejected, got %v", err)
+	}
+}
+
+func TestRegisterGatewaysWithConfig(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterFactory("a", func(config *GatewayConfig, client *http.Client) Gateway { return &fakeGateway{method: "a"} })
+	pm.RegisterFactory("b", func(config *GatewayConfig, client *http.Client) Gateway {
+		return &webhookGateway{fakeGateway: fakeGateway{method: "b"}}
+	})
+
+	err := pm.RegisterGatewaysWithConfig(map[string]*GatewayConfig{
+		"a":       {},
+		"b":       {}, // handles webhooks without a secret
+		"missing": {},
+	})
+	if err == nil || !strings.Contains(err.Error(), "gateway b") || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Expected errors for b and missing, got %v", err)
+	}
+	if _, err := pm.GetGateway("a"); err != nil {
+		t.Errorf("Expected a to be registered: %v", err)
+	}
+	if _, err := pm.GetGateway("b"); err == nil {
+		t.Error("Expected b to be skipped")
+	}
+}
+
+func TestRemoveGateway(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+	pm.RegisterAlias("fake_wallet", "fake")
+
+	if err := pm.RemoveGateway("missing"); !errors.Is(err, ErrGatewayNotRegistered) {
+		t.Errorf("Expected ErrGatewayNotRegistered, got %v", err)
+	}
+	if err := pm.RemoveGateway("fake_wallet"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := pm.GetGateway("fake"); !errors.Is(err, ErrGatewayNotRegistered) {
+		t.Errorf("Expected fake to be removed, got %v", err)
+	}
+
+	pm.RegisterFactory("fake", func(config *GatewayConfig, client *http.Client) Gateway { return &fakeGateway{method: "fake"} })
+	pm.RemoveFactory("fake")
+	if err := pm.RegisterGatewayWithConfig("fake", &GatewayConfig{}); err == nil {
+		t.Error("Expected registration without a factory to fail")
+	}
+}
+
+func TestRemoveGatewayConcurrently(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			pm.InitiatePayment(context.Background(), "fake", &PaymentRequest{OrderID: "O1", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL})
+		}()
+		go func() {
+			defer wg.Done()
+			pm.RemoveGateway("fake")
+			pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+		}()
+	}
+	wg.Wait()
+}
+
+// settlingGateway reports a payment unknown, then pending, then completed
+type settlingGateway struct {
+	fakeGateway
+	calls  int
+	failAt int
+}
+
+func (g *settlingGateway) VerifyPayment(ctx context.Context, req *VerificationRequest) (*VerificationResponse, error) {
+	g.calls++
+	switch {
+	case g.calls == g.failAt:
+		return NewVerificationResponse(WithStatus(StatusFailed)), nil
+	case g.calls == 1:
+		return nil, ErrorFromHTTPStatus(g.method, http.StatusNotFound, "not found")
+	case g.calls == 2:
+		return NewVerificationResponse(WithStatus(StatusPending)), nil
+	}
+	return NewVerificationResponse(WithStatus(StatusCompleted)), nil
+}
+
+func TestVerifyRetry(t *testing.T) {
+	ctx := context.Background()
+	req := &VerificationRequest{TransactionID: "t1"}
+
+	pm := NewPaymentManager(0)
+	g := &settlingGateway{fakeGateway: fakeGateway{method: "fake"}}
+	pm.RegisterGateway("fake", g)
+	if _, err := pm.VerifyPayment(ctx, "fake", req); HTTPStatusForError(err) != http.StatusNotFound || g.calls != 1 {
+		t.Errorf("Expected a single not-found attempt without retries, got %v after %d calls", err, g.calls)
+	}
+
+	g.calls = 0
+	pm.SetVerifyRetry(VerifyRetryOptions{MaxWait: time.Second, InitialBackoff: time.Millisecond})
+	resp, err := pm.VerifyPayment(ctx, "fake", req)
+	if err != nil || resp.Status != StatusCompleted || g.calls != 3 {
+		t.Errorf("Expected completion on the third attempt, got %v, %v after %d calls", resp, err, g.calls)
+	}
+
+	// A definitive failure ends the retries
+	g.calls, g.failAt = 0, 2
+	if resp, err := pm.VerifyPayment(ctx, "fake", req); err != nil || resp.Status != StatusFailed || g.calls != 2 {
+		t.Errorf("Expected the failure to be returned at once, got %v, %v after %d calls", resp, err, g.calls)
+	}
+
+	// The last pending result is returned once the window closes
+	g.calls, g.failAt = 0, 0
+	pm.SetVerifyRetry(VerifyRetryOptions{MaxWait: 5 * time.Millisecond, InitialBackoff: 4 * time.Millisecond})
+	if resp, err := pm.VerifyPayment(ctx, "fake", req); err != nil || resp.Status != StatusPending || g.calls != 2 {
+		t.Errorf("Expected pending once the window closed, got %v, %v after %d calls", resp, err, g.calls)
+	}
+}
+
+func TestGetBalanceUnsupported(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+	if _, err := pm.GetBalance(context.Background(), "fake"); HTTPStatusForError(err) != http.StatusNotImplemented {
+		t.Errorf("Expected unsupported, got %v", err)
+	}
+}
+
+// subscribingGateway accepts every subscription, failing lookups with err
+type subscribingGateway struct {
+	fakeGateway
+	err  error
+	gets int
+}
+
+func (s *subscribingGateway) CreateSubscription(ctx context.Context, req *SubscriptionRequest) (*SubscriptionResponse, error) {
+	return &SubscriptionResponse{ID: "sub_1", Status: SubscriptionActive, Amount: req.Amount, Interval: req.Interval}, nil
+}
+
+func (s *subscribingGateway) CancelSubscription(ctx context.Context, id string) error { return nil }
+
+func (s *subscribingGateway) GetSubscription(ctx context.Context, id string) (*SubscriptionResponse, error) {
+	s.gets++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &SubscriptionResponse{ID: id, Status: SubscriptionActive}, nil
+}
+
+func TestCreateSubscription(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+	pm.RegisterGateway("subs", &subscribingGateway{fakeGateway: fakeGateway{method: "subs"}})
+	ctx := context.Background()
+	req := &SubscriptionRequest{Amount: money.New(10, money.MustCurrency("USD")), Interval: IntervalMonthly, CustomerEmail: "a@example.com"}
+
+	if _, err := pm.CreateSubscription(ctx, "fake", req); HTTPStatusForError(err) != http.StatusNotImplemented {
+		t.Errorf("Expected unsupported, got %v", err)
+	}
+	if caps, _ := pm.GetCapabilities("subs"); !caps.Subscriptions {
+		t.Error("Expected the subscriptions capability")
+	}
+	if resp, err := pm.CreateSubscription(ctx, "subs", req); err != nil || resp.ID != "sub_1" {
+		t.Errorf("Unexpected result %+v, %v", resp, err)
+	}
+
+	var verr *ValidationError
+	invalid := &SubscriptionRequest{Amount: req.Amount, Interval: "weekly", TrialDays: -1}
+	if _, err := pm.CreateSubscription(ctx, "subs", invalid); !errors.As(err, &verr) || len(verr.Fields) != 3 {
+		t.Errorf("Expected interval, email and trial errors, got %v", err)
+	}
+}
+
+func TestSubscriptionAccountsAndResilience(t *testing.T) {
+	unavailable := ErrorFromHTTPStatus("b", http.StatusServiceUnavailable, "HTTP 503")
+	pm := NewPaymentManagerWithOptions(WithResiliencePolicy(ResiliencePolicy{
+		Circuit: CircuitPolicy{FailureThreshold: 1, OpenFor: time.Minute},
+	}, "b"))
+	pm.RegisterFactory("subs", func(config *GatewayConfig, client *http.Client) Gateway {
+		return &subscribingGateway{fakeGateway: fakeGateway{method: config.MerchantID}, err: unavailable}
+	})
+	pm.RegisterGatewayAccount("subs", "brand_a", &GatewayConfig{MerchantID: "a"})
+	pm.RegisterGatewayAccount("subs", "brand_b", &GatewayConfig{MerchantID: "b"})
+	ctx := context.Background()
+
+	req := &SubscriptionRequest{Amount: money.New(10, money.MustCurrency("USD")), Interval: IntervalMonthly, CustomerEmail: "a@example.com", Metadata: map[string]string{MetadataAccount: "brand_b"}}
+	if _, err := pm.CreateSubscription(ctx, "subs", req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Lookups go to the account the subscription was created on, whose
+	// circuit opens after the first failure
+	if _, err := pm.GetSubscription(ctx, "subs", "sub_1"); !errors.Is(err, unavailable) {
+		t.Fatalf("Expected the gateway's error, got %v", err)
+	}
+	if _, err := pm.GetSubscription(ctx, "subs", "sub_1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen, got %v", err)
+	}
+	a, _ := pm.GetGatewayAccount("subs", "brand_a")
+	b, _ := pm.GetGatewayAccount("subs", "brand_b")
+	if a.(*subscribingGateway).gets != 0 || b.(*subscribingGateway).gets != 1 {
+		t.Errorf("Expected one lookup on brand_b, got %d and %d", a.(*subscribingGateway).gets, b.(*subscribingGateway).gets)
+	}
+}
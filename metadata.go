@@ -0,0 +1,35 @@
+package payment
+
+import "strings"
+
+// MetadataPaymentMethodType is the VerificationResponse.Metadata key holding
+// the instrument the customer actually paid with (e.g. "card", "upi", "wallet")
+const MetadataPaymentMethodType = "payment_method_type"
+
+// MetadataPrefix namespaces our metadata keys when forwarded to providers so
+// they can't collide with provider-reserved keys
+const MetadataPrefix = "m_"
+
+// NamespaceMetadata returns a copy of md with every key prefixed by MetadataPrefix
+func NamespaceMetadata(md map[string]string) map[string]string {
+	if len(md) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(md))
+	for k, v := range md {
+		out[MetadataPrefix+k] = v
+	}
+	return out
+}
+
+// StripMetadataNamespace returns only the namespaced keys of md with the
+// prefix removed. Provider-owned keys are dropped.
+func StripMetadataNamespace(md map[string]string) map[string]string {
+	out := make(map[string]string)
+	for k, v := range md {
+		if strings.HasPrefix(k, MetadataPrefix) {
+			out[strings.TrimPrefix(k, MetadataPrefix)] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,79 @@
+package payment
+
+import (
+	"math"
+
+	"github.com/oarkflow/money"
+)
+
+// ExtraConfigMinorUnits is the ExtraConfig key for per-gateway minor-unit
+// exponents, keyed by currency code, e.g. {"ISK": 2}
+const ExtraConfigMinorUnits = "minor_units"
+
+// MinorUnitOverrides maps currency codes to the minor-unit exponent gateways
+// expect. It pins the currencies that don't use two decimals, so a currency
+// re-registered with the money package can't silently change what gateways
+// are sent. Other currencies use their ISO 4217 decimals.
+var MinorUnitOverrides = map[string]int{
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLP": 0, "ISK": 0, "JPY": 0, "KRW": 0, "PYG": 0, "UGX": 0, "VND": 0, "XAF": 0, "XOF": 0,
+}
+
+// MinorUnitExponent returns the number of decimals in currency's minor unit
+// for a gateway: config.ExtraConfig["minor_units"] first, then
+// MinorUnitOverrides, then the currency's ISO 4217 decimals
+func MinorUnitExponent(config *GatewayConfig, currency money.Currency) int {
+	if config != nil {
+		switch units := config.ExtraConfig[ExtraConfigMinorUnits].(type) {
+		case map[string]int:
+			if e, ok := units[currency.Code]; ok {
+				return e
+			}
+		case map[string]interface{}:
+			// JSON numbers decode as float64
+			if e, ok := units[currency.Code].(float64); ok {
+				return int(e)
+			}
+		}
+	}
+	if e, ok := MinorUnitOverrides[currency.Code]; ok {
+		return e
+	}
+	return int(currency.Decimals)
+}
+
+// AmountInMinorUnits returns m as an integer number of minor units, e.g.
+// 1.5 BHD as 1500 and 1500 JPY as 1500. When the exponent has fewer
+// decimals than the amount it is rounded half away from zero.
+func AmountInMinorUnits(config *GatewayConfig, m money.Money) int64 {
+	return rescale(m.Minor(), MinorUnitExponent(config, m.Currency())-int(m.Currency().Decimals))
+}
+
+// AmountFromMinorUnits is the inverse of AmountInMinorUnits: it returns
+// minor, in the gateway's minor units of currency, as money, e.g. 1500 as
+// 1.5 BHD. Gateways use it for the amounts providers report.
+func AmountFromMinorUnits(config *GatewayConfig, minor int64, currency money.Currency) money.Money {
+	return money.NewFromMinor(rescale(minor, int(currency.Decimals)-MinorUnitExponent(config, currency)), currency)
+}
+
+// rescale shifts minor by shift decimal places, rounding half away from
+// zero when shift is negative
+func rescale(minor int64, shift int) int64 {
+	if shift >= 0 {
+		return minor * int64(math.Pow10(shift))
+	}
+
+	factor := int64(math.Pow10(-shift))
+	q, r := minor/factor, minor%factor
+	if r < 0 {
+		r = -r
+	}
+	if 2*r >= factor {
+		if minor < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
@@ -0,0 +1,204 @@
+// Package paymenttest provides assertions for tests of payment responses
+// and an in-memory transport for tests of gateway requests.
+//
+// Responses carry money.Money fields, whose currency metadata makes
+// reflect.DeepEqual brittle; here money is equal when the minor units and
+// currency code are. Provider-generated ids and timestamps can be ignored:
+//
+//	paymenttest.AssertResponseEqual(t, want, got, paymenttest.IgnoreIDs())
+package paymenttest
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/money"
+)
+
+var (
+	moneyType    = reflect.TypeOf(money.Money{})
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// Option changes what AssertResponseEqual and Diff compare
+type Option func(*options)
+
+type options struct {
+	ignoreIDs   bool
+	ignoreTimes bool
+	ignored     map[string]bool
+}
+
+// IgnoreIDs skips struct fields named ID or ending in ID, such as
+// TransactionID, OrderID and SessionID
+func IgnoreIDs() Option {
+	return func(o *options) { o.ignoreIDs = true }
+}
+
+// IgnoreTimes skips time.Time and time.Duration fields
+func IgnoreTimes() Option {
+	return func(o *options) { o.ignoreTimes = true }
+}
+
+// IgnoreFields skips struct fields with the given names, at any depth
+func IgnoreFields(names ...string) Option {
+	return func(o *options) {
+		for _, name := range names {
+			o.ignored[name] = true
+		}
+	}
+}
+
+// MoneyEqual reports whether want and got have the same minor units and
+// currency code
+func MoneyEqual(want, got money.Money) bool {
+	return want.Minor() == got.Minor() && want.Currency().Code == got.Currency().Code
+}
+
+// AssertMoneyEqual fails t unless MoneyEqual(want, got)
+func AssertMoneyEqual(t testing.TB, want, got money.Money) {
+	t.Helper()
+	if !MoneyEqual(want, got) {
+		t.Errorf("money mismatch: want %s, got %s", formatMoney(want), formatMoney(got))
+	}
+}
+
+// AssertResponseEqual fails t with every difference between want and got,
+// typically *payment.PaymentResponse or *payment.VerificationResponse
+// values, see Diff
+func AssertResponseEqual(t testing.TB, want, got any, opts ...Option) {
+	t.Helper()
+	if diffs := Diff(want, got, opts...); len(diffs) > 0 {
+		t.Errorf("response mismatch:\n\t%s", strings.Join(diffs, "\n\t"))
+	}
+}
+
+// Diff returns the differences between want and got, one per field, as
+// "path: want x, got y". Pointers are followed, money.Money is compared
+// with MoneyEqual and time.Time with Time.Equal. Unexported fields are
+// ignored.
+func Diff(want, got any, opts ...Option) []string {
+	o := &options{ignored: make(map[string]bool)}
+	for _, opt := range opts {
+		opt(o)
+	}
+	var diffs []string
+	o.diff(&diffs, typeName(want, got), reflect.ValueOf(want), reflect.ValueOf(got))
+	return diffs
+}
+
+func typeName(want, got any) string {
+	t := reflect.TypeOf(want)
+	if t == nil {
+		t = reflect.TypeOf(got)
+	}
+	if t == nil {
+		return "value"
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Name() == "" {
+		return "value"
+	}
+	return t.Name()
+}
+
+func (o *options) diff(diffs *[]string, path string, want, got reflect.Value) {
+	if !want.IsValid() || !got.IsValid() {
+		if want.IsValid() != got.IsValid() {
+			*diffs = append(*diffs, fmt.Sprintf("%s: want %s, got %s", path, format(want), format(got)))
+		}
+		return
+	}
+	if want.Type() != got.Type() {
+		*diffs = append(*diffs, fmt.Sprintf("%s: want type %s, got %s", path, want.Type(), got.Type()))
+		return
+	}
+
+	switch want.Type() {
+	case moneyType:
+		w, g := want.Interface().(money.Money), got.Interface().(money.Money)
+		if !MoneyEqual(w, g) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: want %s, got %s", path, formatMoney(w), formatMoney(g)))
+		}
+		return
+	case timeType:
+		if !want.Interface().(time.Time).Equal(got.Interface().(time.Time)) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: want %s, got %s", path, format(want), format(got)))
+		}
+		return
+	}
+
+	switch want.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if want.IsNil() || got.IsNil() {
+			if want.IsNil() != got.IsNil() {
+				*diffs = append(*diffs, fmt.Sprintf("%s: want %s, got %s", path, format(want), format(got)))
+			}
+			return
+		}
+		o.diff(diffs, path, want.Elem(), got.Elem())
+	case reflect.Struct:
+		for i := range want.NumField() {
+			field := want.Type().Field(i)
+			if !field.IsExported() || o.skip(field) {
+				continue
+			}
+			o.diff(diffs, path+"."+field.Name, want.Field(i), got.Field(i))
+		}
+	case reflect.Slice, reflect.Array:
+		if want.Len() != got.Len() {
+			*diffs = append(*diffs, fmt.Sprintf("%s: want %d elements, got %d", path, want.Len(), got.Len()))
+			return
+		}
+		for i := range want.Len() {
+			o.diff(diffs, fmt.Sprintf("%s[%d]", path, i), want.Index(i), got.Index(i))
+		}
+	case reflect.Map:
+		keys := make(map[string]reflect.Value)
+		for _, key := range append(want.MapKeys(), got.MapKeys()...) {
+			keys[fmt.Sprint(key.Interface())] = key
+		}
+		for _, name := range slices.Sorted(maps.Keys(keys)) {
+			key := keys[name]
+			o.diff(diffs, fmt.Sprintf("%s[%s]", path, name), want.MapIndex(key), got.MapIndex(key))
+		}
+	default:
+		if !reflect.DeepEqual(want.Interface(), got.Interface()) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: want %s, got %s", path, format(want), format(got)))
+		}
+	}
+}
+
+// skip reports whether field is ignored by the options
+func (o *options) skip(field reflect.StructField) bool {
+	if o.ignored[field.Name] {
+		return true
+	}
+	if o.ignoreIDs && strings.HasSuffix(field.Name, "ID") {
+		return true
+	}
+	return o.ignoreTimes && (field.Type == timeType || field.Type == durationType)
+}
+
+func format(v reflect.Value) string {
+	if !v.IsValid() {
+		return "<missing>"
+	}
+	return fmt.Sprintf("%#v", v.Interface())
+}
+
+func formatMoney(m money.Money) string {
+	code := m.Currency().Code
+	if code == "" {
+		code = "<no currency>"
+	}
+	return fmt.Sprintf("%d %s (minor units)", m.Minor(), code)
+}
@@ -0,0 +1,95 @@
+package paymenttest_test
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/money"
+	"github.com/oarkflow/payment"
+	"github.com/oarkflow/payment/paymenttest"
+)
+
+func TestDiff(t *testing.T) {
+	npr := money.MustCurrency("NPR")
+	want := &payment.VerificationResponse{
+		Success:       true,
+		Status:        payment.StatusCompleted,
+		TransactionID: "T1",
+		OrderID:       "O1",
+		Amount:        money.New(100, npr),
+		Metadata:      map[string]string{"a": "1"},
+	}
+
+	// Money with the same minor units and code is equal whatever its
+	// currency metadata
+	got := *want
+	renamed := npr
+	renamed.Name = "Rupee"
+	got.Amount = money.NewFromMinor(want.Amount.Minor(), renamed)
+	if diffs := paymenttest.Diff(want, &got); len(diffs) != 0 {
+		t.Errorf("Expected no differences, got %q", diffs)
+	}
+
+	got.TransactionID = "T2"
+	got.PaidAmount = money.New(90, npr)
+	got.Metadata = map[string]string{"a": "2", "b": "1"}
+	wantDiffs := []string{
+		`VerificationResponse.TransactionID: want "T1", got "T2"`,
+		`VerificationResponse.PaidAmount: want 0 <no currency> (minor units), got 9000 NPR (minor units)`,
+		`VerificationResponse.Metadata[a]: want "1", got "2"`,
+		`VerificationResponse.Metadata[b]: want <missing>, got "1"`,
+	}
+	if diffs := paymenttest.Diff(want, &got); !reflect.DeepEqual(diffs, wantDiffs) {
+		t.Errorf("Expected %q, got %q", wantDiffs, diffs)
+	}
+
+	diffs := paymenttest.Diff(want, &got, paymenttest.IgnoreIDs(), paymenttest.IgnoreFields("PaidAmount", "Metadata"))
+	if len(diffs) != 0 {
+		t.Errorf("Expected ignored fields to match, got %q", diffs)
+	}
+}
+
+func TestDiffIgnoreTimes(t *testing.T) {
+	want := payment.Transaction{ID: "T1", CreatedAt: time.Now()}
+	got := payment.Transaction{ID: "T1", CreatedAt: want.CreatedAt.Add(time.Second)}
+	if diffs := paymenttest.Diff(want, got); len(diffs) != 1 {
+		t.Errorf("Expected the CreatedAt difference, got %q", diffs)
+	}
+	if diffs := paymenttest.Diff(want, got, paymenttest.IgnoreTimes()); len(diffs) != 0 {
+		t.Errorf("Expected times to be ignored, got %q", diffs)
+	}
+
+	// Equal instants in different locations are equal
+	got.CreatedAt = want.CreatedAt.UTC()
+	if diffs := paymenttest.Diff(want, got); len(diffs) != 0 {
+		t.Errorf("Expected no differences, got %q", diffs)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	tr := &paymenttest.Transport{Handler: paymenttest.RespondJSON(http.StatusCreated, `{"id":"P1"}`)}
+	req, _ := http.NewRequest(http.MethodPost, "https://provider.test/pay?x=1", strings.NewReader(`{"amount":100}`))
+	req.Header.Set("Authorization", "Key secret")
+	resp, err := tr.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusCreated || string(body) != `{"id":"P1"}` || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected response %d %s", resp.StatusCode, body)
+	}
+
+	want := []paymenttest.Request{{
+		Method: http.MethodPost,
+		URL:    "https://provider.test/pay?x=1",
+		Header: http.Header{"Authorization": {"Key secret"}},
+		Body:   []byte(`{"amount":100}`),
+	}}
+	if got := tr.Requests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,87 @@
+package paymenttest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// Request is an outgoing request recorded by Transport
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+// Transport is an in-memory http.RoundTripper for gateway tests. It records
+// every request and answers it with Handler without opening a connection.
+// Set it as GatewayConfig.Transport, or pass Client() to a gateway's New:
+//
+//	tr := &paymenttest.Transport{Handler: paymenttest.RespondJSON(http.StatusOK, `{"pidx":"P1"}`)}
+//	config := &payment.GatewayConfig{BaseURL: "https://provider.test", Transport: tr}
+type Transport struct {
+	// Handler answers requests. Nil answers 200 with an empty JSON object.
+	Handler http.Handler
+
+	mu       sync.Mutex
+	requests []Request
+}
+
+// RoundTrip records req and serves it with t.Handler
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.mu.Lock()
+	t.requests = append(t.requests, Request{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+		Body:   body,
+	})
+	t.mu.Unlock()
+
+	handler := t.Handler
+	if handler == nil {
+		handler = RespondJSON(http.StatusOK, `{}`)
+	}
+	served := req.Clone(req.Context())
+	served.Body = io.NopCloser(bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, served)
+
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+// Client returns an HTTP client that sends requests through t
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// Requests returns the requests recorded so far, in order
+func (t *Transport) Requests() []Request {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Request(nil), t.requests...)
+}
+
+// RespondJSON returns a handler that answers every request with status and
+// the JSON body
+func RespondJSON(status int, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	})
+}
@@ -0,0 +1,61 @@
+package payment
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// withGatewayTransport returns a copy of client that sends requests through
+// transport. A nil transport returns client unchanged.
+func withGatewayTransport(client *http.Client, transport http.RoundTripper) *http.Client {
+	if transport == nil {
+		return client
+	}
+	routed := &http.Client{}
+	if client != nil {
+		*routed = *client
+	}
+	routed.Transport = transport
+	return routed
+}
+
+// gatewayClient returns the client a gateway built from config should use:
+// client itself, or a copy routed through config.ProxyURL
+func gatewayClient(client *http.Client, config *GatewayConfig) (*http.Client, error) {
+	if config.ProxyURL == "" {
+		return client, nil
+	}
+	if config.Transport != nil {
+		return nil, fmt.Errorf("cannot apply a proxy to a custom transport")
+	}
+	proxy, err := url.Parse(config.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch proxy.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxy.Scheme)
+	}
+
+	base, ok := http.DefaultTransport.(*http.Transport)
+	if client != nil {
+		if t, isTransport := client.Transport.(*http.Transport); isTransport {
+			base, ok = t, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("cannot apply a proxy to a custom transport")
+	}
+	transport := base.Clone()
+	transport.Proxy = http.ProxyURL(proxy)
+
+	proxied := &http.Client{Transport: transport}
+	if client != nil {
+		proxied.Timeout = client.Timeout
+		proxied.CheckRedirect = client.CheckRedirect
+		proxied.Jar = client.Jar
+	}
+	return proxied, nil
+}
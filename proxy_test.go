@@ -0,0 +1,83 @@
+package payment
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestGatewayProxy(t *testing.T) {
+	pm := NewPaymentManager(0)
+	clients := map[string]*http.Client{}
+	for _, method := range []string{"direct", "proxied", "bad"} {
+		pm.RegisterFactory(method, func(config *GatewayConfig, client *http.Client) Gateway {
+			clients[method] = client
+			return &fakeGateway{method: method}
+		})
+	}
+
+	if err := pm.RegisterGatewayWithConfig("direct", &GatewayConfig{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := pm.RegisterGatewayWithConfig("proxied", &GatewayConfig{ProxyURL: "socks5://egress.internal:1080"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := pm.RegisterGatewayWithConfig("bad", &GatewayConfig{ProxyURL: "ftp://egress.internal"}); err == nil {
+		t.Error("Expected unsupported proxy scheme to be rejected")
+	}
+
+	if clients["direct"] != pm.client {
+		t.Error("Expected gateways without a proxy to share the manager's client")
+	}
+	proxied := clients["proxied"]
+	if proxied == pm.client || proxied.Timeout != pm.client.Timeout {
+		t.Fatalf("Expected a separate client with the same timeout")
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://api.razorpay.com", nil)
+	proxy, err := proxied.Transport.(*http.Transport).Proxy(req)
+	if err != nil || proxy == nil || proxy.Host != "egress.internal:1080" {
+		t.Errorf("Expected requests to go through the proxy, got %v (%v)", proxy, err)
+	}
+}
+
+func TestGatewayTransport(t *testing.T) {
+	recording := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("not sent")
+	})
+	pm := NewPaymentManager(0)
+	clients := map[string]*http.Client{}
+	for _, method := range []string{"faked", "proxied"} {
+		pm.RegisterFactory(method, func(config *GatewayConfig, client *http.Client) Gateway {
+			clients[method] = client
+			return &fakeGateway{method: method}
+		})
+	}
+
+	if err := pm.RegisterGatewayWithConfig("faked", &GatewayConfig{Transport: recording}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	faked := clients["faked"]
+	if faked == pm.client || faked.Timeout != pm.client.Timeout {
+		t.Fatal("Expected a separate client with the same timeout")
+	}
+	if _, ok := faked.Transport.(roundTripFunc); !ok {
+		t.Errorf("Expected the configured transport, got %T", faked.Transport)
+	}
+	if _, ok := pm.client.Transport.(*http.Transport); !ok {
+		t.Error("Expected the manager's transport to be left alone")
+	}
+
+	err := pm.RegisterGatewayWithConfig("proxied", &GatewayConfig{Transport: recording, ProxyURL: "http://egress.internal:3128"})
+	if err == nil {
+		t.Error("Expected a proxy on a custom transport to be rejected")
+	}
+
+	pm = NewPaymentManagerWithOptions(WithHTTPTransport(recording))
+	if _, ok := pm.client.Transport.(roundTripFunc); !ok {
+		t.Errorf("Expected the shared client to use the transport, got %T", pm.client.Transport)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
@@ -0,0 +1,39 @@
+package payment
+
+import "errors"
+
+// PaymentResponse.Metadata keys holding a method-specific QR payload, used by
+// QRPayload in preference to PaymentURL
+const (
+	MetadataQRPayload = "qr_payload"
+	MetadataUPIIntent = "upi_intent"
+)
+
+// ErrNoQRPayload is returned when a response has nothing to encode
+var ErrNoQRPayload = errors.New("response has no payment URL or QR payload")
+
+// ErrQRCodeUnavailable is returned by QRCodeForResponse in builds without
+// the qrcode tag
+var ErrQRCodeUnavailable = errors.New("QR code rendering requires building with -tags qrcode")
+
+// QRCodeSize is the width and height, in pixels, of the PNG
+// QRCodeForResponse renders
+const QRCodeSize = 256
+
+// QRPayload returns the string a QR code for resp should encode, for
+// point-of-sale and mobile handoff: the qr_payload metadata (e.g. PromptPay),
+// then upi_intent, then PaymentURL. QRCodeForResponse renders it as a PNG.
+func QRPayload(resp *PaymentResponse) (string, error) {
+	if resp == nil {
+		return "", ErrNoQRPayload
+	}
+	for _, key := range []string{MetadataQRPayload, MetadataUPIIntent} {
+		if v := resp.Metadata[key]; v != "" {
+			return v, nil
+		}
+	}
+	if resp.PaymentURL != "" {
+		return resp.PaymentURL, nil
+	}
+	return "", ErrNoQRPayload
+}
@@ -0,0 +1,15 @@
+//go:build qrcode
+
+package payment
+
+import qrcode "github.com/skip2/go-qrcode"
+
+// QRCodeForResponse renders QRPayload(resp) as a QRCodeSize PNG. It is
+// built only with the qrcode tag, so default builds don't link the encoder.
+func QRCodeForResponse(resp *PaymentResponse) ([]byte, error) {
+	payload, err := QRPayload(resp)
+	if err != nil {
+		return nil, err
+	}
+	return qrcode.Encode(payload, qrcode.Medium, QRCodeSize)
+}
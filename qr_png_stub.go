@@ -0,0 +1,12 @@
+//go:build !qrcode
+
+package payment
+
+// QRCodeForResponse returns ErrQRCodeUnavailable: PNG rendering is built
+// only with the qrcode tag. Without it, render QRPayload with any QR library.
+func QRCodeForResponse(resp *PaymentResponse) ([]byte, error) {
+	if _, err := QRPayload(resp); err != nil {
+		return nil, err
+	}
+	return nil, ErrQRCodeUnavailable
+}
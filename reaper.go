@@ -0,0 +1,167 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ReaperOptions configures the pending-payment reaper
+type ReaperOptions struct {
+	// Interval between sweeps. Defaults to one minute.
+	Interval time.Duration
+	// BatchSize limits how many pending transactions are checked per sweep.
+	// Defaults to 100.
+	BatchSize int
+	// OnUpdate is called whenever the reaper changes a transaction's status
+	OnUpdate func(txn *Transaction)
+	// HoldWarning is how long before an authorization hold lapses that
+	// OnHoldExpiring is called. Defaults to 24 hours.
+	HoldWarning time.Duration
+	// OnHoldExpiring is called once per authorized transaction whose hold
+	// lapses within HoldWarning, so it can be captured or voided in time
+	OnHoldExpiring func(txn *Transaction)
+}
+
+// StartReaper starts a background loop that refreshes pending transactions
+// in the TransactionStore via GetStatus and cancels those past ExpiresAt
+// that the provider doesn't report as settled. It runs until Close is called.
+func (pm *PaymentManager) StartReaper(opts ReaperOptions) error {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.transactions == nil {
+		return errors.New("reaper requires a transaction store")
+	}
+	if pm.reaperCancel != nil {
+		return errors.New("reaper already running")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	pm.reaperCancel = cancel
+	pm.reaperDone = done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				pm.ReapPending(ctx, opts)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// ReapPending runs a single reaper sweep. It is exported so callers can drive
+// sweeps from their own scheduler instead of StartReaper.
+func (pm *PaymentManager) ReapPending(ctx context.Context, opts ReaperOptions) {
+	pm.mu.RLock()
+	store := pm.transactions
+	pm.mu.RUnlock()
+	if store == nil {
+		return
+	}
+
+	pending, err := store.ListPending(opts.BatchSize)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, txn := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		if txn.Status.IsTerminal() {
+			continue
+		}
+		if txn.Status == StatusAuthorized {
+			pm.checkHold(ctx, store, txn, now, opts)
+			continue
+		}
+
+		// An expired payment may still have been paid at the last moment, so
+		// the provider is asked before it is canceled. A lookup that fails
+		// transiently is retried on the next sweep.
+		status := txn.Status
+		resp, err := pm.GetStatus(ctx, txn.Method, &StatusRequest{TransactionID: txn.ProviderID(), SessionID: txn.SessionID, OrderID: txn.OrderID, Amount: txn.Amount})
+		if err == nil && resp.Status != "" {
+			status = resp.Status
+		}
+		if !txn.ExpiresAt.IsZero() && now.After(txn.ExpiresAt) && !status.IsTerminal() {
+			if IsTransient(err) {
+				continue
+			}
+			status = StatusCanceled
+		}
+
+		if status == txn.Status {
+			continue
+		}
+		txn.Status = status
+		txn.UpdatedAt = now
+		if err := store.Save(txn); err != nil {
+			continue
+		}
+		if opts.OnUpdate != nil {
+			opts.OnUpdate(txn)
+		}
+	}
+}
+
+// checkHold reports a hold nearing expiry and voids one that has lapsed
+// with the gateway. A hold the gateway fails to void stays authorized and
+// is retried on the next sweep. Authorized transactions aren't polled via
+// GetStatus.
+func (pm *PaymentManager) checkHold(ctx context.Context, store TransactionStore, txn *Transaction, now time.Time, opts ReaperOptions) {
+	if txn.HoldExpiresAt.IsZero() {
+		return
+	}
+	warning := opts.HoldWarning
+	if warning <= 0 {
+		warning = 24 * time.Hour
+	}
+
+	switch {
+	case now.After(txn.HoldExpiresAt):
+		if err := pm.VoidAuthorization(ctx, txn.Method, txn.ID); err != nil {
+			return
+		}
+		if voided, err := store.Get(txn.ID); err == nil && opts.OnUpdate != nil {
+			opts.OnUpdate(voided)
+		}
+	case txn.HoldWarnedAt.IsZero() && now.Add(warning).After(txn.HoldExpiresAt):
+		txn.HoldWarnedAt = now
+		if err := store.Save(txn); err == nil && opts.OnHoldExpiring != nil {
+			opts.OnHoldExpiring(txn)
+		}
+	}
+}
+
+// Close stops background work started by the manager, such as the reaper
+func (pm *PaymentManager) Close() error {
+	pm.mu.Lock()
+	cancel, done := pm.reaperCancel, pm.reaperDone
+	pm.reaperCancel, pm.reaperDone = nil, nil
+	pm.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	return nil
+}
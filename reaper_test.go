@@ -0,0 +1,198 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/money"
+)
+
+func TestReapPending(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+	pm.RegisterGateway("poll", &pollingGateway{fakeGateway: fakeGateway{method: "poll"}, remaining: 1 << 30})
+	store := NewMemoryTransactionStore()
+	pm.SetTransactionStore(store)
+
+	ctx := context.Background()
+	if _, err := pm.InitiatePayment(ctx, "fake", &PaymentRequest{OrderID: "live", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Expired payments are canceled unless the provider reports them paid
+	expiresAt := time.Now().Add(-time.Minute)
+	if _, err := pm.InitiatePayment(ctx, "poll", &PaymentRequest{OrderID: "old", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL, ExpiresAt: expiresAt}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := pm.InitiatePayment(ctx, "fake", &PaymentRequest{OrderID: "late", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL, ExpiresAt: expiresAt}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	updated := map[string]PaymentStatus{}
+	pm.ReapPending(ctx, ReaperOptions{OnUpdate: func(txn *Transaction) {
+		updated[txn.OrderID] = txn.Status
+	}})
+
+	if updated["live"] != StatusCompleted {
+		t.Errorf("Expected live to be completed, got %s", updated["live"])
+	}
+	if updated["old"] != StatusCanceled {
+		t.Errorf("Expected old to be canceled, got %s", updated["old"])
+	}
+	if updated["late"] != StatusCompleted {
+		t.Errorf("Expected late to be completed, got %s", updated["late"])
+	}
+
+	pending, _ := store.ListPending(0)
+	if len(pending) != 0 {
+		t.Errorf("Expected no pending transactions, got %d", len(pending))
+	}
+}
+
+func TestStartReaperRequiresStore(t *testing.T) {
+	pm := NewPaymentManager(0)
+	if err := pm.StartReaper(ReaperOptions{}); err == nil {
+		t.Error("Expected error without a transaction store")
+	}
+
+	pm.SetTransactionStore(NewMemoryTransactionStore())
+	if err := pm.StartReaper(ReaperOptions{Interval: time.Millisecond}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := pm.StartReaper(ReaperOptions{}); err == nil {
+		t.Error("Expected error when reaper is already running")
+	}
+	pm.Close()
+}
+
+// pollingGateway reports pending until polled the given number of times
+type pollingGateway struct {
+	fakeGateway
+	remaining int
+}
+
+func (p *pollingGateway) GetStatus(ctx context.Context, req *StatusRequest) (*StatusResponse, error) {
+	if p.remaining > 0 {
+		p.remaining--
+		return &StatusResponse{Status: StatusPending, TransactionID: req.TransactionID}, nil
+	}
+	return &StatusResponse{Status: StatusCompleted, TransactionID: req.TransactionID}, nil
+}
+
+func TestWaitForTerminalStatus(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("poll", &pollingGateway{fakeGateway: fakeGateway{method: "poll"}, remaining: 2})
+
+	resp, err := pm.WaitForTerminalStatus(context.Background(), "poll", "t1", time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !resp.Status.IsSuccess() {
+		t.Errorf("Expected completed, got %s", resp.Status)
+	}
+
+	pm.RegisterGateway("stuck", &pollingGateway{fakeGateway: fakeGateway{method: "stuck"}, remaining: 1 << 30})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pm.WaitForTerminalStatus(ctx, "stuck", "t2", time.Millisecond); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+// holdGateway places holds that lapse after validity
+type holdGateway struct {
+	fakeGateway
+	validity time.Duration
+	voidErr  error
+	voided   []string
+}
+
+func (h *holdGateway) AuthorizePayment(ctx context.Context, req *PaymentRequest) (*AuthorizationResponse, error) {
+	return &AuthorizationResponse{Success: true, TransactionID: "auth-" + req.OrderID, OrderID: req.OrderID, Amount: req.Amount, ExpiresAt: time.Now().Add(h.validity)}, nil
+}
+
+func (h *holdGateway) CapturePayment(ctx context.Context, req *CaptureRequest) (*CaptureResponse, error) {
+	return &CaptureResponse{Success: true, TransactionID: req.TransactionID}, nil
+}
+
+func (h *holdGateway) VoidAuthorization(ctx context.Context, txnID string) error {
+	if h.voidErr != nil {
+		return h.voidErr
+	}
+	h.voided = append(h.voided, txnID)
+	return nil
+}
+
+func TestReapPendingHoldExpiry(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("hold", &holdGateway{fakeGateway: fakeGateway{method: "hold"}, validity: time.Hour})
+	pm.SetTransactionStore(NewMemoryTransactionStore())
+
+	ctx := context.Background()
+	auth, err := pm.AuthorizePayment(ctx, "hold", &PaymentRequest{OrderID: "O1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	warned := 0
+	opts := ReaperOptions{HoldWarning: 2 * time.Hour, OnHoldExpiring: func(txn *Transaction) { warned++ }}
+	pm.ReapPending(ctx, opts)
+	pm.ReapPending(ctx, opts)
+	if warned != 1 {
+		t.Errorf("Expected one expiry warning, got %d", warned)
+	}
+
+	holds, err := pm.ExpiringHolds(2 * time.Hour)
+	if err != nil || len(holds) != 1 || holds[0].ID != auth.TransactionID {
+		t.Errorf("Expected the hold to be expiring, got %v %v", holds, err)
+	}
+
+	if _, err := pm.CapturePayment(ctx, "hold", &CaptureRequest{TransactionID: auth.TransactionID}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if txn, _ := pm.GetTransactionStore().Get(auth.TransactionID); txn.Status != StatusCompleted {
+		t.Errorf("Expected completed after capture, got %s", txn.Status)
+	}
+
+	if _, err := pm.AuthorizePayment(ctx, "hold", nil); !errors.Is(err, ErrNilRequest) {
+		t.Errorf("Expected ErrNilRequest, got %v", err)
+	}
+	if _, err := pm.AuthorizePayment(ctx, "missing", &PaymentRequest{}); err == nil {
+		t.Error("Expected error for unregistered gateway")
+	}
+	pm.RegisterGateway("plain", &fakeGateway{method: "plain"})
+	if _, err := pm.AuthorizePayment(ctx, "plain", &PaymentRequest{}); HTTPStatusForError(err) != 501 {
+		t.Errorf("Expected unsupported error, got %v", err)
+	}
+}
+
+func TestReapPendingVoidsLapsedHolds(t *testing.T) {
+	g := &holdGateway{fakeGateway: fakeGateway{method: "hold"}, validity: -time.Minute, voidErr: errors.New("provider down")}
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("hold", g)
+	store := NewMemoryTransactionStore()
+	pm.SetTransactionStore(store)
+
+	ctx := context.Background()
+	auth, err := pm.AuthorizePayment(ctx, "hold", &PaymentRequest{OrderID: "O1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// A failed void leaves the hold authorized for the next sweep
+	pm.ReapPending(ctx, ReaperOptions{})
+	if txn, _ := store.Get(auth.TransactionID); txn.Status != StatusAuthorized {
+		t.Errorf("Expected authorized after a failed void, got %s", txn.Status)
+	}
+
+	g.voidErr = nil
+	var updated *Transaction
+	pm.ReapPending(ctx, ReaperOptions{OnUpdate: func(txn *Transaction) { updated = txn }})
+	if len(g.voided) != 1 || g.voided[0] != auth.TransactionID {
+		t.Errorf("Expected the lapsed hold to be voided, got %v", g.voided)
+	}
+	if updated == nil || updated.Status != StatusCanceled {
+		t.Errorf("Expected a canceled update, got %+v", updated)
+	}
+}
@@ -0,0 +1,115 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/oarkflow/money"
+)
+
+// refundTracked refunds a stored transaction, enforcing that it was
+// captured and the remaining balance. Transactions the store doesn't know
+// fail with ErrTransactionNotFound. Refunds of the same transaction are
+// serialized so concurrent calls can't over-refund.
+func (pm *PaymentManager) refundTracked(ctx context.Context, g Gateway, store TransactionStore, req *RefundRequest) (*RefundResponse, error) {
+	unlock := pm.refundLocks.lock(req.TransactionID)
+	defer unlock()
+
+	// Without a record the captured amount and prior refunds are unknown,
+	// so the refund can't be checked
+	txn, ok := findTransaction(store, req.TransactionID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTransactionNotFound, req.TransactionID)
+	}
+
+	if !refundable(txn.Status) {
+		return nil, NewPaymentError(ErrKindValidation, g.GetMethod(), fmt.Sprintf("transaction %s is %s, not captured", txn.ID, txn.Status), nil)
+	}
+	remaining, err := txn.RefundableBalance()
+	if err != nil {
+		return nil, err
+	}
+	amount := req.Amount
+	if amount.Currency().Code == "" || amount.IsZero() {
+		amount = remaining
+	}
+	cmp, err := amount.Cmp(remaining)
+	if err != nil {
+		return nil, NewPaymentError(ErrKindValidation, g.GetMethod(), "", err)
+	}
+	if cmp > 0 || !amount.IsPositive() {
+		return nil, fmt.Errorf("%w: requested %s, refundable %s", ErrRefundExceedsCaptured, amount, remaining)
+	}
+
+	refundReq := *req
+	refundReq.Amount = amount
+	start := time.Now()
+	resp, err := g.RefundPayment(ctx, &refundReq)
+	pm.trackLatency(g.GetMethod(), start)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		resp.Remaining = remaining
+		return resp, nil
+	}
+
+	if resp.Remaining, err = txn.addRefund(RefundRecord{RefundID: resp.RefundID, Amount: amount, CreatedAt: time.Now()}); err != nil {
+		return nil, err
+	}
+	if err := store.Save(txn); err != nil {
+		return nil, err
+	}
+	pm.recordLedger(LedgerEntry{
+		Time:          txn.UpdatedAt,
+		Type:          LedgerRefunded,
+		Method:        g.GetMethod(),
+		TransactionID: txn.ID,
+		OrderID:       txn.OrderID,
+		Amount:        amount,
+		Status:        refundStatus(resp.Remaining),
+		Reference:     resp.RefundID,
+	})
+	return resp, nil
+}
+
+// addRefund records r against t and moves t to StatusRefunded or
+// StatusPartiallyRefunded. It returns the refundable balance left.
+func (t *Transaction) addRefund(r RefundRecord) (money.Money, error) {
+	refunded := r.Amount
+	if t.Refunded.Currency().Code != "" {
+		var err error
+		if refunded, err = t.Refunded.Add(r.Amount); err != nil {
+			return money.Money{}, err
+		}
+	}
+	t.Refunded = refunded
+	remaining, err := t.RefundableBalance()
+	if err != nil {
+		return money.Money{}, err
+	}
+	t.Status = refundStatus(remaining)
+	t.UpdatedAt = r.CreatedAt
+	t.Refunds = append(t.Refunds, r)
+	return remaining, nil
+}
+
+// refundStatus returns the status of a refunded payment with remaining
+// still refundable
+func refundStatus(remaining money.Money) PaymentStatus {
+	if remaining.IsPositive() {
+		return StatusPartiallyRefunded
+	}
+	return StatusRefunded
+}
+
+// refundable reports whether a payment in status was captured: it is
+// completed or already refunded. The refundable balance decides the rest.
+func refundable(status PaymentStatus) bool {
+	switch status {
+	case StatusCompleted, StatusPartiallyRefunded, StatusRefunded:
+		return true
+	}
+	return false
+}
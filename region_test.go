@@ -1,6 +1,8 @@
 package payment
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 )
 
@@ -201,3 +203,208 @@ func TestValidateGatewayForCountry(t *testing.T) {
 		t.Error("Validation should fail for ESewa in USA")
 	}
 }
+
+func TestDefaultRegionFallback(t *testing.T) {
+	registry := NewGatewayRegistry()
+	registry.RegisterRegionGateway(RegionSouthAsia, "regional-pay", 5)
+	registry.RegisterGlobalGateway("stripe", 10)
+
+	unknown := Country("BT")
+
+	// Unmapped countries fall back to global only
+	if registry.IsGatewayAvailable(unknown, "regional-pay") {
+		t.Error("Regional gateway should not be available before setting default region")
+	}
+
+	registry.SetDefaultRegion(RegionSouthAsia)
+
+	if !registry.IsGatewayAvailable(unknown, "regional-pay") {
+		t.Error("Regional gateway should be available via default region")
+	}
+
+	gateways := registry.GetAvailableGateways(unknown)
+	if len(gateways) != 2 || gateways[0] != "regional-pay" {
+		t.Errorf("Expected [regional-pay stripe], got %v", gateways)
+	}
+
+	// Mapped countries keep their own region
+	if registry.IsGatewayAvailable(CountryUSA, "regional-pay") {
+		t.Error("Default region should not apply to mapped countries")
+	}
+}
+
+func TestRecommendationsDeterministicOnTies(t *testing.T) {
+	registry := NewGatewayRegistry()
+	registry.RegisterCountryGateway(CountryNepal, "khalti", 1)
+	registry.RegisterCountryGateway(CountryNepal, "esewa", 1)
+	registry.RegisterRegionGateway(RegionSouthAsia, "regional-b", 1)
+	registry.RegisterRegionGateway(RegionSouthAsia, "regional-a", 1)
+	registry.RegisterRegionGateway(RegionSouthAsia, "regional-d", 2)
+	registry.RegisterRegionGateway(RegionSouthAsia, "regional-c", 2)
+	registry.RegisterGlobalGateway("stripe", 1)
+
+	expected := []string{"esewa", "khalti", "regional-a", "regional-b", "stripe", "regional-c", "regional-d"}
+	expectedRecommended := map[string]bool{
+		"esewa": true, "khalti": true, "regional-a": true, "regional-b": true,
+		"regional-c": true, "regional-d": false, "stripe": false,
+	}
+
+	for run := 0; run < 20; run++ {
+		recs := registry.GetRecommendations(CountryNepal)
+		if len(recs) != len(expected) {
+			t.Fatalf("Expected %d recommendations, got %d", len(expected), len(recs))
+		}
+		for i, want := range expected {
+			if recs[i].Method != want {
+				t.Fatalf("Run %d position %d: got %s, want %s", run, i, recs[i].Method, want)
+			}
+			if recs[i].Recommended != expectedRecommended[want] {
+				t.Fatalf("Run %d: %s recommended = %v", run, want, recs[i].Recommended)
+			}
+		}
+	}
+}
+
+func TestCurrencyGateway(t *testing.T) {
+	registry := NewGatewayRegistry()
+	registry.RegisterCurrencyGateway("usd", "usd-only", 2)
+	registry.RegisterCurrencyGateway("USD", "stripe", 1)
+
+	gateways := registry.GetAvailableGatewaysForCurrency("USD")
+	if len(gateways) != 2 || gateways[0] != "stripe" {
+		t.Errorf("Expected [stripe usd-only], got %v", gateways)
+	}
+
+	if !registry.IsGatewayAvailableForCurrency("usd", "usd-only") {
+		t.Error("usd-only should be available for USD")
+	}
+	if registry.IsGatewayAvailableForCurrency("EUR", "usd-only") {
+		t.Error("usd-only should not be available for EUR")
+	}
+}
+
+func TestRegistryConcurrentReadsAndWrites(t *testing.T) {
+	registry := NewGatewayRegistry()
+	for i := 0; i < 10; i++ {
+		registry.RegisterCountryGateway(CountryNepal, fmt.Sprintf("gw-%d", i), i)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				registry.RegisterCountryGateway(CountryNepal, fmt.Sprintf("gw-%d", j%10), (i+j)%5)
+				registry.RegisterGlobalGateway(fmt.Sprintf("global-%d", i), j)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				registry.GetAvailableGateways(CountryNepal)
+				registry.GetRecommendations(CountryNepal)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRegisterAll(t *testing.T) {
+	registry := NewGatewayRegistry()
+	err := registry.RegisterAll([]GatewayEntry{
+		{Scope: ScopeCountry, Target: string(CountryNepal), Method: "esewa", Priority: 1},
+		{Scope: ScopeRegion, Target: string(RegionSouthAsia), Method: "regional", Priority: 5},
+		{Scope: ScopeGlobal, Method: "stripe", Priority: 10},
+		{Scope: ScopeCurrency, Target: "NPR", Method: "esewa", Priority: 1},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	gateways := registry.GetAvailableGateways(CountryNepal)
+	if len(gateways) != 3 || gateways[0] != "esewa" {
+		t.Errorf("Expected [esewa regional stripe], got %v", gateways)
+	}
+	if !registry.IsGatewayAvailableForCurrency("NPR", "esewa") {
+		t.Error("esewa should be registered for NPR")
+	}
+
+	bad := NewGatewayRegistry()
+	err = bad.RegisterAll([]GatewayEntry{
+		{Scope: ScopeGlobal, Method: "stripe", Priority: 10},
+		{Scope: "planet", Target: "earth", Method: "x", Priority: 1},
+	})
+	if err == nil {
+		t.Error("Expected error for unknown scope")
+	}
+	if bad.IsGatewayAvailable(CountryUSA, "stripe") {
+		t.Error("Nothing should be registered when an entry is invalid")
+	}
+}
+
+func TestGatewayTags(t *testing.T) {
+	registry := NewGatewayRegistry()
+	registry.RegisterCountryGateway(CountryNepal, "khalti", 2)
+	registry.RegisterCountryGateway(CountryNepal, "esewa", 1)
+	registry.RegisterCountryGateway(CountryNepal, "connectips", 4)
+	registry.RegisterGlobalGateway("stripe", 10)
+
+	registry.TagGateway("esewa", TagWallet)
+	registry.TagGateway("khalti", TagWallet, TagBank)
+	registry.TagGateway("connectips", TagBank)
+	registry.TagGateway("stripe", TagCard)
+
+	wallets := registry.GetGatewaysByTag(CountryNepal, TagWallet)
+	if len(wallets) != 2 || wallets[0] != "esewa" || wallets[1] != "khalti" {
+		t.Errorf("Expected [esewa khalti], got %v", wallets)
+	}
+
+	if banks := registry.GetGatewaysByTag(CountryUSA, TagBank); len(banks) != 0 {
+		t.Errorf("Expected no bank gateways for USA, got %v", banks)
+	}
+
+	if tags := registry.GetGatewayTags("khalti"); len(tags) != 2 || tags[0] != TagBank {
+		t.Errorf("Expected [bank wallet], got %v", tags)
+	}
+}
+
+func TestUnregisterGateway(t *testing.T) {
+	registry := NewGatewayRegistry()
+	registry.RegisterGlobalGateway("stripe", 10)
+	registry.RegisterRegionGateway(RegionSouthAsia, "razorpay", 2)
+	registry.RegisterCountryGateway(CountryNepal, "esewa", 1)
+	registry.RegisterCountryGateway(CountryIndia, "razorpay", 1)
+
+	registry.UnregisterCountryGateway(CountryNepal, "esewa")
+	if registry.IsGatewayAvailable(CountryNepal, "esewa") {
+		t.Error("esewa should not be available in Nepal after unregistering")
+	}
+	if registry.GetGatewayPriority("esewa") != 999 {
+		t.Errorf("Expected default priority for esewa, got %d", registry.GetGatewayPriority("esewa"))
+	}
+
+	// razorpay stays available through its region registration
+	registry.UnregisterCountryGateway(CountryIndia, "razorpay")
+	if !registry.IsGatewayAvailable(CountryIndia, "razorpay") {
+		t.Error("razorpay should still be available in India through South Asia")
+	}
+	if registry.GetGatewayPriority("razorpay") == 999 {
+		t.Error("razorpay priority should be kept while it has registrations")
+	}
+	registry.UnregisterRegionGateway(RegionSouthAsia, "razorpay")
+	if registry.IsGatewayAvailable(CountryIndia, "razorpay") || registry.GetGatewayPriority("razorpay") != 999 {
+		t.Error("razorpay should be fully unregistered")
+	}
+
+	registry.UnregisterGlobalGateway("stripe")
+	if registry.IsGatewayAvailable(CountryUSA, "stripe") {
+		t.Error("stripe should not be available after unregistering")
+	}
+
+	registry.RegisterCurrencyGateway("npr", "khalti", 2)
+	registry.UnregisterCurrencyGateway("NPR", "khalti")
+	if registry.IsGatewayAvailableForCurrency("NPR", "khalti") {
+		t.Error("khalti should not be available for NPR after unregistering")
+	}
+}
@@ -2,6 +2,8 @@ package payment
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 )
 
@@ -16,24 +18,65 @@ type GatewayRegistry struct {
 	// Country-specific gateways
 	countryGateways map[Country]map[string]bool
 
+	// Currency-specific gateways, keyed by ISO 4217 code
+	currencyGateways map[string]map[string]bool
+
 	// Gateway priorities (lower number = higher priority)
 	gatewayPriority map[string]int
 
+	// Gateway tags such as "wallet" or "card"
+	gatewayTags map[string]map[string]bool
+
+	// Region used for countries missing from CountryToRegion
+	defaultRegion Region
+
 	mu sync.RWMutex
 }
 
 // NewGatewayRegistry creates a new gateway registry
 func NewGatewayRegistry() *GatewayRegistry {
 	return &GatewayRegistry{
-		globalGateways:  make(map[string]bool),
-		regionGateways:  make(map[Region]map[string]bool),
-		countryGateways: make(map[Country]map[string]bool),
-		gatewayPriority: make(map[string]int),
+		globalGateways:   make(map[string]bool),
+		regionGateways:   make(map[Region]map[string]bool),
+		countryGateways:  make(map[Country]map[string]bool),
+		currencyGateways: make(map[string]map[string]bool),
+		gatewayPriority:  make(map[string]int),
+		gatewayTags:      make(map[string]map[string]bool),
+		defaultRegion:    RegionGlobal,
+	}
+}
+
+// SetDefaultRegion sets the region used for countries that are not in
+// CountryToRegion. Defaults to RegionGlobal.
+func (r *GatewayRegistry) SetDefaultRegion(region Region) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if region == "" {
+		region = RegionGlobal
 	}
+	r.defaultRegion = region
+}
+
+// GetDefaultRegion returns the fallback region for unmapped countries
+func (r *GatewayRegistry) GetDefaultRegion() Region {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.defaultRegion
+}
+
+// regionFor resolves a country's region, falling back to the default region.
+// Callers must hold r.mu.
+func (r *GatewayRegistry) regionFor(country Country) Region {
+	if region, ok := CountryToRegion[country]; ok {
+		return region
+	}
+	return r.defaultRegion
 }
 
 // RegisterGlobalGateway registers a gateway available globally
 func (r *GatewayRegistry) RegisterGlobalGateway(method string, priority int) {
+	method = NormalizeMethod(method)
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -43,6 +86,7 @@ func (r *GatewayRegistry) RegisterGlobalGateway(method string, priority int) {
 
 // RegisterRegionGateway registers a gateway for a specific region
 func (r *GatewayRegistry) RegisterRegionGateway(region Region, method string, priority int) {
+	method = NormalizeMethod(method)
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -55,6 +99,7 @@ func (r *GatewayRegistry) RegisterRegionGateway(region Region, method string, pr
 
 // RegisterCountryGateway registers a gateway for a specific country
 func (r *GatewayRegistry) RegisterCountryGateway(country Country, method string, priority int) {
+	method = NormalizeMethod(method)
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -65,6 +110,152 @@ func (r *GatewayRegistry) RegisterCountryGateway(country Country, method string,
 	r.gatewayPriority[method] = priority
 }
 
+// RegisterCurrencyGateway registers a gateway for a specific currency
+func (r *GatewayRegistry) RegisterCurrencyGateway(currency string, method string, priority int) {
+	method = NormalizeMethod(method)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	currency = strings.ToUpper(currency)
+	if r.currencyGateways[currency] == nil {
+		r.currencyGateways[currency] = make(map[string]bool)
+	}
+	r.currencyGateways[currency][method] = true
+	r.gatewayPriority[method] = priority
+}
+
+// UnregisterGlobalGateway removes a global registration
+func (r *GatewayRegistry) UnregisterGlobalGateway(method string) {
+	method = NormalizeMethod(method)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.globalGateways, method)
+	r.forgetPriority(method)
+}
+
+// UnregisterRegionGateway removes a gateway from a region
+func (r *GatewayRegistry) UnregisterRegionGateway(region Region, method string) {
+	method = NormalizeMethod(method)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.regionGateways[region], method)
+	if len(r.regionGateways[region]) == 0 {
+		delete(r.regionGateways, region)
+	}
+	r.forgetPriority(method)
+}
+
+// UnregisterCountryGateway removes a gateway from a country
+func (r *GatewayRegistry) UnregisterCountryGateway(country Country, method string) {
+	method = NormalizeMethod(method)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.countryGateways[country], method)
+	if len(r.countryGateways[country]) == 0 {
+		delete(r.countryGateways, country)
+	}
+	r.forgetPriority(method)
+}
+
+// UnregisterCurrencyGateway removes a gateway from a currency
+func (r *GatewayRegistry) UnregisterCurrencyGateway(currency string, method string) {
+	method = NormalizeMethod(method)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	currency = strings.ToUpper(currency)
+	delete(r.currencyGateways[currency], method)
+	if len(r.currencyGateways[currency]) == 0 {
+		delete(r.currencyGateways, currency)
+	}
+	r.forgetPriority(method)
+}
+
+// forgetPriority drops method's priority once it has no registrations left,
+// so GetGatewayPriority returns the default again. Callers must hold r.mu.
+func (r *GatewayRegistry) forgetPriority(method string) {
+	if r.globalGateways[method] {
+		return
+	}
+	for _, methods := range r.currencyGateways {
+		if methods[method] {
+			return
+		}
+	}
+	for _, methods := range r.regionGateways {
+		if methods[method] {
+			return
+		}
+	}
+	for _, methods := range r.countryGateways {
+		if methods[method] {
+			return
+		}
+	}
+	delete(r.gatewayPriority, method)
+}
+
+// GetAvailableGatewaysForCurrency returns the gateways registered for a
+// currency, sorted by priority
+func (r *GatewayRegistry) GetAvailableGatewaysForCurrency(currency string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.sortedMethods(r.currencyGateways[strings.ToUpper(currency)])
+}
+
+// IsGatewayAvailableForCurrency checks if a gateway is registered for a currency
+func (r *GatewayRegistry) IsGatewayAvailableForCurrency(currency string, method string) bool {
+	method = NormalizeMethod(method)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.currencyGateways[strings.ToUpper(currency)][method]
+}
+
+// GetGatewayCurrencies returns the currencies a gateway is registered for,
+// sorted. It is empty for gateways not restricted by currency.
+func (r *GatewayRegistry) GetGatewayCurrencies(method string) []string {
+	method = NormalizeMethod(method)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	currencies := []string{}
+	for currency, methods := range r.currencyGateways {
+		if methods[method] {
+			currencies = append(currencies, currency)
+		}
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
+// KnownCountries returns every country in CountryToRegion plus any country
+// with its own gateway registrations, sorted by code
+func (r *GatewayRegistry) KnownCountries() []Country {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[Country]bool)
+	countries := []Country{}
+	for country := range CountryToRegion {
+		seen[country] = true
+		countries = append(countries, country)
+	}
+	for country := range r.countryGateways {
+		if !seen[country] {
+			seen[country] = true
+			countries = append(countries, country)
+		}
+	}
+
+	sort.Slice(countries, func(i, j int) bool { return countries[i] < countries[j] })
+	return countries
+}
+
 // GetAvailableGateways returns all available gateways for a country, sorted by priority
 func (r *GatewayRegistry) GetAvailableGateways(country Country) []string {
 	r.mu.RLock()
@@ -78,7 +269,7 @@ func (r *GatewayRegistry) GetAvailableGateways(country Country) []string {
 	}
 
 	// Add region gateways
-	region := GetRegion(country)
+	region := r.regionFor(country)
 	if regionGateways, ok := r.regionGateways[region]; ok {
 		for method := range regionGateways {
 			gatewaysMap[method] = true
@@ -98,14 +289,15 @@ func (r *GatewayRegistry) GetAvailableGateways(country Country) []string {
 		gateways = append(gateways, method)
 	}
 
-	// Sort by priority
-	r.sortByPriority(gateways)
+	// Sort by priority using a snapshot taken under the lock
+	sortByPriority(gateways, r.prioritySnapshot(gateways))
 
 	return gateways
 }
 
 // IsGatewayAvailable checks if a gateway is available for a country
 func (r *GatewayRegistry) IsGatewayAvailable(country Country, method string) bool {
+	method = NormalizeMethod(method)
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -115,7 +307,7 @@ func (r *GatewayRegistry) IsGatewayAvailable(country Country, method string) boo
 	}
 
 	// Check region availability
-	region := GetRegion(country)
+	region := r.regionFor(country)
 	if regionGateways, ok := r.regionGateways[region]; ok {
 		if regionGateways[method] {
 			return true
@@ -132,8 +324,62 @@ func (r *GatewayRegistry) IsGatewayAvailable(country Country, method string) boo
 	return false
 }
 
+// Common gateway tags
+const (
+	TagWallet = "wallet"
+	TagBank   = "bank"
+	TagCard   = "card"
+	TagBNPL   = "bnpl"
+)
+
+// TagGateway adds tags to a gateway for grouping and routing
+func (r *GatewayRegistry) TagGateway(method string, tags ...string) {
+	method = NormalizeMethod(method)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.gatewayTags[method] == nil {
+		r.gatewayTags[method] = make(map[string]bool)
+	}
+	for _, tag := range tags {
+		r.gatewayTags[method][tag] = true
+	}
+}
+
+// GetGatewayTags returns the tags of a gateway, sorted
+func (r *GatewayRegistry) GetGatewayTags(method string) []string {
+	method = NormalizeMethod(method)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tags := make([]string, 0, len(r.gatewayTags[method]))
+	for tag := range r.gatewayTags[method] {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// GetGatewaysByTag returns gateways available for a country that carry tag,
+// sorted by priority
+func (r *GatewayRegistry) GetGatewaysByTag(country Country, tag string) []string {
+	available := r.GetAvailableGateways(country)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tagged := []string{}
+	for _, method := range available {
+		if r.gatewayTags[method][tag] {
+			tagged = append(tagged, method)
+		}
+	}
+	return tagged
+}
+
 // GetGatewayPriority returns the priority of a gateway
 func (r *GatewayRegistry) GetGatewayPriority(method string) int {
+	method = NormalizeMethod(method)
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -143,65 +389,132 @@ func (r *GatewayRegistry) GetGatewayPriority(method string) int {
 	return 999 // Default low priority
 }
 
-// sortByPriority sorts gateways by their priority (lower number = higher priority)
-func (r *GatewayRegistry) sortByPriority(gateways []string) {
-	// Simple bubble sort for small lists
-	n := len(gateways)
-	for i := 0; i < n-1; i++ {
-		for j := 0; j < n-i-1; j++ {
-			p1 := r.gatewayPriority[gateways[j]]
-			p2 := r.gatewayPriority[gateways[j+1]]
-			if p1 > p2 {
-				gateways[j], gateways[j+1] = gateways[j+1], gateways[j]
+// prioritySnapshot copies the priorities of the given methods so sorting
+// never reads the shared map. Callers must hold r.mu.
+func (r *GatewayRegistry) prioritySnapshot(methods []string) map[string]int {
+	priorities := make(map[string]int, len(methods))
+	for _, method := range methods {
+		priorities[method] = r.gatewayPriority[method]
+	}
+	return priorities
+}
+
+// sortByPriority sorts gateways by their priority (lower number = higher priority),
+// breaking ties by method name
+func sortByPriority(gateways []string, priorities map[string]int) {
+	sort.SliceStable(gateways, func(i, j int) bool {
+		pi, pj := priorities[gateways[i]], priorities[gateways[j]]
+		if pi != pj {
+			return pi < pj
+		}
+		return gateways[i] < gateways[j]
+	})
+}
+
+// Gateway registration scopes
+const (
+	ScopeGlobal   = "global"
+	ScopeRegion   = "region"
+	ScopeCountry  = "country"
+	ScopeCurrency = "currency"
+)
+
+// GatewayEntry describes a single registry registration. Target is the
+// region, country code or currency code for the scope and is ignored for
+// global entries.
+type GatewayEntry struct {
+	Scope    string `json:"scope"`
+	Target   string `json:"target,omitempty"`
+	Method   string `json:"method"`
+	Priority int    `json:"priority"`
+}
+
+// RegisterAll applies every entry. Entries are validated first so nothing is
+// registered if any entry is invalid.
+func (r *GatewayRegistry) RegisterAll(entries []GatewayEntry) error {
+	for i, e := range entries {
+		if e.Method == "" {
+			return fmt.Errorf("entry %d: method is required", i)
+		}
+		switch e.Scope {
+		case ScopeGlobal:
+		case ScopeRegion, ScopeCountry, ScopeCurrency:
+			if e.Target == "" {
+				return fmt.Errorf("entry %d: %s scope requires a target", i, e.Scope)
 			}
+		default:
+			return fmt.Errorf("entry %d: unknown scope %q", i, e.Scope)
+		}
+	}
+
+	for _, e := range entries {
+		switch e.Scope {
+		case ScopeGlobal:
+			r.RegisterGlobalGateway(e.Method, e.Priority)
+		case ScopeRegion:
+			r.RegisterRegionGateway(Region(e.Target), e.Method, e.Priority)
+		case ScopeCountry:
+			r.RegisterCountryGateway(Country(e.Target), e.Method, e.Priority)
+		case ScopeCurrency:
+			r.RegisterCurrencyGateway(e.Target, e.Method, e.Priority)
 		}
 	}
+	return nil
+}
+
+// DefaultGatewayEntries returns the entries used by DefaultRegistry. The
+// slice is a fresh copy and can be modified before passing to RegisterAll.
+func DefaultGatewayEntries() []GatewayEntry {
+	return []GatewayEntry{
+		// Nepal-specific gateways
+		{Scope: ScopeCountry, Target: string(CountryNepal), Method: "esewa", Priority: 1},
+		{Scope: ScopeCountry, Target: string(CountryNepal), Method: "khalti", Priority: 2},
+		{Scope: ScopeCountry, Target: string(CountryNepal), Method: "imepay", Priority: 3},
+		{Scope: ScopeCountry, Target: string(CountryNepal), Method: "connectips", Priority: 4},
+
+		// India-specific gateways
+		{Scope: ScopeCountry, Target: string(CountryIndia), Method: "razorpay", Priority: 1},
+		{Scope: ScopeCountry, Target: string(CountryIndia), Method: "paytm", Priority: 2},
+		{Scope: ScopeCountry, Target: string(CountryIndia), Method: "phonepe", Priority: 3},
+		{Scope: ScopeCountry, Target: string(CountryIndia), Method: "upi", Priority: 4},
+
+		// Southeast Asia
+		{Scope: ScopeCountry, Target: string(CountrySingapore), Method: "grab-pay", Priority: 1},
+		{Scope: ScopeCountry, Target: string(CountryMalaysia), Method: "grab-pay", Priority: 1},
+		{Scope: ScopeCountry, Target: string(CountryThailand), Method: "promptpay", Priority: 1},
+		{Scope: ScopeCountry, Target: string(CountryIndonesia), Method: "gopay", Priority: 1},
+		{Scope: ScopeCountry, Target: string(CountryPhilippines), Method: "gcash", Priority: 1},
+
+		// Global gateways (available everywhere)
+		{Scope: ScopeGlobal, Method: "stripe", Priority: 10},
+		{Scope: ScopeGlobal, Method: "paypal", Priority: 11},
+		{Scope: ScopeGlobal, Method: "wise", Priority: 12},
+
+		// Region-specific gateways
+		{Scope: ScopeRegion, Target: string(RegionEurope), Method: "sepa", Priority: 5},
+		{Scope: ScopeRegion, Target: string(RegionNorthAmerica), Method: "venmo", Priority: 5},
+		{Scope: ScopeRegion, Target: string(RegionAfrica), Method: "mpesa", Priority: 1},
+		{Scope: ScopeRegion, Target: string(RegionLatinAmerica), Method: "mercadopago", Priority: 1},
+	}
 }
 
 // DefaultRegistry returns a pre-configured registry with common payment gateways
 func DefaultRegistry() *GatewayRegistry {
 	registry := NewGatewayRegistry()
-
-	// Nepal-specific gateways
-	registry.RegisterCountryGateway(CountryNepal, "esewa", 1)
-	registry.RegisterCountryGateway(CountryNepal, "khalti", 2)
-	registry.RegisterCountryGateway(CountryNepal, "imepay", 3)
-	registry.RegisterCountryGateway(CountryNepal, "connectips", 4)
-
-	// India-specific gateways
-	registry.RegisterCountryGateway(CountryIndia, "razorpay", 1)
-	registry.RegisterCountryGateway(CountryIndia, "paytm", 2)
-	registry.RegisterCountryGateway(CountryIndia, "phonepe", 3)
-	registry.RegisterCountryGateway(CountryIndia, "upi", 4)
-
-	// Southeast Asia
-	registry.RegisterCountryGateway(CountrySingapore, "grab-pay", 1)
-	registry.RegisterCountryGateway(CountryMalaysia, "grab-pay", 1)
-	registry.RegisterCountryGateway(CountryThailand, "promptpay", 1)
-	registry.RegisterCountryGateway(CountryIndonesia, "gopay", 1)
-	registry.RegisterCountryGateway(CountryPhilippines, "gcash", 1)
-
-	// Global gateways (available everywhere)
-	registry.RegisterGlobalGateway("stripe", 10)
-	registry.RegisterGlobalGateway("paypal", 11)
-	registry.RegisterGlobalGateway("wise", 12)
-
-	// Region-specific gateways
-	registry.RegisterRegionGateway(RegionEurope, "sepa", 5)
-	registry.RegisterRegionGateway(RegionNorthAmerica, "venmo", 5)
-	registry.RegisterRegionGateway(RegionAfrica, "mpesa", 1)
-	registry.RegisterRegionGateway(RegionLatinAmerica, "mercadopago", 1)
-
+	_ = registry.RegisterAll(DefaultGatewayEntries())
 	return registry
 }
 
 // GatewayRecommendation provides information about recommended gateways
 type GatewayRecommendation struct {
 	Method      string `json:"method"`
+	Name        string `json:"name,omitempty"` // display name, set for configured gateways
 	Priority    int    `json:"priority"`
 	Scope       string `json:"scope"` // "country", "region", or "global"
 	Available   bool   `json:"available"`
 	Recommended bool   `json:"recommended"`
+	// Capabilities is set for configured gateways
+	Capabilities *GatewayCapabilities `json:"capabilities,omitempty"`
 }
 
 // GetRecommendations returns gateway recommendations for a country
@@ -214,12 +527,12 @@ func (r *GatewayRegistry) GetRecommendations(country Country) []GatewayRecommend
 
 	// Country-specific gateways (highest priority)
 	if countryGateways, ok := r.countryGateways[country]; ok {
-		for method := range countryGateways {
+		for _, method := range r.sortedMethods(countryGateways) {
 			if !seenMethods[method] {
 				recommendations = append(recommendations, GatewayRecommendation{
 					Method:      method,
 					Priority:    r.gatewayPriority[method],
-					Scope:       "country",
+					Scope:       ScopeCountry,
 					Available:   true,
 					Recommended: true,
 				})
@@ -229,14 +542,14 @@ func (r *GatewayRegistry) GetRecommendations(country Country) []GatewayRecommend
 	}
 
 	// Region gateways
-	region := GetRegion(country)
+	region := r.regionFor(country)
 	if regionGateways, ok := r.regionGateways[region]; ok {
-		for method := range regionGateways {
+		for _, method := range r.sortedMethods(regionGateways) {
 			if !seenMethods[method] {
 				recommendations = append(recommendations, GatewayRecommendation{
 					Method:      method,
 					Priority:    r.gatewayPriority[method],
-					Scope:       "region",
+					Scope:       ScopeRegion,
 					Available:   true,
 					Recommended: len(recommendations) < 5, // Recommend top 5
 				})
@@ -246,12 +559,12 @@ func (r *GatewayRegistry) GetRecommendations(country Country) []GatewayRecommend
 	}
 
 	// Global gateways
-	for method := range r.globalGateways {
+	for _, method := range r.sortedMethods(r.globalGateways) {
 		if !seenMethods[method] {
 			recommendations = append(recommendations, GatewayRecommendation{
 				Method:      method,
 				Priority:    r.gatewayPriority[method],
-				Scope:       "global",
+				Scope:       ScopeGlobal,
 				Available:   true,
 				Recommended: false,
 			})
@@ -265,15 +578,32 @@ func (r *GatewayRegistry) GetRecommendations(country Country) []GatewayRecommend
 	return recommendations
 }
 
+// scopeRank orders scopes from most to least specific
+var scopeRank = map[string]int{ScopeCountry: 0, ScopeRegion: 1, ScopeGlobal: 2}
+
+// sortRecommendations sorts by priority, then scope, then method name so
+// ties are always ordered the same way
 func (r *GatewayRegistry) sortRecommendations(recs []GatewayRecommendation) {
-	n := len(recs)
-	for i := 0; i < n-1; i++ {
-		for j := 0; j < n-i-1; j++ {
-			if recs[j].Priority > recs[j+1].Priority {
-				recs[j], recs[j+1] = recs[j+1], recs[j]
-			}
+	sort.SliceStable(recs, func(i, j int) bool {
+		if recs[i].Priority != recs[j].Priority {
+			return recs[i].Priority < recs[j].Priority
+		}
+		if scopeRank[recs[i].Scope] != scopeRank[recs[j].Scope] {
+			return scopeRank[recs[i].Scope] < scopeRank[recs[j].Scope]
 		}
+		return recs[i].Method < recs[j].Method
+	})
+}
+
+// sortedMethods returns the methods of a set ordered by priority, then name.
+// Callers must hold r.mu.
+func (r *GatewayRegistry) sortedMethods(set map[string]bool) []string {
+	methods := make([]string, 0, len(set))
+	for method := range set {
+		methods = append(methods, method)
 	}
+	sortByPriority(methods, r.prioritySnapshot(methods))
+	return methods
 }
 
 // ValidateGatewayForCountry validates if a gateway can be used for a country
@@ -0,0 +1,215 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the gateway while its circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("circuit open")
+
+// ResiliencePolicy configures how the manager protects itself and a provider
+// from failing calls. InitiatePayment, VerifyPayment, RefundPayment,
+// GetStatus and the subscription methods apply it to every call they make to
+// the gateway.
+type ResiliencePolicy struct {
+	// Retry retries transient failures, see RetryPolicy
+	Retry RetryPolicy
+	// Circuit stops calling a gateway that keeps failing
+	Circuit CircuitPolicy
+	// RateLimit bounds the rate of calls to a gateway
+	RateLimit RateLimit
+	// Timeout bounds each attempt, however many HTTP requests the gateway
+	// makes for it (e.g. PayPal's token and order calls). It is the
+	// manager-level deadline; GatewayConfig.Timeout is the HTTP client's
+	// deadline for each single request. Both apply and the first to expire
+	// wins, so only set this one to bound a whole attempt. Zero leaves the
+	// deadline to the caller's context and the client timeout.
+	Timeout time.Duration
+}
+
+// CircuitPolicy opens a gateway's circuit after FailureThreshold consecutive
+// transient failures (see IsTransient). While it is open, calls fail with
+// ErrCircuitOpen. After OpenFor calls go through again: a success closes the
+// circuit and another transient failure reopens it. A zero FailureThreshold
+// disables the breaker.
+type CircuitPolicy struct {
+	FailureThreshold int
+	// OpenFor defaults to 30s
+	OpenFor time.Duration
+}
+
+// RateLimit allows PerSecond calls per second on average, in bursts of up
+// to Burst (default 1). Calls over the limit wait for their turn until their
+// context is done. A zero PerSecond is unlimited.
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// SetResiliencePolicy applies policy to the given methods, or to every
+// gateway without its own policy when no methods are given. A method's
+// policy replaces the global one as a whole.
+func (pm *PaymentManager) SetResiliencePolicy(policy ResiliencePolicy, methods ...string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.setResiliencePolicy(policy, methods...)
+}
+
+// setResiliencePolicy sets policy. Callers must hold pm.mu.
+func (pm *PaymentManager) setResiliencePolicy(policy ResiliencePolicy, methods ...string) {
+	if len(methods) == 0 {
+		pm.resilience = policy
+		return
+	}
+	for _, method := range methods {
+		pm.gatewayResilience[NormalizeMethod(method)] = policy
+	}
+}
+
+// WithResiliencePolicy applies policy to methods, or globally, see
+// SetResiliencePolicy
+func WithResiliencePolicy(policy ResiliencePolicy, methods ...string) ManagerOption {
+	return func(pm *PaymentManager) { pm.setResiliencePolicy(policy, methods...) }
+}
+
+// ResiliencePolicy returns the policy applied to method
+func (pm *PaymentManager) ResiliencePolicy(method string) ResiliencePolicy {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if policy, ok := pm.gatewayResilience[pm.resolveMethod(method)]; ok {
+		return policy
+	}
+	return pm.resilience
+}
+
+// guard prepares a call to method under its policy: it fails fast while the
+// circuit is open, waits for the rate limit, claims a concurrency slot and
+// applies the timeout to ctx. done must be called with the call's error.
+func (pm *PaymentManager) guard(ctx context.Context, method string) (context.Context, func(err error), error) {
+	policy := pm.ResiliencePolicy(method)
+	state := pm.resilienceStates.get(method)
+
+	if !state.allow(policy.Circuit, time.Now()) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrCircuitOpen, method)
+	}
+	if err := state.wait(ctx, policy.RateLimit, method); err != nil {
+		return nil, nil, err
+	}
+	release, err := pm.acquire(ctx, method)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if policy.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, policy.Timeout)
+	}
+	return ctx, func(err error) {
+		cancel()
+		release()
+		state.record(policy.Circuit, err, time.Now())
+	}, nil
+}
+
+// resilienceStates holds the circuit and rate limit state of each method
+type resilienceStates struct {
+	states map[string]*resilienceState
+	mu     sync.Mutex
+}
+
+func newResilienceStates() *resilienceStates {
+	return &resilienceStates{states: make(map[string]*resilienceState)}
+}
+
+func (s *resilienceStates) get(method string) *resilienceState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[method]
+	if !ok {
+		state = &resilienceState{}
+		s.states[method] = state
+	}
+	return state
+}
+
+// resilienceState is one method's circuit breaker and token bucket
+type resilienceState struct {
+	failures  int
+	openUntil time.Time
+
+	tokens   float64
+	refilled time.Time
+
+	mu sync.Mutex
+}
+
+// allow reports whether the circuit lets a call through at now
+func (s *resilienceState) allow(p CircuitPolicy, now time.Time) bool {
+	if p.FailureThreshold <= 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !now.Before(s.openUntil)
+}
+
+// record counts err towards opening the circuit
+func (s *resilienceState) record(p CircuitPolicy, err error, now time.Time) {
+	if p.FailureThreshold <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !IsTransient(err) {
+		s.failures = 0
+		s.openUntil = time.Time{}
+		return
+	}
+	s.failures++
+	if s.failures >= p.FailureThreshold {
+		openFor := p.OpenFor
+		if openFor <= 0 {
+			openFor = 30 * time.Second
+		}
+		s.openUntil = now.Add(openFor)
+	}
+}
+
+// wait takes a token from the bucket, waiting until one is available or ctx
+// is done
+func (s *resilienceState) wait(ctx context.Context, limit RateLimit, method string) error {
+	if limit.PerSecond <= 0 {
+		return nil
+	}
+	burst := float64(max(limit.Burst, 1))
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		if s.refilled.IsZero() {
+			s.tokens = burst
+		} else {
+			s.tokens = min(burst, s.tokens+now.Sub(s.refilled).Seconds()*limit.PerSecond)
+		}
+		s.refilled = now
+		if s.tokens >= 1 {
+			s.tokens--
+			s.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - s.tokens) / limit.PerSecond * float64(time.Second))
+		s.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w: %s rate limit: %w", ErrTooManyRequests, method, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// hangingGateway reports the status only once ctx is done
+type hangingGateway struct {
+	fakeGateway
+}
+
+func (g *hangingGateway) GetStatus(ctx context.Context, req *StatusRequest) (*StatusResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	unavailable := ErrorFromHTTPStatus("fake", http.StatusServiceUnavailable, "HTTP 503")
+	g := &flakyGateway{fakeGateway: fakeGateway{method: "fake"}, err: unavailable, failures: 3}
+	pm := NewPaymentManagerWithOptions(WithResiliencePolicy(ResiliencePolicy{
+		Circuit: CircuitPolicy{FailureThreshold: 2, OpenFor: 20 * time.Millisecond},
+	}, "Fake"))
+	pm.RegisterGateway("fake", g)
+
+	for range 2 {
+		if _, err := pm.GetStatus(ctx, "fake", &StatusRequest{TransactionID: "t1"}); !errors.Is(err, unavailable) {
+			t.Fatalf("Expected the gateway's error, got %v", err)
+		}
+	}
+	if _, err := pm.GetStatus(ctx, "fake", &StatusRequest{TransactionID: "t1"}); !errors.Is(err, ErrCircuitOpen) || g.calls != 2 {
+		t.Fatalf("Expected ErrCircuitOpen without a call, got %v after %d calls", err, g.calls)
+	}
+	if status := HTTPStatusForError(fmt.Errorf("%w: fake", ErrCircuitOpen)); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", status)
+	}
+
+	// A failure once the circuit half-opens reopens it; a success closes it
+	time.Sleep(25 * time.Millisecond)
+	if _, err := pm.GetStatus(ctx, "fake", &StatusRequest{TransactionID: "t1"}); !errors.Is(err, unavailable) || g.calls != 3 {
+		t.Fatalf("Expected a call once the circuit half-opens, got %v after %d calls", err, g.calls)
+	}
+	if _, err := pm.GetStatus(ctx, "fake", &StatusRequest{TransactionID: "t1"}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected the circuit to reopen, got %v", err)
+	}
+	time.Sleep(25 * time.Millisecond)
+	for range 2 {
+		if _, err := pm.GetStatus(ctx, "fake", &StatusRequest{TransactionID: "t1"}); err != nil {
+			t.Fatalf("Expected the circuit to close, got %v", err)
+		}
+	}
+}
+
+func TestResiliencePolicyPerMethod(t *testing.T) {
+	global := ResiliencePolicy{Retry: RetryPolicy{MaxAttempts: 3}}
+	own := ResiliencePolicy{Timeout: time.Second}
+	pm := NewPaymentManagerWithOptions(WithResiliencePolicy(global), WithResiliencePolicy(own, "stripe"))
+	pm.RegisterAlias("card", "stripe")
+
+	if got := pm.ResiliencePolicy("esewa"); got != global {
+		t.Errorf("Expected the global policy, got %+v", got)
+	}
+	if got := pm.ResiliencePolicy("card"); got != own {
+		t.Errorf("Expected stripe's own policy, got %+v", got)
+	}
+	pm.SetRetryPolicy(RetryPolicy{MaxAttempts: 5})
+	if pm.ResiliencePolicy("esewa").Retry.MaxAttempts != 5 || pm.ResiliencePolicy("stripe").Retry.MaxAttempts != 0 {
+		t.Error("SetRetryPolicy should only change the global policy")
+	}
+}
+
+func TestResiliencePolicyTimeout(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &hangingGateway{fakeGateway{method: "fake"}})
+	pm.SetResiliencePolicy(ResiliencePolicy{Timeout: 10 * time.Millisecond})
+
+	start := time.Now()
+	if _, err := pm.GetStatus(context.Background(), "fake", &StatusRequest{TransactionID: "t1"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the policy deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the call to end after 10ms, took %s", elapsed)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+	pm.SetResiliencePolicy(ResiliencePolicy{RateLimit: RateLimit{PerSecond: 50, Burst: 2}})
+
+	start := time.Now()
+	for range 4 {
+		if _, err := pm.GetStatus(context.Background(), "fake", &StatusRequest{TransactionID: "t1"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected 2 calls over the burst to wait 40ms, took %s", elapsed)
+	}
+
+	// The first call to a fresh gateway takes the burst
+	pm.RegisterGateway("slow", &fakeGateway{method: "slow"})
+	pm.SetResiliencePolicy(ResiliencePolicy{RateLimit: RateLimit{PerSecond: 0.001}}, "slow")
+	if _, err := pm.GetStatus(context.Background(), "slow", &StatusRequest{TransactionID: "t1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := pm.GetStatus(ctx, "slow", &StatusRequest{TransactionID: "t1"}); !errors.Is(err, ErrTooManyRequests) {
+		t.Errorf("Expected ErrTooManyRequests once the context is done, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+)
+
+// ErrPaymentExpired is returned by Resumer implementations when the
+// provider session can no longer be used and a new payment is needed
+var ErrPaymentExpired = errors.New("payment session expired")
+
+// Resumer is implemented by gateways that can reopen an unpaid payment,
+// e.g. by fetching the provider session's current URL. ResumePayment
+// returns ErrPaymentExpired if the session can't be reused.
+type Resumer interface {
+	ResumePayment(ctx context.Context, txn *Transaction) (*PaymentResponse, error)
+}
+
+// OrderStore is implemented by TransactionStores that can look transactions
+// up by order id
+type OrderStore interface {
+	// GetByOrderID returns the most recently created transaction for orderID
+	GetByOrderID(orderID string) (*Transaction, error)
+}
+
+// ResumePayment returns the payment to continue for an unpaid order: the
+// existing payment when it is still valid, or a new one created from the
+// original request when it has expired or failed. The transaction store must
+// implement OrderStore. Orders that are already paid are rejected.
+func (pm *PaymentManager) ResumePayment(ctx context.Context, method, orderID string) (*PaymentResponse, error) {
+	orders, ok := pm.GetTransactionStore().(OrderStore)
+	if !ok {
+		return nil, NewPaymentError(ErrKindUnsupported, method, "transaction store cannot look up orders", nil)
+	}
+	txn, err := orders.GetByOrderID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	switch txn.Status {
+	case StatusCompleted, StatusRefunded, StatusPartiallyRefunded, StatusAuthorized:
+		return nil, NewPaymentError(ErrKindValidation, method, "order "+orderID+" is already paid", nil)
+	}
+	if txn.Request == nil {
+		return nil, NewPaymentError(ErrKindUnsupported, method, "order "+orderID+" was not recorded with its request", nil)
+	}
+	g, err := pm.GetGatewayAccount(method, txn.Metadata[MetadataAccount])
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if txn.Status == StatusPending && (txn.ExpiresAt.IsZero() || now.Before(txn.ExpiresAt)) {
+		resp, err := pm.reopenPayment(ctx, g, txn)
+		if err == nil {
+			resp.Resumed = true
+			resp.TestMode = IsTestMode(g)
+			return resp, nil
+		}
+		if !errors.Is(err, ErrPaymentExpired) {
+			return nil, err
+		}
+	}
+
+	// Replace the stale payment, keeping the original expiry window
+	if txn.Status == StatusPending {
+		pm.updateTransaction(txn.ID, func(t *Transaction) { t.Status = StatusCanceled })
+	}
+	// A fresh key, so providers don't replay the stale payment
+	req := *txn.Request
+	req.IdempotencyKey = DefaultIdempotencyKey(method, orderID) + "-" + txn.ID
+	if !req.ExpiresAt.IsZero() {
+		req.ExpiresAt = now.Add(req.ExpiresAt.Sub(txn.CreatedAt))
+	}
+	return pm.InitiatePayment(ctx, method, &req)
+}
+
+// reopenPayment asks g to resume txn, falling back to its recorded URL
+func (pm *PaymentManager) reopenPayment(ctx context.Context, g Gateway, txn *Transaction) (*PaymentResponse, error) {
+	if r, ok := UnwrapGateway(g).(Resumer); ok {
+		release, err := pm.acquire(ctx, g.GetMethod())
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return r.ResumePayment(ctx, txn)
+	}
+	if txn.PaymentURL == "" {
+		return nil, ErrPaymentExpired
+	}
+	return &PaymentResponse{
+		Success:       true,
+		PaymentURL:    txn.PaymentURL,
+		TransactionID: txn.ProviderID(),
+		SessionID:     txn.SessionID,
+		OrderID:       txn.OrderID,
+	}, nil
+}
+
+func (s *MemoryTransactionStore) GetByOrderID(orderID string) (*Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matches := []*Transaction{}
+	for _, txn := range s.txns {
+		if txn.OrderID == orderID {
+			matches = append(matches, txn)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, ErrTransactionNotFound
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].CreatedAt.Before(matches[j].CreatedAt)
+	})
+	cp := *matches[len(matches)-1]
+	cp.Refunds = slices.Clone(cp.Refunds)
+	return &cp, nil
+}
@@ -0,0 +1,109 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy retries gateway calls that fail transiently, see IsTransient.
+// VerifyPayment and GetStatus are always retried under it; InitiatePayment
+// only for gateways that forward the idempotency key to their provider, see
+// IdempotencyKeyForwarder, so a retry can't charge the customer twice. The
+// zero value makes a single attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry, doubled after each
+	// attempt. It defaults to 200ms.
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between attempts. It defaults to 5s.
+	MaxDelay time.Duration
+	// Jitter randomizes each wait by up to this fraction of it, e.g. 0.2
+	// for ±20%, so clients don't retry in lockstep
+	Jitter float64
+}
+
+// delay returns the wait before retry number attempt, counting from 1
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	base := p.BaseDelay
+	if base <= 0 {
+		base = 200 * time.Millisecond
+	}
+	maxDelay := p.maxDelay()
+	d := base
+	for i := 1; i < attempt && d < maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, maxDelay)
+	if p.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(d))
+	}
+	return max(d, 0)
+}
+
+// maxDelay returns MaxDelay or its default
+func (p RetryPolicy) maxDelay() time.Duration {
+	if p.MaxDelay <= 0 {
+		return 5 * time.Second
+	}
+	return p.MaxDelay
+}
+
+// IsTransient reports whether err is a failure worth retrying: a network
+// error, a timeout, or a 429 or 5xx response from the provider. A
+// Stripe-Should-Retry header on the response overrides the status.
+// Cancellation of the caller's context is not transient.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var perr *PaymentError
+	if !errors.As(err, &perr) {
+		return false
+	}
+	switch perr.Headers[HeaderStripeShouldRetry] {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return perr.Kind == ErrKindProvider || perr.Kind == ErrKindTimeout
+}
+
+// SetRetryPolicy sets the retry policy for transient gateway failures. It
+// is the Retry of the global ResiliencePolicy; gateways with their own
+// policy keep its Retry.
+func (pm *PaymentManager) SetRetryPolicy(policy RetryPolicy) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.resilience.Retry = policy
+}
+
+// retryTransient calls fn until it succeeds, fails with an error that isn't
+// transient, or the policy's attempts run out. A provider's Retry-After
+// lengthens the wait, and one longer than MaxDelay ends the retries. ctx
+// being done ends the waits between attempts; the last result is returned.
+func retryTransient[T any](ctx context.Context, policy RetryPolicy, fn func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := fn()
+		if attempt >= policy.MaxAttempts || !IsTransient(err) {
+			return result, err
+		}
+		delay := policy.delay(attempt)
+		if after, ok := RetryAfter(err); ok {
+			if after > policy.maxDelay() {
+				return result, err
+			}
+			delay = max(delay, after)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/money"
+)
+
+// flakyGateway fails every call with err until it has failed failures times
+type flakyGateway struct {
+	fakeGateway
+	err      error
+	failures int
+	calls    int
+}
+
+func (g *flakyGateway) fail() error {
+	g.calls++
+	if g.calls <= g.failures {
+		return g.err
+	}
+	return nil
+}
+
+func (g *flakyGateway) InitiatePayment(ctx context.Context, req *PaymentRequest) (*PaymentResponse, error) {
+	if err := g.fail(); err != nil {
+		return nil, err
+	}
+	return g.fakeGateway.InitiatePayment(ctx, req)
+}
+
+func (g *flakyGateway) VerifyPayment(ctx context.Context, req *VerificationRequest) (*VerificationResponse, error) {
+	if err := g.fail(); err != nil {
+		return nil, err
+	}
+	return g.fakeGateway.VerifyPayment(ctx, req)
+}
+
+func (g *flakyGateway) GetStatus(ctx context.Context, req *StatusRequest) (*StatusResponse, error) {
+	if err := g.fail(); err != nil {
+		return nil, err
+	}
+	return g.fakeGateway.GetStatus(ctx, req)
+}
+
+// forwardingGateway is a flakyGateway whose provider deduplicates by
+// idempotency key
+type forwardingGateway struct {
+	flakyGateway
+}
+
+func (g *forwardingGateway) ForwardsIdempotencyKey() bool { return true }
+
+func TestRetryPolicy(t *testing.T) {
+	ctx := context.Background()
+	unavailable := ErrorFromHTTPStatus("fake", http.StatusServiceUnavailable, "HTTP 503")
+	g := &flakyGateway{fakeGateway: fakeGateway{method: "fake"}, err: unavailable, failures: 2}
+	pm := NewPaymentManagerWithOptions(WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+	pm.RegisterGateway("fake", g)
+
+	if _, err := pm.GetStatus(ctx, "fake", &StatusRequest{TransactionID: "t1"}); err != nil || g.calls != 3 {
+		t.Errorf("Expected GetStatus to succeed on the third attempt, got %v after %d calls", err, g.calls)
+	}
+
+	g.calls = 0
+	if _, err := pm.VerifyPayment(ctx, "fake", &VerificationRequest{TransactionID: "t1"}); err != nil || g.calls != 3 {
+		t.Errorf("Expected VerifyPayment to succeed on the third attempt, got %v after %d calls", err, g.calls)
+	}
+
+	// Initiation is retried only by gateways that forward the idempotency key
+	g.calls = 0
+	req := &PaymentRequest{OrderID: "O1", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL, IdempotencyKey: "key-1"}
+	if _, err := pm.InitiatePayment(ctx, "fake", req); !errors.Is(err, unavailable) || g.calls != 1 {
+		t.Errorf("Expected a single attempt when the key isn't forwarded, got %v after %d calls", err, g.calls)
+	}
+	fwd := &forwardingGateway{flakyGateway{fakeGateway: fakeGateway{method: "fwd"}, err: unavailable, failures: 2}}
+	pm.RegisterGateway("fwd", fwd)
+	req.IdempotencyKey = ""
+	if _, err := pm.InitiatePayment(ctx, "fwd", req); err != nil || fwd.calls != 3 {
+		t.Errorf("Expected InitiatePayment to succeed on the third attempt, got %v after %d calls", err, fwd.calls)
+	}
+
+	// Attempts run out
+	g.calls, g.failures = 0, 5
+	if _, err := pm.GetStatus(ctx, "fake", &StatusRequest{TransactionID: "t1"}); !errors.Is(err, unavailable) || g.calls != 3 {
+		t.Errorf("Expected the last error after 3 attempts, got %v after %d calls", err, g.calls)
+	}
+
+	// Errors that aren't transient are returned at once
+	g.calls, g.err = 0, ErrorFromHTTPStatus("fake", http.StatusBadRequest, "HTTP 400")
+	if _, err := pm.GetStatus(ctx, "fake", &StatusRequest{TransactionID: "t1"}); err == nil || g.calls != 1 {
+		t.Errorf("Expected a single attempt for a 400, got %v after %d calls", err, g.calls)
+	}
+}
+
+func TestRetryPolicyHonorsContext(t *testing.T) {
+	g := &flakyGateway{fakeGateway: fakeGateway{method: "fake"}, err: WrapTransportError("fake", errors.New("connection reset")), failures: 5}
+	pm := NewPaymentManagerWithOptions(WithRetryPolicy(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour}))
+	pm.RegisterGateway("fake", g)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pm.GetStatus(ctx, "fake", &StatusRequest{TransactionID: "t1"}); !IsTransient(err) || g.calls != 1 {
+		t.Errorf("Expected the first error once the context is done, got %v after %d calls", err, g.calls)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 40: time.Second} {
+		if got := p.delay(attempt); got != want {
+			t.Errorf("delay(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for range 100 {
+		if d := p.delay(2); d < 100*time.Millisecond || d > 300*time.Millisecond {
+			t.Fatalf("delay(2) with jitter = %s, want within 100ms-300ms", d)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// ErrInvalidCallbackSignature is returned when the signature a gateway
+// appended to the return URL doesn't match the signed fields, i.e. the
+// redirect was tampered with
+var ErrInvalidCallbackSignature = errors.New("invalid callback signature")
+
+// ReturnURLParser is implemented by gateways that know the query parameters
+// they append to the success/return URL
+type ReturnURLParser interface {
+	ParseReturnURL(values url.Values) (*VerificationRequest, error)
+}
+
+// ParseReturnURL builds a VerificationRequest from the query parameters a
+// gateway appended to the return URL
+func (pm *PaymentManager) ParseReturnURL(method string, values url.Values) (*VerificationRequest, error) {
+	g, err := pm.GetGateway(method)
+	if err != nil {
+		return nil, err
+	}
+	parser, ok := UnwrapGateway(g).(ReturnURLParser)
+	if !ok {
+		return nil, fmt.Errorf("gateway %s does not support return URL parsing", method)
+	}
+	return parser.ParseReturnURL(values)
+}
+
+// ValuesToRawData flattens query values into a RawData map, keeping the first
+// value of each key
+func ValuesToRawData(values url.Values) map[string]string {
+	raw := make(map[string]string, len(values))
+	for k := range values {
+		raw[k] = values.Get(k)
+	}
+	return raw
+}
@@ -0,0 +1,75 @@
+package payment
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// SetRoutingWeights splits traffic for a country between gateways in
+// proportion to their weights, e.g. {"khalti": 70, "esewa": 30}. It is used
+// by SelectWeightedGateway and InitiatePaymentForCountry. Calling it with no
+// weights restores priority routing.
+func (pm *PaymentManager) SetRoutingWeights(country Country, weights map[string]int) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if len(weights) == 0 {
+		delete(pm.weights, country)
+		return
+	}
+	cp := make(map[string]int, len(weights))
+	for method, weight := range weights {
+		cp[NormalizeMethod(method)] = weight
+	}
+	pm.weights[country] = cp
+}
+
+// SetRoutingSeed reseeds the random source used for weighted routing, so
+// selections are reproducible in tests
+func (pm *PaymentManager) SetRoutingSeed(seed uint64) {
+	pm.routingMu.Lock()
+	defer pm.routingMu.Unlock()
+	pm.routingRand = rand.New(rand.NewPCG(seed, seed))
+}
+
+// SelectWeightedGateway picks a configured gateway available in country at
+// random, in proportion to the country's routing weights. Gateways without a
+// positive weight are never picked. Without weights, or if no weighted
+// gateway is available, it returns GetRecommendedGateway.
+func (pm *PaymentManager) SelectWeightedGateway(country Country) (string, error) {
+	pm.mu.RLock()
+	weights := pm.weights[country]
+	pm.mu.RUnlock()
+	if len(weights) == 0 {
+		return pm.GetRecommendedGateway(country)
+	}
+
+	// Walk available gateways in priority order so selection is stable for a seed
+	candidates := []string{}
+	total := 0
+	for _, method := range pm.GetAvailableGatewaysForCountry(country) {
+		if w := weights[method]; w > 0 {
+			candidates = append(candidates, method)
+			total += w
+		}
+	}
+	if total == 0 {
+		return pm.GetRecommendedGateway(country)
+	}
+
+	pm.routingMu.Lock()
+	if pm.routingRand == nil {
+		seed := uint64(time.Now().UnixNano())
+		pm.routingRand = rand.New(rand.NewPCG(seed, seed))
+	}
+	n := pm.routingRand.IntN(total)
+	pm.routingMu.Unlock()
+
+	for _, method := range candidates {
+		if n -= weights[method]; n < 0 {
+			return method, nil
+		}
+	}
+	return "", fmt.Errorf("no gateways available for country %s", country)
+}
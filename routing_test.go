@@ -0,0 +1,108 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/oarkflow/money"
+)
+
+func TestSelectWeightedGateway(t *testing.T) {
+	pm := NewPaymentManager(0)
+	registry := pm.GetRegistry()
+	registry.RegisterCountryGateway(CountryNepal, "esewa", 1)
+	registry.RegisterCountryGateway(CountryNepal, "khalti", 2)
+	registry.RegisterCountryGateway(CountryNepal, "imepay", 3)
+	pm.RegisterGateway("esewa", &fakeGateway{method: "esewa"})
+	pm.RegisterGateway("khalti", &fakeGateway{method: "khalti"})
+	pm.RegisterGateway("imepay", &fakeGateway{method: "imepay"})
+
+	// Without weights, priority wins
+	if method, _ := pm.SelectWeightedGateway(CountryNepal); method != "esewa" {
+		t.Errorf("Expected esewa, got %s", method)
+	}
+
+	pm.SetRoutingWeights(CountryNepal, map[string]int{"khalti": 70, "esewa": 30, "unconfigured": 100})
+	pm.SetRoutingSeed(42)
+	counts := map[string]int{}
+	const n = 10000
+	for i := 0; i < n; i++ {
+		method, err := pm.SelectWeightedGateway(CountryNepal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[method]++
+	}
+	if counts["imepay"] != 0 || counts["unconfigured"] != 0 {
+		t.Errorf("Unweighted or unconfigured gateways were selected: %v", counts)
+	}
+	if share := float64(counts["khalti"]) / n; share < 0.67 || share > 0.73 {
+		t.Errorf("Expected ~70%% khalti, got %.2f (%v)", share, counts)
+	}
+
+	// The same seed reproduces the same sequence
+	sequence := func() []string {
+		pm.SetRoutingSeed(7)
+		picks := []string{}
+		for i := 0; i < 20; i++ {
+			method, _ := pm.SelectWeightedGateway(CountryNepal)
+			picks = append(picks, method)
+		}
+		return picks
+	}
+	first, second := sequence(), sequence()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Seeded selections differ: %v vs %v", first, second)
+		}
+	}
+
+	pm.SetRoutingWeights(CountryNepal, nil)
+	if method, _ := pm.SelectWeightedGateway(CountryNepal); method != "esewa" {
+		t.Errorf("Expected priority routing after clearing weights, got %s", method)
+	}
+}
+
+func TestInitiatePaymentForCountryRecordsMethod(t *testing.T) {
+	pm := NewPaymentManager(0)
+	registry := pm.GetRegistry()
+	registry.RegisterCountryGateway(CountryNepal, "esewa", 1)
+	registry.RegisterCountryGateway(CountryNepal, "khalti", 2)
+	pm.RegisterGateway("esewa", &fakeGateway{method: "esewa"})
+	pm.RegisterGateway("khalti", &fakeGateway{method: "khalti"})
+	pm.SetTransactionStore(NewMemoryTransactionStore())
+	pm.SetRoutingWeights(CountryNepal, map[string]int{"esewa": 50, "khalti": 50})
+	ctx := context.Background()
+
+	amount := money.New(100, money.MustCurrency("NPR"))
+	if _, err := pm.InitiatePaymentForCountry(ctx, CountryNepal, &PaymentRequest{OrderID: "O1", Amount: amount, SuccessURL: testSuccessURL}); err != nil {
+		t.Fatal(err)
+	}
+	method, ok := pm.GetMethodForOrder("O1")
+	if !ok {
+		t.Fatal("Expected the method to be recorded for O1")
+	}
+
+	// Retries of a live order stay on the same gateway
+	for i := 0; i < 20; i++ {
+		if _, err := pm.InitiatePaymentForCountry(ctx, CountryNepal, &PaymentRequest{OrderID: "O1", Amount: amount, SuccessURL: testSuccessURL}); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := pm.GetMethodForOrder("O1"); got != method {
+			t.Fatalf("Retry %d routed to %s, expected %s", i, got, method)
+		}
+	}
+
+	resp, err := pm.VerifyPaymentForOrder(ctx, &VerificationRequest{OrderID: "O1", TransactionID: "txn-O1", Amount: amount})
+	if err != nil || resp.Status != StatusCompleted {
+		t.Fatalf("Expected completed verification, got %v, %v", resp, err)
+	}
+
+	if _, ok := pm.GetMethodForOrder("unknown"); ok {
+		t.Error("Expected no method for an unknown order")
+	}
+	if _, err := pm.VerifyPaymentForOrder(ctx, &VerificationRequest{OrderID: "unknown"}); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("Expected ErrTransactionNotFound, got %v", err)
+	}
+}
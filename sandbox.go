@@ -0,0 +1,46 @@
+package payment
+
+import (
+	"context"
+
+	"github.com/oarkflow/money"
+)
+
+// SandboxOutcome is a simulated result triggered by a magic test amount
+type SandboxOutcome string
+
+const (
+	SandboxDecline           SandboxOutcome = "decline"
+	SandboxInsufficientFunds SandboxOutcome = "insufficient_funds"
+	SandboxTimeout           SandboxOutcome = "timeout"
+)
+
+// DefaultSandboxAmounts are the magic amounts, in minor units, used when
+// GatewayConfig.SandboxAmounts is nil
+var DefaultSandboxAmounts = map[int64]SandboxOutcome{
+	51: SandboxDecline,
+	52: SandboxInsufficientFunds,
+	53: SandboxTimeout,
+}
+
+// SandboxError returns the simulated error for amount when config is in
+// sandbox mode and the amount is mapped to an outcome. It returns nil
+// otherwise, so simulated gateways can call it unconditionally.
+func SandboxError(config *GatewayConfig, method string, amount money.Money) error {
+	if config == nil || !config.Sandbox {
+		return nil
+	}
+	amounts := config.SandboxAmounts
+	if amounts == nil {
+		amounts = DefaultSandboxAmounts
+	}
+	switch amounts[amount.Minor()] {
+	case SandboxDecline:
+		return NewPaymentError(ErrKindDeclined, method, "sandbox: card declined", nil)
+	case SandboxInsufficientFunds:
+		return NewPaymentError(ErrKindDeclined, method, "sandbox: insufficient funds", nil)
+	case SandboxTimeout:
+		return NewPaymentError(ErrKindTimeout, method, "sandbox: provider timed out", context.DeadlineExceeded)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package payment
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SecretResolver resolves secret references such as "vault://stripe/key" to
+// their values, e.g. from Vault or a cloud KMS
+type SecretResolver interface {
+	Resolve(ref string) (string, error)
+}
+
+// SecretResolverFunc adapts a function to SecretResolver
+type SecretResolverFunc func(ref string) (string, error)
+
+func (f SecretResolverFunc) Resolve(ref string) (string, error) { return f(ref) }
+
+// IsSecretRef reports whether value is a secret reference: a
+// "scheme://path" value whose scheme is not http or https
+func IsSecretRef(value string) bool {
+	scheme, rest, ok := strings.Cut(value, "://")
+	if !ok || scheme == "" || rest == "" || scheme == "http" || scheme == "https" {
+		return false
+	}
+	for _, r := range scheme {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveSecrets returns config with the secret references in MerchantID,
+// SecretKey, APIKey and WebhookSecret replaced by their values. config is
+// returned unchanged when it holds no references; otherwise a copy is
+// returned so the references are never overwritten.
+func resolveSecrets(resolver SecretResolver, config *GatewayConfig) (*GatewayConfig, error) {
+	if resolver == nil || config == nil {
+		return config, nil
+	}
+	fields := []struct {
+		name  string
+		value func(*GatewayConfig) *string
+	}{
+		{"MerchantID", func(c *GatewayConfig) *string { return &c.MerchantID }},
+		{"SecretKey", func(c *GatewayConfig) *string { return &c.SecretKey }},
+		{"APIKey", func(c *GatewayConfig) *string { return &c.APIKey }},
+		{"WebhookSecret", func(c *GatewayConfig) *string { return &c.WebhookSecret }},
+	}
+
+	var resolved *GatewayConfig
+	for _, f := range fields {
+		ref := *f.value(config)
+		if !IsSecretRef(ref) {
+			continue
+		}
+		secret, err := resolver.Resolve(ref)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", f.name, err)
+		}
+		if resolved == nil {
+			cp := *config
+			resolved = &cp
+		}
+		*f.value(resolved) = secret
+	}
+	if resolved == nil {
+		return config, nil
+	}
+	return resolved, nil
+}
+
+// SetSecretResolver resolves secret references in GatewayConfig when
+// gateways are registered from a factory. Gateways keep the values resolved
+// at registration; register them again to pick up rotated secrets.
+func (pm *PaymentManager) SetSecretResolver(resolver SecretResolver) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.secrets = resolver
+}
@@ -0,0 +1,52 @@
+package payment
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestIsSecretRef(t *testing.T) {
+	for value, want := range map[string]bool{
+		"vault://stripe/key":     true,
+		"aws-kms://alias/stripe": true,
+		"sk_test_123":            false,
+		"https://example.com":    false,
+		"vault://":               false,
+		"://key":                 false,
+	} {
+		if got := IsSecretRef(value); got != want {
+			t.Errorf("IsSecretRef(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestSecretResolver(t *testing.T) {
+	pm := NewPaymentManager(0)
+	var built *GatewayConfig
+	pm.RegisterFactory("fake", func(config *GatewayConfig, client *http.Client) Gateway {
+		built = config
+		return &fakeGateway{method: "fake"}
+	})
+	pm.SetSecretResolver(SecretResolverFunc(func(ref string) (string, error) {
+		if ref == "vault://missing" {
+			return "", errors.New("not found")
+		}
+		return "resolved:" + ref, nil
+	}))
+
+	config := &GatewayConfig{MerchantID: "M1", SecretKey: "vault://fake/secret", BaseURL: "https://api.example"}
+	if err := pm.RegisterGatewayWithConfig("fake", config); err != nil {
+		t.Fatal(err)
+	}
+	if built.SecretKey != "resolved:vault://fake/secret" || built.MerchantID != "M1" || built.BaseURL != "https://api.example" {
+		t.Errorf("Unexpected resolved config %+v", built)
+	}
+	if config.SecretKey != "vault://fake/secret" {
+		t.Errorf("Expected the caller's reference to be kept, got %q", config.SecretKey)
+	}
+
+	if err := pm.RegisterGatewayWithConfig("fake", &GatewayConfig{APIKey: "vault://missing"}); err == nil {
+		t.Error("Expected a resolution error")
+	}
+}
@@ -0,0 +1,26 @@
+package setup
+
+import "github.com/oarkflow/payment"
+
+// SandboxConfigs returns sandbox configurations for the gateways that publish
+// shared test credentials: eSewa's EPAYTEST merchant and Khalti's test keys.
+//
+// TEST ONLY. These credentials are public and only work against the
+// providers' sandboxes; never use them for live payments. Each call returns
+// fresh configs, so they can be modified before use:
+//
+//	pm := setup.SetupPaymentManagerWithDefaults(setup.SandboxConfigs())
+func SandboxConfigs() map[string]*payment.GatewayConfig {
+	return map[string]*payment.GatewayConfig{
+		"esewa": {
+			MerchantID: "EPAYTEST",
+			SecretKey:  "8gBm/:&EnhH.1/q",
+			Sandbox:    true,
+		},
+		"khalti": {
+			SecretKey: "test_secret_key_68791341fdd94846a146f0457ff7b455",
+			APIKey:    "test_public_key_979320ffda734d8e9f7758ac39ec775f",
+			Sandbox:   true,
+		},
+	}
+}
@@ -7,111 +7,168 @@ import (
 	"github.com/oarkflow/payment"
 	"github.com/oarkflow/payment/gateways/connectips"
 	"github.com/oarkflow/payment/gateways/esewa"
+	"github.com/oarkflow/payment/gateways/fake"
 	"github.com/oarkflow/payment/gateways/imepay"
 	"github.com/oarkflow/payment/gateways/khalti"
+	"github.com/oarkflow/payment/gateways/mpesa"
 	"github.com/oarkflow/payment/gateways/paypal"
+	"github.com/oarkflow/payment/gateways/paytm"
+	"github.com/oarkflow/payment/gateways/phonepe"
 	"github.com/oarkflow/payment/gateways/razorpay"
 	"github.com/oarkflow/payment/gateways/stripe"
 )
 
+// Option configures the payment managers built by the setup helpers
+type Option func(*options)
+
+type options struct {
+	fakeGateway bool
+}
+
+// WithFakeGateway registers the "fake" gateway factory for local
+// development. The fake gateway completes payments without contacting a
+// provider; never enable it in production.
+func WithFakeGateway() Option {
+	return func(o *options) { o.fakeGateway = true }
+}
+
 // SetupPaymentManager creates a fully configured payment manager with all gateways
-func SetupPaymentManager(configs map[string]*payment.GatewayConfig) *payment.PaymentManager {
+func SetupPaymentManager(configs map[string]*payment.GatewayConfig, opts ...Option) *payment.PaymentManager {
 	pm := payment.NewPaymentManager(30 * time.Second)
+	registerFactories(pm, opts)
 
-	// Register built-in gateway factories - Nepal gateways
+	// Register gateways with provided configs
+	for method, config := range configs {
+		if err := pm.RegisterGatewayWithConfig(method, config); err != nil {
+			log.Printf("Error registering gateway %s: %v", method, err)
+			continue
+		}
+	}
+
+	return pm
+}
+
+// SetupPaymentManagerConcurrently is like SetupPaymentManager but creates the
+// gateways in parallel and returns every configuration error instead of
+// logging it. The manager is returned with the gateways that did build.
+func SetupPaymentManagerConcurrently(configs map[string]*payment.GatewayConfig, opts ...Option) (*payment.PaymentManager, error) {
+	pm := payment.NewPaymentManager(30 * time.Second)
+	registerFactories(pm, opts)
+	return pm, pm.RegisterGatewaysWithConfig(configs)
+}
+
+// registerFactories registers the built-in gateway factories, and the fake
+// gateway when opts enable it
+func registerFactories(pm *payment.PaymentManager, opts []Option) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Nepal gateways
 	pm.RegisterFactory("esewa", esewa.New)
 	pm.RegisterFactory("khalti", khalti.New)
 	pm.RegisterFactory("imepay", imepay.New)
 	pm.RegisterFactory("connectips", connectips.New)
 
-	// Register international gateway factories
+	// International gateways
 	pm.RegisterFactory("stripe", stripe.New)
 	pm.RegisterFactory("paypal", paypal.New)
 	pm.RegisterFactory("razorpay", razorpay.New)
+	pm.RegisterFactory("paytm", paytm.New)
+	pm.RegisterFactory("phonepe", phonepe.New)
 
-	// Register gateways with provided configs
-	for method, config := range configs {
-		if err := pm.RegisterGatewayWithConfig(method, config); err != nil {
-			log.Printf("Error registering gateway %s: %v", method, err)
-			continue
-		}
-	}
+	// African gateways
+	pm.RegisterFactory("mpesa", mpesa.New)
 
-	return pm
+	// Local development only
+	if o.fakeGateway {
+		pm.RegisterFactory("fake", fake.New)
+	}
 }
+
 // SetupPaymentManagerWithRegistry creates a payment manager with custom registry
 func SetupPaymentManagerWithRegistry(
 	configs map[string]*payment.GatewayConfig,
 	registry *payment.GatewayRegistry,
+	opts ...Option,
 ) *payment.PaymentManager {
-	pm := SetupPaymentManager(configs)
+	pm := SetupPaymentManager(configs, opts...)
 	pm.SetRegistry(registry)
 	return pm
 }
 
+// defaultGatewayEntries returns the country and region mappings used by the
+// setup helpers, based on actual payment gateway support in each country
+func defaultGatewayEntries() []payment.GatewayEntry {
+	country := func(c payment.Country, method string, priority int) payment.GatewayEntry {
+		return payment.GatewayEntry{Scope: payment.ScopeCountry, Target: string(c), Method: method, Priority: priority}
+	}
+	region := func(r payment.Region, method string, priority int) payment.GatewayEntry {
+		return payment.GatewayEntry{Scope: payment.ScopeRegion, Target: string(r), Method: method, Priority: priority}
+	}
+
+	return []payment.GatewayEntry{
+		// Nepal-specific payment gateways
+		// Note: Stripe, PayPal, Wise do NOT support receiving payments in Nepal
+		country(payment.CountryNepal, "esewa", 1),
+		country(payment.CountryNepal, "khalti", 2),
+		country(payment.CountryNepal, "imepay", 3),
+		country(payment.CountryNepal, "connectips", 4),
+
+		// India-specific payment gateways
+		country(payment.CountryIndia, "razorpay", 1),
+		country(payment.CountryIndia, "paytm", 2),
+
+		// USA, Canada and UK payment gateways
+		country(payment.CountryUSA, "stripe", 1),
+		country(payment.CountryUSA, "paypal", 2),
+		country(payment.CountryCanada, "stripe", 1),
+		country(payment.CountryCanada, "paypal", 2),
+		country(payment.CountryUK, "stripe", 1),
+		country(payment.CountryUK, "paypal", 2),
+
+		// North America (US, Canada supported)
+		region(payment.RegionNorthAmerica, "stripe", 1),
+		region(payment.RegionNorthAmerica, "paypal", 2),
+
+		// Europe (most European countries supported)
+		region(payment.RegionEurope, "stripe", 1),
+		region(payment.RegionEurope, "paypal", 2),
+
+		// Oceania (Australia, New Zealand)
+		region(payment.RegionOceania, "stripe", 1),
+		region(payment.RegionOceania, "paypal", 2),
+	}
+}
+
 // createDefaultRegistry creates a registry with default country and region mappings
-// Based on actual payment gateway support in each country
 func createDefaultRegistry() *payment.GatewayRegistry {
 	registry := payment.NewGatewayRegistry()
-
-	// Register Nepal-specific payment gateways
-	// Note: Stripe, PayPal, Wise do NOT support receiving payments in Nepal
-	registry.RegisterCountryGateway(payment.CountryNepal, "esewa", 1)
-	registry.RegisterCountryGateway(payment.CountryNepal, "khalti", 2)
-	registry.RegisterCountryGateway(payment.CountryNepal, "imepay", 3)
-	registry.RegisterCountryGateway(payment.CountryNepal, "connectips", 4)
-
-	// Register India-specific payment gateways
-	registry.RegisterCountryGateway(payment.CountryIndia, "razorpay", 1)
-	registry.RegisterCountryGateway(payment.CountryIndia, "paytm", 2)
-
-	// Register USA payment gateways
-	registry.RegisterCountryGateway(payment.CountryUSA, "stripe", 1)
-	registry.RegisterCountryGateway(payment.CountryUSA, "paypal", 2)
-
-	// Register Canada payment gateways
-	registry.RegisterCountryGateway(payment.CountryCanada, "stripe", 1)
-	registry.RegisterCountryGateway(payment.CountryCanada, "paypal", 2)
-
-	// Register UK payment gateways
-	registry.RegisterCountryGateway(payment.CountryUK, "stripe", 1)
-	registry.RegisterCountryGateway(payment.CountryUK, "paypal", 2)
-
-	// Register by region - North America (US, Canada supported)
-	registry.RegisterRegionGateway(payment.RegionNorthAmerica, "stripe", 1)
-	registry.RegisterRegionGateway(payment.RegionNorthAmerica, "paypal", 2)
-
-	// Register by region - Europe (most European countries supported)
-	registry.RegisterRegionGateway(payment.RegionEurope, "stripe", 1)
-	registry.RegisterRegionGateway(payment.RegionEurope, "paypal", 2)
-
-	// Register by region - Oceania (Australia, New Zealand)
-	registry.RegisterRegionGateway(payment.RegionOceania, "stripe", 1)
-	registry.RegisterRegionGateway(payment.RegionOceania, "paypal", 2)
-
+	_ = registry.RegisterAll(defaultGatewayEntries())
 	return registry
 }
 
 // SetupPaymentManagerWithDefaults creates a payment manager with default registry
 // This includes default Nepal gateway registrations
-func SetupPaymentManagerWithDefaults(configs map[string]*payment.GatewayConfig) *payment.PaymentManager {
-	pm := SetupPaymentManager(configs)
+func SetupPaymentManagerWithDefaults(configs map[string]*payment.GatewayConfig, opts ...Option) *payment.PaymentManager {
+	pm := SetupPaymentManager(configs, opts...)
 	registry := createDefaultRegistry()
 	pm.SetRegistry(registry)
 	return pm
 }
 
 // SetupForCountry creates a payment manager optimized for a specific country
-func SetupForCountry(country payment.Country, configs map[string]*payment.GatewayConfig) *payment.PaymentManager {
-	pm := SetupPaymentManager(configs)
+func SetupForCountry(country payment.Country, configs map[string]*payment.GatewayConfig, opts ...Option) *payment.PaymentManager {
+	pm := SetupPaymentManager(configs, opts...)
 	registry := createDefaultRegistry()
 	pm.SetRegistry(registry)
 	return pm
 }
 
 // SetupMultiRegion creates a payment manager for multiple regions
-func SetupMultiRegion(configs map[string]*payment.GatewayConfig) *payment.PaymentManager {
-	pm := SetupPaymentManager(configs)
+func SetupMultiRegion(configs map[string]*payment.GatewayConfig, opts ...Option) *payment.PaymentManager {
+	pm := SetupPaymentManager(configs, opts...)
 	registry := createDefaultRegistry()
 	pm.SetRegistry(registry)
 	return pm
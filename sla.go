@@ -0,0 +1,176 @@
+package payment
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SLAStats summarizes recent call latency for a gateway
+type SLAStats struct {
+	Method  string        `json:"method"`
+	Samples int           `json:"samples"`
+	P50     time.Duration `json:"p50"`
+	P95     time.Duration `json:"p95"`
+	Max     time.Duration `json:"max"`
+	// Breached is true while P95 exceeds the configured threshold
+	Breached bool `json:"breached"`
+}
+
+// SLAOptions configures an SLATracker
+type SLAOptions struct {
+	// WindowSize is the number of most recent calls kept per gateway
+	// (default 100)
+	WindowSize int
+	// MinSamples is the number of calls needed before the threshold is
+	// evaluated (default 10)
+	MinSamples int
+	// Threshold is the p95 latency above which OnBreach is called. Zero
+	// disables alerting.
+	Threshold time.Duration
+	// OnBreach is called when a gateway's p95 first exceeds Threshold, and
+	// again only after it has recovered
+	OnBreach func(stats SLAStats)
+}
+
+// latencyWindow is a fixed-size ring buffer of call durations
+type latencyWindow struct {
+	samples  []time.Duration
+	next     int
+	full     bool
+	breached bool
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % len(w.samples)
+	if w.next == 0 {
+		w.full = true
+	}
+}
+
+func (w *latencyWindow) stats(method string) SLAStats {
+	n := w.next
+	if w.full {
+		n = len(w.samples)
+	}
+	stats := SLAStats{Method: method, Samples: n, Breached: w.breached}
+	if n == 0 {
+		return stats
+	}
+
+	sorted := append([]time.Duration(nil), w.samples[:n]...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	stats.P50 = percentile(sorted, 50)
+	stats.P95 = percentile(sorted, 95)
+	stats.Max = sorted[n-1]
+	return stats
+}
+
+// percentile returns the nearest-rank percentile of sorted
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// SLATracker keeps a rolling latency window per gateway
+type SLATracker struct {
+	opts    SLAOptions
+	windows map[string]*latencyWindow
+	mu      sync.Mutex
+}
+
+// NewSLATracker creates an SLATracker
+func NewSLATracker(opts SLAOptions) *SLATracker {
+	if opts.WindowSize <= 0 {
+		opts.WindowSize = 100
+	}
+	if opts.MinSamples <= 0 {
+		opts.MinSamples = 10
+	}
+	return &SLATracker{opts: opts, windows: make(map[string]*latencyWindow)}
+}
+
+// Record adds a call duration for method
+func (t *SLATracker) Record(method string, d time.Duration) {
+	t.mu.Lock()
+	w, ok := t.windows[method]
+	if !ok {
+		w = &latencyWindow{samples: make([]time.Duration, t.opts.WindowSize)}
+		t.windows[method] = w
+	}
+	w.add(d)
+
+	var breach *SLAStats
+	if t.opts.Threshold > 0 {
+		stats := w.stats(method)
+		if stats.Samples >= t.opts.MinSamples {
+			exceeded := stats.P95 > t.opts.Threshold
+			if exceeded && !w.breached {
+				stats.Breached = true
+				breach = &stats
+			}
+			w.breached = exceeded
+		}
+	}
+	t.mu.Unlock()
+
+	if breach != nil && t.opts.OnBreach != nil {
+		t.opts.OnBreach(*breach)
+	}
+}
+
+// Stats returns the current latency summary for method
+func (t *SLATracker) Stats(method string) SLAStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w, ok := t.windows[method]
+	if !ok {
+		return SLAStats{Method: method}
+	}
+	return w.stats(method)
+}
+
+// Before implements GatewayHook
+func (t *SLATracker) Before(ctx context.Context, call *GatewayCall) {}
+
+// After implements GatewayHook, recording the call's duration
+func (t *SLATracker) After(ctx context.Context, call *GatewayCall) {
+	t.Record(call.Method, call.Duration)
+}
+
+// SetSLATracker enables latency tracking for calls made through the manager.
+// Pass nil to disable it. Don't also install the tracker as a hook on the
+// manager's gateways, or calls are counted twice.
+func (pm *PaymentManager) SetSLATracker(tracker *SLATracker) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.sla = tracker
+}
+
+// GatewaySLA returns the rolling latency summary for method. It is empty if
+// no SLATracker is set.
+func (pm *PaymentManager) GatewaySLA(method string) SLAStats {
+	pm.mu.RLock()
+	tracker := pm.sla
+	method = pm.resolveMethod(method)
+	pm.mu.RUnlock()
+	if tracker == nil {
+		return SLAStats{Method: method}
+	}
+	return tracker.Stats(method)
+}
+
+// trackLatency records the time since start for method, if tracking is enabled
+func (pm *PaymentManager) trackLatency(method string, start time.Time) {
+	pm.mu.RLock()
+	tracker := pm.sla
+	pm.mu.RUnlock()
+	if tracker != nil {
+		tracker.Record(method, time.Since(start))
+	}
+}
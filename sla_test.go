@@ -0,0 +1,63 @@
+package payment
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSLATracker(t *testing.T) {
+	var breaches []SLAStats
+	tracker := NewSLATracker(SLAOptions{
+		WindowSize: 20,
+		MinSamples: 5,
+		Threshold:  100 * time.Millisecond,
+		OnBreach:   func(stats SLAStats) { breaches = append(breaches, stats) },
+	})
+
+	for i := 1; i <= 20; i++ {
+		tracker.Record("esewa", time.Duration(i)*time.Millisecond)
+	}
+	stats := tracker.Stats("esewa")
+	if stats.Samples != 20 || stats.P50 != 10*time.Millisecond || stats.P95 != 19*time.Millisecond || stats.Max != 20*time.Millisecond {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if len(breaches) != 0 {
+		t.Fatalf("Expected no breach, got %v", breaches)
+	}
+
+	// Slow calls push the old samples out of the window
+	for i := 0; i < 10; i++ {
+		tracker.Record("esewa", time.Second)
+	}
+	if len(breaches) != 1 || !breaches[0].Breached {
+		t.Fatalf("Expected exactly one breach, got %v", breaches)
+	}
+	if !tracker.Stats("esewa").Breached {
+		t.Error("Stats should report the breach")
+	}
+
+	for i := 0; i < 20; i++ {
+		tracker.Record("esewa", time.Millisecond)
+	}
+	if tracker.Stats("esewa").Breached {
+		t.Error("Breach should clear once p95 recovers")
+	}
+}
+
+func TestGatewaySLA(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("fake", &fakeGateway{method: "fake"})
+
+	if stats := pm.GatewaySLA("fake"); stats.Samples != 0 {
+		t.Errorf("Expected no samples without a tracker, got %+v", stats)
+	}
+
+	pm.SetSLATracker(NewSLATracker(SLAOptions{}))
+	if _, err := pm.GetStatus(context.Background(), "fake", &StatusRequest{TransactionID: "t1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stats := pm.GatewaySLA("fake"); stats.Samples != 1 {
+		t.Errorf("Expected 1 sample, got %+v", stats)
+	}
+}
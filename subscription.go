@@ -0,0 +1,194 @@
+package payment
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/oarkflow/money"
+)
+
+// SubscriptionInterval is how often a subscription bills
+type SubscriptionInterval string
+
+const (
+	IntervalMonthly SubscriptionInterval = "monthly"
+	IntervalYearly  SubscriptionInterval = "yearly"
+)
+
+// SubscriptionStatus is the gateway-independent state of a subscription
+type SubscriptionStatus string
+
+const (
+	// SubscriptionPending is waiting for the customer to authorize the
+	// first payment or mandate
+	SubscriptionPending  SubscriptionStatus = "pending"
+	SubscriptionTrialing SubscriptionStatus = "trialing"
+	SubscriptionActive   SubscriptionStatus = "active"
+	// SubscriptionPastDue has a failed renewal the provider is retrying
+	SubscriptionPastDue  SubscriptionStatus = "past_due"
+	SubscriptionPaused   SubscriptionStatus = "paused"
+	SubscriptionCanceled SubscriptionStatus = "canceled"
+	// SubscriptionCompleted has billed all its cycles
+	SubscriptionCompleted SubscriptionStatus = "completed"
+)
+
+// SubscriptionRequest bills Amount every Interval, starting after TrialDays
+type SubscriptionRequest struct {
+	Amount        money.Money          `json:"amount"`
+	Interval      SubscriptionInterval `json:"interval"`
+	CustomerEmail string               `json:"customer_email"`
+	TrialDays     int                  `json:"trial_days,omitempty"`
+	// Description names the plan on the provider's invoices
+	Description string            `json:"description,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	// Cycles is the number of charges. Zero bills until canceled; Razorpay
+	// needs a limit and uses ten years' worth.
+	Cycles int `json:"cycles,omitempty"`
+}
+
+// Validate checks that the request has a positive amount, a monthly or
+// yearly interval, a customer email and no negative trial or cycles. It
+// returns a *ValidationError listing every failing field.
+func (r *SubscriptionRequest) Validate() error {
+	var fields []FieldError
+	if !r.Amount.IsPositive() {
+		fields = append(fields, FieldError{"amount", "must be greater than zero"})
+	}
+	if r.Interval != IntervalMonthly && r.Interval != IntervalYearly {
+		fields = append(fields, FieldError{"interval", "must be monthly or yearly"})
+	}
+	if strings.TrimSpace(r.CustomerEmail) == "" {
+		fields = append(fields, FieldError{"customer_email", "is required"})
+	}
+	if r.TrialDays < 0 {
+		fields = append(fields, FieldError{"trial_days", "must not be negative"})
+	}
+	if r.Cycles < 0 {
+		fields = append(fields, FieldError{"cycles", "must not be negative"})
+	}
+	return validationError(fields)
+}
+
+// SubscriptionResponse describes a provider subscription
+type SubscriptionResponse struct {
+	ID       string               `json:"id"`
+	Status   SubscriptionStatus   `json:"status"`
+	Amount   money.Money          `json:"amount"`
+	Interval SubscriptionInterval `json:"interval"`
+	// PaymentURL is where the customer authorizes the subscription, for
+	// providers that collect the mandate on a hosted page
+	PaymentURL string `json:"payment_url,omitempty"`
+	// TrialEnd is when the first charge is due, if there is a trial
+	TrialEnd time.Time `json:"trial_end,omitempty"`
+	// CurrentPeriodEnd is when the next charge is due
+	CurrentPeriodEnd time.Time `json:"current_period_end,omitempty"`
+}
+
+// SubscriptionGateway is implemented by gateways that bill customers on a
+// schedule
+type SubscriptionGateway interface {
+	CreateSubscription(ctx context.Context, req *SubscriptionRequest) (*SubscriptionResponse, error)
+	CancelSubscription(ctx context.Context, id string) error
+	GetSubscription(ctx context.Context, id string) (*SubscriptionResponse, error)
+}
+
+// subscriptionGateway returns the gateway for account of method as a
+// SubscriptionGateway
+func (pm *PaymentManager) subscriptionGateway(method, account string) (SubscriptionGateway, string, error) {
+	g, err := pm.GetGatewayAccount(method, account)
+	if err != nil {
+		return nil, "", err
+	}
+	sg, ok := UnwrapGateway(g).(SubscriptionGateway)
+	if !ok {
+		return nil, "", NewPaymentError(ErrKindUnsupported, g.GetMethod(), "subscriptions are not supported", nil)
+	}
+	return sg, g.GetMethod(), nil
+}
+
+// subscriptionKey keys pm.subscriptionAccounts
+func subscriptionKey(method, id string) string {
+	return method + "|" + id
+}
+
+// subscriptionAccount returns the account subscription id was created on
+// through this manager, or "" for the default account
+func (pm *PaymentManager) subscriptionAccount(method, id string) string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.subscriptionAccounts[subscriptionKey(pm.resolveMethod(method), id)]
+}
+
+// CreateSubscription starts billing req on method, using the account named
+// by req.Metadata[MetadataAccount] if set. The call goes through the
+// method's ResiliencePolicy like a payment. Gateways that don't implement
+// SubscriptionGateway return an ErrKindUnsupported error.
+func (pm *PaymentManager) CreateSubscription(ctx context.Context, method string, req *SubscriptionRequest) (resp *SubscriptionResponse, err error) {
+	if req == nil {
+		return nil, NewPaymentError(ErrKindValidation, method, "", ErrNilRequest)
+	}
+	account := req.Metadata[MetadataAccount]
+	sg, resolved, err := pm.subscriptionGateway(method, account)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	ctx, done, err := pm.guard(ctx, resolved)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { done(err) }()
+	defer pm.trackLatency(resolved, time.Now())
+
+	resp, err = sg.CreateSubscription(ctx, req)
+	if err == nil && account != "" {
+		pm.mu.Lock()
+		pm.subscriptionAccounts[subscriptionKey(pm.resolveMethod(method), resp.ID)] = account
+		pm.mu.Unlock()
+	}
+	return resp, err
+}
+
+// CancelSubscription cancels subscription id on method immediately, on the
+// account it was created on through this manager
+func (pm *PaymentManager) CancelSubscription(ctx context.Context, method, id string) (err error) {
+	sg, resolved, err := pm.subscriptionGateway(method, pm.subscriptionAccount(method, id))
+	if err != nil {
+		return err
+	}
+	ctx, done, err := pm.guard(ctx, resolved)
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
+	defer pm.trackLatency(resolved, time.Now())
+
+	if err = sg.CancelSubscription(ctx, id); err == nil {
+		pm.mu.Lock()
+		delete(pm.subscriptionAccounts, subscriptionKey(pm.resolveMethod(method), id))
+		pm.mu.Unlock()
+	}
+	return err
+}
+
+// GetSubscription returns subscription id on method, retrying transient
+// failures under the method's policy
+func (pm *PaymentManager) GetSubscription(ctx context.Context, method, id string) (*SubscriptionResponse, error) {
+	sg, resolved, err := pm.subscriptionGateway(method, pm.subscriptionAccount(method, id))
+	if err != nil {
+		return nil, err
+	}
+	return retryTransient(ctx, pm.ResiliencePolicy(resolved).Retry, func() (*SubscriptionResponse, error) {
+		ctx, done, err := pm.guard(ctx, resolved)
+		if err != nil {
+			return nil, err
+		}
+		defer pm.trackLatency(resolved, time.Now())
+		sub, err := sg.GetSubscription(ctx, id)
+		done(err)
+		return sub, err
+	})
+}
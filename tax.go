@@ -0,0 +1,83 @@
+package payment
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/oarkflow/money"
+)
+
+// Metadata keys noting the tax on gateways without tax line items
+const (
+	MetadataTaxAmount    = "tax_amount"
+	MetadataTaxInclusive = "tax_inclusive"
+)
+
+// TaxLineItemer is implemented by gateways that itemize
+// PaymentRequest.TaxAmount themselves. Other gateways receive the total in
+// Amount with the tax noted in Metadata.
+type TaxLineItemer interface {
+	SupportsTaxLineItems() bool
+}
+
+// HasTax reports whether the request carries a tax amount
+func (r *PaymentRequest) HasTax() bool {
+	return r.TaxAmount.Currency().Code != "" && !r.TaxAmount.IsZero()
+}
+
+// ValidateTax checks that TaxAmount is consistent with Amount and TaxInclusive
+func (r *PaymentRequest) ValidateTax() error {
+	if !r.HasTax() {
+		return nil
+	}
+	if r.TaxAmount.IsNegative() {
+		return fmt.Errorf("tax amount %s is negative", r.TaxAmount)
+	}
+	cmp, err := r.TaxAmount.Cmp(r.Amount)
+	if err != nil {
+		return fmt.Errorf("tax currency %s does not match amount currency %s", r.TaxAmount.Currency().Code, r.Amount.Currency().Code)
+	}
+	if r.TaxInclusive && cmp >= 0 {
+		return fmt.Errorf("inclusive tax %s must be less than amount %s", r.TaxAmount, r.Amount)
+	}
+	return nil
+}
+
+// TotalAmount returns the amount to charge: Amount when tax is inclusive or
+// absent, Amount plus TaxAmount otherwise
+func (r *PaymentRequest) TotalAmount() (money.Money, error) {
+	if !r.HasTax() || r.TaxInclusive {
+		return r.Amount, nil
+	}
+	return r.Amount.Add(r.TaxAmount)
+}
+
+// prepareTax validates req's tax and, for gateways without tax line items,
+// returns a copy with the tax folded into Amount and noted in Metadata
+func prepareTax(g Gateway, req *PaymentRequest) (*PaymentRequest, error) {
+	if !req.HasTax() {
+		return req, nil
+	}
+	if err := req.ValidateTax(); err != nil {
+		return nil, NewPaymentError(ErrKindValidation, g.GetMethod(), "", err)
+	}
+	if t, ok := UnwrapGateway(g).(TaxLineItemer); ok && t.SupportsTaxLineItems() {
+		return req, nil
+	}
+
+	total, err := req.TotalAmount()
+	if err != nil {
+		return nil, NewPaymentError(ErrKindValidation, g.GetMethod(), "", err)
+	}
+	folded := *req
+	folded.Amount = total
+	folded.TaxAmount = money.Money{}
+	folded.TaxInclusive = false
+	folded.Metadata = make(map[string]string, len(req.Metadata)+2)
+	for k, v := range req.Metadata {
+		folded.Metadata[k] = v
+	}
+	folded.Metadata[MetadataTaxAmount] = req.TaxAmount.Format(money.WithoutComma(), money.WithoutSymbol())
+	folded.Metadata[MetadataTaxInclusive] = strconv.FormatBool(req.TaxInclusive)
+	return &folded, nil
+}
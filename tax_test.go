@@ -0,0 +1,67 @@
+package payment
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oarkflow/money"
+)
+
+func TestValidateTax(t *testing.T) {
+	inr := money.MustCurrency("INR")
+	tests := []struct {
+		name    string
+		req     PaymentRequest
+		wantErr bool
+	}{
+		{"no tax", PaymentRequest{Amount: money.New(100, inr)}, false},
+		{"exclusive", PaymentRequest{Amount: money.New(100, inr), TaxAmount: money.New(18, inr)}, false},
+		{"inclusive", PaymentRequest{Amount: money.New(118, inr), TaxAmount: money.New(18, inr), TaxInclusive: true}, false},
+		{"inclusive exceeds amount", PaymentRequest{Amount: money.New(18, inr), TaxAmount: money.New(18, inr), TaxInclusive: true}, true},
+		{"negative", PaymentRequest{Amount: money.New(100, inr), TaxAmount: money.New(-1, inr)}, true},
+		{"currency mismatch", PaymentRequest{Amount: money.New(100, inr), TaxAmount: money.New(1, money.MustCurrency("EUR"))}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.req.ValidateTax(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateTax() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestInitiatePaymentFoldsTax(t *testing.T) {
+	pm := NewPaymentManager(0)
+	fake := &recordingGateway{fakeGateway: fakeGateway{method: "fake"}}
+	pm.RegisterGateway("fake", fake)
+
+	inr := money.MustCurrency("INR")
+	req := &PaymentRequest{OrderID: "O1", Amount: money.New(100, inr), TaxAmount: money.New(18, inr), SuccessURL: testSuccessURL}
+	if _, err := pm.InitiatePayment(context.Background(), "fake", req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !fake.initReq.Amount.Equals(money.New(118, inr)) {
+		t.Errorf("Expected folded total 118, got %s", fake.initReq.Amount)
+	}
+	if fake.initReq.Metadata[MetadataTaxAmount] != "18.00" || fake.initReq.Metadata[MetadataTaxInclusive] != "false" {
+		t.Errorf("Tax should be noted in metadata, got %v", fake.initReq.Metadata)
+	}
+	if !req.Amount.Equals(money.New(100, inr)) || req.Metadata != nil {
+		t.Error("Caller's request should not be modified")
+	}
+
+	bad := &PaymentRequest{OrderID: "O2", Amount: money.New(10, inr), TaxAmount: money.New(18, inr), TaxInclusive: true, SuccessURL: testSuccessURL}
+	if _, err := pm.InitiatePayment(context.Background(), "fake", bad); HTTPStatusForError(err) != 400 {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+}
+
+// recordingGateway captures the last initiated request
+type recordingGateway struct {
+	fakeGateway
+	initReq *PaymentRequest
+}
+
+func (r *recordingGateway) InitiatePayment(ctx context.Context, req *PaymentRequest) (*PaymentResponse, error) {
+	r.initReq = req
+	return r.fakeGateway.InitiatePayment(ctx, req)
+}
@@ -0,0 +1,22 @@
+package payment
+
+import (
+	"net/http"
+	"time"
+)
+
+// withGatewayTimeout returns client with its timeout replaced by timeout, for
+// gateways whose providers need a different deadline than the shared client.
+// The copy shares client's transport, so connections are still pooled. A
+// zero timeout returns client unchanged.
+func withGatewayTimeout(client *http.Client, timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		return client
+	}
+	timed := &http.Client{}
+	if client != nil {
+		*timed = *client
+	}
+	timed.Timeout = timeout
+	return timed
+}
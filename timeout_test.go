@@ -0,0 +1,41 @@
+package payment
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGatewayTimeout(t *testing.T) {
+	pm := NewPaymentManager(0)
+	clients := map[string]*http.Client{}
+	for _, method := range []string{"shared", "fast", "proxied"} {
+		pm.RegisterFactory(method, func(config *GatewayConfig, client *http.Client) Gateway {
+			clients[method] = client
+			return &fakeGateway{method: method}
+		})
+	}
+	pm.RegisterGatewayWithConfig("shared", &GatewayConfig{})
+	pm.RegisterGatewayWithConfig("fast", &GatewayConfig{Timeout: 20 * time.Millisecond})
+	pm.RegisterGatewayWithConfig("proxied", &GatewayConfig{Timeout: time.Minute, ProxyURL: "http://egress.internal:3128"})
+
+	if clients["shared"] != pm.client || pm.client.Timeout != 30*time.Second {
+		t.Error("Expected gateways without a timeout to share the manager's client")
+	}
+	fast := clients["fast"]
+	if fast.Timeout != 20*time.Millisecond || fast.Transport != pm.client.Transport {
+		t.Errorf("Expected a 20ms client sharing the transport, got %s", fast.Timeout)
+	}
+	if proxied := clients["proxied"]; proxied.Timeout != time.Minute || proxied.Transport == pm.client.Transport {
+		t.Errorf("Expected a proxied 1m client, got %s", proxied.Timeout)
+	}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+	if _, err := fast.Get(slow.URL); err == nil {
+		t.Error("Expected the gateway timeout to cut the request short")
+	}
+}
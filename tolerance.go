@@ -0,0 +1,44 @@
+package payment
+
+import (
+	"math"
+
+	"github.com/oarkflow/money"
+)
+
+// AmountTolerance is how far a provider-reported amount may differ from the
+// expected amount and still be accepted, e.g. to absorb a cent of rounding.
+// The zero value requires an exact match.
+type AmountTolerance struct {
+	// Minor is the allowed difference in minor units
+	Minor int64
+	// Relative is the allowed difference as a fraction of the expected
+	// amount, e.g. 0.001 for 0.1%
+	Relative float64
+}
+
+// Allows reports whether paid matches expected within t. The larger of Minor
+// and Relative applies. Amounts in different currencies never match.
+func (t AmountTolerance) Allows(expected, paid money.Money) bool {
+	if expected.Currency().Code != paid.Currency().Code {
+		return false
+	}
+	diff := expected.Minor() - paid.Minor()
+	if diff < 0 {
+		diff = -diff
+	}
+	limit := max(t.Minor, 0)
+	if t.Relative > 0 {
+		limit = max(limit, int64(math.Floor(t.Relative*math.Abs(float64(expected.Minor())))))
+	}
+	return diff <= limit
+}
+
+// SetAmountTolerance sets how far the provider-reported amount may differ
+// from the stored initiated amount before VerifyPayment returns
+// ErrAmountMismatch. The default is an exact match.
+func (pm *PaymentManager) SetAmountTolerance(t AmountTolerance) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.amountTolerance = t
+}
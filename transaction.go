@@ -0,0 +1,391 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oarkflow/money"
+)
+
+// ErrTransactionNotFound is returned when a transaction is not in the store
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// ErrAmountMismatch is returned when the provider-reported amount differs from
+// the amount recorded when the payment was initiated
+var ErrAmountMismatch = errors.New("paid amount does not match initiated amount")
+
+// ErrOrderMismatch is returned when the provider reports a payment for a
+// different order than the one being verified
+var ErrOrderMismatch = errors.New("payment belongs to a different order")
+
+// ErrRefundExceedsCaptured is returned when a refund would take the total
+// refunded above the captured amount
+var ErrRefundExceedsCaptured = errors.New("refund exceeds captured amount")
+
+// Transaction is the manager's record of an initiated payment
+type Transaction struct {
+	ID        string            `json:"id"`
+	OrderID   string            `json:"order_id"`
+	Method    string            `json:"method"`
+	Amount    money.Money       `json:"amount"`
+	Status    PaymentStatus     `json:"status"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	ExpiresAt time.Time         `json:"expires_at,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	// SessionID is the provider session the payment was created under, if any
+	SessionID string `json:"session_id,omitempty"`
+	// PaymentURL is where the customer was sent to pay
+	PaymentURL string `json:"payment_url,omitempty"`
+	// Request is the request the payment was initiated with, as sent to the
+	// gateway. ResumePayment uses it to recreate expired payments.
+	Request *PaymentRequest `json:"request,omitempty"`
+	// PaidAmount and Fee are recorded from a successful verification
+	PaidAmount money.Money `json:"paid_amount,omitempty"`
+	Fee        money.Money `json:"fee,omitempty"`
+	// Refunded is the cumulative amount refunded through the manager
+	Refunded money.Money `json:"refunded,omitempty"`
+	// Refunds lists the individual refunds made through the manager
+	Refunds []RefundRecord `json:"refunds,omitempty"`
+	// HoldExpiresAt is when an authorization hold lapses and can no longer
+	// be captured. HoldWarnedAt records when the reaper reported it expiring.
+	HoldExpiresAt time.Time `json:"hold_expires_at,omitempty"`
+	HoldWarnedAt  time.Time `json:"hold_warned_at,omitempty"`
+}
+
+// RefundRecord is one refund of a transaction
+type RefundRecord struct {
+	RefundID  string      `json:"refund_id,omitempty"`
+	Amount    money.Money `json:"amount"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// ProviderID returns the provider's payment id, or "" while the payment is
+// stored under its SessionID because the provider hasn't assigned one yet
+func (t *Transaction) ProviderID() string {
+	if t.ID == t.SessionID {
+		return ""
+	}
+	return t.ID
+}
+
+// Currency returns the ISO 4217 code of the transaction amount
+func (t *Transaction) Currency() string {
+	return t.Amount.Currency().Code
+}
+
+// RefundableBalance returns the captured amount not yet refunded
+func (t *Transaction) RefundableBalance() (money.Money, error) {
+	if t.Refunded.Currency().Code == "" {
+		return t.Amount, nil
+	}
+	return t.Amount.Sub(t.Refunded)
+}
+
+// TransactionStore persists transactions recorded by the manager
+type TransactionStore interface {
+	Save(txn *Transaction) error
+	Get(id string) (*Transaction, error)
+	// ListPending returns up to limit non-terminal transactions, oldest first.
+	// A limit <= 0 returns all of them.
+	ListPending(limit int) ([]*Transaction, error)
+}
+
+// TransactionDeleter is implemented by TransactionStores that can remove a
+// transaction. Verification uses it to drop the record a payment was kept
+// under before the provider assigned its payment id.
+type TransactionDeleter interface {
+	Delete(id string) error
+}
+
+// MemoryTransactionStore is an in-memory TransactionStore
+type MemoryTransactionStore struct {
+	txns      map[string]*Transaction
+	customers map[string]string
+	ledger    []LedgerEntry
+	mu        sync.RWMutex
+}
+
+// NewMemoryTransactionStore creates an empty in-memory transaction store
+func NewMemoryTransactionStore() *MemoryTransactionStore {
+	return &MemoryTransactionStore{
+		txns:      make(map[string]*Transaction),
+		customers: make(map[string]string),
+	}
+}
+
+func (s *MemoryTransactionStore) Save(txn *Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := *txn
+	cp.Refunds = slices.Clone(txn.Refunds)
+	s.txns[txn.ID] = &cp
+	return nil
+}
+
+func (s *MemoryTransactionStore) Get(id string) (*Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	txn, ok := s.txns[id]
+	if !ok {
+		return nil, ErrTransactionNotFound
+	}
+	cp := *txn
+	cp.Refunds = slices.Clone(txn.Refunds)
+	return &cp, nil
+}
+
+func (s *MemoryTransactionStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.txns, id)
+	return nil
+}
+
+func (s *MemoryTransactionStore) ListPending(limit int) ([]*Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pending := []*Transaction{}
+	for _, txn := range s.txns {
+		if !txn.Status.IsTerminal() {
+			cp := *txn
+			cp.Refunds = slices.Clone(txn.Refunds)
+			pending = append(pending, &cp)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+	if limit > 0 && len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+func (s *MemoryTransactionStore) GetCustomer(method, key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.customers[method+"|"+key]
+	if !ok {
+		return "", ErrCustomerNotFound
+	}
+	return id, nil
+}
+
+func (s *MemoryTransactionStore) SaveCustomer(method, key, customerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.customers[method+"|"+key] = customerID
+	return nil
+}
+
+// recordTransaction saves a newly initiated payment if a store is configured
+func (pm *PaymentManager) recordTransaction(method string, req *PaymentRequest, resp *PaymentResponse) {
+	pm.mu.RLock()
+	store := pm.transactions
+	pm.mu.RUnlock()
+	if store == nil || resp == nil {
+		return
+	}
+
+	// Payments the provider hasn't assigned an id yet are kept under their
+	// session until verification reports one
+	id := resp.TransactionID
+	if id == "" {
+		id = resp.SessionID
+	}
+	if id == "" {
+		id = req.OrderID
+	}
+	status := StatusPending
+	if !resp.Success {
+		status = StatusFailed
+	}
+
+	// Record what the customer is charged, including exclusive tax
+	amount, err := req.TotalAmount()
+	if err != nil {
+		amount = req.Amount
+	}
+
+	now := time.Now()
+	original := *req
+	_ = store.Save(&Transaction{
+		ID:         id,
+		OrderID:    req.OrderID,
+		Method:     method,
+		Amount:     amount,
+		Status:     status,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		ExpiresAt:  req.ExpiresAt,
+		Metadata:   req.Metadata,
+		SessionID:  resp.SessionID,
+		PaymentURL: resp.PaymentURL,
+		Request:    &original,
+	})
+	pm.recordLedger(LedgerEntry{
+		Time:          now,
+		Type:          LedgerInitiated,
+		Method:        method,
+		TransactionID: id,
+		OrderID:       req.OrderID,
+		Amount:        amount,
+		Status:        status,
+	})
+}
+
+// findTransaction returns the first stored transaction matching one of ids
+func findTransaction(store TransactionStore, ids ...string) (*Transaction, bool) {
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if txn, err := store.Get(id); err == nil {
+			return txn, true
+		}
+	}
+	return nil, false
+}
+
+// GetTransaction returns the normalized record of txnID: the manager's
+// stored transaction, if any, updated with the provider's current status.
+// Fields the provider doesn't expose are left zero. If the status lookup
+// fails, the stored record is returned as-is; without one the error is
+// returned.
+func (pm *PaymentManager) GetTransaction(ctx context.Context, method, txnID string) (*Transaction, error) {
+	var txn *Transaction
+	if store := pm.GetTransactionStore(); store != nil {
+		txn, _ = findTransaction(store, txnID)
+	}
+
+	status, err := pm.GetStatus(ctx, method, &StatusRequest{TransactionID: txnID})
+	if err != nil {
+		if txn != nil {
+			return txn, nil
+		}
+		return nil, err
+	}
+
+	if txn == nil {
+		txn = &Transaction{ID: txnID, Method: pm.ResolveMethod(method)}
+	}
+	if status.Status != "" {
+		txn.Status = status.Status
+	}
+	if txn.OrderID == "" {
+		txn.OrderID = status.OrderID
+	}
+	if txn.Amount.Currency().Code == "" {
+		txn.Amount = status.Amount
+	}
+	if txn.PaidAmount.Currency().Code == "" && status.Status.IsSuccess() {
+		txn.PaidAmount = status.Amount
+	}
+	return txn, nil
+}
+
+// recordCapture marks the stored transaction for a successful verification
+// completed and adds a captured ledger entry. A transaction kept under
+// another id, such as its session, is re-keyed to the verified payment id.
+// Repeat verifications of a completed transaction are not recorded again.
+func (pm *PaymentManager) recordCapture(method string, req *VerificationRequest, resp *VerificationResponse) {
+	store := pm.GetTransactionStore()
+	if store == nil {
+		return
+	}
+	entry := LedgerEntry{
+		Type:          LedgerCaptured,
+		Method:        method,
+		TransactionID: resp.TransactionID,
+		OrderID:       resp.OrderID,
+		Amount:        resp.PaidAmount,
+		Fee:           resp.Fee,
+		Status:        resp.Status,
+	}
+	if txn, ok := findTransaction(store, resp.TransactionID, req.TransactionID, req.SessionID, resp.OrderID, req.OrderID); ok {
+		if txn.Status.IsSuccess() || txn.Status == StatusRefunded || txn.Status == StatusPartiallyRefunded {
+			return
+		}
+		previous := txn.ID
+		if resp.TransactionID != "" {
+			txn.ID = resp.TransactionID
+		}
+		txn.Status = resp.Status
+		txn.PaidAmount = resp.PaidAmount
+		txn.Fee = resp.Fee
+		txn.UpdatedAt = time.Now()
+		if err := store.Save(txn); err == nil && txn.ID != previous {
+			if deleter, ok := store.(TransactionDeleter); ok {
+				_ = deleter.Delete(previous)
+			}
+		}
+		entry.TransactionID = txn.ID
+		entry.OrderID = txn.OrderID
+	}
+	pm.recordLedger(entry)
+}
+
+// checkStoredOrder fails a verification for req.OrderID when the store
+// recorded the payment for another order, or recorded the order under a
+// different provider payment, e.g. a Khalti pidx from someone else's
+// checkout. Orders stored before the provider assigned an id aren't
+// compared.
+func (pm *PaymentManager) checkStoredOrder(req *VerificationRequest, resp *VerificationResponse) error {
+	store := pm.GetTransactionStore()
+	if store == nil || resp == nil || req.OrderID == "" {
+		return nil
+	}
+	if txn, ok := findTransaction(store, resp.TransactionID, req.TransactionID, req.SessionID); ok {
+		if txn.OrderID != "" && txn.OrderID != req.OrderID {
+			return fmt.Errorf("%w: payment %s was initiated for order %q, not %q", ErrOrderMismatch, txn.ID, txn.OrderID, req.OrderID)
+		}
+		return nil
+	}
+
+	txn, ok := pm.orderTransaction(req.OrderID)
+	if !ok || txn.ID == txn.OrderID || txn.ProviderID() == "" {
+		return nil
+	}
+	id := resp.TransactionID
+	if id == "" {
+		id = req.TransactionID
+	}
+	if id != "" && id != txn.ID {
+		return fmt.Errorf("%w: order %q was initiated as payment %s, not %s", ErrOrderMismatch, req.OrderID, txn.ID, id)
+	}
+	return nil
+}
+
+// checkStoredAmount compares the provider-reported amount in resp with the
+// amount recorded for the transaction, if both are known, within the
+// manager's AmountTolerance
+func (pm *PaymentManager) checkStoredAmount(req *VerificationRequest, resp *VerificationResponse) error {
+	pm.mu.RLock()
+	store := pm.transactions
+	tolerance := pm.amountTolerance
+	pm.mu.RUnlock()
+	if store == nil || resp == nil {
+		return nil
+	}
+
+	txn, ok := findTransaction(store, resp.TransactionID, req.TransactionID, req.SessionID, resp.OrderID, req.OrderID)
+	if !ok || txn.Amount.Currency().Code == "" {
+		return nil
+	}
+
+	reported := resp.PaidAmount
+	if reported.Currency().Code == "" {
+		return nil
+	}
+	if !tolerance.Allows(txn.Amount, reported) {
+		return fmt.Errorf("%w: initiated %s, provider reported %s", ErrAmountMismatch, txn.Amount, reported)
+	}
+	return nil
+}
@@ -16,19 +16,56 @@ const (
 	StatusCompleted PaymentStatus = "completed"
 	StatusFailed    PaymentStatus = "failed"
 	StatusRefunded  PaymentStatus = "refunded"
-	StatusCanceled  PaymentStatus = "canceled"
+	// StatusPartiallyRefunded means part of the captured amount was refunded
+	StatusPartiallyRefunded PaymentStatus = "partially_refunded"
+	StatusCanceled          PaymentStatus = "canceled"
+	StatusDisputed          PaymentStatus = "disputed"
+	// StatusRequiresAction means the customer must complete a step such as
+	// 3-D Secure or an OTP
+	StatusRequiresAction PaymentStatus = "requires_action"
+	// StatusAuthorized means funds are held and await capture or void
+	StatusAuthorized PaymentStatus = "authorized"
 )
 
+// IsTerminal reports whether no further status changes are expected.
+// Pending, requires-action, authorized and disputed payments are not terminal.
+// Partially refunded payments are settled and count as terminal even though
+// further refunds may follow.
+func (s PaymentStatus) IsTerminal() bool {
+	switch s {
+	case StatusCompleted, StatusFailed, StatusRefunded, StatusPartiallyRefunded, StatusCanceled:
+		return true
+	}
+	return false
+}
+
+// IsSuccess reports whether the payment was captured
+func (s PaymentStatus) IsSuccess() bool {
+	return s == StatusCompleted
+}
+
 // Gateway interface - all payment providers must implement this
 type Gateway interface {
 	InitiatePayment(ctx context.Context, req *PaymentRequest) (*PaymentResponse, error)
 	VerifyPayment(ctx context.Context, req *VerificationRequest) (*VerificationResponse, error)
 	RefundPayment(ctx context.Context, req *RefundRequest) (*RefundResponse, error)
-	GetStatus(ctx context.Context, txnID string) (*StatusResponse, error)
+	GetStatus(ctx context.Context, req *StatusRequest) (*StatusResponse, error)
 	GetName() string
 	GetMethod() string
 }
 
+// TestModer is implemented by gateways that can report whether they are
+// configured for their sandbox
+type TestModer interface {
+	TestMode() bool
+}
+
+// IsTestMode reports whether g is running against its sandbox
+func IsTestMode(g Gateway) bool {
+	tm, ok := UnwrapGateway(g).(TestModer)
+	return ok && tm.TestMode()
+}
+
 // WebhookHandler interface for handling payment callbacks
 type WebhookHandler interface {
 	ParseWebhook(req *http.Request) (*WebhookData, error)
@@ -48,6 +85,24 @@ type PaymentRequest struct {
 	WebhookURL    string            `json:"webhook_url,omitempty"`
 	Description   string            `json:"description,omitempty"`
 	Metadata      map[string]string `json:"metadata,omitempty"`
+
+	// IdempotencyKey deduplicates retried requests when an IdempotencyStore is
+	// set. It is also forwarded to providers that deduplicate requests
+	// themselves (Stripe's and Razorpay's Idempotency-Key header); other
+	// gateways ignore it. When empty, InitiatePayment sends the gateway
+	// DefaultIdempotencyKey for the order.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// ExpiresAt is when an unpaid payment should be considered canceled
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+
+	// TaxAmount is the VAT/GST portion of the payment. When TaxInclusive is
+	// set it is already part of Amount; otherwise it is charged on top.
+	TaxAmount    money.Money `json:"tax_amount,omitempty"`
+	TaxInclusive bool        `json:"tax_inclusive,omitempty"`
+
+	// AllowCurrencyMismatch lets InitiatePaymentForCountry charge a currency
+	// other than the country's default, e.g. USD in Nepal
+	AllowCurrencyMismatch bool `json:"allow_currency_mismatch,omitempty"`
 }
 
 type PaymentResponse struct {
@@ -57,6 +112,24 @@ type PaymentResponse struct {
 	OrderID       string            `json:"order_id"`
 	Message       string            `json:"message,omitempty"`
 	Metadata      map[string]string `json:"metadata,omitempty"`
+
+	// SessionID is the provider's checkout session or order object, for
+	// gateways that distinguish it from the payment itself (e.g. a Stripe
+	// Checkout Session vs its PaymentIntent). TransactionID remains the
+	// identifier used for verification and refunds.
+	SessionID string `json:"session_id,omitempty"`
+	// FormFields, when set, must be POSTed to PaymentURL as an HTML form
+	// instead of redirecting the customer to it, as eSewa's checkout
+	// requires
+	FormFields map[string]string `json:"form_fields,omitempty"`
+	// IdempotencyKey echoes the key from the request, if any
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// Replayed is true when the response was served from the idempotency store
+	Replayed bool `json:"replayed,omitempty"`
+	// TestMode is true when the gateway is running against its sandbox
+	TestMode bool `json:"test_mode,omitempty"`
+	// Resumed is true when ResumePayment returned an existing payment
+	Resumed bool `json:"resumed,omitempty"`
 }
 
 type VerificationRequest struct {
@@ -64,8 +137,15 @@ type VerificationRequest struct {
 	OrderID       string            `json:"order_id,omitempty"`
 	Amount        money.Money       `json:"amount,omitempty"`
 	RawData       map[string]string `json:"raw_data,omitempty"`
+
+	// SessionID identifies the payment by its checkout session when the
+	// TransactionID isn't known yet, see PaymentResponse.SessionID
+	SessionID string `json:"session_id,omitempty"`
 }
 
+// VerificationResponse reports the outcome of a verification.
+// Amount is the amount we requested; PaidAmount is what the provider reports
+// as actually paid.
 type VerificationResponse struct {
 	Success       bool              `json:"success"`
 	Status        PaymentStatus     `json:"status"`
@@ -76,6 +156,37 @@ type VerificationResponse struct {
 	Fee           money.Money       `json:"fee,omitempty"`
 	Message       string            `json:"message,omitempty"`
 	Metadata      map[string]string `json:"metadata,omitempty"`
+	// DeclineCode is the provider's code for a declined payment and
+	// DeclineReason its gateway-independent meaning
+	DeclineCode   string        `json:"decline_code,omitempty"`
+	DeclineReason DeclineReason `json:"decline_reason,omitempty"`
+	// TestMode is true when the gateway is running against its sandbox
+	TestMode bool `json:"test_mode,omitempty"`
+}
+
+// Underpaid reports whether the provider reported less than was requested.
+// Returns false if either amount is unknown or the currencies differ.
+func (v *VerificationResponse) Underpaid() bool {
+	cmp, ok := v.comparePaid()
+	return ok && cmp < 0
+}
+
+// Overpaid reports whether the provider reported more than was requested.
+// Returns false if either amount is unknown or the currencies differ.
+func (v *VerificationResponse) Overpaid() bool {
+	cmp, ok := v.comparePaid()
+	return ok && cmp > 0
+}
+
+func (v *VerificationResponse) comparePaid() (int, bool) {
+	if v.Amount.Currency().Code == "" || v.PaidAmount.Currency().Code == "" {
+		return 0, false
+	}
+	cmp, err := v.PaidAmount.Cmp(v.Amount)
+	if err != nil {
+		return 0, false
+	}
+	return cmp, true
 }
 
 type RefundRequest struct {
@@ -88,6 +199,27 @@ type RefundResponse struct {
 	Success  bool   `json:"success"`
 	RefundID string `json:"refund_id,omitempty"`
 	Message  string `json:"message,omitempty"`
+
+	// Remaining is the refundable balance after this refund, set when the
+	// manager tracks the transaction
+	Remaining money.Money `json:"remaining,omitempty"`
+}
+
+// StatusRequest identifies the payment to look up. Most providers need only
+// TransactionID; others look payments up by OrderID and Amount, or need
+// callback fields in RawData, like VerificationRequest.
+type StatusRequest struct {
+	TransactionID string `json:"transaction_id,omitempty"`
+	// SessionID is the provider session the payment was created under, for
+	// gateways such as Razorpay that look payments up by it until the
+	// provider has assigned a TransactionID
+	SessionID string      `json:"session_id,omitempty"`
+	OrderID   string      `json:"order_id,omitempty"`
+	Amount    money.Money `json:"amount,omitempty"`
+	// CustomerPhone is the payer's phone, for gateways such as IMEPay that
+	// look payments up by it
+	CustomerPhone string            `json:"customer_phone,omitempty"`
+	RawData       map[string]string `json:"raw_data,omitempty"`
 }
 
 type StatusResponse struct {
@@ -97,12 +229,35 @@ type StatusResponse struct {
 	Amount        money.Money   `json:"amount"`
 }
 
+// WebhookEventType classifies a webhook notification
+type WebhookEventType string
+
+const (
+	EventPayment    WebhookEventType = "payment"
+	EventRefund     WebhookEventType = "refund"
+	EventDispute    WebhookEventType = "dispute"
+	EventChargeback WebhookEventType = "chargeback"
+)
+
+// WebhookData is a parsed provider notification. For refund events RefundID
+// identifies the refund and TransactionID the original payment. For dispute
+// and chargeback events DueBy is the evidence submission deadline.
 type WebhookData struct {
+	EventType     WebhookEventType  `json:"event_type"`
+	EventID       string            `json:"event_id,omitempty"`
 	TransactionID string            `json:"transaction_id"`
 	OrderID       string            `json:"order_id"`
+	RefundID      string            `json:"refund_id,omitempty"`
+	DisputeID     string            `json:"dispute_id,omitempty"`
+	Reason        string            `json:"reason,omitempty"`
+	DueBy         time.Time         `json:"due_by,omitempty"`
 	Amount        money.Money       `json:"amount"`
 	Status        PaymentStatus     `json:"status"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
 	RawData       map[string]string `json:"raw_data"`
+	// ProviderEvent is the provider's own event type, e.g.
+	// payment_intent.succeeded, see RegisterWebhookEvents
+	ProviderEvent string `json:"provider_event,omitempty"`
 }
 
 // Config for each gateway
@@ -111,10 +266,69 @@ type GatewayConfig struct {
 	SecretKey   string
 	APIKey      string
 	BaseURL     string
-	Timeout     time.Duration
+	Timeout     time.Duration // Overrides the client timeout for each request when non-zero, see ResiliencePolicy.Timeout
 	Sandbox     bool
 	Currency    string // Default currency for the gateway
 	ExtraConfig map[string]interface{}
+
+	// WebhookSecret is used by WebhookHandler implementations to verify callbacks
+	WebhookSecret string
+
+	// ProxyURL routes this gateway's outbound requests through an HTTP(S) or
+	// SOCKS5 proxy, e.g. "socks5://egress.internal:1080", for providers that
+	// allowlist source IPs. Applied when the gateway is built from a factory.
+	ProxyURL string
+
+	// Debug attaches a redacted copy of failed outbound requests, including
+	// the signature base string, to the returned PaymentError
+	Debug bool
+
+	// LogSignatures logs the field order, base string and resulting
+	// signature of every signature a gateway computes, with secrets
+	// redacted. Intended for integrating new merchants; never enable it in
+	// production.
+	LogSignatures bool
+	// Logger receives signature logs. Nil uses the manager's logger, see
+	// PaymentManager.SetLogger, for gateways it builds from this config, or
+	// else slog.Default(). NewSlogLogger adapts a *slog.Logger.
+	Logger Logger
+
+	// SandboxAmounts maps amounts in minor units to simulated outcomes for
+	// simulated gateways in sandbox mode. Nil uses DefaultSandboxAmounts; an
+	// empty map disables them.
+	SandboxAmounts map[int64]SandboxOutcome
+
+	// AmountTolerance is how far an amount the provider reports may differ
+	// from the requested amount in gateways that cross-check it. The zero
+	// value requires an exact match.
+	AmountTolerance AmountTolerance
+
+	// Transport replaces the transport of this gateway's HTTP client, e.g.
+	// with an in-memory fake in tests. Applied when the gateway is built from
+	// a factory; it cannot be combined with ProxyURL.
+	Transport http.RoundTripper
+	// OnRateLimitHeaders, if set, receives the RateLimitHeaders of every
+	// provider response that has any, successful or not, so callers can pace
+	// their traffic before a 429. Applied when the gateway is built from a
+	// factory.
+	OnRateLimitHeaders func(method string, headers map[string]string)
+	// Clock supplies the current time to the gateway. Nil uses time.Now.
+	Clock Clock
+}
+
+// GetWebhookSecret returns WebhookSecret, falling back to
+// ExtraConfig["webhook_secret"] for older configurations
+func (c *GatewayConfig) GetWebhookSecret() string {
+	if c == nil {
+		return ""
+	}
+	if c.WebhookSecret != "" {
+		return c.WebhookSecret
+	}
+	if secret, ok := c.ExtraConfig["webhook_secret"].(string); ok {
+		return secret
+	}
+	return ""
 }
 
 // GatewayFactory is a function that creates a gateway instance
@@ -0,0 +1,177 @@
+package payment
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/oarkflow/money"
+)
+
+func TestVerificationResponsePaidAmount(t *testing.T) {
+	npr := money.MustCurrency("NPR")
+	usd := money.MustCurrency("USD")
+
+	tests := []struct {
+		name      string
+		amount    money.Money
+		paid      money.Money
+		underpaid bool
+		overpaid  bool
+	}{
+		{"exact", money.New(100, npr), money.New(100, npr), false, false},
+		{"underpaid", money.New(100, npr), money.New(90, npr), true, false},
+		{"overpaid", money.New(100, npr), money.New(110, npr), false, true},
+		{"paid unknown", money.New(100, npr), money.Money{}, false, false},
+		{"currency mismatch", money.New(100, npr), money.New(1, usd), false, false},
+	}
+
+	for _, tt := range tests {
+		v := &VerificationResponse{Amount: tt.amount, PaidAmount: tt.paid}
+		if got := v.Underpaid(); got != tt.underpaid {
+			t.Errorf("%s: Underpaid() = %v; want %v", tt.name, got, tt.underpaid)
+		}
+		if got := v.Overpaid(); got != tt.overpaid {
+			t.Errorf("%s: Overpaid() = %v; want %v", tt.name, got, tt.overpaid)
+		}
+	}
+}
+
+func TestPaymentStatusClassification(t *testing.T) {
+	tests := []struct {
+		status   PaymentStatus
+		terminal bool
+		success  bool
+	}{
+		{StatusPending, false, false},
+		{StatusRequiresAction, false, false},
+		{StatusDisputed, false, false},
+		{StatusCompleted, true, true},
+		{StatusFailed, true, false},
+		{StatusRefunded, true, false},
+		{StatusCanceled, true, false},
+	}
+	for _, tt := range tests {
+		if got := tt.status.IsTerminal(); got != tt.terminal {
+			t.Errorf("%s.IsTerminal() = %v, want %v", tt.status, got, tt.terminal)
+		}
+		if got := tt.status.IsSuccess(); got != tt.success {
+			t.Errorf("%s.IsSuccess() = %v, want %v", tt.status, got, tt.success)
+		}
+	}
+}
+
+func TestMetadataNamespace(t *testing.T) {
+	ours := map[string]string{"cart": "42"}
+	sent := NamespaceMetadata(ours)
+	if sent["m_cart"] != "42" {
+		t.Errorf("Expected m_cart to be set, got %v", sent)
+	}
+
+	// Provider echoes our keys alongside its own
+	sent["order_id"] = "provider-owned"
+	back := StripMetadataNamespace(sent)
+	if len(back) != 1 || back["cart"] != "42" {
+		t.Errorf("Expected round-trip to {cart:42}, got %v", back)
+	}
+}
+
+func TestQRPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    *PaymentResponse
+		want    string
+		wantErr bool
+	}{
+		{"payment url", &PaymentResponse{PaymentURL: "https://pay.example.com/1"}, "https://pay.example.com/1", false},
+		{"upi intent", &PaymentResponse{PaymentURL: "https://pay.example.com/1", Metadata: map[string]string{MetadataUPIIntent: "upi://pay?pa=m@upi"}}, "upi://pay?pa=m@upi", false},
+		{"qr payload", &PaymentResponse{Metadata: map[string]string{MetadataQRPayload: "000201", MetadataUPIIntent: "upi://pay"}}, "000201", false},
+		{"empty", &PaymentResponse{}, "", true},
+		{"nil", nil, "", true},
+	}
+	for _, tt := range tests {
+		got, err := QRPayload(tt.resp)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: QRPayload() = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestQRCodeForResponse(t *testing.T) {
+	if _, err := QRCodeForResponse(&PaymentResponse{}); !errors.Is(err, ErrNoQRPayload) {
+		t.Errorf("Expected ErrNoQRPayload, got %v", err)
+	}
+	// Without the qrcode tag there is no renderer
+	png, err := QRCodeForResponse(&PaymentResponse{PaymentURL: "https://pay.example.com/1"})
+	if err != nil && !errors.Is(err, ErrQRCodeUnavailable) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err == nil && !bytes.HasPrefix(png, []byte("\x89PNG")) {
+		t.Errorf("Expected a PNG, got %q", png[:min(len(png), 8)])
+	}
+}
+
+func TestNewVerificationResponse(t *testing.T) {
+	npr := money.MustCurrency("NPR")
+
+	ok := NewVerificationResponse(WithStatus(StatusCompleted), WithTransactionID("T1"), WithAmount(money.New(100, npr)))
+	if err := ok.Validate(); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+	if !ok.Success || !ok.PaidAmount.Equals(money.New(100, npr)) {
+		t.Errorf("Successful payment should default paid amount to amount, got %+v", ok)
+	}
+
+	failed := NewVerificationResponse(WithStatus(StatusFailed), WithOrderID("O1"), WithCurrency("NPR"))
+	if err := failed.Validate(); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+	if failed.Success || !failed.PaidAmount.IsZero() || failed.PaidAmount.Currency().Code != "NPR" {
+		t.Errorf("Failed payment should have zero NPR paid amount, got %+v", failed)
+	}
+
+	if err := (&VerificationResponse{Status: StatusCompleted}).Validate(); err == nil {
+		t.Error("Expected validation error for an incomplete response")
+	}
+}
+
+func TestNormalizeDeclineCode(t *testing.T) {
+	for code, want := range map[string]DeclineReason{
+		"insufficient_funds":   DeclineInsufficientFunds,
+		"INSUFFICIENT_BALANCE": DeclineInsufficientFunds,
+		"expired_card":         DeclineCardExpired,
+		"do_not_honor":         DeclineDoNotHonor,
+		"something_new":        DeclineOther,
+		"":                     "",
+	} {
+		if got := NormalizeDeclineCode(code); got != want {
+			t.Errorf("NormalizeDeclineCode(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestAmountTolerance(t *testing.T) {
+	usd := money.MustCurrency("USD")
+	expected := money.NewFromMinor(10000, usd)
+
+	tests := []struct {
+		name      string
+		tolerance AmountTolerance
+		paid      money.Money
+		want      bool
+	}{
+		{"exact", AmountTolerance{}, money.NewFromMinor(10000, usd), true},
+		{"cent short, exact", AmountTolerance{}, money.NewFromMinor(9999, usd), false},
+		{"cent short", AmountTolerance{Minor: 1}, money.NewFromMinor(9999, usd), true},
+		{"cent over", AmountTolerance{Minor: 1}, money.NewFromMinor(10001, usd), true},
+		{"underpaid", AmountTolerance{Minor: 1}, money.NewFromMinor(9000, usd), false},
+		{"within relative", AmountTolerance{Relative: 0.001}, money.NewFromMinor(9990, usd), true},
+		{"beyond relative", AmountTolerance{Relative: 0.001}, money.NewFromMinor(9989, usd), false},
+		{"other currency", AmountTolerance{Minor: 100}, money.NewFromMinor(10000, money.MustCurrency("EUR")), false},
+	}
+	for _, tt := range tests {
+		if got := tt.tolerance.Allows(expected, tt.paid); got != tt.want {
+			t.Errorf("%s: Allows = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
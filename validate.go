@@ -0,0 +1,108 @@
+package payment
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// FieldError is one invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (f FieldError) String() string { return f.Field + ": " + f.Message }
+
+// ValidationError lists every invalid field of a request. HTTPStatusForError
+// maps it to 400.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.String()
+	}
+	return "invalid payment request: " + strings.Join(parts, "; ")
+}
+
+// RequestValidator is implemented by gateways with requirements beyond
+// PaymentRequest.Validate, such as a phone number format. InitiatePayment
+// reports its field errors along with the common ones.
+type RequestValidator interface {
+	ValidateRequest(req *PaymentRequest) []FieldError
+}
+
+// Validate checks that the request has a positive amount, an order id and
+// an absolute http(s) SuccessURL, and that any tax is consistent. It returns
+// a *ValidationError listing every failing field.
+func (r *PaymentRequest) Validate() error {
+	return validationError(r.fieldErrors(true))
+}
+
+// fieldErrors returns the request's invalid fields. SuccessURL may be empty
+// unless requireSuccessURL is set.
+func (r *PaymentRequest) fieldErrors(requireSuccessURL bool) []FieldError {
+	var fields []FieldError
+	if !r.Amount.IsPositive() {
+		fields = append(fields, FieldError{"amount", "must be greater than zero"})
+	}
+	if strings.TrimSpace(r.OrderID) == "" {
+		fields = append(fields, FieldError{"order_id", "is required"})
+	}
+	if r.SuccessURL == "" {
+		if requireSuccessURL {
+			fields = append(fields, FieldError{"success_url", "is required"})
+		}
+	} else if err := checkRedirectURL(r.SuccessURL); err != nil {
+		fields = append(fields, FieldError{"success_url", err.Error()})
+	}
+	if err := r.ValidateTax(); err != nil {
+		fields = append(fields, FieldError{"tax_amount", err.Error()})
+	}
+	return fields
+}
+
+// checkRedirectURL checks that raw is an absolute http or https URL
+func checkRedirectURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("is not a valid URL")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// validateFor checks req for g: the common checks, the currency, the
+// customer details g's capabilities require, and g's own RequestValidator
+// rules. Push-flow gateways don't redirect the customer, so they don't need
+// a SuccessURL.
+func validateFor(g Gateway, req *PaymentRequest) error {
+	caps := Capabilities(g)
+	fields := req.fieldErrors(caps.Flow != FlowPush)
+	if code := req.Amount.Currency().Code; code != "" && !SupportsCurrency(g, code) {
+		fields = append(fields, FieldError{"amount", "currency " + code + " is not supported by " + g.GetMethod()})
+	}
+	if caps.RequiresPhone && strings.TrimSpace(req.CustomerPhone) == "" {
+		fields = append(fields, FieldError{"customer_phone", "is required by " + g.GetMethod()})
+	}
+	if caps.RequiresEmail && strings.TrimSpace(req.CustomerEmail) == "" {
+		fields = append(fields, FieldError{"customer_email", "is required by " + g.GetMethod()})
+	}
+	if v, ok := UnwrapGateway(g).(RequestValidator); ok {
+		fields = append(fields, v.ValidateRequest(req)...)
+	}
+	return validationError(fields)
+}
+
+// validationError returns a *ValidationError for fields, or nil without any
+func validationError(fields []FieldError) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
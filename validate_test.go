@@ -0,0 +1,81 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/oarkflow/money"
+)
+
+// invalidFields returns the fields listed by err, a *ValidationError
+func invalidFields(t *testing.T, err error) []string {
+	t.Helper()
+	var verr *ValidationError
+	if err == nil {
+		return nil
+	}
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a *ValidationError, got %v", err)
+	}
+	fields := make([]string, len(verr.Fields))
+	for i, f := range verr.Fields {
+		fields[i] = f.Field
+	}
+	return fields
+}
+
+func TestPaymentRequestValidate(t *testing.T) {
+	npr := money.MustCurrency("NPR")
+	tests := []struct {
+		name   string
+		req    PaymentRequest
+		fields []string
+	}{
+		{"valid", PaymentRequest{OrderID: "O1", Amount: money.New(100, npr), SuccessURL: testSuccessURL}, nil},
+		{"empty", PaymentRequest{}, []string{"amount", "order_id", "success_url"}},
+		{"negative amount", PaymentRequest{OrderID: "O1", Amount: money.New(-1, npr), SuccessURL: testSuccessURL}, []string{"amount"}},
+		{"relative URL", PaymentRequest{OrderID: "O1", Amount: money.New(100, npr), SuccessURL: "/done"}, []string{"success_url"}},
+		{"other scheme", PaymentRequest{OrderID: "O1", Amount: money.New(100, npr), SuccessURL: "javascript:alert(1)"}, []string{"success_url"}},
+		{"bad tax", PaymentRequest{OrderID: "O1", Amount: money.New(100, npr), SuccessURL: testSuccessURL, TaxAmount: money.New(-1, npr)}, []string{"tax_amount"}},
+	}
+	for _, tt := range tests {
+		if got := invalidFields(t, tt.req.Validate()); !slices.Equal(got, tt.fields) {
+			t.Errorf("%s: invalid fields %v, want %v", tt.name, got, tt.fields)
+		}
+	}
+}
+
+// phoneGateway requires a customer phone and rejects order "blocked"
+type phoneGateway struct{ fakeGateway }
+
+func (p *phoneGateway) Capabilities() GatewayCapabilities {
+	return GatewayCapabilities{Flow: FlowRedirect, RequiresPhone: true}
+}
+
+func (p *phoneGateway) ValidateRequest(req *PaymentRequest) []FieldError {
+	if req.OrderID == "blocked" {
+		return []FieldError{{Field: "order_id", Message: "is blocked"}}
+	}
+	return nil
+}
+
+func TestInitiatePaymentValidates(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.RegisterGateway("phone", &phoneGateway{fakeGateway{method: "phone"}})
+	ctx := context.Background()
+
+	_, err := pm.InitiatePayment(ctx, "phone", &PaymentRequest{OrderID: "blocked"})
+	if got, want := invalidFields(t, err), []string{"amount", "success_url", "customer_phone", "order_id"}; !slices.Equal(got, want) {
+		t.Errorf("Invalid fields %v, want %v", got, want)
+	}
+	if HTTPStatusForError(err) != 400 {
+		t.Errorf("Expected 400, got %d", HTTPStatusForError(err))
+	}
+
+	req := &PaymentRequest{OrderID: "O1", Amount: money.New(100, money.MustCurrency("NPR")), SuccessURL: testSuccessURL, CustomerPhone: "9800000000"}
+	if _, err := pm.InitiatePayment(ctx, "phone", req); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
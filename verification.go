@@ -0,0 +1,203 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/oarkflow/money"
+)
+
+// VerificationOption sets a field on a VerificationResponse built by
+// NewVerificationResponse
+type VerificationOption func(*verificationBuilder)
+
+type verificationBuilder struct {
+	resp     VerificationResponse
+	currency string
+}
+
+func WithStatus(status PaymentStatus) VerificationOption {
+	return func(b *verificationBuilder) { b.resp.Status = status }
+}
+
+func WithTransactionID(id string) VerificationOption {
+	return func(b *verificationBuilder) { b.resp.TransactionID = id }
+}
+
+func WithOrderID(id string) VerificationOption {
+	return func(b *verificationBuilder) { b.resp.OrderID = id }
+}
+
+// WithAmount sets the requested amount
+func WithAmount(amount money.Money) VerificationOption {
+	return func(b *verificationBuilder) { b.resp.Amount = amount }
+}
+
+// WithPaidAmount sets the amount the provider reports as paid
+func WithPaidAmount(amount money.Money) VerificationOption {
+	return func(b *verificationBuilder) { b.resp.PaidAmount = amount }
+}
+
+func WithFee(fee money.Money) VerificationOption {
+	return func(b *verificationBuilder) { b.resp.Fee = fee }
+}
+
+func WithMessage(message string) VerificationOption {
+	return func(b *verificationBuilder) { b.resp.Message = message }
+}
+
+func WithMetadata(metadata map[string]string) VerificationOption {
+	return func(b *verificationBuilder) { b.resp.Metadata = metadata }
+}
+
+// WithCurrency sets the currency used for money fields that have none,
+// typically the gateway's configured currency
+func WithCurrency(code string) VerificationOption {
+	return func(b *verificationBuilder) { b.currency = code }
+}
+
+// NewVerificationResponse builds a VerificationResponse with every field set:
+//   - Status defaults to pending and Success is derived from it
+//   - unset money fields are zero in the response's currency, except that
+//     PaidAmount defaults to Amount for successful payments whose provider
+//     doesn't report a paid amount
+//   - Metadata is never nil and Message describes the status if unset
+func NewVerificationResponse(opts ...VerificationOption) *VerificationResponse {
+	b := &verificationBuilder{}
+	for _, opt := range opts {
+		opt(b)
+	}
+	resp := &b.resp
+
+	if resp.Status == "" {
+		resp.Status = StatusPending
+	}
+	resp.Success = resp.Status.IsSuccess()
+
+	currency := b.currency
+	for _, m := range []money.Money{resp.Amount, resp.PaidAmount, resp.Fee} {
+		if code := m.Currency().Code; code != "" {
+			currency = code
+			break
+		}
+	}
+	if c, ok := money.GetCurrency(currency); ok {
+		if !hasCurrency(resp.PaidAmount) && resp.Success && hasCurrency(resp.Amount) {
+			resp.PaidAmount = resp.Amount
+		}
+		for _, m := range []*money.Money{&resp.Amount, &resp.PaidAmount, &resp.Fee} {
+			if !hasCurrency(*m) {
+				*m = money.NewFromMinor(0, c)
+			}
+		}
+	}
+
+	if resp.Metadata == nil {
+		resp.Metadata = map[string]string{}
+	}
+	if resp.Message == "" {
+		resp.Message = fmt.Sprintf("Payment %s", resp.Status)
+		if resp.Success {
+			resp.Message = "Payment verified successfully"
+		}
+	}
+	return resp
+}
+
+func hasCurrency(m money.Money) bool {
+	return m.Currency().Code != ""
+}
+
+// Validate reports whether every field of the response is set consistently,
+// as NewVerificationResponse guarantees
+func (v *VerificationResponse) Validate() error {
+	problems := []error{}
+	if v.Status == "" {
+		problems = append(problems, errors.New("status is empty"))
+	}
+	if v.Success != v.Status.IsSuccess() {
+		problems = append(problems, fmt.Errorf("success %v contradicts status %s", v.Success, v.Status))
+	}
+	if v.TransactionID == "" && v.OrderID == "" {
+		problems = append(problems, errors.New("neither transaction nor order id is set"))
+	}
+	code := v.Amount.Currency().Code
+	fields := []struct {
+		name string
+		m    money.Money
+	}{{"amount", v.Amount}, {"paid amount", v.PaidAmount}, {"fee", v.Fee}}
+	for _, f := range fields {
+		if !hasCurrency(f.m) {
+			problems = append(problems, fmt.Errorf("%s has no currency", f.name))
+		} else if f.m.Currency().Code != code {
+			problems = append(problems, fmt.Errorf("%s currency %s differs from %s", f.name, f.m.Currency().Code, code))
+		}
+	}
+	if v.Metadata == nil {
+		problems = append(problems, errors.New("metadata is nil"))
+	}
+	if v.Message == "" {
+		problems = append(problems, errors.New("message is empty"))
+	}
+	return errors.Join(problems...)
+}
+
+// ErrMissingVerificationData is returned when a VerificationRequest lacks
+// fields the gateway needs to verify the payment
+var ErrMissingVerificationData = errors.New("missing verification data")
+
+// VerificationFielder is implemented by gateways that declare the data they
+// need to verify a payment. Each entry is a RawData key; alternatives are
+// separated by "|", and transaction_id, order_id, session_id and amount name
+// the VerificationRequest fields.
+type VerificationFielder interface {
+	RequiredVerificationFields() []string
+}
+
+// RequiredVerificationFields returns the fields g needs to verify a payment,
+// or nil if it doesn't declare them
+func RequiredVerificationFields(g Gateway) []string {
+	if vf, ok := UnwrapGateway(g).(VerificationFielder); ok {
+		return vf.RequiredVerificationFields()
+	}
+	return nil
+}
+
+// MissingFields returns the entries of required that r doesn't satisfy
+func (r *VerificationRequest) MissingFields(required []string) []string {
+	missing := []string{}
+	for _, field := range required {
+		if !r.hasAny(strings.Split(field, "|")) {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+func (r *VerificationRequest) hasAny(names []string) bool {
+	for _, name := range names {
+		switch name {
+		case "transaction_id":
+			if r.TransactionID != "" {
+				return true
+			}
+		case "order_id":
+			if r.OrderID != "" {
+				return true
+			}
+		case "session_id":
+			if r.SessionID != "" {
+				return true
+			}
+		case "amount":
+			if !r.Amount.IsZero() {
+				return true
+			}
+		}
+		if r.RawData[name] != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// VerifyRetryOptions makes VerifyPayment retry while the provider doesn't
+// know the transaction yet or still reports it pending, as happens when a
+// customer returns before the provider has settled the payment. Definitive
+// failures are never retried.
+type VerifyRetryOptions struct {
+	// MaxWait bounds the total time spent retrying. Zero disables retries.
+	MaxWait time.Duration
+	// InitialBackoff is the wait before the first retry, doubled after each
+	// attempt. It defaults to 500ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts. It defaults to 5s.
+	MaxBackoff time.Duration
+}
+
+// SetVerifyRetry configures retries of not-yet-settled verifications. A zero
+// MaxWait turns retries off.
+func (pm *PaymentManager) SetVerifyRetry(opts VerifyRetryOptions) {
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = 500 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Second
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.verifyRetry = opts
+}
+
+// notYetSettled reports whether a verification result means the provider
+// hasn't finished with the payment, rather than that it failed
+func notYetSettled(resp *VerificationResponse, err error) bool {
+	if err != nil {
+		var perr *PaymentError
+		return errors.Is(err, ErrTransactionNotFound) || (errors.As(err, &perr) && perr.Kind == ErrKindNotFound)
+	}
+	return resp != nil && resp.Status == StatusPending
+}
+
+// verifyWithRetry calls g.VerifyPayment, retrying with backoff while the
+// result is not yet settled and the retry window is open. The last result
+// is returned when the window closes. Each attempt also retries transient
+// failures under the gateway's ResiliencePolicy.
+func (pm *PaymentManager) verifyWithRetry(ctx context.Context, g Gateway, req *VerificationRequest) (*VerificationResponse, error) {
+	pm.mu.RLock()
+	opts := pm.verifyRetry
+	pm.mu.RUnlock()
+	policy := pm.ResiliencePolicy(g.GetMethod()).Retry
+
+	deadline := time.Now().Add(opts.MaxWait)
+	backoff := opts.InitialBackoff
+	for {
+		resp, err := retryTransient(ctx, policy, func() (*VerificationResponse, error) {
+			return pm.verifyOnce(ctx, g, req)
+		})
+		if opts.MaxWait <= 0 || !notYetSettled(resp, err) || time.Now().Add(backoff).After(deadline) {
+			return resp, err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, opts.MaxBackoff)
+	}
+}
+
+// verifyOnce makes a single verification call under the concurrency limits
+func (pm *PaymentManager) verifyOnce(ctx context.Context, g Gateway, req *VerificationRequest) (*VerificationResponse, error) {
+	ctx, done, err := pm.guard(ctx, g.GetMethod())
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := g.VerifyPayment(ctx, req)
+	pm.trackLatency(g.GetMethod(), start)
+	done(err)
+	return resp, err
+}
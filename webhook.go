@@ -0,0 +1,291 @@
+package payment
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrDuplicateWebhook is returned by HandleWebhook for an event it has
+// already handled, identified by WebhookData.EventID
+var ErrDuplicateWebhook = errors.New("duplicate webhook event")
+
+// ErrWebhookEventIgnored is returned for webhook events outside those
+// registered with RegisterWebhookEvents, and by gateways for event types
+// they don't model. WebhookMux acknowledges them with 200.
+var ErrWebhookEventIgnored = errors.New("webhook event ignored")
+
+// webhookDedupTTL is how long handled event ids are remembered. Providers
+// stop redelivering well within a day.
+const webhookDedupTTL = 24 * time.Hour
+
+// maxSeenWebhooks bounds the remembered event ids before expired ones are
+// pruned
+const maxSeenWebhooks = 10000
+
+// WebhookSubscriber is called with every webhook event the manager handles.
+// data is shared between subscribers and must not be modified.
+type WebhookSubscriber func(method string, data *WebhookData)
+
+// webhookEvents deduplicates handled webhook events and fans them out to
+// subscribers
+type webhookEvents struct {
+	seen        map[string]time.Time
+	subscribers map[int]WebhookSubscriber
+	nextID      int
+	// handled holds each method's registered event types, see
+	// RegisterWebhookEvents
+	handled map[string]map[string]bool
+	// events serializes deliveries of the same event, so a redelivery
+	// waits for the first to be processed and marked seen
+	events keyLocks
+	mu     sync.Mutex
+}
+
+func newWebhookEvents() *webhookEvents {
+	return &webhookEvents{
+		seen:        make(map[string]time.Time),
+		subscribers: make(map[int]WebhookSubscriber),
+		handled:     make(map[string]map[string]bool),
+	}
+}
+
+// RegisterWebhookEvents limits the webhook events HandleWebhook processes
+// for method to types, added to those registered before. A type matches
+// either the provider's event type (WebhookData.ProviderEvent, e.g.
+// "charge.refunded") or our WebhookEventType (e.g. "refund"). Other events
+// fail with ErrWebhookEventIgnored. Calling it without types handles every
+// event again.
+func (pm *PaymentManager) RegisterWebhookEvents(method string, types ...string) {
+	method = pm.ResolveMethod(method)
+	e := pm.webhooks
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(types) == 0 {
+		delete(e.handled, method)
+		return
+	}
+	if e.handled[method] == nil {
+		e.handled[method] = make(map[string]bool)
+	}
+	for _, t := range types {
+		e.handled[method][t] = true
+	}
+}
+
+// handles reports whether data is among the events registered for method.
+// Every event is handled when none are registered.
+func (e *webhookEvents) handles(method string, data *WebhookData) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	types, ok := e.handled[method]
+	return !ok || types[data.ProviderEvent] || types[string(data.EventType)]
+}
+
+// isSeen reports whether key was marked seen within webhookDedupTTL
+func (e *webhookEvents) isSeen(key string, now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	at, ok := e.seen[key]
+	return ok && now.Sub(at) < webhookDedupTTL
+}
+
+// markSeen records key as handled at now
+func (e *webhookEvents) markSeen(key string, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.seen) >= maxSeenWebhooks {
+		for k, at := range e.seen {
+			if now.Sub(at) >= webhookDedupTTL {
+				delete(e.seen, k)
+			}
+		}
+	}
+	e.seen[key] = now
+}
+
+func (e *webhookEvents) publish(method string, data *WebhookData) {
+	e.mu.Lock()
+	ids := make([]int, 0, len(e.subscribers))
+	for id := range e.subscribers {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	subs := make([]WebhookSubscriber, len(ids))
+	for i, id := range ids {
+		subs[i] = e.subscribers[id]
+	}
+	e.mu.Unlock()
+
+	for _, fn := range subs {
+		fn(method, data)
+	}
+}
+
+// SubscribeWebhooks calls fn, in subscription order, for every event
+// HandleWebhook processes. Duplicates are not delivered. The returned func
+// removes the subscription.
+func (pm *PaymentManager) SubscribeWebhooks(fn WebhookSubscriber) (unsubscribe func()) {
+	e := pm.webhooks
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	id := e.nextID
+	e.nextID++
+	e.subscribers[id] = fn
+	return func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.subscribers, id)
+	}
+}
+
+// WebhookMux returns a handler for every registered gateway's webhooks at
+// POST /webhooks/{method}. Events are handled by HandleWebhook; duplicates
+// and ignored events are acknowledged with 200 so providers stop
+// redelivering them, and errors get the status from HTTPStatusForError.
+// Mount it at the server root.
+func (pm *PaymentManager) WebhookMux() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /webhooks/{method}", func(w http.ResponseWriter, r *http.Request) {
+		_, err := pm.HandleWebhook(r.PathValue("method"), r)
+		switch {
+		case errors.Is(err, ErrDuplicateWebhook):
+			writeJSON(w, http.StatusOK, map[string]string{"status": "duplicate"})
+		case errors.Is(err, ErrWebhookEventIgnored):
+			writeJSON(w, http.StatusOK, map[string]string{"status": "ignored"})
+		case err != nil:
+			writeResult(w, nil, err)
+		default:
+			writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		}
+	})
+	return mux
+}
+
+// ReadWebhookBody reads the request body and restores it so it can be read
+// again, e.g. by ValidateWebhook followed by ParseWebhook
+func ReadWebhookBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// HandleWebhook validates and parses a callback for method and applies it to
+// the transaction store: completed refunds move the original payment to
+// StatusRefunded or StatusPartiallyRefunded. The event is then published to
+// SubscribeWebhooks subscribers. Events with an EventID already handled are
+// returned with ErrDuplicateWebhook; an event whose processing failed is not
+// marked handled, so the provider's redelivery is processed again. Events
+// not registered with RegisterWebhookEvents for method, or the method it
+// aliases, are returned with ErrWebhookEventIgnored. The gateway must
+// implement WebhookHandler.
+func (pm *PaymentManager) HandleWebhook(method string, req *http.Request) (*WebhookData, error) {
+	g, err := pm.GetGateway(method)
+	if err != nil {
+		return nil, err
+	}
+	wh, ok := UnwrapGateway(g).(WebhookHandler)
+	if !ok {
+		return nil, NewPaymentError(ErrKindUnsupported, method, "webhooks not supported", nil)
+	}
+	if err := wh.ValidateWebhook(req); err != nil {
+		return nil, err
+	}
+	data, err := wh.ParseWebhook(req)
+	if err != nil {
+		return nil, err
+	}
+	if !pm.webhooks.handles(pm.ResolveMethod(method), data) {
+		event := data.ProviderEvent
+		if event == "" {
+			event = string(data.EventType)
+		}
+		return data, fmt.Errorf("%w: %s %s", ErrWebhookEventIgnored, g.GetMethod(), event)
+	}
+
+	if data.EventID != "" {
+		key := g.GetMethod() + "|" + data.EventID
+		unlock := pm.webhooks.events.lock(key)
+		defer unlock()
+		if pm.webhooks.isSeen(key, time.Now()) {
+			return data, fmt.Errorf("%w: %s %s", ErrDuplicateWebhook, g.GetMethod(), data.EventID)
+		}
+	}
+
+	if data.EventType == EventRefund && (data.Status == StatusRefunded || data.Status == StatusPartiallyRefunded) {
+		if err := pm.applyRefundWebhook(g.GetMethod(), data); err != nil {
+			return data, err
+		}
+	}
+	if data.EventID != "" {
+		pm.webhooks.markSeen(g.GetMethod()+"|"+data.EventID, time.Now())
+	}
+	pm.webhooks.publish(g.GetMethod(), data)
+	return data, nil
+}
+
+// applyRefundWebhook records a completed refund against the stored payment.
+// Refunds already recorded, e.g. made through RefundPayment, and refunds of
+// payments the store doesn't know are skipped. It fails only if the store
+// does.
+func (pm *PaymentManager) applyRefundWebhook(method string, data *WebhookData) error {
+	store := pm.GetTransactionStore()
+	if store == nil || data.TransactionID == "" {
+		return nil
+	}
+	unlock := pm.refundLocks.lock(data.TransactionID)
+	defer unlock()
+
+	txn, err := store.Get(data.TransactionID)
+	if errors.Is(err, ErrTransactionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if data.RefundID != "" && slices.ContainsFunc(txn.Refunds, func(r RefundRecord) bool { return r.RefundID == data.RefundID }) {
+		return nil
+	}
+
+	// Refund the balance when the event has no usable amount, and never
+	// record more than was captured
+	remaining, err := txn.RefundableBalance()
+	if err != nil || !remaining.IsPositive() {
+		return nil
+	}
+	amount := data.Amount
+	if cmp, err := amount.Cmp(remaining); err != nil || cmp > 0 || !amount.IsPositive() {
+		amount = remaining
+	}
+
+	left, err := txn.addRefund(RefundRecord{RefundID: data.RefundID, Amount: amount, CreatedAt: time.Now()})
+	if err != nil {
+		return nil
+	}
+	if err := store.Save(txn); err != nil {
+		return err
+	}
+	pm.recordLedger(LedgerEntry{
+		Time:          txn.UpdatedAt,
+		Type:          LedgerRefunded,
+		Method:        method,
+		TransactionID: txn.ID,
+		OrderID:       txn.OrderID,
+		Amount:        amount,
+		Status:        refundStatus(left),
+		Reference:     data.RefundID,
+	})
+	return nil
+}
@@ -0,0 +1,223 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/money"
+)
+
+// webhookGateway returns a fixed event from ParseWebhook
+type webhookGateway struct {
+	fakeGateway
+	event *WebhookData
+}
+
+func (g *webhookGateway) ValidateWebhook(req *http.Request) error { return nil }
+
+func (g *webhookGateway) ParseWebhook(req *http.Request) (*WebhookData, error) {
+	cp := *g.event
+	return &cp, nil
+}
+
+func TestHandleWebhookRefunds(t *testing.T) {
+	pm := NewPaymentManager(0)
+	pm.SetTransactionStore(NewMemoryTransactionStore())
+	g := &webhookGateway{fakeGateway: fakeGateway{method: "fake"}}
+	pm.RegisterGateway("fake", g)
+	ctx := context.Background()
+
+	usd := money.MustCurrency("USD")
+	resp, err := pm.InitiatePayment(ctx, "fake", &PaymentRequest{OrderID: "O1", Amount: money.New(100, usd), SuccessURL: testSuccessURL})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := pm.VerifyPayment(ctx, "fake", &VerificationRequest{TransactionID: resp.TransactionID, Amount: money.New(100, usd)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		refundID string
+		amount   int64
+		event    PaymentStatus
+		status   PaymentStatus
+		refunded int64
+	}{
+		{"re_1", 30, StatusPartiallyRefunded, StatusPartiallyRefunded, 30},
+		{"re_1", 30, StatusPartiallyRefunded, StatusPartiallyRefunded, 30}, // redelivered
+		{"re_2", 20, StatusRefunded, StatusPartiallyRefunded, 50},
+		{"re_3", 500, StatusRefunded, StatusRefunded, 100}, // capped at the captured amount
+	}
+	for _, tt := range tests {
+		g.event = &WebhookData{EventType: EventRefund, Status: tt.event, TransactionID: resp.TransactionID, RefundID: tt.refundID, Amount: money.New(tt.amount, usd)}
+		if _, err := pm.HandleWebhook("fake", httptest.NewRequest(http.MethodPost, "/", nil)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		txn, _ := pm.GetTransactionStore().Get(resp.TransactionID)
+		if txn.Status != tt.status || !txn.Refunded.Equals(money.New(tt.refunded, usd)) {
+			t.Errorf("%s: expected %s with %d refunded, got %s with %s", tt.refundID, tt.status, tt.refunded, txn.Status, txn.Refunded)
+		}
+	}
+
+	pm.RegisterGateway("plain", &fakeGateway{method: "plain"})
+	if _, err := pm.HandleWebhook("plain", httptest.NewRequest(http.MethodPost, "/", nil)); HTTPStatusForError(err) != http.StatusNotImplemented {
+		t.Errorf("Expected unsupported, got %v", err)
+	}
+}
+
+func TestWebhookMux(t *testing.T) {
+	pm := NewPaymentManager(0)
+	g := &webhookGateway{fakeGateway: fakeGateway{method: "fake"}}
+	pm.RegisterGateway("fake", g)
+	pm.RegisterGateway("plain", &fakeGateway{method: "plain"})
+
+	var got []string
+	unsubscribe := pm.SubscribeWebhooks(func(method string, data *WebhookData) {
+		got = append(got, method+":"+data.EventID)
+	})
+	mux := pm.WebhookMux()
+	post := func(path string) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		return rec.Code
+	}
+
+	g.event = &WebhookData{EventType: EventPayment, EventID: "evt_1", Status: StatusCompleted}
+	if code := post("/webhooks/fake"); code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", code)
+	}
+	if code := post("/webhooks/fake"); code != http.StatusOK {
+		t.Errorf("Expected a duplicate to be acknowledged, got %d", code)
+	}
+	g.event = &WebhookData{EventType: EventPayment, EventID: "evt_2", Status: StatusCompleted}
+	post("/webhooks/fake")
+	if len(got) != 2 || got[0] != "fake:evt_1" || got[1] != "fake:evt_2" {
+		t.Errorf("Expected each event published once, got %v", got)
+	}
+
+	unsubscribe()
+	g.event = &WebhookData{EventType: EventPayment, EventID: "evt_3", Status: StatusCompleted}
+	post("/webhooks/fake")
+	if len(got) != 2 {
+		t.Errorf("Expected no delivery after unsubscribing, got %v", got)
+	}
+
+	if code := post("/webhooks/missing"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unregistered gateway, got %d", code)
+	}
+	if code := post("/webhooks/plain"); code != http.StatusNotImplemented {
+		t.Errorf("Expected 501 without webhook support, got %d", code)
+	}
+}
+
+func TestRegisterWebhookEvents(t *testing.T) {
+	pm := NewPaymentManager(0)
+	g := &webhookGateway{fakeGateway: fakeGateway{method: "fake"}}
+	pm.RegisterGateway("fake", g)
+	var got []string
+	pm.SubscribeWebhooks(func(method string, data *WebhookData) {
+		got = append(got, data.EventID)
+	})
+	handle := func(id, providerEvent string, eventType WebhookEventType) error {
+		g.event = &WebhookData{EventID: id, ProviderEvent: providerEvent, EventType: eventType}
+		_, err := pm.HandleWebhook("fake", httptest.NewRequest(http.MethodPost, "/", nil))
+		return err
+	}
+
+	// Every event is handled until types are registered
+	if err := handle("evt_1", "customer.created", "other"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pm.RegisterWebhookEvents("FAKE", "payment_intent.succeeded")
+	pm.RegisterWebhookEvents("fake", string(EventRefund))
+	if err := handle("evt_2", "payment_intent.succeeded", EventPayment); err != nil {
+		t.Errorf("Expected a registered provider event to be handled, got %v", err)
+	}
+	if err := handle("evt_3", "charge.refunded", EventRefund); err != nil {
+		t.Errorf("Expected a registered event type to be handled, got %v", err)
+	}
+	if err := handle("evt_4", "customer.created", "other"); !errors.Is(err, ErrWebhookEventIgnored) {
+		t.Errorf("Expected ErrWebhookEventIgnored, got %v", err)
+	}
+	rec := httptest.NewRecorder()
+	pm.WebhookMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhooks/fake", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "ignored") {
+		t.Errorf("Expected ignored events to be acknowledged, got %d %s", rec.Code, rec.Body)
+	}
+	if want := []string{"evt_1", "evt_2", "evt_3"}; !slices.Equal(got, want) {
+		t.Errorf("Expected %v published, got %v", want, got)
+	}
+
+	pm.RegisterWebhookEvents("fake")
+	if err := handle("evt_5", "customer.created", "other"); err != nil {
+		t.Errorf("Expected every event to be handled again, got %v", err)
+	}
+
+	// Events are registered under the method the gateway was registered
+	// as, whatever its GetMethod reports
+	card := &webhookGateway{fakeGateway: fakeGateway{method: "fake"}}
+	pm.RegisterGateway("card", card)
+	pm.RegisterWebhookEvents("card", string(EventRefund))
+	card.event = &WebhookData{EventID: "evt_6", ProviderEvent: "customer.created", EventType: "other"}
+	if _, err := pm.HandleWebhook("card", httptest.NewRequest(http.MethodPost, "/", nil)); !errors.Is(err, ErrWebhookEventIgnored) {
+		t.Errorf("Expected ErrWebhookEventIgnored, got %v", err)
+	}
+}
+
+// failingSaveStore fails Save while fail is set
+type failingSaveStore struct {
+	*MemoryTransactionStore
+	fail bool
+}
+
+func (s *failingSaveStore) Save(txn *Transaction) error {
+	if s.fail {
+		return errors.New("store unavailable")
+	}
+	return s.MemoryTransactionStore.Save(txn)
+}
+
+func TestHandleWebhookRedeliversFailedEvents(t *testing.T) {
+	pm := NewPaymentManager(0)
+	store := &failingSaveStore{MemoryTransactionStore: NewMemoryTransactionStore()}
+	pm.SetTransactionStore(store)
+	g := &webhookGateway{fakeGateway: fakeGateway{method: "fake"}}
+	pm.RegisterGateway("fake", g)
+	ctx := context.Background()
+
+	usd := money.MustCurrency("USD")
+	resp, err := pm.InitiatePayment(ctx, "fake", &PaymentRequest{OrderID: "O1", Amount: money.New(100, usd), SuccessURL: testSuccessURL})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := pm.VerifyPayment(ctx, "fake", &VerificationRequest{TransactionID: resp.TransactionID, Amount: money.New(100, usd)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	g.event = &WebhookData{EventType: EventRefund, EventID: "evt_1", Status: StatusRefunded, TransactionID: resp.TransactionID, RefundID: "re_1", Amount: money.New(100, usd)}
+	handle := func() error {
+		_, err := pm.HandleWebhook("fake", httptest.NewRequest(http.MethodPost, "/", nil))
+		return err
+	}
+
+	store.fail = true
+	if err := handle(); err == nil {
+		t.Fatal("Expected the store failure to be returned")
+	}
+	store.fail = false
+	if err := handle(); err != nil {
+		t.Fatalf("Expected the redelivery to be processed, got %v", err)
+	}
+	if txn, _ := store.Get(resp.TransactionID); txn.Status != StatusRefunded {
+		t.Errorf("Expected the redelivered refund to be applied, got %s", txn.Status)
+	}
+	if err := handle(); !errors.Is(err, ErrDuplicateWebhook) {
+		t.Errorf("Expected ErrDuplicateWebhook once processed, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package payment
+
+import (
+	"context"
+	"time"
+)
+
+// Gateway operation names passed to hooks
+const (
+	OpInitiatePayment = "initiate_payment"
+	OpVerifyPayment   = "verify_payment"
+	OpRefundPayment   = "refund_payment"
+	OpGetStatus       = "get_status"
+)
+
+// GatewayCall describes a single call made through a wrapped gateway
+type GatewayCall struct {
+	Method    string
+	Operation string
+	Request   interface{}
+	Response  interface{}
+	Err       error
+	StartedAt time.Time
+	Duration  time.Duration
+}
+
+// GatewayHook is invoked around every call made through a wrapped gateway.
+// Before runs prior to delegating; After runs once the inner gateway returns.
+type GatewayHook interface {
+	Before(ctx context.Context, call *GatewayCall)
+	After(ctx context.Context, call *GatewayCall)
+}
+
+// GatewayHookFuncs adapts plain functions to the GatewayHook interface.
+// Nil functions are skipped.
+type GatewayHookFuncs struct {
+	BeforeFunc func(ctx context.Context, call *GatewayCall)
+	AfterFunc  func(ctx context.Context, call *GatewayCall)
+}
+
+func (h GatewayHookFuncs) Before(ctx context.Context, call *GatewayCall) {
+	if h.BeforeFunc != nil {
+		h.BeforeFunc(ctx, call)
+	}
+}
+
+func (h GatewayHookFuncs) After(ctx context.Context, call *GatewayCall) {
+	if h.AfterFunc != nil {
+		h.AfterFunc(ctx, call)
+	}
+}
+
+// wrappedGateway decorates a Gateway with hooks
+type wrappedGateway struct {
+	inner Gateway
+	hooks []GatewayHook
+}
+
+// WrapGateway returns a Gateway that calls hooks around each method and
+// delegates to g. The original gateway is reachable through Unwrap.
+func WrapGateway(g Gateway, hooks ...GatewayHook) Gateway {
+	return &wrappedGateway{inner: g, hooks: hooks}
+}
+
+// Unwrap returns the gateway being decorated
+func (w *wrappedGateway) Unwrap() Gateway { return w.inner }
+
+func (w *wrappedGateway) GetName() string   { return w.inner.GetName() }
+func (w *wrappedGateway) GetMethod() string { return w.inner.GetMethod() }
+
+func (w *wrappedGateway) InitiatePayment(ctx context.Context, req *PaymentRequest) (*PaymentResponse, error) {
+	call := w.before(ctx, OpInitiatePayment, req)
+	resp, err := w.inner.InitiatePayment(ctx, req)
+	w.after(ctx, call, resp, err)
+	return resp, err
+}
+
+func (w *wrappedGateway) VerifyPayment(ctx context.Context, req *VerificationRequest) (*VerificationResponse, error) {
+	call := w.before(ctx, OpVerifyPayment, req)
+	resp, err := w.inner.VerifyPayment(ctx, req)
+	w.after(ctx, call, resp, err)
+	return resp, err
+}
+
+func (w *wrappedGateway) RefundPayment(ctx context.Context, req *RefundRequest) (*RefundResponse, error) {
+	call := w.before(ctx, OpRefundPayment, req)
+	resp, err := w.inner.RefundPayment(ctx, req)
+	w.after(ctx, call, resp, err)
+	return resp, err
+}
+
+func (w *wrappedGateway) GetStatus(ctx context.Context, req *StatusRequest) (*StatusResponse, error) {
+	call := w.before(ctx, OpGetStatus, req)
+	resp, err := w.inner.GetStatus(ctx, req)
+	w.after(ctx, call, resp, err)
+	return resp, err
+}
+
+func (w *wrappedGateway) before(ctx context.Context, op string, req interface{}) *GatewayCall {
+	call := &GatewayCall{
+		Method:    w.inner.GetMethod(),
+		Operation: op,
+		Request:   req,
+		StartedAt: time.Now(),
+	}
+	for _, h := range w.hooks {
+		h.Before(ctx, call)
+	}
+	return call
+}
+
+func (w *wrappedGateway) after(ctx context.Context, call *GatewayCall, resp interface{}, err error) {
+	call.Response = resp
+	call.Err = err
+	call.Duration = time.Since(call.StartedAt)
+	for _, h := range w.hooks {
+		h.After(ctx, call)
+	}
+}
+
+// UnwrapGateway peels off any wrappers and returns the innermost gateway.
+// Use it before type-asserting for optional interfaces such as WebhookHandler.
+func UnwrapGateway(g Gateway) Gateway {
+	for {
+		u, ok := g.(interface{ Unwrap() Gateway })
+		if !ok {
+			return g
+		}
+		g = u.Unwrap()
+	}
+}
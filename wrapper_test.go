@@ -0,0 +1,87 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// testSuccessURL is a valid PaymentRequest.SuccessURL for tests
+const testSuccessURL = "https://shop.example.com/success"
+
+// fakeGateway is a minimal Gateway used by tests
+type fakeGateway struct {
+	method    string
+	initErr   error
+	verifyReq *VerificationRequest
+}
+
+func (f *fakeGateway) InitiatePayment(ctx context.Context, req *PaymentRequest) (*PaymentResponse, error) {
+	if f.initErr != nil {
+		return nil, f.initErr
+	}
+	return &PaymentResponse{Success: true, OrderID: req.OrderID, TransactionID: "txn-" + req.OrderID}, nil
+}
+
+func (f *fakeGateway) VerifyPayment(ctx context.Context, req *VerificationRequest) (*VerificationResponse, error) {
+	f.verifyReq = req
+	return &VerificationResponse{Success: true, Status: StatusCompleted, TransactionID: req.TransactionID, OrderID: req.OrderID, Amount: req.Amount, PaidAmount: req.Amount}, nil
+}
+
+func (f *fakeGateway) RefundPayment(ctx context.Context, req *RefundRequest) (*RefundResponse, error) {
+	return &RefundResponse{Success: true}, nil
+}
+
+func (f *fakeGateway) GetStatus(ctx context.Context, req *StatusRequest) (*StatusResponse, error) {
+	return &StatusResponse{Status: StatusCompleted, TransactionID: req.TransactionID}, nil
+}
+
+func (f *fakeGateway) GetName() string   { return "Fake" }
+func (f *fakeGateway) GetMethod() string { return f.method }
+
+func TestWrapGateway(t *testing.T) {
+	inner := &fakeGateway{method: "fake", initErr: errors.New("boom")}
+
+	var ops []string
+	var lastErr error
+	hook := GatewayHookFuncs{
+		BeforeFunc: func(ctx context.Context, call *GatewayCall) {
+			ops = append(ops, "before:"+call.Operation)
+		},
+		AfterFunc: func(ctx context.Context, call *GatewayCall) {
+			ops = append(ops, "after:"+call.Operation)
+			lastErr = call.Err
+		},
+	}
+
+	g := WrapGateway(inner, hook)
+	if g.GetMethod() != "fake" {
+		t.Errorf("Expected method fake, got %s", g.GetMethod())
+	}
+
+	if _, err := g.InitiatePayment(context.Background(), &PaymentRequest{OrderID: "o1"}); err == nil {
+		t.Error("Expected error from inner gateway")
+	}
+	if lastErr == nil {
+		t.Error("Hook should observe the inner error")
+	}
+
+	if _, err := g.GetStatus(context.Background(), &StatusRequest{TransactionID: "t1"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"before:initiate_payment", "after:initiate_payment", "before:get_status", "after:get_status"}
+	if len(ops) != len(expected) {
+		t.Fatalf("Expected %d hook calls, got %d", len(expected), len(ops))
+	}
+	for i, want := range expected {
+		if ops[i] != want {
+			t.Errorf("Hook call %d: got %s, want %s", i, ops[i], want)
+		}
+	}
+
+	// Wrapping twice should still unwrap to the original
+	if UnwrapGateway(WrapGateway(g)) != Gateway(inner) {
+		t.Error("UnwrapGateway should return the innermost gateway")
+	}
+}